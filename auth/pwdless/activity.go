@@ -0,0 +1,89 @@
+package pwdless
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// AccountActivity tracks when a token was last issued and last consumed per account in memory, e.g. for analytics
+// and support, set with WithAccountActivity. It holds the most recently active accounts up to its maximum, evicting
+// the least recently active. It is safe for concurrent use and may be shared by multiple LoginTokenAuth instances.
+type AccountActivity[ID comparable] struct {
+	mux      sync.Mutex
+	max      int
+	order    *list.List
+	accounts map[ID]*list.Element
+}
+
+// activity is an entry of AccountActivity, held in order of last activity.
+type activity[ID comparable] struct {
+	id       ID
+	issued   time.Time
+	consumed time.Time
+}
+
+// NewAccountActivity returns an AccountActivity tracking up to maxAccounts accounts, at least one.
+func NewAccountActivity[ID comparable](maxAccounts int) *AccountActivity[ID] {
+	return &AccountActivity[ID]{
+		max:      max(maxAccounts, 1),
+		order:    list.New(),
+		accounts: make(map[ID]*list.Element),
+	}
+}
+
+// LastIssued returns when a token was last issued for account id and whether it is tracked.
+func (t *AccountActivity[ID]) LastIssued(id ID) (time.Time, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	e, ok := t.accounts[id]
+	if !ok || e.Value.(*activity[ID]).issued.IsZero() {
+		return time.Time{}, false
+	}
+	return e.Value.(*activity[ID]).issued, true
+}
+
+// LastConsumed returns when a token of account id was last consumed successfully and whether it is tracked.
+func (t *AccountActivity[ID]) LastConsumed(id ID) (time.Time, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	e, ok := t.accounts[id]
+	if !ok || e.Value.(*activity[ID]).consumed.IsZero() {
+		return time.Time{}, false
+	}
+	return e.Value.(*activity[ID]).consumed, true
+}
+
+// issue records a token issued for account id at at, nil-safe for LoginTokenAuth without tracker.
+func (t *AccountActivity[ID]) issue(id ID, at time.Time) {
+	if t != nil {
+		t.update(id, func(a *activity[ID]) { a.issued = at })
+	}
+}
+
+// consume records a token of account id consumed at at, nil-safe for LoginTokenAuth without tracker.
+func (t *AccountActivity[ID]) consume(id ID, at time.Time) {
+	if t != nil {
+		t.update(id, func(a *activity[ID]) { a.consumed = at })
+	}
+}
+
+// update applies f to the entry of account id moved to the front, evicting the least recently active account
+// to add it if full.
+func (t *AccountActivity[ID]) update(id ID, f func(a *activity[ID])) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if e, ok := t.accounts[id]; ok {
+		t.order.MoveToFront(e)
+		f(e.Value.(*activity[ID]))
+		return
+	}
+	if t.order.Len() >= t.max {
+		oldest := t.order.Back()
+		t.order.Remove(oldest)
+		delete(t.accounts, oldest.Value.(*activity[ID]).id)
+	}
+	a := &activity[ID]{id: id}
+	f(a)
+	t.accounts[id] = t.order.PushFront(a)
+}
@@ -0,0 +1,79 @@
+package pwdless
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAccountActivity(t *testing.T) {
+	clock := newFakeClock()
+	activity := NewAccountActivity[int](2)
+	a, _ := newTestAuth(time.Hour, WithClock(clock.Now), WithAccountActivity(activity))
+
+	if _, ok := activity.LastIssued(1); ok {
+		t.Error("got last issued for untracked account")
+	}
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := activity.LastIssued(1); !ok || !got.Equal(clock.Now()) {
+		t.Errorf("got last issued %v, %v, want: %v, true", got, ok, clock.Now())
+	}
+	if _, ok := activity.LastConsumed(1); ok {
+		t.Error("got last consumed before consumption")
+	}
+
+	clock.Add(time.Minute)
+	if _, err := a.GetAccountID(lt.Token); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := activity.LastConsumed(1); !ok || !got.Equal(clock.Now()) {
+		t.Errorf("got last consumed %v, %v, want: %v, true", got, ok, clock.Now())
+	}
+	issued := clock.Now().Add(-time.Minute)
+	if got, _ := activity.LastIssued(1); !got.Equal(issued) {
+		t.Errorf("got last issued %v after consumption, want: %v", got, issued)
+	}
+	a.GetAccountID(lt.Token)
+	if got, _ := activity.LastConsumed(1); !got.Equal(clock.Now()) {
+		t.Errorf("got last consumed %v after failed consumption, want: %v", got, clock.Now())
+	}
+
+	// the least recently active account is evicted
+	for _, id := range []int{2, 1, 3} {
+		clock.Add(time.Second)
+		if _, err := a.CreateToken(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := activity.LastIssued(2); ok {
+		t.Error("least recently active account not evicted")
+	}
+	for _, id := range []int{1, 3} {
+		if _, ok := activity.LastIssued(id); !ok {
+			t.Errorf("recently active account %d evicted", id)
+		}
+	}
+}
+
+func TestAccountActivity_concurrent(t *testing.T) {
+	activity := NewAccountActivity[int](10)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				activity.issue(j%20, time.Now())
+				activity.consume(i, time.Now())
+				activity.LastIssued(j % 20)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := activity.order.Len(); n != 10 || len(activity.accounts) != 10 {
+		t.Errorf("got %d accounts in order and %d indexed, want: %d", n, len(activity.accounts), 10)
+	}
+}
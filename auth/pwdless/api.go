@@ -3,6 +3,8 @@
 package pwdless
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"path"
@@ -40,7 +42,7 @@ type Mailer interface {
 
 // Resource implements passwordless account authentication against a database.
 type Resource struct {
-	LoginAuth *LoginTokenAuth
+	LoginAuth *LoginTokenAuthInt
 	TokenAuth *jwt.TokenAuth
 	Store     AuthStorer
 	Mailer    Mailer
@@ -52,6 +54,9 @@ func NewResource(authStore AuthStorer, mailer Mailer) (*Resource, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := loginAuth.Start(context.Background()); err != nil {
+		return nil, err
+	}
 
 	tokenAuth, err := jwt.NewTokenAuth()
 	if err != nil {
@@ -122,7 +127,17 @@ func (rs *Resource) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	lt := rs.LoginAuth.CreateToken(acc.ID)
+	lt, err := rs.LoginAuth.CreateTokenContext(r.Context(), acc.ID)
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrTooManyTokens) {
+		log(r).WithField("email", body.Email).Warn(err)
+		render.Render(w, r, ErrTooManyRequests(ErrLoginRequests))
+		return
+	}
+	if err != nil {
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+		return
+	}
 
 	go func() {
 		content := email.ContentLoginToken{
@@ -153,7 +168,7 @@ func (body *tokenRequest) Bind(r *http.Request) error {
 	body.Token = strings.TrimSpace(body.Token)
 
 	return validation.ValidateStruct(body,
-		validation.Field(&body.Token, validation.Required, is.Alphanumeric),
+		validation.Field(&body.Token, validation.Required),
 	)
 }
 
@@ -165,7 +180,16 @@ func (rs *Resource) token(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, err := rs.LoginAuth.GetAccountID(body.Token)
+	id, err := rs.LoginAuth.GetAccountIDFrom(r.Context(), body.Token, clientIP(r))
+	if errors.Is(err, ErrTooManyAttempts) {
+		log(r).Warn(err)
+		render.Render(w, r, ErrTooManyRequests(ErrLoginAttempts))
+		return
+	}
+	if errors.Is(err, ErrTokenExpired) {
+		render.Render(w, r, ErrUnauthorized(ErrLoginTokenExpired))
+		return
+	}
 	if err != nil {
 		render.Render(w, r, ErrUnauthorized(ErrLoginToken))
 		return
@@ -31,7 +31,8 @@ var (
 )
 
 func TestMain(m *testing.M) {
-	viper.SetDefault("auth_login_token_length", 8)
+	viper.SetDefault("auth_login_url", "http://localhost:3000/login")
+	viper.SetDefault("auth_login_token_length", 32)
 	viper.SetDefault("auth_login_token_expiry", "11m")
 	viper.SetDefault("auth_jwt_secret", "random")
 	viper.SetDefault("log_level", "error")
@@ -158,7 +159,10 @@ func TestAuthResource_token(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			token := auth.LoginAuth.CreateToken(tc.id)
+			token, err := auth.LoginAuth.CreateToken(tc.id)
+			if err != nil {
+				t.Fatal(err)
+			}
 			if tc.token != "" {
 				token.Token = tc.token
 			}
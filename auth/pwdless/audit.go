@@ -0,0 +1,112 @@
+package pwdless
+
+import (
+	"sync"
+	"time"
+)
+
+// AuditOutcome is the result of a consume attempt recorded in an AuditEntry.
+type AuditOutcome string
+
+// The outcomes of consume attempts.
+const (
+	AuditSuccess     AuditOutcome = "success"
+	AuditExpired     AuditOutcome = "expired"
+	AuditNotFound    AuditOutcome = "not_found"
+	AuditRateLimited AuditOutcome = "rate_limited"
+	// AuditRejected covers all other failures, like a fingerprint mismatch or store error, see Err.
+	AuditRejected AuditOutcome = "rejected"
+)
+
+// AuditEntry records a consume attempt.
+type AuditEntry[ID comparable] struct {
+	Time time.Time
+	// Token is the redacted hash of the tokenstring, matching the tokens returned by ListForAccount.
+	Token string
+	// AccountID is the account of the token, the zero value if it was not found or expired.
+	AccountID ID
+	Outcome   AuditOutcome
+	// Source is the source invalid tokens are counted against, e.g. the client IP, if any.
+	Source string
+	// Err is the error returned to the caller, nil on success.
+	Err error
+}
+
+// Auditor records every consume attempt, successful or not, by GetAccountID and its variants, ConsumeAndRotate
+// and GetAccountIDByCode, e.g. for compliance. Record is called synchronously before the call returns,
+// so it must be fast and safe for concurrent use.
+type Auditor[ID comparable] interface {
+	Record(entry AuditEntry[ID])
+}
+
+// auditOutcome returns the outcome of a consume attempt failing with err.
+func auditOutcome(err error) AuditOutcome {
+	switch err {
+	case nil:
+		return AuditSuccess
+	case ErrTokenExpired:
+		return AuditExpired
+	case ErrTokenNotFound, ErrTokenPrefix:
+		return AuditNotFound
+	case ErrTooManyAttempts, ErrRateLimited:
+		return AuditRateLimited
+	default:
+		return AuditRejected
+	}
+}
+
+// audit records the consume attempt of the token stored by key for account id failing with err, if an Auditor is set.
+func (a *LoginTokenAuth[ID]) audit(key string, id ID, source string, err error) {
+	if a.auditor == nil || err == ErrClosed {
+		return
+	}
+	a.auditor.Record(AuditEntry[ID]{
+		Time:      a.clock(),
+		Token:     redactToken(key),
+		AccountID: id,
+		Outcome:   auditOutcome(err),
+		Source:    source,
+		Err:       err,
+	})
+}
+
+// MemoryAuditor implements Auditor keeping the most recent entries in memory, e.g. for inspection in tests
+// or an admin interface.
+type MemoryAuditor[ID comparable] struct {
+	mux     sync.Mutex
+	entries []AuditEntry[ID]
+	next    int // index the next entry is written to once entries is full
+	size    int
+}
+
+// NewMemoryAuditor returns a MemoryAuditor keeping the last size entries.
+func NewMemoryAuditor[ID comparable](size int) *MemoryAuditor[ID] {
+	return &MemoryAuditor[ID]{
+		entries: make([]AuditEntry[ID], 0, size),
+		size:    size,
+	}
+}
+
+// Record adds entry, dropping the oldest entry if full.
+func (m *MemoryAuditor[ID]) Record(entry AuditEntry[ID]) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.size <= 0 {
+		return
+	}
+	if len(m.entries) < m.size {
+		m.entries = append(m.entries, entry)
+		return
+	}
+	m.entries[m.next] = entry
+	m.next = (m.next + 1) % m.size
+}
+
+// Entries returns the kept entries, oldest first.
+func (m *MemoryAuditor[ID]) Entries() []AuditEntry[ID] {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	entries := make([]AuditEntry[ID], 0, len(m.entries))
+	entries = append(entries, m.entries[m.next:]...)
+	return append(entries, m.entries[:m.next]...)
+}
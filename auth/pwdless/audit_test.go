@@ -0,0 +1,71 @@
+package pwdless
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_audit(t *testing.T) {
+	clock := newFakeClock()
+	auditor := NewMemoryAuditor[int](10)
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithAuditor[int](auditor), WithBruteForceProtection(1, time.Minute))
+
+	valid, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := a.CreateToken(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	a.GetAccountIDFrom(ctx, valid.Token, "10.0.0.1")
+	clock.Add(2 * time.Minute)
+	a.GetAccountIDFrom(ctx, expired.Token, "10.0.0.2")
+	a.GetAccountIDFrom(ctx, "unknown", "10.0.0.1")
+	a.GetAccountIDFrom(ctx, "unknown", "10.0.0.1")
+
+	want := []struct {
+		id      int
+		source  string
+		outcome AuditOutcome
+	}{
+		{1, "10.0.0.1", AuditSuccess},
+		{0, "10.0.0.2", AuditExpired},
+		{0, "10.0.0.1", AuditNotFound},
+		{0, "10.0.0.1", AuditRateLimited},
+	}
+	entries := auditor.Entries()
+	if len(entries) != len(want) {
+		t.Fatalf("got %d audit entries, want: %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.AccountID != want[i].id || e.Source != want[i].source || e.Outcome != want[i].outcome {
+			t.Errorf("got entry %d %+v, want: %+v", i, e, want[i])
+		}
+		if (e.Err == nil) != (e.Outcome == AuditSuccess) {
+			t.Errorf("got entry %d error %v with outcome %s", i, e.Err, e.Outcome)
+		}
+	}
+	hash := a.hashToken(valid.Token)
+	if entries[0].Token != redactToken(hash) || !entries[0].Time.Equal(clock.Now().Add(-2*time.Minute)) {
+		t.Errorf("got token %q at %s, want redacted hash %q", entries[0].Token, entries[0].Time, redactToken(hash))
+	}
+}
+
+func TestMemoryAuditor(t *testing.T) {
+	m := NewMemoryAuditor[int](3)
+	for id := 1; id <= 5; id++ {
+		m.Record(AuditEntry[int]{AccountID: id})
+	}
+	entries := m.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want: %d", len(entries), 3)
+	}
+	for i, e := range entries {
+		if e.AccountID != i+3 {
+			t.Errorf("got account %d at %d, want: %d", e.AccountID, i, i+3)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Package authtest provides helpers for testing login flows built on pwdless without waiting for real expiry
+// or implementing a fake token store.
+package authtest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dhax/go-base/auth/pwdless"
+)
+
+// Clock is a manually advanced clock to be set by pwdless.WithClock. It is safe for concurrent use.
+type Clock struct {
+	mux sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a Clock set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+// Add advances the clock by d.
+func (c *Clock) Add(d time.Duration) {
+	c.mux.Lock()
+	c.now = c.now.Add(d)
+	c.mux.Unlock()
+}
+
+// Set sets the clock to t.
+func (c *Clock) Set(t time.Time) {
+	c.mux.Lock()
+	c.now = t
+	c.mux.Unlock()
+}
+
+// FakeStore implements pwdless.TokenStore keeping tokens in a pwdless.MemoryStore, programmable to fail all operations
+// with an error or to report all tokens as expired. It implements none of the optional store capabilities.
+type FakeStore[ID comparable] struct {
+	store *pwdless.MemoryStore[ID]
+
+	mux     sync.Mutex
+	err     error
+	expired bool
+}
+
+// NewFakeStore returns an empty FakeStore.
+func NewFakeStore[ID comparable]() *FakeStore[ID] {
+	return &FakeStore[ID]{store: pwdless.NewMemoryStore[ID]()}
+}
+
+// SetErr makes all operations fail with err until reset by SetErr(nil).
+func (s *FakeStore[ID]) SetErr(err error) {
+	s.mux.Lock()
+	s.err = err
+	s.mux.Unlock()
+}
+
+// SetExpired makes Get return all tokens expired until reset by SetExpired(false), so consuming them fails
+// with pwdless.ErrTokenExpired and removes them unless disabled by pwdless.WithDeleteExpiredOnAccess.
+func (s *FakeStore[ID]) SetExpired(expired bool) {
+	s.mux.Lock()
+	s.expired = expired
+	s.mux.Unlock()
+}
+
+// fail returns the error set by SetErr.
+func (s *FakeStore[ID]) fail() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.err
+}
+
+// Save adds or replaces a login token.
+func (s *FakeStore[ID]) Save(ctx context.Context, lt pwdless.LoginToken[ID]) error {
+	if err := s.fail(); err != nil {
+		return err
+	}
+	return s.store.Save(ctx, lt)
+}
+
+// Get returns the login token for tokenstring and whether it exists, with its expiry in the past if set by SetExpired.
+func (s *FakeStore[ID]) Get(ctx context.Context, token string) (pwdless.LoginToken[ID], bool, error) {
+	if err := s.fail(); err != nil {
+		return pwdless.LoginToken[ID]{}, false, err
+	}
+	lt, ok, err := s.store.Get(ctx, token)
+	s.mux.Lock()
+	if ok && s.expired {
+		lt.Expiry = time.Time{}
+	}
+	s.mux.Unlock()
+	return lt, ok, err
+}
+
+// Delete removes the login token for tokenstring.
+func (s *FakeStore[ID]) Delete(ctx context.Context, token string) error {
+	if err := s.fail(); err != nil {
+		return err
+	}
+	return s.store.Delete(ctx, token)
+}
+
+// DeleteByAccount removes all login tokens referencing account ID and returns the number removed.
+func (s *FakeStore[ID]) DeleteByAccount(ctx context.Context, id ID) (int, error) {
+	if err := s.fail(); err != nil {
+		return 0, err
+	}
+	return s.store.DeleteByAccount(ctx, id)
+}
+
+// PurgeExpired removes all login tokens expired at now and returns the removed tokens.
+func (s *FakeStore[ID]) PurgeExpired(ctx context.Context, now time.Time) ([]pwdless.LoginToken[ID], error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return s.store.PurgeExpired(ctx, now)
+}
+
+// Count returns the number of login tokens not expired at now.
+func (s *FakeStore[ID]) Count(ctx context.Context, now time.Time) (int, error) {
+	if err := s.fail(); err != nil {
+		return 0, err
+	}
+	return s.store.Count(ctx, now)
+}
+
+// CountForAccount returns the number of login tokens referencing account ID not expired at now.
+func (s *FakeStore[ID]) CountForAccount(ctx context.Context, id ID, now time.Time) (int, error) {
+	if err := s.fail(); err != nil {
+		return 0, err
+	}
+	return s.store.CountForAccount(ctx, id, now)
+}
+
+// Clear removes all login tokens.
+func (s *FakeStore[ID]) Clear(ctx context.Context) error {
+	if err := s.fail(); err != nil {
+		return err
+	}
+	return s.store.Clear(ctx)
+}
+
+// List returns all login tokens referencing account ID not expired at now.
+func (s *FakeStore[ID]) List(ctx context.Context, id ID, now time.Time) ([]pwdless.LoginToken[ID], error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return s.store.List(ctx, id, now)
+}
+
+// Extend sets the expiry of the login token for tokenstring if it exists and is not expired at now.
+func (s *FakeStore[ID]) Extend(ctx context.Context, token string, now, expiry time.Time) (pwdless.LoginToken[ID], bool, error) {
+	if err := s.fail(); err != nil {
+		return pwdless.LoginToken[ID]{}, false, err
+	}
+	return s.store.Extend(ctx, token, now, expiry)
+}
+
+// Len returns the number of stored login tokens, including expired tokens not purged yet.
+func (s *FakeStore[ID]) Len() int {
+	return s.store.Len()
+}
+
+// Auth is a LoginTokenAuth for accounts identified by int using a FakeStore and a Clock.
+type Auth struct {
+	*pwdless.LoginTokenAuthInt
+	Store *FakeStore[int]
+	Clock *Clock
+}
+
+// NewTestAuth returns an Auth configured with a localhost login url, an expiry of 15 minutes, a FakeStore and
+// a Clock set to the current time, which opts may override. Settings are not read from viper.
+// It panics if opts are invalid.
+func NewTestAuth(opts ...pwdless.Option) *Auth {
+	a := &Auth{
+		Store: NewFakeStore[int](),
+		Clock: NewClock(time.Now()),
+	}
+	auth, err := pwdless.NewLoginTokenAuthWithOptions[int](append([]pwdless.Option{
+		pwdless.WithLoginURL("http://localhost/login"),
+		pwdless.WithExpiry(15 * time.Minute),
+		pwdless.WithStore[int](a.Store),
+		pwdless.WithClock(a.Clock.Now),
+	}, opts...)...)
+	if err != nil {
+		panic(err)
+	}
+	a.LoginTokenAuthInt = auth
+	return a
+}
+
+// Expire advances the clock just past the expiry of lt. Tokens accepted within a clock skew set by
+// pwdless.WithClockSkew need the clock advanced by the skew too.
+func (a *Auth) Expire(lt pwdless.LoginToken[int]) {
+	if d := lt.Expiry.Sub(a.Clock.Now()); d >= 0 {
+		a.Clock.Add(d + time.Nanosecond)
+	}
+}
@@ -0,0 +1,39 @@
+package authtest_test
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dhax/go-base/auth/pwdless"
+	"github.com/dhax/go-base/auth/pwdless/authtest"
+)
+
+func Example() {
+	a := authtest.NewTestAuth()
+
+	lt, _ := a.CreateToken(1)
+	a.Expire(lt)
+	_, err := a.GetAccountID(lt.Token)
+	fmt.Println(errors.Is(err, pwdless.ErrTokenExpired))
+
+	lt, _ = a.CreateToken(1)
+	errDown := errors.New("database down")
+	a.Store.SetErr(errDown)
+	_, err = a.GetAccountID(lt.Token)
+	fmt.Println(errors.Is(err, errDown))
+
+	a.Store.SetErr(nil)
+	a.Store.SetExpired(true)
+	_, err = a.GetAccountID(lt.Token)
+	fmt.Println(errors.Is(err, pwdless.ErrTokenExpired))
+
+	a.Store.SetExpired(false)
+	lt, _ = a.CreateToken(1)
+	id, err := a.GetAccountID(lt.Token)
+	fmt.Println(id, err)
+	// Output:
+	// true
+	// true
+	// true
+	// 1 <nil>
+}
@@ -0,0 +1,170 @@
+package pwdless
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// defaultAsyncConcurrency is the number of tokens CreateTokensAsync creates concurrently if not configured.
+const defaultAsyncConcurrency = 8
+
+// TokenResult is the outcome of creating a token for AccountID by CreateTokensAsync.
+type TokenResult[ID comparable] struct {
+	AccountID ID
+	Token     LoginToken[ID]
+	Err       error
+}
+
+// batchSaver is implemented by stores saving multiple tokens in one operation, either saving all or none of them.
+type batchSaver[ID comparable] interface {
+	SaveBatch(ctx context.Context, tokens []LoginToken[ID]) error
+}
+
+// CreateTokens creates tokens for all account ids like CreateToken, returning them in the same order, e.g. for bulk invites.
+// Tokens are saved in one operation if the store implements SaveBatch, otherwise one by one, removing the tokens
+// already saved if saving fails. Limits per account are checked against the tokens existing before the batch.
+// On error no token of the batch remains, tokens evicted for the batch are saved again and rate limit events
+// are refunded, by a RateLimitStore only if it implements Decr.
+func (a *LoginTokenAuth[ID]) CreateTokens(ids []ID) (_ []LoginToken[ID], err error) {
+	if a.closed.Load() {
+		return nil, ErrClosed
+	}
+	ctx, span := a.startSpan(context.Background(), "pwdless.CreateTokens")
+	defer func() { endSpan(span, err) }()
+
+	now := a.clock()
+	u := &batchUndo[ID]{now: now}
+	defer func() {
+		if err != nil {
+			// roll back regardless of ctx, as it might be the cause of the failure
+			u.rollback(context.Background(), a)
+		}
+	}()
+	tokens := make([]LoginToken[ID], len(ids))
+	stored := make([]LoginToken[ID], len(ids))
+	for i, id := range ids {
+		tokens[i], stored[i], err = a.prepare(ctx, LoginToken[ID]{AccountID: id}, a.loginTokenExpiry, now, a.newToken, u)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := a.saveBatch(ctx, stored); err != nil {
+		return nil, err
+	}
+	for i, lt := range stored {
+		a.created(ctx, lt)
+		tokens[i], _ = a.relayed(tokens[i], nil)
+	}
+	return tokens, nil
+}
+
+// batchUndo records the side effects of preparing the tokens of a batch, to be rolled back if the batch fails.
+// Its methods do nothing on a nil batchUndo, as used for single tokens.
+type batchUndo[ID comparable] struct {
+	now     time.Time
+	limited []ID
+	shared  []ID
+	evicted []LoginToken[ID]
+}
+
+// limit records a rate limit event of account id, counted by the shared RateLimitStore if shared.
+func (u *batchUndo[ID]) limit(id ID, shared bool) {
+	switch {
+	case u == nil:
+	case shared:
+		u.shared = append(u.shared, id)
+	default:
+		u.limited = append(u.limited, id)
+	}
+}
+
+// evict records the stored token lt evicted to make room for the batch.
+func (u *batchUndo[ID]) evict(lt LoginToken[ID]) {
+	if u != nil {
+		u.evicted = append(u.evicted, lt)
+	}
+}
+
+// rollback refunds the recorded rate limit events and saves the evicted tokens again.
+func (u *batchUndo[ID]) rollback(ctx context.Context, a *LoginTokenAuth[ID]) {
+	for _, id := range u.limited {
+		a.limiter.refund(id, u.now)
+	}
+	for _, id := range u.shared {
+		if err := a.shared.refund(ctx, id); err != nil {
+			a.logger.WarnContext(ctx, "refunding login token rate limit failed", slog.String("reason", err.Error()))
+		}
+	}
+	for _, lt := range u.evicted {
+		if err := a.store.Save(ctx, lt); err != nil {
+			a.logger.WarnContext(ctx, "restoring evicted login token failed", slog.String("reason", err.Error()))
+			continue
+		}
+		a.stats.active.Add(1)
+	}
+}
+
+// saveBatch saves all tokens or none of them.
+func (a *LoginTokenAuth[ID]) saveBatch(ctx context.Context, tokens []LoginToken[ID]) error {
+	tokens = append([]LoginToken[ID](nil), tokens...)
+	for i := range tokens {
+		var err error
+		if tokens[i], err = a.sealData(tokens[i]); err != nil {
+			return err
+		}
+	}
+	if b, ok := a.store.(batchSaver[ID]); ok {
+		return b.SaveBatch(ctx, tokens)
+	}
+	for i, lt := range tokens {
+		if err := a.store.Save(ctx, lt); err != nil {
+			// roll back regardless of ctx, as it might be the cause of the failure
+			for _, saved := range tokens[:i] {
+				a.store.Delete(context.Background(), saved.Token)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateTokensAsync creates tokens for all account ids received from ids like CreateToken, streaming
+// their results in completion order, e.g. for large invite jobs. Tokens are created concurrently, bounded by
+// WithAsyncConcurrency. The results channel is closed after ids was closed and all results were sent or
+// once ctx is done, so callers have to drain it until closed or cancel ctx.
+func (a *LoginTokenAuth[ID]) CreateTokensAsync(ctx context.Context, ids <-chan ID) <-chan TokenResult[ID] {
+	n := a.asyncConcurrency
+	results := make(chan TokenResult[ID])
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				var id ID
+				var ok bool
+				select {
+				case id, ok = <-ids:
+					if !ok {
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+				lt, err := a.CreateTokenContext(ctx, id)
+				select {
+				case results <- TokenResult[ID]{AccountID: id, Token: lt, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
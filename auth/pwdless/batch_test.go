@@ -0,0 +1,143 @@
+package pwdless
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// flakyStore fails the failAt-th Save and does not implement SaveBatch.
+type flakyStore struct {
+	TokenStore[int]
+	saves, failAt int
+}
+
+func (s *flakyStore) Save(ctx context.Context, lt LoginToken[int]) error {
+	if s.saves++; s.saves == s.failAt {
+		return errStore
+	}
+	return s.TokenStore.Save(ctx, lt)
+}
+
+func TestLoginTokenAuth_CreateTokens(t *testing.T) {
+	a, store := newTestAuth(time.Minute, WithMetrics(prometheus.NewRegistry()))
+	m := a.metrics
+
+	ids := []int{3, 1, 2}
+	tokens, err := a.CreateTokens(ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != len(ids) || len(store.token) != len(ids) {
+		t.Fatalf("got %d tokens, %d stored, want: %d", len(tokens), len(store.token), len(ids))
+	}
+	for i, lt := range tokens {
+		if id, err := a.GetAccountID(lt.Token); err != nil || id != ids[i] {
+			t.Errorf("got %d, %v for token %d, want: %d", id, err, i, ids[i])
+		}
+	}
+	if got := m.Snapshot().Created; got != 3 {
+		t.Errorf("got %d created, want: %d", got, 3)
+	}
+}
+
+func TestLoginTokenAuth_CreateTokensRollback(t *testing.T) {
+	store := &flakyStore{TokenStore: NewMemoryStore[int](), failAt: 3}
+	a, _ := newTestAuth(time.Minute, WithStore[int](store))
+
+	if _, err := a.CreateTokens([]int{1, 2, 3, 4}); err != errStore {
+		t.Fatalf("got %v, want: %v", err, errStore)
+	}
+	if n, _ := a.Count(); n != 0 {
+		t.Errorf("got %d tokens after failed batch, want: %d", n, 0)
+	}
+
+	a, mem := newTestAuth(time.Minute, WithRateLimit(1, time.Minute))
+	if _, err := a.CreateTokens([]int{1, 2, 1}); err != ErrRateLimited {
+		t.Fatalf("got %v, want: %v", err, ErrRateLimited)
+	}
+	if n := len(mem.token); n != 0 {
+		t.Errorf("got %d tokens after rate limited batch, want: %d", n, 0)
+	}
+	if _, err := a.CreateTokens([]int{1, 2}); err != nil {
+		t.Errorf("got %v retrying rate limited batch, want: nil", err)
+	}
+}
+
+func TestLoginTokenAuth_CreateTokensRetry(t *testing.T) {
+	clock := newFakeClock()
+	store := &flakyStore{TokenStore: NewMemoryStore[int](), failAt: 3}
+	a, _ := newTestAuth(time.Minute, WithStore[int](store), WithClock(clock.Now), WithRateLimit(2, time.Minute),
+		WithDistributedRateLimit(newFakeRateLimitStore(clock.Now)), WithMaxPerAccount(1, true))
+	old, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.CreateTokens([]int{1, 2}); err != errStore {
+		t.Fatalf("got %v, want: %v", err, errStore)
+	}
+	if id, err := a.Peek(old.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v for token evicted by failed batch, want: 1, nil", id, err)
+	}
+	if _, err := a.CreateTokens([]int{1, 2, 2, 2}); err != ErrRateLimited {
+		t.Fatalf("got %v, want: %v", err, ErrRateLimited)
+	}
+
+	tokens, err := a.CreateTokens([]int{1, 2, 2})
+	if err != nil {
+		t.Fatalf("got %v retrying failed batches, want: nil", err)
+	}
+	for i, lt := range tokens {
+		if id, err := a.Peek(lt.Token); err != nil || id != []int{1, 2, 2}[i] {
+			t.Errorf("got %d, %v for token %d of retried batch", id, err, i)
+		}
+	}
+	if _, err := a.Peek(old.Token); err != ErrTokenNotFound {
+		t.Errorf("got %v for token evicted by retried batch, want: %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestLoginTokenAuth_CreateTokensAsync(t *testing.T) {
+	a, store := newTestAuth(time.Minute, WithAsyncConcurrency(3))
+
+	ids := make(chan int)
+	go func() {
+		defer close(ids)
+		for id := 1; id <= 20; id++ {
+			ids <- id
+		}
+	}()
+
+	seen := make(map[int]bool)
+	for res := range a.CreateTokensAsync(context.Background(), ids) {
+		if res.Err != nil {
+			t.Fatalf("got error %v for account %d", res.Err, res.AccountID)
+		}
+		if seen[res.AccountID] {
+			t.Errorf("got account %d twice", res.AccountID)
+		}
+		seen[res.AccountID] = true
+		if id, err := a.Peek(res.Token.Token); err != nil || id != res.AccountID {
+			t.Errorf("got %d, %v for token of account %d", id, err, res.AccountID)
+		}
+	}
+	if len(seen) != 20 || len(store.token) != 20 {
+		t.Errorf("got results for %d accounts and %d stored tokens, want: %d", len(seen), len(store.token), 20)
+	}
+}
+
+func TestLoginTokenAuth_CreateTokensAsyncCancel(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	ids := make(chan int)
+	results := a.CreateTokensAsync(ctx, ids)
+
+	ids <- 1
+	<-results
+	cancel()
+	for range results {
+	}
+}
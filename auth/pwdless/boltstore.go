@@ -0,0 +1,293 @@
+package pwdless
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// BoltBucket defines the bucket operations used by BoltStore. It is satisfied by *bbolt.Bucket of go.etcd.io/bbolt.
+// Values returned by Get are only valid during the transaction.
+type BoltBucket interface {
+	Get(key []byte) []byte
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	ForEach(fn func(k, v []byte) error) error
+}
+
+// BoltDB runs transactions on the bucket used by BoltStore, committing read-write transactions if fn returns nil.
+// It is satisfied by a thin adapter around a bbolt database:
+//
+//	type boltDB struct{ db *bbolt.DB }
+//
+//	func (b boltDB) Update(fn func(pwdless.BoltBucket) error) error {
+//		return b.db.Update(func(tx *bbolt.Tx) error {
+//			bucket, err := tx.CreateBucketIfNotExists([]byte("login_tokens"))
+//			if err != nil {
+//				return err
+//			}
+//			return fn(bucket)
+//		})
+//	}
+//
+//	func (b boltDB) View(fn func(pwdless.BoltBucket) error) error {
+//		return b.db.View(func(tx *bbolt.Tx) error {
+//			if bucket := tx.Bucket([]byte("login_tokens")); bucket != nil {
+//				return fn(bucket)
+//			}
+//			return nil
+//		})
+//	}
+type BoltDB interface {
+	Update(fn func(BoltBucket) error) error
+	View(fn func(BoltBucket) error) error
+}
+
+// BoltStore implements TokenStore using an embedded bbolt database, keeping login tokens across restarts of a
+// single instance without running a database server. Tokens are saved JSON encoded keyed by tokenstring.
+// Operations other than Get and Delete scan the bucket, which is fine for the token counts of a single instance.
+type BoltStore[ID comparable] struct {
+	db BoltDB
+}
+
+// NewBoltStore returns a BoltStore using db. The bolt database is owned by the caller and has to be closed by it.
+func NewBoltStore[ID comparable](db BoltDB) *BoltStore[ID] {
+	return &BoltStore[ID]{db: db}
+}
+
+// Save adds or replaces a login token. It fails if the tokenstring is already stored for another account.
+func (s *BoltStore[ID]) Save(ctx context.Context, lt LoginToken[ID]) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.db.Update(func(b BoltBucket) error {
+		return boltSave(b, lt)
+	})
+}
+
+// SaveBatch adds or replaces all tokens in a single transaction. It saves none if a tokenstring is already stored
+// for another account.
+func (s *BoltStore[ID]) SaveBatch(ctx context.Context, tokens []LoginToken[ID]) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.db.Update(func(b BoltBucket) error {
+		for _, lt := range tokens {
+			if err := boltSave(b, lt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Get returns the login token for tokenstring and whether it exists.
+func (s *BoltStore[ID]) Get(ctx context.Context, token string) (lt LoginToken[ID], ok bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	err = s.db.View(func(b BoltBucket) error {
+		lt, ok, err = boltGet[ID](b, token)
+		return err
+	})
+	return lt, ok, err
+}
+
+// Delete removes the login token for tokenstring.
+func (s *BoltStore[ID]) Delete(ctx context.Context, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.db.Update(func(b BoltBucket) error {
+		return b.Delete([]byte(token))
+	})
+}
+
+// DeleteByAccount removes all login tokens referencing account ID and returns the number removed.
+func (s *BoltStore[ID]) DeleteByAccount(ctx context.Context, id ID) (int, error) {
+	deleted, err := s.deleteWhere(ctx, func(lt LoginToken[ID]) bool { return lt.AccountID == id })
+	return len(deleted), err
+}
+
+// PurgeExpired removes all login tokens expired at now in a single transaction and returns the removed tokens.
+func (s *BoltStore[ID]) PurgeExpired(ctx context.Context, now time.Time) ([]LoginToken[ID], error) {
+	return s.deleteWhere(ctx, func(lt LoginToken[ID]) bool { return !lt.Valid(now) })
+}
+
+// Count returns the number of login tokens not expired at now.
+func (s *BoltStore[ID]) Count(ctx context.Context, now time.Time) (int, error) {
+	tokens, err := s.find(ctx, func(lt LoginToken[ID]) bool { return lt.Valid(now) })
+	return len(tokens), err
+}
+
+// CountForAccount returns the number of login tokens referencing account ID not expired at now.
+func (s *BoltStore[ID]) CountForAccount(ctx context.Context, id ID, now time.Time) (int, error) {
+	tokens, err := s.List(ctx, id, now)
+	return len(tokens), err
+}
+
+// Clear removes all login tokens.
+func (s *BoltStore[ID]) Clear(ctx context.Context) error {
+	_, err := s.deleteWhere(ctx, func(LoginToken[ID]) bool { return true })
+	return err
+}
+
+// List returns all login tokens referencing account ID not expired at now.
+func (s *BoltStore[ID]) List(ctx context.Context, id ID, now time.Time) ([]LoginToken[ID], error) {
+	return s.find(ctx, func(lt LoginToken[ID]) bool { return lt.AccountID == id && lt.Valid(now) })
+}
+
+// Extend sets the expiry of the login token for tokenstring if it exists and is not expired at now.
+func (s *BoltStore[ID]) Extend(ctx context.Context, token string, now, expiry time.Time) (lt LoginToken[ID], ok bool, err error) {
+	ok, err = s.update(ctx, token, now, func(v *LoginToken[ID]) {
+		v.Expiry = expiry
+		lt = *v
+	})
+	return lt, ok, err
+}
+
+// Reassign sets the account of the login token for tokenstring to id with accountHash if it exists and is not
+// expired at now, and reports whether it was updated.
+func (s *BoltStore[ID]) Reassign(ctx context.Context, token string, now time.Time, id ID, accountHash string) (bool, error) {
+	return s.update(ctx, token, now, func(lt *LoginToken[ID]) {
+		lt.AccountID = id
+		lt.AccountHash = accountHash
+	})
+}
+
+// ExtendForAccount adds by to the expiry of all login tokens referencing account ID not expired at now
+// in a single transaction and returns the number extended.
+func (s *BoltStore[ID]) ExtendForAccount(ctx context.Context, id ID, now time.Time, by time.Duration) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	n := 0
+	err := s.db.Update(func(b BoltBucket) error {
+		tokens, err := boltFind(b, func(lt LoginToken[ID]) bool { return lt.AccountID == id && lt.Valid(now) })
+		if err != nil {
+			return err
+		}
+		for _, lt := range tokens {
+			lt.Expiry = lt.Expiry.Add(by)
+			if err := boltPut(b, lt); err != nil {
+				return err
+			}
+		}
+		n = len(tokens)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// update applies fn to the login token for tokenstring if it exists and is not expired at now,
+// and reports whether it was updated.
+func (s *BoltStore[ID]) update(ctx context.Context, token string, now time.Time, fn func(*LoginToken[ID])) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	updated := false
+	err := s.db.Update(func(b BoltBucket) error {
+		lt, ok, err := boltGet[ID](b, token)
+		if err != nil || !ok || !lt.Valid(now) {
+			return err
+		}
+		fn(&lt)
+		updated = true
+		return boltPut(b, lt)
+	})
+	if err != nil {
+		return false, err
+	}
+	return updated, nil
+}
+
+// find returns all login tokens matching match.
+func (s *BoltStore[ID]) find(ctx context.Context, match func(LoginToken[ID]) bool) (tokens []LoginToken[ID], err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	err = s.db.View(func(b BoltBucket) error {
+		tokens, err = boltFind(b, match)
+		return err
+	})
+	return tokens, err
+}
+
+// deleteWhere removes all login tokens matching match in a single transaction and returns the removed tokens.
+func (s *BoltStore[ID]) deleteWhere(ctx context.Context, match func(LoginToken[ID]) bool) ([]LoginToken[ID], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var deleted []LoginToken[ID]
+	err := s.db.Update(func(b BoltBucket) error {
+		tokens, err := boltFind(b, match)
+		if err != nil {
+			return err
+		}
+		// delete after iterating, as bbolt buckets must not be modified during ForEach
+		for _, lt := range tokens {
+			if err := b.Delete([]byte(lt.Token)); err != nil {
+				return err
+			}
+		}
+		deleted = tokens
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// boltSave saves lt unless its tokenstring is stored for another account.
+func boltSave[ID comparable](b BoltBucket, lt LoginToken[ID]) error {
+	old, ok, err := boltGet[ID](b, lt.Token)
+	if err != nil {
+		return err
+	}
+	if ok && old.AccountID != lt.AccountID {
+		return errTokenCollision
+	}
+	return boltPut(b, lt)
+}
+
+// boltPut saves lt encoded.
+func boltPut[ID comparable](b BoltBucket, lt LoginToken[ID]) error {
+	v, err := json.Marshal(storedToken[ID](lt))
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(lt.Token), v)
+}
+
+// boltGet returns the login token for tokenstring decoded and whether it exists.
+func boltGet[ID comparable](b BoltBucket, token string) (LoginToken[ID], bool, error) {
+	v := b.Get([]byte(token))
+	if v == nil {
+		return LoginToken[ID]{}, false, nil
+	}
+	var lt LoginToken[ID]
+	if err := json.Unmarshal(v, &lt); err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	return lt, true, nil
+}
+
+// boltFind returns all login tokens in b matching match.
+func boltFind[ID comparable](b BoltBucket, match func(LoginToken[ID]) bool) ([]LoginToken[ID], error) {
+	var tokens []LoginToken[ID]
+	err := b.ForEach(func(_, v []byte) error {
+		var lt LoginToken[ID]
+		if err := json.Unmarshal(v, &lt); err != nil {
+			return err
+		}
+		if match(lt) {
+			tokens = append(tokens, lt)
+		}
+		return nil
+	})
+	return tokens, err
+}
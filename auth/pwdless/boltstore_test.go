@@ -0,0 +1,178 @@
+package pwdless
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBolt implements BoltDB persisting the bucket to a JSON file on every committed transaction.
+type fakeBolt struct {
+	mux    sync.Mutex
+	path   string
+	bucket fakeBucket
+}
+
+// openFakeBolt opens the database at path, creating it if it does not exist.
+func openFakeBolt(t *testing.T, path string) *fakeBolt {
+	db := &fakeBolt{path: path, bucket: make(fakeBucket)}
+	v, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(v, &db.bucket); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func (db *fakeBolt) Update(fn func(BoltBucket) error) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	tx := make(fakeBucket, len(db.bucket))
+	for k, v := range db.bucket {
+		tx[k] = v
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	v, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(db.path, v, 0600); err != nil {
+		return err
+	}
+	db.bucket = tx
+	return nil
+}
+
+func (db *fakeBolt) View(fn func(BoltBucket) error) error {
+	db.mux.Lock()
+	defer db.mux.Unlock()
+	return fn(db.bucket)
+}
+
+type fakeBucket map[string][]byte
+
+func (b fakeBucket) Get(key []byte) []byte { return b[string(key)] }
+
+func (b fakeBucket) Put(key, value []byte) error {
+	b[string(key)] = value
+	return nil
+}
+
+func (b fakeBucket) Delete(key []byte) error {
+	delete(b, string(key))
+	return nil
+}
+
+func (b fakeBucket) ForEach(fn func(k, v []byte) error) error {
+	for k, v := range b {
+		if err := fn([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestBoltStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.db")
+	clock := newFakeClock()
+	open := func() *LoginTokenAuthInt {
+		a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithStore[int](NewBoltStore[int](openFakeBolt(t, path))))
+		return a
+	}
+
+	a := open()
+	kept, err := a.CreateTokenWithData(1, map[string]string{"k": "v"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumed, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountID(consumed.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateTokenWithExpiry(2, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopen after the short lived token expired
+	clock.Add(2 * time.Second)
+	a = open()
+	if n, err := a.Count(); err != nil || n != 1 {
+		t.Errorf("got %d, %v tokens after reopening, want: %d", n, err, 1)
+	}
+	if _, err := a.GetAccountID(consumed.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got %v for token consumed before reopening, want: %v", err, ErrTokenNotFound)
+	}
+	if n, err := a.purgeExpired(context.Background()); err != nil || n != 1 {
+		t.Errorf("got %d, %v purged, want: %d", n, err, 1)
+	}
+
+	a = open()
+	store := NewBoltStore[int](openFakeBolt(t, path))
+	if tokens, err := store.PurgeExpired(context.Background(), clock.Now()); err != nil || len(tokens) != 0 {
+		t.Errorf("got %d, %v purged after reopening, want purge persisted", len(tokens), err)
+	}
+	id, data, err := a.GetAccountIDWithData(kept.Token)
+	if err != nil || id != 1 || data["k"] != "v" {
+		t.Errorf("got %d, %v, %v consuming token after reopening, want: %d", id, data, err, 1)
+	}
+	if n, err := a.Count(); err != nil || n != 0 {
+		t.Errorf("got %d, %v tokens after consuming all, want: %d", n, err, 0)
+	}
+}
+
+func TestBoltStore_operations(t *testing.T) {
+	ctx := context.Background()
+	s := NewBoltStore[int](openFakeBolt(t, filepath.Join(t.TempDir(), "tokens.db")))
+	now := time.Now()
+
+	if err := s.SaveBatch(ctx, []LoginToken[int]{
+		{Token: "a", AccountID: 1, Expiry: now.Add(time.Minute)},
+		{Token: "b", AccountID: 1, Expiry: now.Add(time.Minute)},
+		{Token: "c", AccountID: 2, Expiry: now.Add(time.Minute)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveBatch(ctx, []LoginToken[int]{
+		{Token: "d", AccountID: 3, Expiry: now.Add(time.Minute)},
+		{Token: "a", AccountID: 3, Expiry: now.Add(time.Minute)},
+	}); err != errTokenCollision {
+		t.Errorf("got %v saving colliding batch, want: %v", err, errTokenCollision)
+	}
+	if _, ok, _ := s.Get(ctx, "d"); ok {
+		t.Error("got token of failed batch saved")
+	}
+
+	if n, err := s.ExtendForAccount(ctx, 1, now, time.Hour); err != nil || n != 2 {
+		t.Errorf("got %d, %v extended, want: %d", n, err, 2)
+	}
+	if got, _, _ := s.Get(ctx, "b"); !got.Expiry.Equal(now.Add(time.Minute + time.Hour)) {
+		t.Errorf("got expiry %v, want extended by an hour", got.Expiry)
+	}
+	if ok, err := s.Reassign(ctx, "c", now, 1, "hash"); !ok || err != nil {
+		t.Errorf("got %v, %v reassigning token", ok, err)
+	}
+	if n, err := s.CountForAccount(ctx, 1, now); err != nil || n != 3 {
+		t.Errorf("got %d, %v tokens of account 1, want: %d", n, err, 3)
+	}
+	if n, err := s.DeleteByAccount(ctx, 1); err != nil || n != 3 {
+		t.Errorf("got %d, %v deleted, want: %d", n, err, 3)
+	}
+	if n, err := s.Count(ctx, now); err != nil || n != 0 {
+		t.Errorf("got %d, %v tokens after deleting, want: %d", n, err, 0)
+	}
+}
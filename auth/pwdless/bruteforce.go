@@ -0,0 +1,92 @@
+package pwdless
+
+import (
+	"sync"
+	"time"
+)
+
+// maxBackoffShift caps the doubling of the lockout window.
+const maxBackoffShift = 16
+
+// attempts is the failure record of a source.
+type attempts struct {
+	failures    int
+	lockedUntil time.Time
+	expires     time.Time
+}
+
+// attemptLimiter locks out sources after threshold failed attempts. Every further failure after a lockout
+// doubles the lockout window, starting at backoff. Records expire once a source stayed quiet for another window.
+type attemptLimiter struct {
+	threshold int
+	backoff   time.Duration
+
+	mux         sync.Mutex
+	sources     map[string]*attempts
+	lastCleanup time.Time
+}
+
+func newAttemptLimiter(threshold int, backoff time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		threshold: threshold,
+		backoff:   backoff,
+		sources:   make(map[string]*attempts),
+	}
+}
+
+// allow reports whether source is not locked out at now.
+// Expired records are removed once per backoff window.
+func (l *attemptLimiter) allow(source string, now time.Time) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if now.Sub(l.lastCleanup) > l.backoff {
+		for k, a := range l.sources {
+			if !now.Before(a.expires) {
+				delete(l.sources, k)
+			}
+		}
+		l.lastCleanup = now
+	}
+
+	a, ok := l.sources[source]
+	if !ok {
+		return true
+	}
+	if !now.Before(a.expires) {
+		delete(l.sources, source)
+		return true
+	}
+	return !now.Before(a.lockedUntil)
+}
+
+// fail records a failed attempt of source at now, locking it out once the threshold is reached.
+func (l *attemptLimiter) fail(source string, now time.Time) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	a, ok := l.sources[source]
+	if !ok || !now.Before(a.expires) {
+		a = &attempts{}
+		l.sources[source] = a
+	}
+	a.failures++
+	if a.failures < l.threshold {
+		a.expires = now.Add(l.backoff)
+		return
+	}
+	shift := a.failures - l.threshold
+	if shift > maxBackoffShift {
+		shift = maxBackoffShift
+	}
+	d := l.backoff << uint(shift)
+	a.lockedUntil = now.Add(d)
+	a.expires = a.lockedUntil.Add(d)
+}
+
+// reset forgets the failed attempts of source.
+func (l *attemptLimiter) reset(source string) {
+	l.mux.Lock()
+	delete(l.sources, source)
+	l.mux.Unlock()
+}
@@ -0,0 +1,93 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_bruteForceProtection(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Hour, WithClock(clock.Now), WithBruteForceProtection(3, time.Minute))
+	const ip = "10.0.0.1"
+	ctx := context.Background()
+
+	fail := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if _, err := a.GetAccountIDFrom(ctx, "invalid", ip); !errors.Is(err, ErrTokenNotFound) {
+				t.Fatalf("got %v, want: %v", err, ErrTokenNotFound)
+			}
+		}
+	}
+	fail(3)
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountIDFrom(ctx, lt.Token, ip); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("got %v after reaching threshold, want: %v", err, ErrTooManyAttempts)
+	}
+	if id, err := a.GetAccountIDFrom(ctx, lt.Token, "10.0.0.2"); err != nil || id != 1 {
+		t.Errorf("got %d, %v for other source, want: %d", id, err, 1)
+	}
+
+	// lockout doubles with every further failure
+	clock.Add(time.Minute)
+	fail(1)
+	clock.Add(time.Minute)
+	if _, err := a.GetAccountIDFrom(ctx, "invalid", ip); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("got %v within doubled backoff, want: %v", err, ErrTooManyAttempts)
+	}
+	clock.Add(time.Minute)
+	fail(1)
+
+	// failures are forgotten after staying quiet for another backoff window
+	clock.Add(8 * time.Minute)
+	fail(2)
+	if _, err := a.GetAccountIDFrom(ctx, "invalid", ip); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got %v after records expired, want: %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestLoginTokenAuth_bruteForceReset(t *testing.T) {
+	a, _ := newTestAuth(time.Hour, WithBruteForceProtection(3, time.Minute))
+	const ip = "10.0.0.1"
+	ctx := context.Background()
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 2; i++ {
+			a.GetAccountIDFrom(ctx, "invalid", ip)
+		}
+		lt, err := a.CreateToken(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.GetAccountIDFrom(ctx, lt.Token, ip); err != nil {
+			t.Fatalf("got %v in round %d, want failures reset on success", err, round)
+		}
+	}
+}
+
+func TestLoginTokenAuth_bruteForceBound(t *testing.T) {
+	a, _ := newTestAuth(time.Hour, WithBruteForceProtection(1, time.Minute))
+	fp := Fingerprint("10.0.0.1", "test")
+	lt, err := a.CreateTokenBound(1, fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountIDBound(lt.Token, Fingerprint("10.0.0.2", "test")); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Fatalf("got %v, want: %v", err, ErrFingerprintMismatch)
+	}
+	if _, err := a.GetAccountIDBound(lt.Token, fp); err != nil {
+		t.Errorf("got %v for other fingerprint, want: nil", err)
+	}
+	if _, err := a.GetAccountIDBound("invalid", fp); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("got %v, want: %v", err, ErrTokenNotFound)
+	}
+	if _, err := a.GetAccountIDBound("invalid", fp); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("got %v, want: %v", err, ErrTooManyAttempts)
+	}
+}
@@ -0,0 +1,148 @@
+package pwdless
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// CachingStore implements TokenStore with a fast cache store in front of a durable backing store.
+// Writes go to both stores, reads are served from the cache and fall back to the backing store,
+// populating the cache. Expired tokens are removed from the cache lazily on read.
+// Counting and listing are answered by the backing store being authoritative.
+type CachingStore[ID comparable] struct {
+	cache   TokenStore[ID]
+	backing TokenStore[ID]
+}
+
+// NewCachingStore returns a CachingStore using cache, e.g. a MemoryStore, in front of backing.
+func NewCachingStore[ID comparable](cache, backing TokenStore[ID]) *CachingStore[ID] {
+	return &CachingStore[ID]{
+		cache:   cache,
+		backing: backing,
+	}
+}
+
+// Save stores the login token in the backing store and the cache.
+func (s *CachingStore[ID]) Save(ctx context.Context, lt LoginToken[ID]) error {
+	if err := s.backing.Save(ctx, lt); err != nil {
+		return err
+	}
+	return s.cache.Save(ctx, lt)
+}
+
+// Get returns the login token for tokenstring from the cache or the backing store and whether it exists.
+func (s *CachingStore[ID]) Get(ctx context.Context, token string) (LoginToken[ID], bool, error) {
+	lt, ok, err := s.cache.Get(ctx, token)
+	if err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	now := time.Now()
+	if ok && lt.Valid(now) {
+		return lt, true, nil
+	}
+	if ok {
+		if err := s.cache.Delete(ctx, token); err != nil {
+			return LoginToken[ID]{}, false, err
+		}
+	}
+
+	lt, ok, err = s.backing.Get(ctx, token)
+	if err != nil || !ok {
+		return LoginToken[ID]{}, false, err
+	}
+	if lt.Valid(now) {
+		if err := s.cache.Save(ctx, lt); err != nil {
+			return LoginToken[ID]{}, false, err
+		}
+	}
+	return lt, true, nil
+}
+
+// Delete removes the login token for tokenstring from both stores.
+func (s *CachingStore[ID]) Delete(ctx context.Context, token string) error {
+	if err := s.backing.Delete(ctx, token); err != nil {
+		return err
+	}
+	return s.cache.Delete(ctx, token)
+}
+
+// DeleteByAccount removes all login tokens referencing account ID from both stores
+// and returns the number removed from the backing store.
+func (s *CachingStore[ID]) DeleteByAccount(ctx context.Context, id ID) (int, error) {
+	n, err := s.backing.DeleteByAccount(ctx, id)
+	if err != nil {
+		return n, err
+	}
+	_, err = s.cache.DeleteByAccount(ctx, id)
+	return n, err
+}
+
+// PurgeExpired removes all login tokens expired at now from both stores and returns the tokens removed from the backing store.
+func (s *CachingStore[ID]) PurgeExpired(ctx context.Context, now time.Time) ([]LoginToken[ID], error) {
+	purged, err := s.backing.PurgeExpired(ctx, now)
+	if err != nil {
+		return purged, err
+	}
+	_, err = s.cache.PurgeExpired(ctx, now)
+	return purged, err
+}
+
+// Count returns the number of login tokens not expired at now from the backing store.
+func (s *CachingStore[ID]) Count(ctx context.Context, now time.Time) (int, error) {
+	return s.backing.Count(ctx, now)
+}
+
+// CountForAccount returns the number of login tokens referencing account ID not expired at now from the backing store.
+func (s *CachingStore[ID]) CountForAccount(ctx context.Context, id ID, now time.Time) (int, error) {
+	return s.backing.CountForAccount(ctx, id, now)
+}
+
+// Clear removes all login tokens from both stores.
+func (s *CachingStore[ID]) Clear(ctx context.Context) error {
+	if err := s.backing.Clear(ctx); err != nil {
+		return err
+	}
+	return s.cache.Clear(ctx)
+}
+
+// List returns all login tokens referencing account ID not expired at now from the backing store.
+func (s *CachingStore[ID]) List(ctx context.Context, id ID, now time.Time) ([]LoginToken[ID], error) {
+	return s.backing.List(ctx, id, now)
+}
+
+// Extend sets the expiry of the login token for tokenstring in the backing store and updates the cache.
+func (s *CachingStore[ID]) Extend(ctx context.Context, token string, now, expiry time.Time) (LoginToken[ID], bool, error) {
+	lt, ok, err := s.backing.Extend(ctx, token, now, expiry)
+	if err != nil || !ok {
+		return LoginToken[ID]{}, false, err
+	}
+	if err := s.cache.Save(ctx, lt); err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	return lt, true, nil
+}
+
+// Flush flushes the backing store if it buffers writes.
+func (s *CachingStore[ID]) Flush(ctx context.Context) error {
+	if f, ok := s.backing.(flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+// Ping checks the backing store if it implements Pinger.
+func (s *CachingStore[ID]) Ping(ctx context.Context) error {
+	if p, ok := s.backing.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// Close closes the backing store if it implements io.Closer.
+func (s *CachingStore[ID]) Close() error {
+	if c, ok := s.backing.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package pwdless
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCachingStore(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryStore[int]()
+	backing := NewMemoryStore[int]()
+	s := NewCachingStore[int](cache, backing)
+
+	lt := LoginToken[int]{Token: "abc", AccountID: 1, Expiry: time.Now().Add(time.Minute)}
+	if err := s.Save(ctx, lt); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := backing.Get(ctx, "abc"); !ok {
+		t.Error("token not written to backing store")
+	}
+
+	if err := cache.Delete(ctx, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := s.Get(ctx, "abc")
+	if err != nil || !ok || got.AccountID != 1 {
+		t.Fatalf("got %+v, %v, %v for token evicted from cache, want found in backing store", got, ok, err)
+	}
+	if _, ok, _ := cache.Get(ctx, "abc"); !ok {
+		t.Error("cache not populated from backing store")
+	}
+
+	if err := s.Delete(ctx, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.Get(ctx, "abc"); ok {
+		t.Error("token found after delete")
+	}
+}
+
+func TestCachingStore_expired(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryStore[int]()
+	backing := NewMemoryStore[int]()
+	s := NewCachingStore[int](cache, backing)
+
+	expired := LoginToken[int]{Token: "exp", AccountID: 1, Expiry: time.Now().Add(-time.Second)}
+	if err := cache.Save(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.Get(ctx, "exp"); ok {
+		t.Error("expired token found not existing in backing store")
+	}
+	if _, ok, _ := cache.Get(ctx, "exp"); ok {
+		t.Error("expired token not evicted from cache on read")
+	}
+}
+
+func TestCachingStore_auth(t *testing.T) {
+	backing := NewMemoryStore[int]()
+	a, err := NewLoginTokenAuthWithOptions[int](
+		WithLoginURL("http://localhost/login"),
+		WithStore[int](NewCachingStore[int](NewMemoryStore[int](), backing)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v, want: %d", id, err, 1)
+	}
+	if len(backing.token) != 0 {
+		t.Error("consumed token not removed from backing store")
+	}
+}
@@ -0,0 +1,108 @@
+package pwdless
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// codeLength is the number of characters of short codes.
+	codeLength = 6
+	// codeAlphabet is the Crockford base32 alphabet of digits and upper case letters without I, L, O and U,
+	// so codes can't be misread, see normalizeCode.
+	codeAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	// maxCodeAttempts is the number of invalid codes for an account before code validation is locked
+	// for the login token expiry, doubling with every further invalid code.
+	maxCodeAttempts = 5
+	// codeKeyPrefix separates code store keys from hashed tokenstrings, so codes can't be consumed as tokens.
+	codeKeyPrefix = "code:"
+)
+
+// CreateCode creates a short alphanumeric code for account ID to be typed in by the user instead of clicking a login link.
+// Codes are not globally unique, they are validated for their account with GetAccountIDByCode
+// and share expiry, rate limiting and per account limits with tokens.
+func (a *LoginTokenAuth[ID]) CreateCode(id ID) (string, error) {
+	lt, err := a.issue(context.Background(), LoginToken[ID]{AccountID: id}, a.loginTokenExpiry, a.newCode)
+	return lt.Token, err
+}
+
+// newCode returns a random code and the key it is stored by for account ID.
+func (a *LoginTokenAuth[ID]) newCode(id ID) (string, string, error) {
+	code, err := randStringBytes(a.randSource, codeLength, codeAlphabet)
+	if err != nil {
+		return "", "", err
+	}
+	return code, a.codeKey(id, code), nil
+}
+
+// normalizeCode returns code as typed in by the user in the form generated by newCode: upper case, without spaces
+// and dashes and with the letters I and L read as 1 and O as 0. Codes are stored and looked up normalized.
+func normalizeCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch r = unicode.ToUpper(r); r {
+		case ' ', '-':
+			return -1
+		case 'I', 'L':
+			return '1'
+		case 'O':
+			return '0'
+		}
+		return r
+	}, code)
+}
+
+func (a *LoginTokenAuth[ID]) codeKey(id ID, code string) string {
+	return codeKeyPrefix + a.hashToken(fmt.Sprintf("%v\x00%s", id, code))
+}
+
+// GetAccountIDByCode consumes the code created by CreateCode for account ID, accepting it in any case and
+// with spaces or dashes added, returning ErrTokenNotFound if it does not exist and ErrTokenExpired if it is past its expiry.
+// After 5 invalid codes validation for the account is locked with ErrTooManyAttempts for the login token expiry,
+// doubling with every further invalid code. A valid code resets the count.
+// Codes are removed once consumed regardless of WithConsumeDeletes and WithConsumeGrace.
+func (a *LoginTokenAuth[ID]) GetAccountIDByCode(id ID, code string) (err error) {
+	if a.closed.Load() {
+		return ErrClosed
+	}
+	code = normalizeCode(code)
+	defer a.pad(context.Background(), time.Now())
+	ctx, span := a.startSpan(context.Background(), "pwdless.GetAccountIDByCode")
+	defer func() {
+		span.SetAttributes(attribute.Bool("pwdless.hit", err == nil))
+		endSpan(span, err)
+		if err != nil {
+			a.stats.failed.Add(1)
+			a.logFailure(ctx, a.codeKey(id, code), err, slog.Any("account_id", id))
+		}
+		a.audit(a.codeKey(id, code), id, "", err)
+	}()
+
+	source := fmt.Sprint(id)
+	if !a.codes.allow(source, a.clock()) {
+		return ErrTooManyAttempts
+	}
+	lt, err := a.get(ctx, a.codeKey(id, code))
+	if err == nil {
+		err = a.verifyAccount(lt, code)
+	}
+	switch err {
+	case nil:
+	case ErrTokenNotFound:
+		a.metrics.incConsumeNotFound()
+		a.codes.fail(source, a.clock())
+		return err
+	case ErrTokenExpired:
+		a.metrics.incConsumeExpired()
+		return err
+	default:
+		return err
+	}
+	a.codes.reset(source)
+	return a.burn(ctx, lt)
+}
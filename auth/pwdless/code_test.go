@@ -0,0 +1,121 @@
+package pwdless
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_CreateCode(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+
+	code, err := a.CreateCode(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != codeLength || strings.Trim(code, codeAlphabet) != "" {
+		t.Errorf("got code %q, want %d characters of %q", code, codeLength, codeAlphabet)
+	}
+	if err := a.GetAccountIDByCode(2, code); err != ErrTokenNotFound {
+		t.Errorf("got %v for code of other account, want: %v", err, ErrTokenNotFound)
+	}
+	if _, err := a.GetAccountID(code); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got %v consuming code as token, want: %v", err, ErrTokenNotFound)
+	}
+	if err := a.GetAccountIDByCode(1, code); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.GetAccountIDByCode(1, code); err != ErrTokenNotFound {
+		t.Errorf("got %v for used code, want: %v", err, ErrTokenNotFound)
+	}
+
+	code, err = a.CreateCode(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(2 * time.Minute)
+	if err := a.GetAccountIDByCode(1, code); err != ErrTokenExpired {
+		t.Errorf("got %v for expired code, want: %v", err, ErrTokenExpired)
+	}
+}
+
+func TestLoginTokenAuth_GetAccountIDByCodeSingleUse(t *testing.T) {
+	a, store := newTestAuth(time.Minute, WithConsumeDeletes(false), WithConsumeGrace(time.Minute))
+	code, err := a.CreateCode(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.GetAccountIDByCode(1, code); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.GetAccountIDByCode(1, code); err != ErrTokenNotFound {
+		t.Errorf("got %v for used code, want: %v", err, ErrTokenNotFound)
+	}
+	if n := len(store.token); n != 0 {
+		t.Errorf("got %d tokens stored after using code, want: 0", n)
+	}
+}
+
+func TestLoginTokenAuth_GetAccountIDByCodeAttempts(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+	code, err := a.CreateCode(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := 0
+	for i := 0; invalid < maxCodeAttempts; i++ {
+		if guess := fmt.Sprintf("%06d", i); guess != code {
+			if err := a.GetAccountIDByCode(1, guess); err != ErrTokenNotFound {
+				t.Fatalf("got %v for invalid code, want: %v", err, ErrTokenNotFound)
+			}
+			invalid++
+		}
+	}
+	if err := a.GetAccountIDByCode(1, code); err != ErrTooManyAttempts {
+		t.Errorf("got %v after %d invalid codes, want: %v", err, maxCodeAttempts, ErrTooManyAttempts)
+	}
+	other, err := a.CreateCode(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.GetAccountIDByCode(2, other); err != nil {
+		t.Errorf("got %v for other account, want: nil", err)
+	}
+
+	clock.Add(time.Minute)
+	code, err = a.CreateCode(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.GetAccountIDByCode(1, code); err != nil {
+		t.Errorf("got %v after lockout, want: nil", err)
+	}
+}
+
+func TestLoginTokenAuth_GetAccountIDByCodeNormalized(t *testing.T) {
+	for _, typed := range []string{"abcd-ef", "ABCDEF", "ABCD EF"} {
+		a, _ := newTestAuth(time.Minute, WithRandSource(bytes.NewReader([]byte{10, 11, 12, 13, 14, 15})))
+		code, err := a.CreateCode(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != "ABCDEF" {
+			t.Fatalf("got code %q, want: %q", code, "ABCDEF")
+		}
+		if err := a.GetAccountIDByCode(1, typed); err != nil {
+			t.Errorf("got %v for code typed as %q, want: <nil>", err, typed)
+		}
+	}
+
+	for typed, want := range map[string]string{"o1l-i0": "01110", " 4 5 ": "45", "wxyz": "WXYZ"} {
+		if got := normalizeCode(typed); got != want {
+			t.Errorf("got %q normalizing %q, want: %q", got, typed, want)
+		}
+	}
+}
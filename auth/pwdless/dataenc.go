@@ -0,0 +1,68 @@
+package pwdless
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+)
+
+// encryptedDataKey is the data key the encrypted data of a stored token is kept under.
+const encryptedDataKey = "_encrypted"
+
+// newDataCipher returns AES-256-GCM keyed by the SHA-256 of key.
+func newDataCipher(key string) (cipher.AEAD, error) {
+	k := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(k[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealData returns the stored token lt with its data encrypted if a data key is configured.
+// The ciphertext is bound to the store key, so it can not be moved to another token.
+func (a *LoginTokenAuth[ID]) sealData(lt LoginToken[ID]) (LoginToken[ID], error) {
+	if a.dataCipher == nil || lt.Data == nil {
+		return lt, nil
+	}
+	plain, err := json.Marshal(lt.Data)
+	if err != nil {
+		return LoginToken[ID]{}, err
+	}
+	nonce := make([]byte, a.dataCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return LoginToken[ID]{}, err
+	}
+	sealed := a.dataCipher.Seal(nonce, nonce, plain, []byte(lt.Token))
+	lt.Data = map[string]string{encryptedDataKey: base64.RawStdEncoding.EncodeToString(sealed)}
+	return lt, nil
+}
+
+// openData returns the stored token lt with its data decrypted, or ErrDataDecryption if it can not be decrypted
+// by the configured data key. Data stored in plaintext, e.g. before a data key was configured, is returned as is.
+func (a *LoginTokenAuth[ID]) openData(lt LoginToken[ID]) (LoginToken[ID], error) {
+	v, ok := lt.Data[encryptedDataKey]
+	if !ok || len(lt.Data) != 1 {
+		return lt, nil
+	}
+	if a.dataCipher == nil {
+		return LoginToken[ID]{}, ErrDataDecryption
+	}
+	n := a.dataCipher.NonceSize()
+	sealed, err := base64.RawStdEncoding.DecodeString(v)
+	if err != nil || len(sealed) < n {
+		return LoginToken[ID]{}, ErrDataDecryption
+	}
+	plain, err := a.dataCipher.Open(nil, sealed[:n], sealed[n:], []byte(lt.Token))
+	if err != nil {
+		return LoginToken[ID]{}, ErrDataDecryption
+	}
+	lt.Data = nil
+	if err := json.Unmarshal(plain, &lt.Data); err != nil {
+		return LoginToken[ID]{}, ErrDataDecryption
+	}
+	return lt, nil
+}
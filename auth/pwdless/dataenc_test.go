@@ -0,0 +1,67 @@
+package pwdless
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_dataEncryption(t *testing.T) {
+	a, store := newTestAuth(time.Minute, WithDataKey("data key"))
+	data := map[string]string{"tenant": "acme", "redirect": "/settings"}
+
+	lt, err := a.CreateTokenWithData(1, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := store.token[a.hashToken(lt.Token)]
+	if len(stored.Data) != 1 || stored.Data[encryptedDataKey] == "" || strings.Contains(stored.Data[encryptedDataKey], "acme") {
+		t.Fatalf("got stored data %v, want encrypted", stored.Data)
+	}
+
+	tokens, err := a.ListForAccount(1, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Data["tenant"] != "acme" {
+		t.Errorf("got listed tokens %+v, want decrypted data", tokens)
+	}
+
+	id, got, err := a.GetAccountIDWithData(lt.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || len(got) != len(data) || got["tenant"] != "acme" || got["redirect"] != "/settings" {
+		t.Errorf("got %d, %v, want: %d, %v", id, got, 1, data)
+	}
+
+	plain, store := newTestAuth(time.Minute)
+	lt, err = plain.CreateTokenWithData(1, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := store.token[plain.hashToken(lt.Token)].Data; got["tenant"] != "acme" {
+		t.Errorf("got stored data %v without data key, want plaintext", got)
+	}
+}
+
+func TestLoginTokenAuth_dataEncryptionWrongKey(t *testing.T) {
+	store := NewMemoryStore[int]()
+	a, _ := newTestAuth(time.Minute, WithStore[int](store), WithDataKey("old key"))
+	b, _ := newTestAuth(time.Minute, WithStore[int](store), WithDataKey("new key"))
+
+	lt, err := a.CreateTokenWithData(1, map[string]string{"tenant": "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.ListForAccount(1, ListOptions{}); !errors.Is(err, ErrDataDecryption) {
+		t.Errorf("got %v listing with wrong key, want: %v", err, ErrDataDecryption)
+	}
+	if _, _, err := b.GetAccountIDWithData(lt.Token); !errors.Is(err, ErrDataDecryption) {
+		t.Errorf("got %v with wrong key, want: %v", err, ErrDataDecryption)
+	}
+	if _, _, err := a.GetAccountIDWithData(lt.Token); err != nil {
+		t.Errorf("got %v with original key, want token kept after failed decryption", err)
+	}
+}
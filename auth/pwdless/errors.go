@@ -9,10 +9,14 @@ import (
 
 // The list of error types presented to the end user as error message.
 var (
-	ErrInvalidLogin  = errors.New("invalid email address")
-	ErrUnknownLogin  = errors.New("email not registered")
-	ErrLoginDisabled = errors.New("login for account disabled")
-	ErrLoginToken    = errors.New("invalid or expired login token")
+	ErrInvalidLogin      = errors.New("invalid email address")
+	ErrUnknownLogin      = errors.New("email not registered")
+	ErrLoginDisabled     = errors.New("login for account disabled")
+	ErrLoginToken        = errors.New("invalid or expired login token")
+	ErrLoginTokenExpired = errors.New("login token expired, please request a new one")
+	ErrLoginTokenMissing = errors.New("login token missing")
+	ErrLoginRequests     = errors.New("too many login requests")
+	ErrLoginAttempts     = errors.New("too many invalid login tokens, please try again later")
 )
 
 // ErrResponse renderer type for handling all sorts of errors.
@@ -31,6 +35,16 @@ func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// ErrBadRequest renders status 400 Bad Request with custom error message.
+func ErrBadRequest(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusBadRequest,
+		StatusText:     http.StatusText(http.StatusBadRequest),
+		ErrorText:      err.Error(),
+	}
+}
+
 // ErrUnauthorized renders status 401 Unauthorized with custom error message.
 func ErrUnauthorized(err error) render.Renderer {
 	return &ErrResponse{
@@ -41,6 +55,16 @@ func ErrUnauthorized(err error) render.Renderer {
 	}
 }
 
+// ErrTooManyRequests renders status 429 Too Many Requests with custom error message.
+func ErrTooManyRequests(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusTooManyRequests,
+		StatusText:     http.StatusText(http.StatusTooManyRequests),
+		ErrorText:      err.Error(),
+	}
+}
+
 // The list of default error types without specific error message.
 var (
 	ErrInternalServerError = &ErrResponse{
@@ -0,0 +1,45 @@
+package pwdless
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// accountExtender is implemented by stores extending all tokens of an account in one operation.
+type accountExtender[ID comparable] interface {
+	ExtendForAccount(ctx context.Context, id ID, now time.Time, by time.Duration) (int, error)
+}
+
+// ExtendAllForAccount adds by to the expiry of all unexpired login tokens referencing account ID and returns
+// the number extended, e.g. to keep links sent before a maintenance window valid. Stores implementing
+// ExtendForAccount(ctx, id, now, by) update all tokens in one operation, otherwise every token is extended on its own.
+func (a *LoginTokenAuth[ID]) ExtendAllForAccount(id ID, by time.Duration) (int, error) {
+	if a.closed.Load() {
+		return 0, ErrClosed
+	}
+	if by <= 0 {
+		return 0, fmt.Errorf("login token extension %s must be positive", by)
+	}
+	ctx := context.Background()
+	now := a.clock()
+	if e, ok := a.store.(accountExtender[ID]); ok {
+		return e.ExtendForAccount(ctx, id, now, by)
+	}
+
+	tokens, err := a.store.List(ctx, id, now)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, lt := range tokens {
+		_, ok, err := a.store.Extend(ctx, lt.Token, now, lt.Expiry.Add(by))
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			n++
+		}
+	}
+	return n, nil
+}
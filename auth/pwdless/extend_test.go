@@ -0,0 +1,59 @@
+package pwdless
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_ExtendAllForAccount(t *testing.T) {
+	for name, wrap := range map[string]func(*MemoryStore[int]) TokenStore[int]{
+		"batch":     func(s *MemoryStore[int]) TokenStore[int] { return s },
+		"per token": func(s *MemoryStore[int]) TokenStore[int] { return struct{ TokenStore[int] }{s} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			clock := newFakeClock()
+			a, err := NewLoginTokenAuthWithOptions[int](
+				WithLoginURL("http://localhost/login"),
+				WithExpiry(time.Minute),
+				WithClock(clock.Now),
+				WithStore[int](wrap(NewMemoryStore[int]())),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var tokens []LoginToken[int]
+			for i := 0; i < 2; i++ {
+				lt, err := a.CreateToken(1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tokens = append(tokens, lt)
+			}
+			other, err := a.CreateToken(2)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if n, err := a.ExtendAllForAccount(1, time.Hour); err != nil || n != 2 {
+				t.Fatalf("got %d, %v tokens extended, want: %d", n, err, 2)
+			}
+			clock.Add(2 * time.Minute)
+			for _, lt := range tokens {
+				if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+					t.Errorf("got %d, %v for extended token after original expiry", id, err)
+				}
+			}
+			if _, err := a.GetAccountID(other.Token); !errors.Is(err, ErrTokenExpired) {
+				t.Errorf("got error %v for token of other account, want: %v", err, ErrTokenExpired)
+			}
+			if n, err := a.ExtendAllForAccount(2, time.Hour); err != nil || n != 0 {
+				t.Errorf("got %d, %v expired tokens extended, want: %d", n, err, 0)
+			}
+			if _, err := a.ExtendAllForAccount(1, 0); err == nil {
+				t.Error("got no error for zero extension")
+			}
+		})
+	}
+}
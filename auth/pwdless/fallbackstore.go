@@ -0,0 +1,318 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultFallbackRetry is the interval a degraded FallbackStore attempts to reconcile with its primary store at.
+const defaultFallbackRetry = 5 * time.Second
+
+// FallbackStore implements TokenStore degrading to a local MemoryStore while a durable primary store fails,
+// so logins keep working during an outage of e.g. the database. On the first failed operation of the primary
+// it is logged and counted by the metrics, and all operations are served from memory until the primary recovers.
+// While degraded, reconciling with the primary is attempted at most every 5 seconds on the next operation, or
+// explicitly by Reconcile. Reconciling replays deletes and saves all tokens created during the outage to the primary.
+//
+// Tokens held only by the primary are not found while degraded, and tokens created during an outage only validate
+// on the instance that created them until reconciled, weakening the guarantees of a store shared by multiple instances.
+// Flush, Ping and Close are passed through to the primary.
+type FallbackStore[ID comparable] struct {
+	primary TokenStore[ID]
+	local   *MemoryStore[ID]
+	metrics *Metrics
+	logger  *slog.Logger
+	clock   func() time.Time
+	retry   time.Duration
+
+	// mux is read locked by operations and write locked by Reconcile.
+	mux       sync.RWMutex
+	degraded  atomic.Bool
+	lastRetry atomic.Int64 // unix nanos
+
+	// deletes applied locally while degraded, replayed to the primary on reconcile.
+	tombMux  sync.Mutex
+	deleted  map[string]struct{}
+	accounts map[ID]struct{}
+}
+
+// NewFallbackStore returns a FallbackStore wrapping primary.
+func NewFallbackStore[ID comparable](primary TokenStore[ID]) *FallbackStore[ID] {
+	return &FallbackStore[ID]{
+		primary:  primary,
+		local:    NewMemoryStore[ID](),
+		logger:   discardLogger,
+		clock:    time.Now,
+		retry:    defaultFallbackRetry,
+		deleted:  make(map[string]struct{}),
+		accounts: make(map[ID]struct{}),
+	}
+}
+
+// Degraded reports whether operations are served from memory as the primary store failed.
+func (s *FallbackStore[ID]) Degraded() bool {
+	return s.degraded.Load()
+}
+
+// fail reports whether the failed operation of the primary is served from memory instead, degrading the store
+// on the first failure. Context errors and tokenstring collisions are returned as is.
+func (s *FallbackStore[ID]) fail(ctx context.Context, err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errTokenCollision) {
+		return false
+	}
+	if s.degraded.CompareAndSwap(false, true) {
+		s.lastRetry.Store(s.clock().UnixNano())
+		s.metrics.incDegraded()
+		s.logger.WarnContext(ctx, "login token store unavailable, serving from memory", slog.String("reason", err.Error()))
+	}
+	return true
+}
+
+// retryDue reports whether a degraded store should attempt to reconcile, letting only one caller per interval do so.
+func (s *FallbackStore[ID]) retryDue() bool {
+	last := s.lastRetry.Load()
+	now := s.clock().UnixNano()
+	return now-last >= int64(s.retry) && s.lastRetry.CompareAndSwap(last, now)
+}
+
+// do calls primary unless degraded, falling back to local if it fails.
+func (s *FallbackStore[ID]) do(ctx context.Context, primary, local func() error) error {
+	if s.degraded.Load() && s.retryDue() {
+		if err := s.Reconcile(ctx); err != nil {
+			s.logger.DebugContext(ctx, "login token store still unavailable", slog.String("reason", err.Error()))
+		}
+	}
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	if !s.degraded.Load() {
+		if err := primary(); !s.fail(ctx, err) {
+			return err
+		}
+	}
+	return local()
+}
+
+// Reconcile moves the store back to the primary if degraded and the primary recovered. Account and token deletes
+// applied during the outage are replayed to the primary, then all unexpired tokens held in memory are saved to it.
+// It returns the first error of the primary, staying degraded. Operations wait while reconciling.
+func (s *FallbackStore[ID]) Reconcile(ctx context.Context) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.degraded.Load() {
+		return nil
+	}
+	if p, ok := s.primary.(Pinger); ok {
+		if err := p.Ping(ctx); err != nil {
+			return err
+		}
+	}
+	for id := range s.accounts {
+		if _, err := s.primary.DeleteByAccount(ctx, id); err != nil {
+			return err
+		}
+		delete(s.accounts, id)
+	}
+	for token := range s.deleted {
+		if err := s.primary.Delete(ctx, token); err != nil {
+			return err
+		}
+		delete(s.deleted, token)
+	}
+	tokens, err := s.local.All(ctx, s.clock())
+	if err != nil {
+		return err
+	}
+	for _, lt := range tokens {
+		if err := s.primary.Save(ctx, lt); err != nil {
+			return err
+		}
+	}
+	if err := s.local.Clear(ctx); err != nil {
+		return err
+	}
+	s.degraded.Store(false)
+	s.logger.InfoContext(ctx, "login token store recovered", slog.Int("reconciled", len(tokens)))
+	return nil
+}
+
+// Save adds or replaces a login token in the primary store, or in memory while degraded.
+func (s *FallbackStore[ID]) Save(ctx context.Context, lt LoginToken[ID]) error {
+	return s.do(ctx,
+		func() error { return s.primary.Save(ctx, lt) },
+		func() error { return s.local.Save(ctx, lt) },
+	)
+}
+
+// Get returns the login token for tokenstring and whether it exists from the primary store, or from memory while degraded.
+func (s *FallbackStore[ID]) Get(ctx context.Context, token string) (lt LoginToken[ID], ok bool, err error) {
+	err = s.do(ctx,
+		func() error {
+			lt, ok, err = s.primary.Get(ctx, token)
+			return err
+		},
+		func() error {
+			lt, ok, err = s.local.Get(ctx, token)
+			return err
+		},
+	)
+	return lt, ok, err
+}
+
+// Delete removes the login token for tokenstring from the primary store, or from memory while degraded
+// to be deleted from the primary on reconcile.
+func (s *FallbackStore[ID]) Delete(ctx context.Context, token string) error {
+	return s.do(ctx,
+		func() error { return s.primary.Delete(ctx, token) },
+		func() error {
+			s.tombMux.Lock()
+			s.deleted[token] = struct{}{}
+			s.tombMux.Unlock()
+			return s.local.Delete(ctx, token)
+		},
+	)
+}
+
+// DeleteByAccount removes all login tokens referencing account ID from the primary store, or from memory while
+// degraded to be deleted from the primary on reconcile, and returns the number removed.
+func (s *FallbackStore[ID]) DeleteByAccount(ctx context.Context, id ID) (n int, err error) {
+	err = s.do(ctx,
+		func() error {
+			n, err = s.primary.DeleteByAccount(ctx, id)
+			return err
+		},
+		func() error {
+			s.tombMux.Lock()
+			s.accounts[id] = struct{}{}
+			s.tombMux.Unlock()
+			n, err = s.local.DeleteByAccount(ctx, id)
+			return err
+		},
+	)
+	return n, err
+}
+
+// PurgeExpired removes all login tokens expired at now from the primary store, or from memory while degraded,
+// and returns the removed tokens.
+func (s *FallbackStore[ID]) PurgeExpired(ctx context.Context, now time.Time) (purged []LoginToken[ID], err error) {
+	err = s.do(ctx,
+		func() error {
+			purged, err = s.primary.PurgeExpired(ctx, now)
+			return err
+		},
+		func() error {
+			purged, err = s.local.PurgeExpired(ctx, now)
+			return err
+		},
+	)
+	return purged, err
+}
+
+// Count returns the number of login tokens not expired at now in the primary store, or in memory while degraded.
+func (s *FallbackStore[ID]) Count(ctx context.Context, now time.Time) (n int, err error) {
+	err = s.do(ctx,
+		func() error {
+			n, err = s.primary.Count(ctx, now)
+			return err
+		},
+		func() error {
+			n, err = s.local.Count(ctx, now)
+			return err
+		},
+	)
+	return n, err
+}
+
+// CountForAccount returns the number of login tokens referencing account ID not expired at now in the primary store,
+// or in memory while degraded.
+func (s *FallbackStore[ID]) CountForAccount(ctx context.Context, id ID, now time.Time) (n int, err error) {
+	err = s.do(ctx,
+		func() error {
+			n, err = s.primary.CountForAccount(ctx, id, now)
+			return err
+		},
+		func() error {
+			n, err = s.local.CountForAccount(ctx, id, now)
+			return err
+		},
+	)
+	return n, err
+}
+
+// Clear removes all login tokens from the primary store, or from memory while degraded.
+func (s *FallbackStore[ID]) Clear(ctx context.Context) error {
+	return s.do(ctx,
+		func() error { return s.primary.Clear(ctx) },
+		func() error { return s.local.Clear(ctx) },
+	)
+}
+
+// List returns all login tokens referencing account ID not expired at now from the primary store,
+// or from memory while degraded.
+func (s *FallbackStore[ID]) List(ctx context.Context, id ID, now time.Time) (tokens []LoginToken[ID], err error) {
+	err = s.do(ctx,
+		func() error {
+			tokens, err = s.primary.List(ctx, id, now)
+			return err
+		},
+		func() error {
+			tokens, err = s.local.List(ctx, id, now)
+			return err
+		},
+	)
+	return tokens, err
+}
+
+// Extend sets the expiry of the login token for tokenstring if it exists and is not expired at now in the primary
+// store, or in memory while degraded.
+func (s *FallbackStore[ID]) Extend(ctx context.Context, token string, now, expiry time.Time) (lt LoginToken[ID], ok bool, err error) {
+	err = s.do(ctx,
+		func() error {
+			lt, ok, err = s.primary.Extend(ctx, token, now, expiry)
+			return err
+		},
+		func() error {
+			lt, ok, err = s.local.Extend(ctx, token, now, expiry)
+			return err
+		},
+	)
+	return lt, ok, err
+}
+
+// CreateTable creates the table of the primary store if it supports it, like SQLStore.
+func (s *FallbackStore[ID]) CreateTable(ctx context.Context) error {
+	tc, ok := s.primary.(tableCreator)
+	if !ok {
+		return fmt.Errorf("token store %T does not support creating its table", s.primary)
+	}
+	return tc.CreateTable(ctx)
+}
+
+// Flush flushes the primary store if it buffers writes.
+func (s *FallbackStore[ID]) Flush(ctx context.Context) error {
+	if f, ok := s.primary.(flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+// Ping checks the primary store if it implements Pinger.
+func (s *FallbackStore[ID]) Ping(ctx context.Context) error {
+	if p, ok := s.primary.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// Close closes the primary store if it implements io.Closer.
+func (s *FallbackStore[ID]) Close() error {
+	if c, ok := s.primary.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
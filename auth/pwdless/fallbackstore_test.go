@@ -0,0 +1,186 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// outageStore is a MemoryStore failing all operations while down.
+type outageStore struct {
+	*MemoryStore[int]
+	down atomic.Bool
+}
+
+func (s *outageStore) err() error {
+	if s.down.Load() {
+		return errStore
+	}
+	return nil
+}
+
+func (s *outageStore) Save(ctx context.Context, lt LoginToken[int]) error {
+	if err := s.err(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Save(ctx, lt)
+}
+
+func (s *outageStore) Get(ctx context.Context, token string) (LoginToken[int], bool, error) {
+	if err := s.err(); err != nil {
+		return LoginToken[int]{}, false, err
+	}
+	return s.MemoryStore.Get(ctx, token)
+}
+
+func (s *outageStore) Delete(ctx context.Context, token string) error {
+	if err := s.err(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Delete(ctx, token)
+}
+
+func (s *outageStore) DeleteByAccount(ctx context.Context, id int) (int, error) {
+	if err := s.err(); err != nil {
+		return 0, err
+	}
+	return s.MemoryStore.DeleteByAccount(ctx, id)
+}
+
+func (s *outageStore) CountForAccount(ctx context.Context, id int, now time.Time) (int, error) {
+	if err := s.err(); err != nil {
+		return 0, err
+	}
+	return s.MemoryStore.CountForAccount(ctx, id, now)
+}
+
+func (s *outageStore) List(ctx context.Context, id int, now time.Time) ([]LoginToken[int], error) {
+	if err := s.err(); err != nil {
+		return nil, err
+	}
+	return s.MemoryStore.List(ctx, id, now)
+}
+
+func (s *outageStore) Ping(ctx context.Context) error {
+	return s.err()
+}
+
+func TestLoginTokenAuth_WithFallback(t *testing.T) {
+	ctx := context.Background()
+	primary := &outageStore{MemoryStore: NewMemoryStore[int]()}
+	a, err := NewLoginTokenAuthWithOptions[int](
+		WithLoginURL("http://localhost/login"),
+		WithStore[int](primary),
+		WithFallback(true),
+		WithMetrics(prometheus.NewRegistry()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := a.metrics
+	fs := a.store.(*FallbackStore[int])
+
+	before, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary.down.Store(true)
+
+	during, err := a.CreateToken(2)
+	if err != nil {
+		t.Fatalf("got %v creating token during outage, want: nil", err)
+	}
+	if !fs.Degraded() {
+		t.Fatal("store not degraded after primary failed")
+	}
+	if got := m.Snapshot().Degraded; got != 1 {
+		t.Errorf("got %d degraded, want: 1", got)
+	}
+	if _, err := a.GetAccountID(before.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got %v for token held by primary during outage, want: %v", err, ErrTokenNotFound)
+	}
+	again, err := a.CreateToken(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := a.GetAccountID(during.Token); err != nil || id != 2 {
+		t.Errorf("got %d, %v for token created during outage, want: 2, nil", id, err)
+	}
+	if err := fs.Reconcile(ctx); !errors.Is(err, errStore) {
+		t.Errorf("got %v reconciling while primary down, want: %v", err, errStore)
+	}
+
+	primary.down.Store(false)
+	if err := fs.Reconcile(ctx); err != nil {
+		t.Fatalf("got %v reconciling after recovery, want: nil", err)
+	}
+	if fs.Degraded() {
+		t.Error("store still degraded after reconcile")
+	}
+	if n := len(fs.local.token); n != 0 {
+		t.Errorf("got %d tokens left in memory after reconcile, want: 0", n)
+	}
+	if _, ok := primary.token[a.hashToken(again.Token)]; !ok {
+		t.Error("token created during outage not reconciled to primary")
+	}
+	if id, err := a.GetAccountID(again.Token); err != nil || id != 2 {
+		t.Errorf("got %d, %v for reconciled token, want: 2, nil", id, err)
+	}
+	if id, err := a.GetAccountID(before.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v for token created before outage, want: 1, nil", id, err)
+	}
+	if got := m.Snapshot().Degraded; got != 1 {
+		t.Errorf("got %d degraded, want: 1", got)
+	}
+}
+
+func TestFallbackStore_reconcileDeletes(t *testing.T) {
+	ctx := context.Background()
+	primary := &outageStore{MemoryStore: NewMemoryStore[int]()}
+	fs := NewFallbackStore[int](primary)
+	expiry := time.Now().Add(time.Minute)
+	for _, lt := range []LoginToken[int]{
+		{Token: "a", AccountID: 1, Expiry: expiry},
+		{Token: "b", AccountID: 2, Expiry: expiry},
+	} {
+		if err := fs.Save(ctx, lt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	primary.down.Store(true)
+	if _, err := fs.DeleteByAccount(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Delete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Save(ctx, LoginToken[int]{Token: "c", AccountID: 1, Expiry: expiry}); err != nil {
+		t.Fatal(err)
+	}
+
+	primary.down.Store(false)
+	fs.retry = 0
+	lt, ok, err := fs.Get(ctx, "c")
+	if err != nil || !ok || lt.AccountID != 1 {
+		t.Fatalf("got %v, %t, %v after recovery, want token of account 1", lt, ok, err)
+	}
+	if fs.Degraded() {
+		t.Error("store not reconciled on operation after recovery")
+	}
+	for _, token := range []string{"a", "b"} {
+		if _, ok := primary.token[token]; ok {
+			t.Errorf("token %s deleted during outage still held by primary", token)
+		}
+	}
+}
+
+func TestLoginTokenAuth_WithFallbackDefaultStore(t *testing.T) {
+	if _, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithFallback(true)); err == nil {
+		t.Error("got nil error for fallback without store")
+	}
+}
@@ -0,0 +1,85 @@
+package pwdless
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/dhax/go-base/auth/pwdless/pwdlesspb"
+)
+
+// GRPCServer implements the LoginTokenService of package pwdlesspb by a LoginTokenAuth, for services not written
+// in Go to create and consume login tokens of the same store. Account IDs are passed JSON encoded.
+// Register it with pwdlesspb.RegisterLoginTokenServiceServer.
+type GRPCServer[ID comparable] struct {
+	pwdlesspb.UnimplementedLoginTokenServiceServer
+	auth *LoginTokenAuth[ID]
+}
+
+// NewGRPCServer returns a GRPCServer serving the login tokens of a.
+func NewGRPCServer[ID comparable](a *LoginTokenAuth[ID]) *GRPCServer[ID] {
+	return &GRPCServer[ID]{auth: a}
+}
+
+// CreateToken creates a login token for the account of the request.
+func (s *GRPCServer[ID]) CreateToken(ctx context.Context, req *pwdlesspb.CreateTokenRequest) (*pwdlesspb.CreateTokenResponse, error) {
+	var id ID
+	if err := json.Unmarshal([]byte(req.GetAccountId()), &id); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "malformed account ID: %v", err)
+	}
+	lt, err := s.auth.CreateTokenContext(ctx, id)
+	if err != nil {
+		return nil, s.status(ctx, err)
+	}
+	return &pwdlesspb.CreateTokenResponse{Token: lt.Token, Expiry: lt.Expiry.Unix()}, nil
+}
+
+// Consume consumes the login token of the request like GetAccountIDFrom, counting invalid tokens against its source.
+func (s *GRPCServer[ID]) Consume(ctx context.Context, req *pwdlesspb.ConsumeRequest) (*pwdlesspb.ConsumeResponse, error) {
+	id, err := s.auth.GetAccountIDFrom(ctx, req.GetToken(), req.GetSource())
+	if err != nil {
+		return nil, s.status(ctx, err)
+	}
+	b, err := json.Marshal(id)
+	if err != nil {
+		return nil, s.status(ctx, err)
+	}
+	return &pwdlesspb.ConsumeResponse{AccountId: string(b)}, nil
+}
+
+// Revoke removes the login token of the request like RevokeToken.
+func (s *GRPCServer[ID]) Revoke(ctx context.Context, req *pwdlesspb.RevokeRequest) (*pwdlesspb.RevokeResponse, error) {
+	if err := s.auth.RevokeToken(req.GetToken()); err != nil {
+		return nil, s.status(ctx, err)
+	}
+	return &pwdlesspb.RevokeResponse{}, nil
+}
+
+// status returns the gRPC status error for err as documented by the service definition, logging internal errors.
+func (s *GRPCServer[ID]) status(ctx context.Context, err error) error {
+	var code codes.Code
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, ErrTokenNotFound), errors.Is(err, ErrTokenExpired), errors.Is(err, errTokenFromFuture):
+		code = codes.NotFound
+	case errors.Is(err, ErrTokenPrefix), errors.Is(err, ErrScopeMismatch), errors.Is(err, ErrFingerprintMismatch):
+		code = codes.InvalidArgument
+	case errors.Is(err, ErrTokenReuseDetected):
+		code = codes.PermissionDenied
+	case errors.Is(err, errTooEarly):
+		code = codes.FailedPrecondition
+	case errors.Is(err, ErrRateLimited), errors.Is(err, ErrTooManyTokens), errors.Is(err, ErrTooManyAttempts):
+		code = codes.ResourceExhausted
+	case errors.Is(err, ErrClosed):
+		code = codes.Unavailable
+	default:
+		s.auth.logger.ErrorContext(ctx, "login token grpc request failed", slog.String("reason", err.Error()))
+		return status.Error(codes.Internal, "internal error")
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,96 @@
+package pwdless
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/dhax/go-base/auth/pwdless/pwdlesspb"
+)
+
+// newTestGRPCClient serves a by a GRPCServer over an in-memory connection and returns a client of it.
+func newTestGRPCClient(t *testing.T, a *LoginTokenAuthInt) pwdlesspb.LoginTokenServiceClient {
+	lis := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer()
+	pwdlesspb.RegisterLoginTokenServiceServer(srv, NewGRPCServer(a))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pwdlesspb.NewLoginTokenServiceClient(conn)
+}
+
+func TestGRPCServer(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithMaxPerAccount(1, false))
+	c := newTestGRPCClient(t, a)
+
+	created, err := c.CreateToken(ctx, &pwdlesspb.CreateTokenRequest{AccountId: "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := clock.Now().Add(time.Minute).Unix(); created.GetExpiry() != want {
+		t.Errorf("got expiry %d, want: %d", created.GetExpiry(), want)
+	}
+	consumed, err := c.Consume(ctx, &pwdlesspb.ConsumeRequest{Token: created.GetToken(), Source: "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consumed.GetAccountId() != "42" {
+		t.Errorf("got account %q, want: %q", consumed.GetAccountId(), "42")
+	}
+
+	revoked, err := c.CreateToken(ctx, &pwdlesspb.CreateTokenRequest{AccountId: "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Revoke(ctx, &pwdlesspb.RevokeRequest{Token: revoked.GetToken()}); err != nil {
+		t.Fatal(err)
+	}
+	expired, err := c.CreateToken(ctx, &pwdlesspb.CreateTokenRequest{AccountId: "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errTooMany := c.CreateToken(ctx, &pwdlesspb.CreateTokenRequest{AccountId: "42"})
+	clock.Add(2 * time.Minute)
+	_, errExpired := c.Consume(ctx, &pwdlesspb.ConsumeRequest{Token: expired.GetToken()})
+	_, errConsumed := c.Consume(ctx, &pwdlesspb.ConsumeRequest{Token: created.GetToken()})
+	_, errRevoked := c.Revoke(ctx, &pwdlesspb.RevokeRequest{Token: revoked.GetToken()})
+	_, errAccount := c.CreateToken(ctx, &pwdlesspb.CreateTokenRequest{AccountId: `"42"`})
+	a.Close(ctx)
+	_, errClosed := c.Consume(ctx, &pwdlesspb.ConsumeRequest{Token: created.GetToken()})
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"consumed", errConsumed, codes.NotFound},
+		{"expired", errExpired, codes.NotFound},
+		{"revoked", errRevoked, codes.NotFound},
+		{"too_many_tokens", errTooMany, codes.ResourceExhausted},
+		{"malformed_account", errAccount, codes.InvalidArgument},
+		{"closed", errClosed, codes.Unavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := status.Code(tc.err); got != tc.want {
+				t.Errorf("got %v (%v), want: %v", got, tc.err, tc.want)
+			}
+		})
+	}
+}
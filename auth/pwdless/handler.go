@@ -0,0 +1,269 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/render"
+)
+
+type ctxKey int
+
+const (
+	ctxAccountID ctxKey = iota
+)
+
+// AccountIDFromContext returns the account ID set by LoginTokenAuth.Middleware or ConsumingMiddleware
+// and whether it is present.
+func AccountIDFromContext[ID comparable](ctx context.Context) (ID, bool) {
+	id, ok := ctx.Value(ctxAccountID).(ID)
+	return id, ok
+}
+
+// MustAccountIDFromContext is like AccountIDFromContext, but panics if no account ID of type ID is present,
+// for handlers only reachable through the middleware. A present zero account ID is returned as is.
+func MustAccountIDFromContext[ID comparable](ctx context.Context) ID {
+	id, ok := AccountIDFromContext[ID](ctx)
+	if !ok {
+		var zero ID
+		panic(fmt.Sprintf("pwdless: no account ID of type %T in context, handler not behind LoginTokenAuth middleware", zero))
+	}
+	return id
+}
+
+type consumeResponse[ID comparable] struct {
+	AccountID ID `json:"account_id"`
+}
+
+type issueResponse struct {
+	LoginURL string `json:"login_url"`
+}
+
+// ErrUnknownAccount is returned by the resolve function of IssueHandler if the request references no account.
+var ErrUnknownAccount = errors.New("unknown account")
+
+var (
+	// ErrTokenExtraction wraps errors of a TokenExtractor passed to the ErrorRenderer.
+	ErrTokenExtraction = errors.New("login token extraction failed")
+	// ErrBearerTokenMissing is passed to the ErrorRenderer by Middleware and ConsumingMiddleware for requests
+	// without "Authorization: Bearer <token>" header. It wraps ErrLoginTokenMissing.
+	ErrBearerTokenMissing = fmt.Errorf("bearer %w", ErrLoginTokenMissing)
+)
+
+// ErrorRenderer responds to a request failed with err by a handler of LoginTokenAuth. err is ErrLoginTokenMissing
+// or ErrBearerTokenMissing for requests without token, wraps ErrTokenExtraction for malformed requests and is returned
+// by consuming or validating the token otherwise, e.g. ErrTokenExpired, ErrTokenNotFound or ErrTooManyAttempts.
+type ErrorRenderer func(w http.ResponseWriter, r *http.Request, err error)
+
+// JSONErrorRenderer is the default ErrorRenderer responding with an ErrResponse. It responds 400 Bad Request
+// for missing tokens and malformed requests, 401 Unauthorized for missing bearer tokens and invalid or expired tokens,
+// telling expired tokens apart, 429 Too Many Requests while locked out and 500 Internal Server Error logging other errors.
+func JSONErrorRenderer(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrBearerTokenMissing):
+		render.Render(w, r, ErrUnauthorized(ErrLoginTokenMissing))
+	case errors.Is(err, ErrLoginTokenMissing):
+		render.Render(w, r, ErrBadRequest(ErrLoginTokenMissing))
+	case errors.Is(err, ErrTokenExtraction):
+		render.Render(w, r, ErrBadRequest(err))
+	case errors.Is(err, ErrTooManyAttempts):
+		render.Render(w, r, ErrTooManyRequests(ErrLoginAttempts))
+	case invalidToken(err), errors.Is(err, errTooEarly):
+		render.Render(w, r, ErrUnauthorized(ErrLoginToken))
+	case errors.Is(err, ErrTokenExpired):
+		render.Render(w, r, ErrUnauthorized(ErrLoginTokenExpired))
+	default:
+		log(r).Error(err)
+		render.Render(w, r, ErrInternalServerError)
+	}
+}
+
+// renderError responds to the request failed with err by the configured ErrorRenderer.
+func (a *LoginTokenAuth[ID]) renderError(w http.ResponseWriter, r *http.Request, err error) {
+	if a.errorRenderer != nil {
+		a.errorRenderer(w, r, err)
+		return
+	}
+	JSONErrorRenderer(w, r, err)
+}
+
+// TokenExtractor returns the tokenstring carried by a request, or an error if the request is malformed.
+// An empty tokenstring is treated as missing token.
+type TokenExtractor func(r *http.Request) (string, error)
+
+// FromQuery returns a TokenExtractor reading the token from the query parameter name.
+func FromQuery(name string) TokenExtractor {
+	return func(r *http.Request) (string, error) {
+		return r.URL.Query().Get(name), nil
+	}
+}
+
+// FromHeader returns a TokenExtractor reading the token from the request header name.
+func FromHeader(name string) TokenExtractor {
+	return func(r *http.Request) (string, error) {
+		return strings.TrimSpace(r.Header.Get(name)), nil
+	}
+}
+
+// FromPathValue returns a TokenExtractor reading the token from the path wildcard name
+// of a route like "/login/{token}" registered with http.ServeMux.
+func FromPathValue(name string) TokenExtractor {
+	return func(r *http.Request) (string, error) {
+		return r.PathValue(name), nil
+	}
+}
+
+// ConsumeHandler returns a http handler consuming the login token passed as query parameter named by the configured token param.
+// It responds with the account ID on success, 400 Bad Request if the token is missing and 401 Unauthorized if not found or expired.
+// Invalid tokens are counted against the client IP if brute force protection is enabled, responding 429 Too Many Requests
+// while locked out. Failures are responded by the ErrorRenderer set with WithErrorRenderer instead if configured.
+func (a *LoginTokenAuth[ID]) ConsumeHandler() http.HandlerFunc {
+	return a.ConsumeHandlerWith(FromQuery(a.loginTokenParam))
+}
+
+// ConsumeHandlerWith is like ConsumeHandler, reading the login token with extract instead,
+// e.g. FromPathValue or FromHeader for clients not passing it as query parameter.
+// Extraction errors are responded with 400 Bad Request.
+func (a *LoginTokenAuth[ID]) ConsumeHandlerWith(extract TokenExtractor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := extract(r)
+		if err != nil {
+			a.renderError(w, r, fmt.Errorf("%w: %w", ErrTokenExtraction, err))
+			return
+		}
+		if token == "" {
+			a.renderError(w, r, ErrLoginTokenMissing)
+			return
+		}
+
+		id, err := a.GetAccountIDFrom(r.Context(), token, clientIP(r))
+		if err != nil {
+			a.renderError(w, r, err)
+			return
+		}
+
+		render.Respond(w, r, &consumeResponse[ID]{AccountID: id})
+	}
+}
+
+// IssueHandler returns a http handler creating a login token for the account ID returned by resolve,
+// e.g. looked up by an email address in the request body, and responding with its login url.
+// If resolve returns ErrUnknownAccount, or the account exceeded the rate limit or its limit of tokens,
+// the response carries a login url with a token that was never stored, so the response does not reveal
+// whether an account exists. Limited accounts are logged and counted by the metrics instead. Other resolve
+// errors are responded with 400 Bad Request. Use SendLoginLink instead to send the login url by email.
+func (a *LoginTokenAuth[ID]) IssueHandler(resolve func(r *http.Request) (ID, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		decoy := func(id ID) {
+			token, _, err := a.newToken(id)
+			if err != nil {
+				log(r).Error(err)
+				render.Render(w, r, ErrInternalServerError)
+				return
+			}
+			render.Respond(w, r, &issueResponse{LoginURL: a.LoginURL(LoginToken[ID]{Token: token, AccountID: id})})
+		}
+
+		id, err := resolve(r)
+		if errors.Is(err, ErrUnknownAccount) {
+			decoy(id)
+			return
+		}
+		if err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		lt, err := a.CreateTokenContext(r.Context(), id)
+		if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrTooManyTokens) {
+			a.logLimited(r.Context(), id, err)
+			decoy(id)
+			return
+		}
+		if err != nil {
+			log(r).Error(err)
+			render.Render(w, r, ErrInternalServerError)
+			return
+		}
+
+		render.Respond(w, r, &issueResponse{LoginURL: a.LoginURL(lt)})
+	}
+}
+
+// Middleware authenticates requests by a login token passed as "Authorization: Bearer <token>" header.
+// The token is validated without consuming it and the account ID is set on the request context,
+// retrievable with AccountIDFromContext. Requests with missing or invalid tokens are responded with 401 Unauthorized,
+// as are tokens created by CreateScopedToken or CreateTokenBound.
+func (a *LoginTokenAuth[ID]) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			a.renderError(w, r, ErrBearerTokenMissing)
+			return
+		}
+
+		lt, err := a.lookupBound(r.Context(), token, "")
+		if err == nil && lt.Scope != "" {
+			err = ErrScopeMismatch
+		}
+		if err != nil {
+			a.renderError(w, r, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxAccountID, lt.AccountID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ConsumingMiddleware is like Middleware, but consumes the token like GetAccountID, for endpoints being the one-shot
+// action a login link grants, like confirming an unsubscription. Every request burns its token, so a retried request
+// is rejected with 401 Unauthorized even if the first one succeeded, and only endpoints fine with that may be wrapped.
+// Invalid tokens are counted against the client IP if brute force protection is enabled, responding 429 Too Many Requests
+// while locked out.
+func (a *LoginTokenAuth[ID]) ConsumingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			a.renderError(w, r, ErrBearerTokenMissing)
+			return
+		}
+
+		id, err := a.GetAccountIDFrom(r.Context(), token, clientIP(r))
+		if err != nil {
+			a.renderError(w, r, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxAccountID, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// invalidToken reports whether err is caused by a tokenstring not referencing a usable token.
+func invalidToken(err error) bool {
+	return errors.Is(err, ErrTokenNotFound) || errors.Is(err, ErrTokenPrefix) || errors.Is(err, ErrFingerprintMismatch) ||
+		errors.Is(err, ErrScopeMismatch) || errors.Is(err, ErrTokenReuseDetected) || errors.Is(err, errTokenFromFuture)
+}
+
+// clientIP returns the host part of the request remote address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// bearerToken returns the token of a "Authorization: Bearer <token>" request header.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
@@ -0,0 +1,377 @@
+package pwdless
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLoginTokenAuth_ConsumeHandler(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+	lt, err := a.CreateTokenWithExpiry(123, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := a.CreateToken(123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(2 * time.Minute)
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		err    error
+	}{
+		{"missing", "", http.StatusBadRequest, ErrLoginTokenMissing},
+		{"unknown", "?token=unknown", http.StatusUnauthorized, ErrLoginToken},
+		{"expired", "?token=" + expired.Token, http.StatusUnauthorized, ErrLoginTokenExpired},
+		{"valid", "?token=" + lt.Token, http.StatusOK, nil},
+		{"consumed", "?token=" + lt.Token, http.StatusUnauthorized, ErrLoginToken},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			a.ConsumeHandler().ServeHTTP(w, httptest.NewRequest("GET", "/consume"+tc.query, nil))
+
+			if w.Code != tc.status {
+				t.Errorf("got http status %d, want: %d", w.Code, tc.status)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("got content type %s, want json", ct)
+			}
+			var body struct {
+				AccountID int    `json:"account_id"`
+				Error     string `json:"error"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if tc.err != nil && body.Error != tc.err.Error() {
+				t.Errorf("got error %q, want: %q", body.Error, tc.err.Error())
+			}
+			if tc.err == nil && body.AccountID != 123 {
+				t.Errorf("got account id %d, want: %d", body.AccountID, 123)
+			}
+		})
+	}
+}
+
+func TestLoginTokenAuth_ConsumeHandlerWith(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+	newToken := func() string {
+		lt, err := a.CreateToken(123)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lt.Token
+	}
+	request := func(target string, setup func(r *http.Request)) *http.Request {
+		r := httptest.NewRequest("GET", target, nil)
+		if setup != nil {
+			setup(r)
+		}
+		return r
+	}
+	path, header := newToken(), newToken()
+
+	tests := []struct {
+		name    string
+		extract TokenExtractor
+		req     *http.Request
+		status  int
+	}{
+		{"path", FromPathValue("token"), request("/login/"+path, func(r *http.Request) { r.SetPathValue("token", path) }), http.StatusOK},
+		{"path_missing", FromPathValue("token"), request("/login/", nil), http.StatusBadRequest},
+		{"header", FromHeader("X-Login-Token"), request("/", func(r *http.Request) { r.Header.Set("X-Login-Token", header) }), http.StatusOK},
+		{"header_missing", FromHeader("X-Login-Token"), request("/", nil), http.StatusBadRequest},
+		{"query", FromQuery("t"), request("/?t="+newToken(), nil), http.StatusOK},
+		{"query_unknown", FromQuery("t"), request("/?t=unknown", nil), http.StatusUnauthorized},
+		{"extract_error", func(*http.Request) (string, error) { return "", errors.New("malformed") }, request("/", nil), http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			a.ConsumeHandlerWith(tc.extract).ServeHTTP(w, tc.req)
+			if w.Code != tc.status {
+				t.Errorf("got http status %d, want: %d", w.Code, tc.status)
+			}
+		})
+	}
+}
+
+func TestLoginTokenAuth_ConsumeHandlerLockout(t *testing.T) {
+	a, _ := newTestAuth(time.Minute, WithBruteForceProtection(2, time.Minute))
+	for i, status := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		a.ConsumeHandler().ServeHTTP(w, httptest.NewRequest("GET", "/consume?token=unknown", nil))
+		if w.Code != status {
+			t.Errorf("got http status %d for attempt %d, want: %d", w.Code, i+1, status)
+		}
+	}
+}
+
+func TestLoginTokenAuth_IssueHandler(t *testing.T) {
+	a, _ := newTestAuth(time.Minute, WithRateLimit(1, time.Minute), WithMetrics(prometheus.NewRegistry()))
+	m := a.metrics
+	accounts := map[string]int{"known@example.com": 123, "limited@example.com": 456}
+	handler := a.IssueHandler(func(r *http.Request) (int, error) {
+		var body struct{ Email string }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return 0, err
+		}
+		id, ok := accounts[body.Email]
+		if !ok {
+			return 0, ErrUnknownAccount
+		}
+		return id, nil
+	})
+	if _, err := a.CreateToken(456); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		valid  bool
+	}{
+		{"known", `{"email":"known@example.com"}`, http.StatusOK, true},
+		{"unknown", `{"email":"unknown@example.com"}`, http.StatusOK, false},
+		{"malformed", `{"email":`, http.StatusBadRequest, false},
+		{"rate_limited", `{"email":"limited@example.com"}`, http.StatusOK, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("POST", "/issue", strings.NewReader(tc.body)))
+			if w.Code != tc.status {
+				t.Fatalf("got http status %d, want: %d", w.Code, tc.status)
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				LoginURL string `json:"login_url"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			u, err := url.Parse(body.LoginURL)
+			if err != nil || u.Query().Get("token") == "" {
+				t.Fatalf("got login url %q, want url with token", body.LoginURL)
+			}
+			_, err = a.GetAccountID(u.Query().Get("token"))
+			if tc.valid && err != nil {
+				t.Errorf("got error %v consuming issued token", err)
+			}
+			if !tc.valid && !errors.Is(err, ErrTokenNotFound) {
+				t.Errorf("got error %v consuming token for unknown account, want: %v", err, ErrTokenNotFound)
+			}
+		})
+	}
+	if got := m.Snapshot().Limited; got != 1 {
+		t.Errorf("got %d limited creations, want: %d", got, 1)
+	}
+}
+
+func TestLoginTokenAuth_Middleware(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+	lt, err := a.CreateToken(123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound, err := a.CreateTokenBound(123, Fingerprint("10.0.0.1", "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotID int
+	var reached bool
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		gotID, _ = AccountIDFromContext[int](r.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"malformed", "Basic " + lt.Token, http.StatusUnauthorized},
+		{"invalid", "Bearer invalid", http.StatusUnauthorized},
+		{"bound", "Bearer " + bound.Token, http.StatusUnauthorized},
+		{"valid", "Bearer " + lt.Token, http.StatusOK},
+		{"not_consumed", "BEARER " + lt.Token, http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reached, gotID = false, 0
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tc.status {
+				t.Errorf("got http status %d, want: %d", w.Code, tc.status)
+			}
+			if tc.status != http.StatusOK && reached {
+				t.Error("next handler reached for unauthorized request")
+			}
+			if tc.status == http.StatusOK && gotID != 123 {
+				t.Errorf("got account id %d from context, want: %d", gotID, 123)
+			}
+		})
+	}
+
+	if _, ok := AccountIDFromContext[int](context.Background()); ok {
+		t.Error("got account id from empty context")
+	}
+}
+
+func TestAccountIDFromContext(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		id   int
+		ok   bool
+	}{
+		{"present", context.WithValue(context.Background(), ctxAccountID, 123), 123, true},
+		{"zero", context.WithValue(context.Background(), ctxAccountID, 0), 0, true},
+		{"absent", context.Background(), 0, false},
+		{"other type", context.WithValue(context.Background(), ctxAccountID, "123"), 0, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if id, ok := AccountIDFromContext[int](tc.ctx); id != tc.id || ok != tc.ok {
+				t.Errorf("got %d, %t, want: %d, %t", id, ok, tc.id, tc.ok)
+			}
+			defer func() {
+				if r := recover(); (r != nil) == tc.ok {
+					t.Errorf("got panic %v, want panic: %t", r, !tc.ok)
+				}
+			}()
+			if id := MustAccountIDFromContext[int](tc.ctx); id != tc.id {
+				t.Errorf("got %d, want: %d", id, tc.id)
+			}
+		})
+	}
+}
+
+func TestLoginTokenAuth_ConsumingMiddleware(t *testing.T) {
+	a, store := newTestAuth(time.Minute)
+	lt, err := a.CreateToken(123)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotID int
+	var reached bool
+	h := a.ConsumingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		gotID, _ = AccountIDFromContext[int](r.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"invalid", "Bearer invalid", http.StatusUnauthorized},
+		{"valid", "Bearer " + lt.Token, http.StatusOK},
+		{"consumed", "Bearer " + lt.Token, http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reached, gotID = false, 0
+			req := httptest.NewRequest("POST", "/unsubscribe", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tc.status {
+				t.Errorf("got http status %d, want: %d", w.Code, tc.status)
+			}
+			if tc.status != http.StatusOK && reached {
+				t.Error("next handler reached for unauthorized request")
+			}
+			if tc.status == http.StatusOK && gotID != 123 {
+				t.Errorf("got account id %d from context, want: %d", gotID, 123)
+			}
+		})
+	}
+	if n := len(store.token); n != 0 {
+		t.Errorf("got %d tokens in store, want consumed token removed", n)
+	}
+}
+
+func TestLoginTokenAuth_ErrorRenderer(t *testing.T) {
+	clock := newFakeClock()
+	var got error
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithErrorRenderer(func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+		http.Redirect(w, r, "/login/new", http.StatusFound)
+	}))
+	expired, err := a.CreateToken(123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bearer, err := a.CreateToken(123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(2 * time.Minute)
+
+	tests := []struct {
+		name  string
+		query string
+		err   error
+	}{
+		{"missing", "", ErrLoginTokenMissing},
+		{"not_found", "?token=unknown", ErrTokenNotFound},
+		{"expired", "?token=" + expired.Token, ErrTokenExpired},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got = nil
+			w := httptest.NewRecorder()
+			a.ConsumeHandler().ServeHTTP(w, httptest.NewRequest("GET", "/consume"+tc.query, nil))
+			if !errors.Is(got, tc.err) {
+				t.Errorf("got renderer error %v, want: %v", got, tc.err)
+			}
+			if w.Code != http.StatusFound || w.Header().Get("Location") != "/login/new" {
+				t.Errorf("got http status %d to %q, want redirect by renderer", w.Code, w.Header().Get("Location"))
+			}
+		})
+	}
+
+	got = nil
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+bearer.Token)
+	a.Middleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+	if !errors.Is(got, ErrTokenExpired) {
+		t.Errorf("got renderer error %v from middleware, want: %v", got, ErrTokenExpired)
+	}
+}
@@ -0,0 +1,61 @@
+package pwdless
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// idempotency maps idempotency keys to the tokens created for them until the tokens expire.
+type idempotency[ID comparable] struct {
+	mux    sync.Mutex
+	tokens map[string]LoginToken[ID]
+}
+
+// purge removes mappings of tokens expired at now.
+func (m *idempotency[ID]) purge(now time.Time) {
+	for k, lt := range m.tokens {
+		if !lt.Valid(now) {
+			delete(m.tokens, k)
+		}
+	}
+}
+
+// CreateTokenIdempotent is like CreateToken, but returns the token already created for account ID with the same
+// idempotencyKey while it is neither expired nor consumed, e.g. to keep retried requests from sending multiple links.
+// The mapping expires with the token. As the token has to be returned again, its tokenstring is kept in memory
+// until then, so the mapping is not shared between instances even with a shared store.
+func (a *LoginTokenAuth[ID]) CreateTokenIdempotent(id ID, idempotencyKey string) (LoginToken[ID], error) {
+	if a.closed.Load() {
+		return LoginToken[ID]{}, ErrClosed
+	}
+	ctx := context.Background()
+	key := fmt.Sprintf("%v\x00%s", id, idempotencyKey)
+
+	m := &a.idempotent
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.purge(a.clock())
+	if lt, ok := m.tokens[key]; ok {
+		_, err := a.lookupIssued(ctx, lt.Token)
+		if err == nil {
+			lt.Data = copyData(lt.Data)
+			return a.relayed(lt, nil)
+		}
+		if err != ErrTokenNotFound && err != ErrTokenExpired {
+			return LoginToken[ID]{}, err
+		}
+		delete(m.tokens, key)
+	}
+
+	lt, err := a.createToken(ctx, LoginToken[ID]{AccountID: id}, a.loginTokenExpiry)
+	if err != nil {
+		return LoginToken[ID]{}, err
+	}
+	if m.tokens == nil {
+		m.tokens = make(map[string]LoginToken[ID])
+	}
+	m.tokens[key] = lt
+	return a.relayed(lt, nil)
+}
@@ -0,0 +1,63 @@
+package pwdless
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_CreateTokenIdempotent(t *testing.T) {
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Minute, WithClock(clock.Now))
+
+	lt, err := a.CreateTokenIdempotent(1, "req-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := a.CreateTokenIdempotent(1, "req-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Token != lt.Token || !again.Expiry.Equal(lt.Expiry) {
+		t.Errorf("got token %s, want same token %s for same key", again.Token, lt.Token)
+	}
+	other, err := a.CreateTokenIdempotent(1, "req-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Token == lt.Token {
+		t.Error("got same token for different keys")
+	}
+	account, err := a.CreateTokenIdempotent(2, "req-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Token == lt.Token {
+		t.Error("got same token for same key of different account")
+	}
+	if n := len(store.token); n != 3 {
+		t.Errorf("got %d tokens in store, want: %d", n, 3)
+	}
+
+	if _, err := a.GetAccountID(lt.Token); err != nil {
+		t.Fatal(err)
+	}
+	consumed, err := a.CreateTokenIdempotent(1, "req-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consumed.Token == lt.Token {
+		t.Error("got consumed token for same key, want new token")
+	}
+
+	clock.Add(2 * time.Minute)
+	expired, err := a.CreateTokenIdempotent(1, "req-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired.Token == other.Token {
+		t.Error("got expired token for same key, want new token")
+	}
+	if n := len(a.idempotent.tokens); n != 1 {
+		t.Errorf("got %d idempotency mappings, want expired mappings removed", n)
+	}
+}
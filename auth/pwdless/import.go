@@ -0,0 +1,46 @@
+package pwdless
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ImportToken stores the caller provided tokenstring for account id expiring at expiry, bypassing generation,
+// e.g. to keep the outstanding tokens of a legacy system valid after migrating. Imported tokens are consumed
+// like generated ones. The tokenstring has to be at least 20 characters and carry the configured prefix, the
+// expiry has to be in the future. Tokens not WellFormed can only be imported with WithWellFormedCheck disabled,
+// as they would be rejected on consumption otherwise. Rate and per account limits do not apply. Importing a tokenstring stored for
+// another account fails, importing it again for the same account replaces the token.
+func (a *LoginTokenAuth[ID]) ImportToken(token string, id ID, expiry time.Time) (err error) {
+	if a.closed.Load() {
+		return ErrClosed
+	}
+	if len(token) < minLoginTokenLength {
+		return fmt.Errorf("imported login token length %d is below minimum of %d", len(token), minLoginTokenLength)
+	}
+	if err := a.checkPrefix(token); err != nil {
+		return err
+	}
+	if a.wellFormedCheck && !a.WellFormed(token) {
+		return fmt.Errorf("imported login token does not match the configured length and alphabet, see WithWellFormedCheck")
+	}
+	now := a.clock()
+	if !expiry.After(now) {
+		return fmt.Errorf("imported login token expiry %s must be in the future", expiry)
+	}
+	ctx, span := a.startSpan(context.Background(), "pwdless.ImportToken")
+	defer func() { endSpan(span, err) }()
+
+	_, stored, err := a.rekey(LoginToken[ID]{AccountID: id, Created: now, Expiry: expiry}, func(ID) (string, string, error) {
+		return token, a.hashToken(token), nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := a.store.Save(ctx, stored); err != nil {
+		return err
+	}
+	a.created(ctx, stored)
+	return nil
+}
@@ -0,0 +1,54 @@
+package pwdless
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_ImportToken(t *testing.T) {
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Minute, WithClock(clock.Now), WithWellFormedCheck(false))
+	const legacy = "legacy-token-0123456789abcdef"
+
+	if err := a.ImportToken(legacy, 1, clock.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.token[legacy]; ok {
+		t.Error("got imported tokenstring stored in plaintext, want hashed")
+	}
+	clock.Add(30 * time.Minute)
+	if id, err := a.GetAccountID(legacy); err != nil || id != 1 {
+		t.Errorf("got %d, %v consuming imported token, want: %d, <nil>", id, err, 1)
+	}
+	if _, err := a.GetAccountID(legacy); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got %v consuming imported token twice, want: %v", err, ErrTokenNotFound)
+	}
+
+	if err := a.ImportToken(legacy, 1, clock.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ImportToken(legacy, 2, clock.Now().Add(time.Minute)); err != errTokenCollision {
+		t.Errorf("got %v importing token of another account, want: %v", err, errTokenCollision)
+	}
+	if err := a.ImportToken("short", 1, clock.Now().Add(time.Minute)); err == nil {
+		t.Error("got no error importing short token")
+	}
+	if err := a.ImportToken(legacy, 1, clock.Now()); err == nil {
+		t.Error("got no error importing token expiring now")
+	}
+
+	strict, _ := newTestAuth(time.Minute)
+	if err := strict.ImportToken(legacy, 1, time.Now().Add(time.Minute)); err == nil {
+		t.Error("got no error importing token not well formed")
+	}
+	if err := strict.ImportToken(strings.Repeat("a", defaultLoginTokenLength), 1, time.Now().Add(time.Minute)); err != nil {
+		t.Errorf("got %v importing well formed token, want: <nil>", err)
+	}
+
+	p, _ := newTestAuth(time.Minute, WithPrefix("lt_"))
+	if err := p.ImportToken(legacy, 1, time.Now().Add(time.Minute)); err != ErrTokenPrefix {
+		t.Errorf("got %v importing token without prefix, want: %v", err, ErrTokenPrefix)
+	}
+}
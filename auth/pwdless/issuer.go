@@ -0,0 +1,26 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+)
+
+var errNoJWTIssuer = errors.New("no jwt issuer configured")
+
+// JWTIssuer defines issuing signed session JWTs for accounts, allowing projects to use their own keys and claims.
+type JWTIssuer[ID comparable] interface {
+	Issue(accountID ID) (string, error)
+}
+
+// ConsumeForJWT consumes the token like GetAccountID and returns a JWT for the account issued by the configured JWTIssuer.
+// Errors consuming the token are returned unchanged.
+func (a *LoginTokenAuth[ID]) ConsumeForJWT(token string) (string, error) {
+	if a.issuer == nil {
+		return "", errNoJWTIssuer
+	}
+	lt, err := a.consume(context.Background(), token, "", "", "")
+	if err != nil {
+		return "", err
+	}
+	return a.issuer.Issue(lt.AccountID)
+}
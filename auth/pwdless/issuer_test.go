@@ -0,0 +1,38 @@
+package pwdless
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// issuerFunc implements JWTIssuer for accounts identified by int.
+type issuerFunc func(id int) (string, error)
+
+func (f issuerFunc) Issue(id int) (string, error) { return f(id) }
+
+func TestLoginTokenAuth_ConsumeForJWT(t *testing.T) {
+	issuer := issuerFunc(func(id int) (string, error) { return fmt.Sprintf("jwt-%d", id), nil })
+	a, _ := newTestAuth(time.Minute, WithJWTIssuer[int](issuer))
+	lt, err := a.CreateToken(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwt, err := a.ConsumeForJWT(lt.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwt != "jwt-7" {
+		t.Errorf("got jwt %q, want: %q", jwt, "jwt-7")
+	}
+	if _, err := a.ConsumeForJWT(lt.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got error %v for consumed token, want: %v", err, ErrTokenNotFound)
+	}
+
+	a, _ = newTestAuth(time.Minute)
+	if _, err := a.ConsumeForJWT(lt.Token); err != errNoJWTIssuer {
+		t.Errorf("got error %v, want: %v", err, errNoJWTIssuer)
+	}
+}
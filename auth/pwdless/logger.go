@@ -0,0 +1,80 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// discardLogger is the default logger of LoginTokenAuth, producing no output.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// Token lifecycle events are logged with the hashed tokenstring redacted to its last 4 characters,
+// plaintext tokenstrings are never logged.
+
+func (a *LoginTokenAuth[ID]) logCreated(ctx context.Context, lt LoginToken[ID]) {
+	a.logger.InfoContext(ctx, "login token created",
+		slog.Any("account_id", lt.AccountID),
+		slog.String("token", redactToken(lt.Token)),
+		slog.Time("expiry", lt.Expiry),
+	)
+}
+
+func (a *LoginTokenAuth[ID]) logConsumed(ctx context.Context, lt LoginToken[ID]) {
+	a.logger.InfoContext(ctx, "login token consumed",
+		slog.Any("account_id", lt.AccountID),
+		slog.String("token", redactToken(lt.Token)),
+	)
+}
+
+// logFailure logs a failed consume of the token stored by key. Rejected tokens are logged as warning,
+// other errors like store failures as error.
+func (a *LoginTokenAuth[ID]) logFailure(ctx context.Context, key string, err error, attrs ...slog.Attr) {
+	level := slog.LevelError
+	if invalidToken(err) || errors.Is(err, ErrTokenExpired) || errors.Is(err, ErrTooManyAttempts) {
+		level = slog.LevelWarn
+	}
+	attrs = append(attrs, slog.String("token", redactToken(key)), slog.String("reason", err.Error()))
+	a.logger.LogAttrs(ctx, level, "login token rejected", attrs...)
+}
+
+func (a *LoginTokenAuth[ID]) logLimited(ctx context.Context, id ID, err error) {
+	a.logger.WarnContext(ctx, "login token creation limited",
+		slog.Any("account_id", id),
+		slog.String("reason", err.Error()),
+	)
+}
+
+func (a *LoginTokenAuth[ID]) logWeakEntropy(bits float64) {
+	a.logger.Warn("login token entropy below recommended",
+		slog.Float64("entropy_bits", bits),
+		slog.Int("recommended_bits", recommendedEntropy),
+		slog.Int("length", a.loginTokenLength),
+		slog.Int("alphabet_size", len(a.alphabet)),
+	)
+}
+
+func (a *LoginTokenAuth[ID]) logPurged(ctx context.Context, n int, err error) {
+	if err != nil {
+		a.logger.ErrorContext(ctx, "purging expired login tokens failed", slog.Int("purged", n), slog.String("reason", err.Error()))
+		return
+	}
+	a.logger.DebugContext(ctx, "expired login tokens purged", slog.Int("purged", n))
+}
+
+func (a *LoginTokenAuth[ID]) logMemoryPressure(ctx context.Context, n int, policy PressurePolicy) {
+	a.logger.WarnContext(ctx, "login token store at memory pressure limit",
+		slog.Int("tokens", n),
+		slog.Int("max_tokens", a.pressureMax),
+		slog.String("policy", policy.String()),
+	)
+}
+
+func (a *LoginTokenAuth[ID]) logReuseDetected(ctx context.Context, lt LoginToken[ID], revoked int) {
+	a.logger.WarnContext(ctx, "superseded login token reused, family revoked",
+		slog.Any("account_id", lt.AccountID),
+		slog.String("token", redactToken(lt.Token)),
+		slog.String("family", redactToken(lt.FamilyID)),
+		slog.Int("revoked", revoked),
+	)
+}
@@ -0,0 +1,127 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordHandler is a slog.Handler collecting records.
+type recordHandler struct {
+	mux     sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mux.Lock()
+	h.records = append(h.records, r)
+	h.mux.Unlock()
+	return nil
+}
+
+func attrs(r slog.Record) map[string]string {
+	m := make(map[string]string)
+	r.Attrs(func(a slog.Attr) bool {
+		m[a.Key] = a.Value.String()
+		return true
+	})
+	return m
+}
+
+func TestLoginTokenAuth_logger(t *testing.T) {
+	clock := newFakeClock()
+	h := &recordHandler{}
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithLogger(slog.New(h)))
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountID(lt.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountID(lt.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("got %v, want: %v", err, ErrTokenNotFound)
+	}
+	if _, err := a.CreateToken(2); err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(2 * time.Minute)
+	if _, err := a.purgeExpired(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		level slog.Level
+		msg   string
+		attrs map[string]string
+	}{
+		{slog.LevelInfo, "login token created", map[string]string{"account_id": "1"}},
+		{slog.LevelInfo, "login token consumed", map[string]string{"account_id": "1"}},
+		{slog.LevelWarn, "login token rejected", map[string]string{"reason": ErrTokenNotFound.Error()}},
+		{slog.LevelInfo, "login token created", map[string]string{"account_id": "2"}},
+		{slog.LevelDebug, "expired login tokens purged", map[string]string{"purged": "1"}},
+	}
+	if len(h.records) != len(want) {
+		t.Fatalf("got %d records, want: %d", len(h.records), len(want))
+	}
+	for i, w := range want {
+		r := h.records[i]
+		if r.Level != w.level || r.Message != w.msg {
+			t.Errorf("got record %d %s %q, want: %s %q", i, r.Level, r.Message, w.level, w.msg)
+		}
+		got := attrs(r)
+		for k, v := range w.attrs {
+			if got[k] != v {
+				t.Errorf("got record %d attribute %s=%q, want: %q", i, k, got[k], v)
+			}
+		}
+		if tok, ok := got["token"]; r.Message != "expired login tokens purged" && (!ok || !strings.HasPrefix(tok, "...") || len(tok) != 7) {
+			t.Errorf("got record %d token %q, want redacted suffix", i, tok)
+		}
+		for k, v := range got {
+			if strings.Contains(v, lt.Token) {
+				t.Errorf("got record %d attribute %s containing plaintext token", i, k)
+			}
+		}
+	}
+}
+
+func TestLoginTokenAuth_loggerDefault(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+	if a.logger.Enabled(context.Background(), slog.LevelError) {
+		t.Error("default logger enabled, want discarding logger")
+	}
+}
+
+func TestLoginTokenAuth_Entropy(t *testing.T) {
+	h := &recordHandler{}
+	a, _ := newTestAuth(time.Minute, WithLogger(slog.New(h)))
+	if got := a.Entropy(); got != 192 {
+		t.Errorf("got entropy %v for default settings, want: %v", got, 192)
+	}
+	if len(h.records) != 0 {
+		t.Errorf("got %d log records for default settings, want: %d", len(h.records), 0)
+	}
+
+	a, _ = newTestAuth(time.Minute, WithLogger(slog.New(h)), WithTokenLength(20), WithAlphabet("0123456789abcdef"))
+	if got := a.Entropy(); got != 80 {
+		t.Errorf("got entropy %v for 20 hex characters, want: %v", got, 80)
+	}
+	if len(h.records) != 1 || h.records[0].Level != slog.LevelWarn || attrs(h.records[0])["entropy_bits"] != "80" {
+		t.Errorf("got log records %v, want single weak entropy warning", h.records)
+	}
+
+	a, _ = newTestAuth(time.Minute, WithTokenGenerator(func() string { return "custom-token-0123456789" }))
+	if got := a.Entropy(); got != 0 {
+		t.Errorf("got entropy %v with token generator, want: %v", got, 0)
+	}
+}
@@ -1,104 +1,1648 @@
 package pwdless
 
 import (
-	"crypto/rand"
+	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math"
+	mathrand "math/rand"
+	"net/url"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/dhax/go-base/logging"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// The list of errors returned by LoginTokenAuth, to be checked with errors.Is.
 var (
-	errTokenNotFound = errors.New("login token not found")
+	// ErrTokenNotFound is returned if no token exists for a tokenstring.
+	ErrTokenNotFound = errors.New("login token not found")
+	// ErrTokenExpired is returned if the token for a tokenstring exists but is past its expiry.
+	ErrTokenExpired = errors.New("login token expired")
+	// ErrRateLimited is returned if an account exceeded the configured token rate limit.
+	ErrRateLimited = errors.New("login token rate limit exceeded")
+	// ErrTokenPrefix is returned if a tokenstring does not carry the configured prefix.
+	ErrTokenPrefix = errors.New("login token has unexpected prefix")
+	// ErrFingerprintMismatch is returned if a token bound to a fingerprint is consumed with a different fingerprint.
+	ErrFingerprintMismatch = errors.New("login token fingerprint mismatch")
+	// ErrScopeMismatch is returned if a token is consumed for a scope other than the one it was created for.
+	ErrScopeMismatch = errors.New("login token scope mismatch")
+	// ErrTokenReuseDetected is returned if a token superseded by ConsumeAndRotate is presented again,
+	// revoking all tokens of its family as the token may have been stolen.
+	ErrTokenReuseDetected = errors.New("login token reuse detected")
+	// ErrClosed is returned by operations after Close has been called.
+	ErrClosed = errors.New("login token auth closed")
+	// ErrTooManyTokens is returned if an account reached the configured maximum of active tokens.
+	ErrTooManyTokens = errors.New("login token limit for account reached")
+	// ErrTooManyAttempts is returned if a source is locked out after repeated invalid tokens.
+	ErrTooManyAttempts = errors.New("too many invalid login token attempts")
+	// ErrReplay is returned if a nonce is used again with the same token.
+	ErrReplay = errors.New("login token nonce already used")
+	// ErrDataDecryption is returned if the data of a stored token can not be decrypted by the configured data key.
+	ErrDataDecryption = errors.New("login token data decryption failed, check the configured data key")
 )
 
-// LoginToken is an in-memory saved token referencing an account ID and an expiry date.
-type LoginToken struct {
+// errTooEarly is returned for tokens consumed within the consume delay since their creation, see WithConsumeDelay.
+var errTooEarly = errors.New("login token consumed too early")
+
+// errTokenFromFuture is returned for tokens created further in the future than the configured tolerance,
+// see WithFutureTolerance. It is handled like ErrTokenNotFound by the handlers and counted as an invalid attempt.
+var errTokenFromFuture = errors.New("login token created in the future")
+
+// LoginToken is a saved token referencing an account ID of type ID and an expiry date.
+// Stores only receive tokens with Token set to the hashed tokenstring.
+type LoginToken[ID comparable] struct {
 	Token     string
-	AccountID int
-	Expiry    time.Time
+	AccountID ID
+	// Created is the time the token was created by the configured clock,
+	// zero for tokens persisted by versions not recording it.
+	Created  time.Time
+	Expiry   time.Time
+	Data     map[string]string
+	Reusable bool
+	// MaxUses is the number of times the token can be consumed, 0 meaning once. It does not apply to reusable tokens.
+	MaxUses int
+	// Uses is the number of times a token with MaxUses was consumed.
+	Uses int
+	// Consumed is the time a single use token was consumed, if kept for the grace period set by WithConsumeGrace,
+	// or the time the pairing code of a poll token was claimed.
+	Consumed time.Time
+	// IdleTimeout expires a reusable token if not consumed for the duration, 0 meaning no idle timeout.
+	IdleTimeout time.Duration
+	// LastUsed is the time a reusable token with IdleTimeout was last consumed, zero if not consumed yet.
+	LastUsed time.Time
+	// Scope is the action the token was created for by CreateScopedToken, empty for login tokens.
+	Scope string
+	// FamilyID is shared by all tokens rotated from the same token by ConsumeAndRotate, empty for tokens never rotated.
+	FamilyID string
+	// Rotated is the time the token was superseded by ConsumeAndRotate, kept until expiry to detect its reuse.
+	Rotated time.Time
+	// Fingerprint is the hashed fingerprint the token is bound to, empty if unbound.
+	Fingerprint string
+	// AccountHash is the tokenstring hashed by the account secret, empty without AccountSecretFunc.
+	AccountHash string
+}
+
+// Valid reports whether lt is not past its expiry at now and, with an IdleTimeout, was used within it
+// since last consumed or created. Tokens are valid up to and including their expiry.
+func (lt LoginToken[ID]) Valid(now time.Time) bool {
+	if now.After(lt.Expiry) {
+		return false
+	}
+	if lt.IdleTimeout <= 0 {
+		return true
+	}
+	last := lt.LastUsed
+	if last.IsZero() {
+		last = lt.Created
+	}
+	return !now.After(last.Add(lt.IdleTimeout))
+}
+
+// String returns a description of lt with its tokenstring redacted to the last 4 characters.
+func (lt LoginToken[ID]) String() string {
+	return fmt.Sprintf("login token %s for account %v expiring %s", redactToken(lt.Token), lt.AccountID, lt.Expiry.Format(time.RFC3339))
+}
+
+// AccountSecretFunc returns the secret of account id used to hash its tokens. Changing the secret invalidates
+// all existing tokens of the account.
+type AccountSecretFunc[ID comparable] func(id ID) ([]byte, error)
+
+// Hooks are optional callbacks invoked on token lifecycle events, e.g. for audit logging.
+// Hooks receive tokens as saved to the store, with Token set to the hashed tokenstring,
+// and are called after the store operation completed.
+type Hooks[ID comparable] struct {
+	// OnCreate is called after a token has been created.
+	OnCreate func(lt LoginToken[ID])
+	// OnConsume is called after a token has been successfully consumed by GetAccountID.
+	OnConsume func(lt LoginToken[ID])
+	// OnExpire is called for every expired token removed from the store by the purge loop,
+	// or on access unless disabled by WithCountAccessExpiry.
+	OnExpire func(lt LoginToken[ID])
+}
+
+func (h Hooks[ID]) onCreate(lt LoginToken[ID]) {
+	if h.OnCreate != nil {
+		h.OnCreate(lt)
+	}
 }
 
-// LoginTokenAuth implements passwordless login authentication flow using temporary in-memory stored tokens.
-type LoginTokenAuth struct {
-	token            map[string]LoginToken
-	mux              sync.RWMutex
-	loginURL         string
-	loginTokenLength int
-	loginTokenExpiry time.Duration
+func (h Hooks[ID]) onConsume(lt LoginToken[ID]) {
+	if h.OnConsume != nil {
+		h.OnConsume(lt)
+	}
 }
 
-// NewLoginTokenAuth configures and returns a LoginToken authentication instance.
-func NewLoginTokenAuth() (*LoginTokenAuth, error) {
-	a := &LoginTokenAuth{
-		token:            make(map[string]LoginToken),
-		loginURL:         viper.GetString("auth_login_url"),
-		loginTokenLength: viper.GetInt("auth_login_token_length"),
-		loginTokenExpiry: viper.GetDuration("auth_login_token_expiry"),
+func (h Hooks[ID]) onExpire(lt LoginToken[ID]) {
+	if h.OnExpire != nil {
+		h.OnExpire(lt)
+	}
+}
+
+// LoginTokenAuth implements passwordless login authentication flow using temporary stored tokens
+// referencing accounts identified by ID.
+type LoginTokenAuth[ID comparable] struct {
+	config
+	store       TokenStore[ID]
+	limiter     *rateLimiter[ID]
+	shared      *sharedRateLimiter[ID]
+	attempts    *attemptLimiter
+	codes       *attemptLimiter
+	hooks       Hooks[ID]
+	metrics     *Metrics
+	tracer      trace.Tracer
+	issuer      JWTIssuer[ID]
+	urlFunc     LoginURLFunc[ID]
+	secretFn    AccountSecretFunc[ID]
+	webhook     *webhook
+	auditor     Auditor[ID]
+	updater     AccountUpdater[ID]
+	sessions    SessionStore[ID]
+	notifier    Notifier[ID]
+	localeFunc  LocaleFunc[ID]
+	validators  []Validator[ID]
+	activity    *AccountActivity[ID]
+	evictBefore EvictionPolicy[ID]
+
+	dataCipher cipher.AEAD
+
+	stats      stats
+	usesMux    sync.Mutex
+	idempotent idempotency[ID]
+	resent     idempotency[ID]
+	nonces     nonceTracker
+
+	gcMux  sync.Mutex
+	gcStop chan struct{}
+	gcWG   sync.WaitGroup
+	closed atomic.Bool
+}
+
+// LoginTokenAuthInt is a LoginTokenAuth for accounts identified by int.
+type LoginTokenAuthInt = LoginTokenAuth[int]
+
+// NewLoginTokenAuth configures and returns a LoginToken authentication instance for accounts identified by int.
+// Settings are read from viper and may be overridden by opts.
+func NewLoginTokenAuth(opts ...Option) (*LoginTokenAuthInt, error) {
+	return NewLoginTokenAuthFor[int](opts...)
+}
+
+// NewLoginTokenAuthFor configures and returns a LoginToken authentication instance for accounts identified by ID.
+// Settings are read from viper and may be overridden by opts. If the settings are invalid and no auth_* key
+// is set in viper at all, the error lists the required keys.
+func NewLoginTokenAuthFor[ID comparable](opts ...Option) (*LoginTokenAuth[ID], error) {
+	return NewLoginTokenAuthFromViper[ID](viper.GetViper(), opts...)
+}
+
+// NewLoginTokenAuthFromViper is like NewLoginTokenAuthFor, reading the settings from v instead of the global viper,
+// e.g. for multiple instances in one binary configured independently, like by environment variables bound
+// under a per instance prefix with v.SetEnvPrefix.
+func NewLoginTokenAuthFromViper[ID comparable](v *viper.Viper, opts ...Option) (*LoginTokenAuth[ID], error) {
+	a, err := NewLoginTokenAuthWithOptions[ID](append(viperOptions(v), opts...)...)
+	return a, viperConfigError(v, err)
+}
+
+// NewLoginTokenAuthWithOptions configures and returns a LoginToken authentication instance for accounts identified by ID
+// using only the provided options.
+func NewLoginTokenAuthWithOptions[ID comparable](opts ...Option) (*LoginTokenAuth[ID], error) {
+	a := &LoginTokenAuth[ID]{
+		config: defaultConfig(),
+		store:  NewMemoryStore[ID](),
+	}
+	for _, opt := range opts {
+		opt(&a.config)
+	}
+	if err := a.config.validate(); err != nil {
+		return nil, err
+	}
+
+	if a.config.store != nil && a.maxStoreSize > 0 {
+		return nil, errors.New("max store size only applies to the default memory store")
+	}
+	if a.config.store == nil && a.fallback {
+		return nil, errors.New("fallback only applies to a store set by WithStore")
+	}
+	if a.maxStoreSize > 0 {
+		a.store = NewBoundedMemoryStore[ID](a.maxStoreSize)
+	}
+	if a.config.store != nil {
+		s, ok := a.config.store.(TokenStore[ID])
+		if !ok {
+			var id ID
+			return nil, fmt.Errorf("token store %T does not support account ID type %T", a.config.store, id)
+		}
+		a.store = s
+	}
+	if _, ok := a.store.(sizer); a.pressureMax > 0 && !ok {
+		return nil, fmt.Errorf("memory pressure does not apply to token store %T", a.store)
+	}
+	if a.config.hooks != nil {
+		h, ok := a.config.hooks.(Hooks[ID])
+		if !ok {
+			var id ID
+			return nil, fmt.Errorf("hooks %T do not support account ID type %T", a.config.hooks, id)
+		}
+		a.hooks = h
+	}
+	if a.config.issuer != nil {
+		i, ok := a.config.issuer.(JWTIssuer[ID])
+		if !ok {
+			var id ID
+			return nil, fmt.Errorf("jwt issuer %T does not support account ID type %T", a.config.issuer, id)
+		}
+		a.issuer = i
+	}
+	if a.config.accountSecret != nil {
+		f, ok := a.config.accountSecret.(AccountSecretFunc[ID])
+		if !ok {
+			var id ID
+			return nil, fmt.Errorf("account secret func %T does not support account ID type %T", a.config.accountSecret, id)
+		}
+		a.secretFn = f
+	}
+	if a.config.auditor != nil {
+		au, ok := a.config.auditor.(Auditor[ID])
+		if !ok {
+			var id ID
+			return nil, fmt.Errorf("auditor %T does not support account ID type %T", a.config.auditor, id)
+		}
+		a.auditor = au
+	}
+	if a.config.accountUpdater != nil {
+		u, ok := a.config.accountUpdater.(AccountUpdater[ID])
+		if !ok {
+			var id ID
+			return nil, fmt.Errorf("account updater %T does not support account ID type %T", a.config.accountUpdater, id)
+		}
+		a.updater = u
+	}
+	if a.config.sessionStore != nil {
+		ss, ok := a.config.sessionStore.(SessionStore[ID])
+		if !ok {
+			var id ID
+			return nil, fmt.Errorf("session store %T does not support account ID type %T", a.config.sessionStore, id)
+		}
+		a.sessions = ss
+	}
+	if a.config.localeFunc != nil {
+		f, ok := a.config.localeFunc.(LocaleFunc[ID])
+		if !ok {
+			var id ID
+			return nil, fmt.Errorf("locale func %T does not support account ID type %T", a.config.localeFunc, id)
+		}
+		a.localeFunc = f
+	}
+	if a.config.activity != nil {
+		t, ok := a.config.activity.(*AccountActivity[ID])
+		if !ok {
+			var id ID
+			return nil, fmt.Errorf("account activity %T does not support account ID type %T", a.config.activity, id)
+		}
+		a.activity = t
+	}
+	a.evictBefore = evictSoonestExpiring[ID]
+	if a.config.evictionPolicy != nil {
+		p, ok := a.config.evictionPolicy.(EvictionPolicy[ID])
+		if !ok {
+			var id ID
+			return nil, fmt.Errorf("eviction policy %T does not support account ID type %T", a.config.evictionPolicy, id)
+		}
+		a.evictBefore = p
+	}
+	a.validators = []Validator[ID]{a.validateExpiry, a.validateFingerprint, validateScope[ID]}
+	if a.consumeDelay > 0 {
+		a.validators = append(a.validators, a.validateConsumeDelay)
+	}
+	if a.config.validators != nil {
+		vs, ok := a.config.validators.([]Validator[ID])
+		if !ok {
+			var id ID
+			return nil, fmt.Errorf("validators %T do not support account ID type %T", a.config.validators, id)
+		}
+		a.validators = append(a.validators, vs...)
+	}
+	if a.config.notifier != nil {
+		n, ok := a.config.notifier.(Notifier[ID])
+		if !ok {
+			var id ID
+			return nil, fmt.Errorf("notifier %T does not support account ID type %T", a.config.notifier, id)
+		}
+		a.notifier = n
+	}
+	if a.config.loginURLFunc != nil {
+		f, ok := a.config.loginURLFunc.(LoginURLFunc[ID])
+		if !ok {
+			var id ID
+			return nil, fmt.Errorf("login url func %T does not support account ID type %T", a.config.loginURLFunc, id)
+		}
+		a.urlFunc = f
+	}
+	if a.registry != nil {
+		a.metrics = NewMetrics()
+	}
+	if ms, ok := a.store.(*MemoryStore[ID]); ok && a.metrics != nil {
+		ms.mux.Lock()
+		ms.onEvict = a.metrics.incEvicted
+		ms.mux.Unlock()
+	}
+	if rs, ok := a.store.(*RedisStore[ID]); ok {
+		rs.clock = a.clock
+	}
+	if a.tracerProvider != nil {
+		a.tracer = a.tracerProvider.Tracer(tracerName)
+	}
+	if a.logger == nil {
+		a.logger = discardLogger
+	}
+	if a.fallback {
+		fs := NewFallbackStore(a.store)
+		fs.metrics = a.metrics
+		fs.logger = a.logger
+		fs.clock = a.clock
+		a.store = fs
+	}
+	if e := a.Entropy(); e > 0 && e < recommendedEntropy {
+		a.logWeakEntropy(e)
+	}
+	switch {
+	case a.rateLimit > 0 && a.rateLimitStore != nil:
+		a.shared = &sharedRateLimiter[ID]{store: a.rateLimitStore, limit: a.rateLimit, window: a.rateWindow}
+	case a.rateLimit > 0:
+		a.limiter = newRateLimiter[ID](a.rateLimit, a.rateWindow)
+	}
+	if a.attemptLimit > 0 {
+		a.attempts = newAttemptLimiter(a.attemptLimit, a.attemptBackoff)
+	}
+	a.codes = newAttemptLimiter(maxCodeAttempts, a.loginTokenExpiry)
+	if a.dataKey != "" {
+		c, err := newDataCipher(a.dataKey)
+		if err != nil {
+			return nil, err
+		}
+		a.dataCipher = c
+	}
+	if a.registry != nil {
+		if err := a.registry.Register(a.metrics); err != nil {
+			return nil, fmt.Errorf("registering login token metrics: %w", err)
+		}
+	}
+	if a.webhookURL != "" {
+		a.webhook = newWebhook(a.webhookURL, a.webhookClient, a.webhookOnCreate, a.metrics.incWebhookDropped)
+		a.webhook.start()
 	}
 	return a, nil
 }
 
-// CreateToken creates an in-memory login token referencing account ID. It returns a token containing a random tokenstring and expiry date.
-func (a *LoginTokenAuth) CreateToken(id int) LoginToken {
-	lt := LoginToken{
-		Token:     randStringBytes(a.loginTokenLength),
-		AccountID: id,
-		Expiry:    time.Now().Add(a.loginTokenExpiry),
+// CreateToken creates a login token referencing account ID. It returns a token containing a random tokenstring and expiry date.
+// Only a hash of the tokenstring is saved to the store. With WithServerRelayOnly the returned token carries
+// the hash instead of the tokenstring, see there.
+func (a *LoginTokenAuth[ID]) CreateToken(id ID) (LoginToken[ID], error) {
+	return a.CreateTokenContext(context.Background(), id)
+}
+
+// CreateTokenContext is like CreateToken, aborting the store operation when ctx is done.
+func (a *LoginTokenAuth[ID]) CreateTokenContext(ctx context.Context, id ID) (LoginToken[ID], error) {
+	return a.relayed(a.createToken(ctx, LoginToken[ID]{AccountID: id}, a.loginTokenExpiry))
+}
+
+// CreateTokenWithData is like CreateToken, attaching data to the token to be returned on consumption.
+func (a *LoginTokenAuth[ID]) CreateTokenWithData(id ID, data map[string]string) (LoginToken[ID], error) {
+	return a.relayed(a.createToken(context.Background(), LoginToken[ID]{AccountID: id, Data: data}, a.loginTokenExpiry))
+}
+
+// CreateReusableToken is like CreateToken, but the token is not consumed by GetAccountID and stays valid until expiry.
+func (a *LoginTokenAuth[ID]) CreateReusableToken(id ID) (LoginToken[ID], error) {
+	return a.relayed(a.createToken(context.Background(), LoginToken[ID]{AccountID: id, Reusable: true}, a.loginTokenExpiry))
+}
+
+// CreateReusableTokenWithIdle is like CreateReusableToken, but the token expires after absolute or once not consumed
+// for idle, whichever comes first. Every consumption resets the idle timeout. An absolute of 0 uses the configured
+// expiry, idle has to be positive. Idle expired tokens are removed once consumed or the absolute expiry passed.
+func (a *LoginTokenAuth[ID]) CreateReusableTokenWithIdle(id ID, absolute, idle time.Duration) (LoginToken[ID], error) {
+	ttl, err := a.expiry(absolute)
+	if err != nil {
+		return LoginToken[ID]{}, err
+	}
+	if idle <= 0 {
+		return LoginToken[ID]{}, fmt.Errorf("login token idle timeout %s must be positive", idle)
+	}
+	return a.relayed(a.createToken(context.Background(), LoginToken[ID]{AccountID: id, Reusable: true, IdleTimeout: idle}, ttl))
+}
+
+// CreateTokenWithUses is like CreateToken, but the token can be consumed by GetAccountID maxUses times before it
+// is removed, e.g. for links shared by a household. A maxUses of 0 or 1 creates a single use token.
+func (a *LoginTokenAuth[ID]) CreateTokenWithUses(id ID, maxUses int) (LoginToken[ID], error) {
+	if maxUses < 0 {
+		return LoginToken[ID]{}, fmt.Errorf("login token max uses %d must not be negative", maxUses)
+	}
+	return a.relayed(a.createToken(context.Background(), LoginToken[ID]{AccountID: id, MaxUses: maxUses}, a.loginTokenExpiry))
+}
+
+// CreateTokenBound is like CreateToken, but binds the token to fingerprint, an opaque value identifying the requesting
+// client like the one returned by Fingerprint. Bound tokens can only be consumed by GetAccountIDBound and looked up
+// by PeekBound with the same fingerprint.
+// An empty fingerprint creates an unbound token.
+func (a *LoginTokenAuth[ID]) CreateTokenBound(id ID, fingerprint string) (LoginToken[ID], error) {
+	lt := LoginToken[ID]{AccountID: id}
+	if fingerprint != "" {
+		lt.Fingerprint = a.hashToken(fingerprint)
+	}
+	return a.relayed(a.createToken(context.Background(), lt, a.loginTokenExpiry))
+}
+
+// CreateScopedToken is like CreateToken, but creates the token for the action scope, e.g. "delete-account",
+// so a link minted for one action does not authorize another. Scoped tokens can only be consumed by
+// GetAccountIDForScope with the same scope. An empty scope creates a login token.
+func (a *LoginTokenAuth[ID]) CreateScopedToken(id ID, scope string) (LoginToken[ID], error) {
+	return a.relayed(a.createToken(context.Background(), LoginToken[ID]{AccountID: id, Scope: scope}, a.loginTokenExpiry))
+}
+
+// CreateTokenWithExpiry is like CreateToken, but the token expires after ttl instead of the configured expiry.
+// A ttl of 0 uses the configured expiry, a negative ttl returns an error.
+func (a *LoginTokenAuth[ID]) CreateTokenWithExpiry(id ID, ttl time.Duration) (LoginToken[ID], error) {
+	ttl, err := a.expiry(ttl)
+	if err != nil {
+		return LoginToken[ID]{}, err
+	}
+	return a.relayed(a.createToken(context.Background(), LoginToken[ID]{AccountID: id}, ttl))
+}
+
+// relayed returns lt with its tokenstring replaced by the reference it is stored by if WithServerRelayOnly is set.
+func (a *LoginTokenAuth[ID]) relayed(lt LoginToken[ID], err error) (LoginToken[ID], error) {
+	if err != nil || !a.relayOnly {
+		return lt, err
 	}
-	a.add(lt)
-	a.purgeExpired()
-	return lt
+	lt.Token = a.hashToken(lt.Token)
+	return lt, nil
 }
 
-// GetAccountID looks up the token by tokenstring and returns the account ID or error if token not found or expired.
-func (a *LoginTokenAuth) GetAccountID(token string) (int, error) {
-	lt, exists := a.get(token)
-	if !exists || time.Now().After(lt.Expiry) {
-		return 0, errTokenNotFound
+// expiry returns ttl, or the configured expiry if ttl is 0 and an error if ttl is negative.
+func (a *LoginTokenAuth[ID]) expiry(ttl time.Duration) (time.Duration, error) {
+	if ttl < 0 {
+		return 0, fmt.Errorf("login token expiry %s must be positive", ttl)
 	}
-	a.delete(lt.Token)
-	return lt.AccountID, nil
+	if ttl == 0 {
+		return a.loginTokenExpiry, nil
+	}
+	return ttl, nil
 }
 
-func (a *LoginTokenAuth) get(token string) (LoginToken, bool) {
-	a.mux.RLock()
-	lt, ok := a.token[token]
-	a.mux.RUnlock()
-	return lt, ok
+// jitter returns a random duration between 0 and the configured expiry jitter.
+func (a *LoginTokenAuth[ID]) jitter() time.Duration {
+	if a.expiryJitter <= 0 {
+		return 0
+	}
+	return time.Duration(mathrand.Int63n(int64(a.expiryJitter) + 1))
 }
 
-func (a *LoginTokenAuth) add(lt LoginToken) {
-	a.mux.Lock()
-	a.token[lt.Token] = lt
-	a.mux.Unlock()
+// createToken saves lt with a random tokenstring and expiring after ttl.
+// It returns ErrRateLimited if the account exceeded the configured token rate limit.
+func (a *LoginTokenAuth[ID]) createToken(ctx context.Context, lt LoginToken[ID], ttl time.Duration) (LoginToken[ID], error) {
+	return a.issue(ctx, lt, ttl, a.newToken)
 }
 
-func (a *LoginTokenAuth) delete(token string) {
-	a.mux.Lock()
-	delete(a.token, token)
-	a.mux.Unlock()
+// newToken returns a random tokenstring, or one by the configured generator, and the key it is stored by.
+func (a *LoginTokenAuth[ID]) newToken(ID) (string, string, error) {
+	var token string
+	if a.tokenGenerator != nil {
+		if token = a.tokenGenerator(); token == "" {
+			return "", "", errors.New("login token generator returned empty tokenstring")
+		}
+	} else {
+		var err error
+		if token, err = randStringBytes(a.randSource, a.loginTokenLength, a.alphabet); err != nil {
+			return "", "", err
+		}
+	}
+	token = a.tokenPrefix + token
+	return token, a.hashToken(token), nil
 }
 
-func (a *LoginTokenAuth) purgeExpired() {
-	for t, v := range a.token {
-		if time.Now().After(v.Expiry) {
-			a.delete(t)
+// recommendedEntropy is the entropy in bits of generated tokenstrings below which a warning is logged on construction.
+const recommendedEntropy = 128
+
+// Entropy returns the entropy in bits of generated tokenstrings, computed from token length and alphabet size,
+// to reason about their brute force resistance. The prefix adds no entropy. It returns 0 with a token generator
+// set by WithTokenGenerator, as its entropy is unknown.
+func (a *LoginTokenAuth[ID]) Entropy() float64 {
+	if a.tokenGenerator != nil {
+		return 0
+	}
+	return float64(a.loginTokenLength) * math.Log2(float64(len(a.alphabet)))
+}
+
+// maxCollisionRetries is the number of times issue generates a new tokenstring if the store reports a collision.
+const maxCollisionRetries = 3
+
+// issue saves lt for account lt.AccountID expiring after ttl with the tokenstring and store key returned by gen.
+func (a *LoginTokenAuth[ID]) issue(ctx context.Context, lt LoginToken[ID], ttl time.Duration, gen func(ID) (string, string, error)) (_ LoginToken[ID], err error) {
+	if a.closed.Load() {
+		return LoginToken[ID]{}, ErrClosed
+	}
+	ctx, span := a.startSpan(ctx, "pwdless.CreateToken")
+	defer func() { endSpan(span, err) }()
+
+	lt, stored, err := a.prepare(ctx, lt, ttl, a.clock(), gen, nil)
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrTooManyTokens) {
+		a.metrics.incLimited()
+	}
+	if err != nil {
+		return LoginToken[ID]{}, err
+	}
+	// Retry with new tokenstrings if the store already has the token for another account.
+	for i := 0; ; i++ {
+		var sealed LoginToken[ID]
+		if sealed, err = a.sealData(stored); err != nil {
+			return LoginToken[ID]{}, err
+		}
+		err = a.store.Save(ctx, sealed)
+		if err != errTokenCollision || i == maxCollisionRetries {
+			break
 		}
+		if lt, stored, err = a.rekey(lt, gen); err != nil {
+			return LoginToken[ID]{}, err
+		}
+	}
+	if err != nil {
+		return LoginToken[ID]{}, err
 	}
+	a.created(ctx, stored)
+	return lt, nil
 }
 
-const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+// prepare checks the limits of account lt.AccountID and returns lt created at now, carrying the tokenstring
+// returned by gen, and its copy to be stored by key. Rate limit events and evicted tokens are recorded to u.
+func (a *LoginTokenAuth[ID]) prepare(ctx context.Context, lt LoginToken[ID], ttl time.Duration, now time.Time, gen func(ID) (string, string, error), u *batchUndo[ID]) (LoginToken[ID], LoginToken[ID], error) {
+	if a.limiter != nil {
+		if !a.limiter.allow(lt.AccountID, now) {
+			return LoginToken[ID]{}, LoginToken[ID]{}, ErrRateLimited
+		}
+		u.limit(lt.AccountID, false)
+	}
+	if a.shared != nil {
+		ok, err := a.shared.allow(ctx, lt.AccountID)
+		if err != nil {
+			return LoginToken[ID]{}, LoginToken[ID]{}, err
+		}
+		u.limit(lt.AccountID, true)
+		if !ok {
+			return LoginToken[ID]{}, LoginToken[ID]{}, ErrRateLimited
+		}
+	}
+	if a.maxPerAccount > 0 {
+		if err := a.limitAccountTokens(ctx, lt.AccountID, now, u); err != nil {
+			return LoginToken[ID]{}, LoginToken[ID]{}, err
+		}
+	}
+	if err := a.relievePressure(ctx, now, u); err != nil {
+		return LoginToken[ID]{}, LoginToken[ID]{}, err
+	}
+	lt.Created = now
+	lt.Expiry = now.Add(ttl + a.jitter())
+	lt.Data = copyData(lt.Data)
+	return a.rekey(lt, gen)
+}
 
-func randStringBytes(n int) string {
-	buf := make([]byte, n)
-	if _, err := rand.Read(buf); err != nil {
-		panic(err)
+// rekey sets a new tokenstring generated by gen, returning the token and the token to store like prepare.
+func (a *LoginTokenAuth[ID]) rekey(lt LoginToken[ID], gen func(ID) (string, string, error)) (LoginToken[ID], LoginToken[ID], error) {
+	token, key, err := gen(lt.AccountID)
+	if err != nil {
+		return LoginToken[ID]{}, LoginToken[ID]{}, err
+	}
+	lt.Token = token
+
+	stored := lt
+	stored.Token = key
+	if stored.AccountHash, err = a.accountHash(lt.AccountID, token); err != nil {
+		return LoginToken[ID]{}, LoginToken[ID]{}, err
+	}
+	return lt, stored, nil
+}
+
+// created counts and reports the saved token stored.
+func (a *LoginTokenAuth[ID]) created(ctx context.Context, stored LoginToken[ID]) {
+	a.metrics.incCreated()
+	a.stats.create()
+	a.hooks.onCreate(stored)
+	a.activity.issue(stored.AccountID, stored.Created)
+	a.webhook.send("create", stored.AccountID, stored.Created)
+	a.logCreated(ctx, stored)
+}
+
+// limitAccountTokens makes room for a new token if account ID reached the configured maximum of active tokens
+// by removing its oldest tokens, or returns ErrTooManyTokens if eviction is disabled.
+// The limit is not enforced atomically, concurrent creation may exceed it. Evicted tokens are recorded to u.
+func (a *LoginTokenAuth[ID]) limitAccountTokens(ctx context.Context, id ID, now time.Time, u *batchUndo[ID]) error {
+	tokens, err := a.store.List(ctx, id, now)
+	if err != nil {
+		return err
+	}
+	tokens = withoutRecoveryCodes(tokens)
+	excess := len(tokens) - a.maxPerAccount + 1
+	if excess <= 0 {
+		return nil
+	}
+	if !a.evictOldest {
+		return ErrTooManyTokens
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Created.Before(tokens[j].Created) })
+	for _, lt := range tokens[:excess] {
+		if err := a.store.Delete(ctx, lt.Token); err != nil {
+			return err
+		}
+		u.evict(lt)
+	}
+	return nil
+}
+
+// GetAccountID looks up the token by tokenstring and returns the account ID,
+// or ErrTokenNotFound if token does not exist and ErrTokenExpired if it is past its expiry.
+// Tokens created in the future beyond the tolerance set by WithFutureTolerance are rejected as well.
+// Errors carry the redacted hashed tokenstring logged for the token, and are checked with errors.Is.
+func (a *LoginTokenAuth[ID]) GetAccountID(token string) (ID, error) {
+	lt, err := a.Consume(token)
+	return lt.AccountID, err
+}
+
+// Consume is like GetAccountID, returning the whole consumed token with its expiry, creation time and data
+// instead of the account ID only, with Token set to the tokenstring.
+func (a *LoginTokenAuth[ID]) Consume(token string) (LoginToken[ID], error) {
+	lt, err := a.consume(context.Background(), token, "", "", "")
+	if err != nil {
+		return LoginToken[ID]{}, err
+	}
+	lt.Token = token
+	return lt, nil
+}
+
+// GetAccountIDContext is like GetAccountID, aborting the store operations when ctx is done.
+func (a *LoginTokenAuth[ID]) GetAccountIDContext(ctx context.Context, token string) (ID, error) {
+	lt, err := a.consume(ctx, token, "", "", "")
+	return lt.AccountID, err
+}
+
+// GetAccountIDFrom is like GetAccountIDContext, counting invalid tokens against source, e.g. the client IP,
+// if brute force protection is enabled. It returns ErrTooManyAttempts while source is locked out.
+func (a *LoginTokenAuth[ID]) GetAccountIDFrom(ctx context.Context, token, source string) (ID, error) {
+	lt, err := a.consume(ctx, token, "", "", source)
+	return lt.AccountID, err
+}
+
+// GetAccountIDWithData is like GetAccountID, additionally returning the data attached to the token.
+func (a *LoginTokenAuth[ID]) GetAccountIDWithData(token string) (ID, map[string]string, error) {
+	lt, err := a.consume(context.Background(), token, "", "", "")
+	return lt.AccountID, lt.Data, err
+}
+
+// GetAccountIDForScope is like GetAccountID, but consumes tokens created by CreateScopedToken for scope only,
+// returning ErrScopeMismatch for tokens of other scopes and login tokens. Mismatching tokens are not consumed.
+// GetAccountID and the other consuming methods only accept login tokens.
+func (a *LoginTokenAuth[ID]) GetAccountIDForScope(token, scope string) (ID, error) {
+	lt, err := a.consume(context.Background(), token, "", scope, "")
+	return lt.AccountID, err
+}
+
+// GetAccountIDBound is like GetAccountID, but returns ErrFingerprintMismatch if the token is bound to a fingerprint
+// other than fingerprint. Unbound tokens are accepted regardless of fingerprint.
+// With brute force protection enabled invalid tokens are counted against fingerprint.
+func (a *LoginTokenAuth[ID]) GetAccountIDBound(token, fingerprint string) (ID, error) {
+	lt, err := a.consume(context.Background(), token, fingerprint, "", fingerprint)
+	return lt.AccountID, err
+}
+
+// Fingerprint returns an opaque fingerprint of a client identified by ip and userAgent for use with CreateTokenBound.
+func Fingerprint(ip, userAgent string) string {
+	sum := sha256.Sum256([]byte(ip + "\x00" + userAgent))
+	return hex.EncodeToString(sum[:])
+}
+
+// Peek looks up the token by tokenstring and returns the account ID or error if token not found or expired.
+// Unlike GetAccountID the token is not consumed, so Peek is safe to call repeatedly.
+// Tokens created by CreateTokenBound return ErrFingerprintMismatch, use PeekBound for them.
+func (a *LoginTokenAuth[ID]) Peek(token string) (ID, error) {
+	return a.PeekBound(token, "")
+}
+
+// PeekBound is like Peek, but accepts tokens bound to fingerprint like GetAccountIDBound.
+func (a *LoginTokenAuth[ID]) PeekBound(token, fingerprint string) (ID, error) {
+	lt, err := a.lookupBound(context.Background(), token, fingerprint)
+	return lt.AccountID, err
+}
+
+// RemainingUses returns how often the token by tokenstring can still be consumed, or ErrTokenNotFound and
+// ErrTokenExpired like GetAccountID. Reusable tokens, not being limited, return -1. The token is not consumed.
+func (a *LoginTokenAuth[ID]) RemainingUses(token string) (int, error) {
+	lt, err := a.lookup(context.Background(), token)
+	if err != nil {
+		return 0, err
+	}
+	if lt.Reusable {
+		return -1, nil
+	}
+	if !lt.Consumed.IsZero() {
+		return 0, nil
 	}
+	return max(lt.MaxUses, 1) - lt.Uses, nil
+}
+
+// VerifyFunc returns a function verifying tokens like Peek, e.g. to plug into bearer authentication middleware.
+// The returned function does not consume tokens, so it accepts the same token until it expires or is consumed.
+func (a *LoginTokenAuth[ID]) VerifyFunc() func(token string) (ID, error) {
+	return a.Peek
+}
 
-	for k, v := range buf {
-		buf[k] = letterBytes[v%byte(len(letterBytes))]
+// TTL returns the remaining validity of the token by tokenstring, computed as lt.Expiry.Sub(now) using the configured clock,
+// or ErrTokenNotFound and ErrTokenExpired like GetAccountID. The token is not consumed, so the duration can be used
+// to render a countdown until the login link expires.
+func (a *LoginTokenAuth[ID]) TTL(token string) (time.Duration, error) {
+	lt, err := a.lookup(context.Background(), token)
+	if err != nil {
+		return 0, err
+	}
+	return lt.Expiry.Sub(a.clock()), nil
+}
+
+// lookup returns the stored token by tokenstring if found and not expired.
+// Presenting a token superseded by ConsumeAndRotate revokes its family, see checkRotated.
+func (a *LoginTokenAuth[ID]) lookup(ctx context.Context, token string) (LoginToken[ID], error) {
+	lt, err := a.find(ctx, token)
+	if err != nil {
+		return lt, err
+	}
+	if err := a.checkRotated(ctx, lt); err != nil {
+		return LoginToken[ID]{}, err
+	}
+	return lt, nil
+}
+
+// lookupBound is like lookup, returning ErrFingerprintMismatch if the token is bound to a fingerprint other than fingerprint.
+func (a *LoginTokenAuth[ID]) lookupBound(ctx context.Context, token, fingerprint string) (LoginToken[ID], error) {
+	lt, err := a.lookup(ctx, token)
+	if err != nil {
+		return lt, err
+	}
+	if err := a.validateFingerprint(lt, ConsumeRequest{Fingerprint: fingerprint}); err != nil {
+		return LoginToken[ID]{}, err
+	}
+	return lt, nil
+}
+
+// lookupIssued is like lookup for tokens looked up again by this instance after issuing them, not presented
+// by clients, returning ErrTokenNotFound for superseded tokens without revoking their family.
+func (a *LoginTokenAuth[ID]) lookupIssued(ctx context.Context, token string) (LoginToken[ID], error) {
+	lt, err := a.find(ctx, token)
+	if err == nil && !lt.Rotated.IsZero() {
+		return LoginToken[ID]{}, ErrTokenNotFound
+	}
+	return lt, err
+}
+
+// find returns the stored token by tokenstring if well formed, found, not expired, not created in the future
+// and matching its account hash.
+func (a *LoginTokenAuth[ID]) find(ctx context.Context, token string) (LoginToken[ID], error) {
+	lt, err := a.findAny(ctx, token)
+	if err != nil {
+		return LoginToken[ID]{}, err
+	}
+	if err := a.validateExpiry(lt, ConsumeRequest{Now: a.clock()}); err != nil {
+		return LoginToken[ID]{}, err
+	}
+	return lt, nil
+}
+
+// findAny is like find regardless of expiry, for consumption checking it by the validators.
+func (a *LoginTokenAuth[ID]) findAny(ctx context.Context, token string) (LoginToken[ID], error) {
+	if a.closed.Load() {
+		return LoginToken[ID]{}, ErrClosed
+	}
+	if err := a.checkPrefix(token); err != nil {
+		return LoginToken[ID]{}, err
+	}
+	if a.wellFormedCheck && !a.WellFormed(token) {
+		return LoginToken[ID]{}, ErrTokenNotFound
+	}
+	lt, err := a.getAny(ctx, a.hashToken(token))
+	if err != nil {
+		return LoginToken[ID]{}, err
+	}
+	if lt.Created.After(a.clock().Add(a.futureTolerance)) {
+		return LoginToken[ID]{}, errTokenFromFuture
+	}
+	return lt, a.verifyAccount(lt, token)
+}
+
+// accountHash returns token hashed by the secret of account id, empty without AccountSecretFunc.
+func (a *LoginTokenAuth[ID]) accountHash(id ID, token string) (string, error) {
+	if a.secretFn == nil {
+		return "", nil
+	}
+	secret, err := a.secretFn(id)
+	if err != nil {
+		return "", err
+	}
+	return macToken(secret, token), nil
+}
+
+// verifyAccount returns ErrTokenNotFound if the stored token lt was not hashed by the current secret of its account.
+func (a *LoginTokenAuth[ID]) verifyAccount(lt LoginToken[ID], token string) error {
+	if a.secretFn == nil {
+		return nil
+	}
+	h, err := a.accountHash(lt.AccountID, token)
+	if err != nil {
+		return err
+	}
+	if !secureEqual(lt.AccountHash, h) {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// get returns the stored token by store key if found and not expired.
+func (a *LoginTokenAuth[ID]) get(ctx context.Context, key string) (LoginToken[ID], error) {
+	lt, err := a.getAny(ctx, key)
+	if err != nil {
+		return LoginToken[ID]{}, err
+	}
+	if err := a.validateExpiry(lt, ConsumeRequest{Now: a.clock()}); err != nil {
+		return LoginToken[ID]{}, err
+	}
+	return lt, nil
+}
+
+// getAny is like get regardless of expiry.
+func (a *LoginTokenAuth[ID]) getAny(ctx context.Context, key string) (LoginToken[ID], error) {
+	lt, exists, err := a.store.Get(ctx, key)
+	if err != nil {
+		return LoginToken[ID]{}, err
+	}
+	// Stores may match keys loosely, e.g. by case insensitive collation, so verify the returned token.
+	if !exists || !secureEqual(lt.Token, key) {
+		return LoginToken[ID]{}, ErrTokenNotFound
+	}
+	return a.openData(lt)
+}
+
+// WellFormed reports whether token could have been generated by the LoginTokenAuth: it has to carry the configured
+// prefix and, unless set by WithTokenGenerator, consist of the configured number of characters of the alphabet.
+// Tokens not well formed are rejected on lookup without accessing the store, reducing the store load of brute
+// force attempts, unless disabled by WithWellFormedCheck.
+func (a *LoginTokenAuth[ID]) WellFormed(token string) bool {
+	if !strings.HasPrefix(token, a.tokenPrefix) {
+		return false
+	}
+	if a.tokenGenerator != nil {
+		return true
+	}
+	token = token[len(a.tokenPrefix):]
+	if len(token) != a.loginTokenLength {
+		return false
+	}
+	for i := 0; i < len(token); i++ {
+		if strings.IndexByte(a.alphabet, token[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPrefix returns ErrTokenPrefix if token does not start with the configured prefix.
+func (a *LoginTokenAuth[ID]) checkPrefix(token string) error {
+	if !strings.HasPrefix(token, a.tokenPrefix) {
+		return ErrTokenPrefix
+	}
+	return nil
+}
+
+// consume looks up the token by tokenstring, returning the stored token if found and accepted by the validators,
+// which check it is not expired, created for scope and bound to fingerprint if bound at all. Tokens not being reusable are deleted, as are expired tokens unless disabled.
+// Invalid tokens are counted against a non-empty source. Errors are wrapped with the hashed tokenstring redacted
+// to its last 4 characters, matching the token logged, to be checked with errors.Is.
+func (a *LoginTokenAuth[ID]) consume(ctx context.Context, token, fingerprint, scope, source string) (_ LoginToken[ID], err error) {
+	defer a.pad(ctx, time.Now())
+	ctx, span := a.startSpan(ctx, "pwdless.GetAccountID")
+	var id ID
+	defer func() {
+		span.SetAttributes(attribute.Bool("pwdless.hit", err == nil))
+		endSpan(span, err)
+		if err != nil && err != ErrClosed {
+			a.stats.failed.Add(1)
+			a.logFailure(ctx, a.hashToken(token), err)
+		}
+		a.audit(a.hashToken(token), id, source, err)
+		if err != nil && err != ErrClosed {
+			err = fmt.Errorf("consume failed for token %s: %w", redactToken(a.hashToken(token)), err)
+		}
+	}()
+
+	if a.attempts != nil && source != "" {
+		if !a.attempts.allow(source, a.clock()) {
+			return LoginToken[ID]{}, ErrTooManyAttempts
+		}
+		defer func() {
+			switch {
+			case err == nil:
+				a.attempts.reset(source)
+			case invalidToken(err):
+				a.attempts.fail(source, a.clock())
+			}
+		}()
+	}
+
+	lt, err := a.findAny(ctx, token)
+	if err == nil {
+		found := lt
+		lt, err = a.accept(ctx, lt, ConsumeRequest{Fingerprint: fingerprint, Scope: scope, Source: source, Now: a.clock()})
+		// expired tokens are audited like tokens not found
+		if err != ErrTokenExpired && err != ErrTokenNotFound {
+			id = found.AccountID
+		}
+	}
+	switch err {
+	case nil:
+	case ErrTokenNotFound:
+		a.metrics.incConsumeNotFound()
+		return LoginToken[ID]{}, err
+	case ErrTokenExpired:
+		a.metrics.incConsumeExpired()
+		if a.deleteExpired {
+			a.deleteExpiredToken(ctx, token)
+		}
+		return LoginToken[ID]{}, err
+	default:
+		return LoginToken[ID]{}, err
+	}
+	return a.redeem(ctx, lt)
+}
+
+// accept returns the stored token lt if accepted by the validators, not revoking the family of expired tokens
+// superseded by ConsumeAndRotate as they are rejected first, see checkRotated.
+func (a *LoginTokenAuth[ID]) accept(ctx context.Context, lt LoginToken[ID], req ConsumeRequest) (LoginToken[ID], error) {
+	if err := a.validate(lt, req); err != nil {
+		return LoginToken[ID]{}, err
+	}
+	if err := a.checkRotated(ctx, lt); err != nil {
+		return LoginToken[ID]{}, err
+	}
+	return lt, nil
+}
+
+// deleteExpiredToken removes the expired token by tokenstring on access instead of waiting for the next purge,
+// counting it as purged if configured. Failures are ignored as the token stays unusable and is removed by the purge later.
+func (a *LoginTokenAuth[ID]) deleteExpiredToken(ctx context.Context, token string) {
+	key := a.hashToken(token)
+	var lt LoginToken[ID]
+	if a.countAccessExp {
+		var ok bool
+		var err error
+		if lt, ok, err = a.store.Get(ctx, key); err != nil || !ok {
+			return
+		}
+	}
+	if err := a.store.Delete(ctx, key); err != nil {
+		return
+	}
+	a.stats.active.Add(-1)
+	if a.countAccessExp {
+		a.expired([]LoginToken[ID]{lt})
+	}
+}
+
+// pad sleeps until the configured minimum lookup duration passed since start or ctx is done.
+func (a *LoginTokenAuth[ID]) pad(ctx context.Context, start time.Time) {
+	d := a.minLookup - time.Since(start)
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// redeem deletes the stored token lt unless reusable or having uses left, counting it as consumed.
+// With a consume grace period single use tokens are marked consumed instead, and consuming them again
+// within the grace period returns the token without counting it again.
+func (a *LoginTokenAuth[ID]) redeem(ctx context.Context, lt LoginToken[ID]) (LoginToken[ID], error) {
+	if !lt.Consumed.IsZero() {
+		return lt, nil
+	}
+	kept := lt.Reusable
+	switch {
+	case lt.Reusable && lt.IdleTimeout > 0:
+		lt.LastUsed = a.clock()
+		sealed, err := a.sealData(lt)
+		if err != nil {
+			return LoginToken[ID]{}, err
+		}
+		if err := a.store.Save(ctx, sealed); err != nil {
+			return LoginToken[ID]{}, err
+		}
+	case lt.Reusable:
+	case !a.consumeDeletes:
+		kept = true
+	case lt.MaxUses > 1:
+		var err error
+		if lt, kept, err = a.use(ctx, lt); err != nil {
+			return LoginToken[ID]{}, err
+		}
+	case a.consumeGrace > 0:
+		now := a.clock()
+		lt.Consumed = now
+		lt.Expiry = now.Add(a.consumeGrace)
+		sealed, err := a.sealData(lt)
+		if err != nil {
+			return LoginToken[ID]{}, err
+		}
+		if err := a.store.Save(ctx, sealed); err != nil {
+			return LoginToken[ID]{}, err
+		}
+	default:
+		if err := a.store.Delete(ctx, lt.Token); err != nil {
+			return LoginToken[ID]{}, err
+		}
+	}
+	a.redeemed(ctx, lt, kept)
+	return lt, nil
+}
+
+// burn deletes the stored single use code lt regardless of WithConsumeDeletes and WithConsumeGrace, which only
+// apply to login tokens, counting it as consumed.
+func (a *LoginTokenAuth[ID]) burn(ctx context.Context, lt LoginToken[ID]) error {
+	if err := a.store.Delete(ctx, lt.Token); err != nil {
+		return err
+	}
+	a.redeemed(ctx, lt, false)
+	return nil
+}
+
+// redeemed counts the token lt as consumed, kept reporting whether it is still stored.
+func (a *LoginTokenAuth[ID]) redeemed(ctx context.Context, lt LoginToken[ID], kept bool) {
+	a.metrics.incConsumed()
+	if !lt.Created.IsZero() {
+		a.metrics.observeConsumeAge(lt.Scope, a.clock().Sub(lt.Created))
+	}
+	a.stats.consume(kept)
+	a.hooks.onConsume(lt)
+	a.activity.consume(lt.AccountID, a.clock())
+	a.webhook.send("consume", lt.AccountID, a.clock())
+	a.logConsumed(ctx, lt)
+}
+
+// use counts a use of the stored token lt limited by MaxUses, deleting it once all uses are taken,
+// and returns the updated token and whether it is kept. The token is read again under a lock, so concurrent
+// consumptions by this instance count every use, while instances sharing a store may exceed the limit slightly.
+func (a *LoginTokenAuth[ID]) use(ctx context.Context, lt LoginToken[ID]) (LoginToken[ID], bool, error) {
+	a.usesMux.Lock()
+	defer a.usesMux.Unlock()
+	lt, err := a.get(ctx, lt.Token)
+	if err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	lt.Uses++
+	if lt.Uses >= lt.MaxUses {
+		return lt, false, a.store.Delete(ctx, lt.Token)
+	}
+	sealed, err := a.sealData(lt)
+	if err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	return lt, true, a.store.Save(ctx, sealed)
+}
+
+// ConsumeAndRotate consumes the token like GetAccountID and returns a new token for the same account expiring after newTTL,
+// e.g. for multi step login flows. A newTTL of 0 uses the configured expiry. The old token is only superseded after the
+// new token has been created, so it stays valid if creation fails.
+// Superseded tokens are kept until their expiry and share a family with the tokens rotated from them. Presenting
+// a superseded token again returns ErrTokenReuseDetected and revokes all tokens of its family, like refresh token
+// reuse detection, as the token may have been stolen.
+func (a *LoginTokenAuth[ID]) ConsumeAndRotate(token string, newTTL time.Duration) (id ID, _ LoginToken[ID], err error) {
+	defer func() { a.audit(a.hashToken(token), id, "", err) }()
+	ttl, err := a.expiry(newTTL)
+	if err != nil {
+		return id, LoginToken[ID]{}, err
+	}
+	ctx := context.Background()
+	old, err := a.findAny(ctx, token)
+	if err == nil {
+		old, err = a.accept(ctx, old, ConsumeRequest{Now: a.clock()})
+	}
+	if err != nil {
+		return id, LoginToken[ID]{}, err
+	}
+	if old.FamilyID == "" {
+		old.FamilyID = old.Token
+	}
+	lt, err := a.createToken(ctx, LoginToken[ID]{AccountID: old.AccountID, FamilyID: old.FamilyID}, ttl)
+	if err != nil {
+		return id, LoginToken[ID]{}, err
+	}
+	old.Rotated = a.clock()
+	sealed, err := a.sealData(old)
+	if err == nil {
+		err = a.store.Save(ctx, sealed)
+	}
+	if err != nil {
+		if rerr := a.store.Delete(ctx, a.hashToken(lt.Token)); rerr != nil {
+			return id, LoginToken[ID]{}, rerr
+		}
+		return id, LoginToken[ID]{}, err
+	}
+	a.metrics.incConsumed()
+	// the superseded token stays stored until its expiry
+	a.stats.consume(true)
+	a.hooks.onConsume(old)
+	a.activity.consume(old.AccountID, a.clock())
+	a.webhook.send("consume", old.AccountID, a.clock())
+	lt, _ = a.relayed(lt, nil)
+	return old.AccountID, lt, nil
+}
+
+// checkRotated returns ErrTokenReuseDetected if the stored token lt was superseded by ConsumeAndRotate,
+// revoking all tokens of its family.
+func (a *LoginTokenAuth[ID]) checkRotated(ctx context.Context, lt LoginToken[ID]) error {
+	if lt.Rotated.IsZero() {
+		return nil
+	}
+	tokens, err := a.store.List(ctx, lt.AccountID, a.clock().Add(-a.clockSkew))
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, t := range tokens {
+		if t.FamilyID != lt.FamilyID {
+			continue
+		}
+		if err := a.store.Delete(ctx, t.Token); err != nil {
+			return err
+		}
+		n++
+	}
+	a.stats.active.Add(-int64(n))
+	a.logReuseDetected(ctx, lt, n)
+	return ErrTokenReuseDetected
+}
+
+// Refresh sets the expiry of the token to ttl from now if it exists and is not expired, returning the updated token.
+// A ttl of 0 uses the configured expiry, a negative ttl returns an error. Missing or expired tokens return ErrTokenNotFound.
+func (a *LoginTokenAuth[ID]) Refresh(token string, ttl time.Duration) (LoginToken[ID], error) {
+	if a.closed.Load() {
+		return LoginToken[ID]{}, ErrClosed
+	}
+	ttl, err := a.expiry(ttl)
+	if err != nil {
+		return LoginToken[ID]{}, err
+	}
+	if err := a.checkPrefix(token); err != nil {
+		return LoginToken[ID]{}, err
+	}
+	now := a.clock()
+	lt, ok, err := a.store.Extend(context.Background(), a.hashToken(token), now, now.Add(ttl))
+	if err != nil {
+		return LoginToken[ID]{}, err
+	}
+	if !ok {
+		return LoginToken[ID]{}, ErrTokenNotFound
+	}
+	if lt, err = a.openData(lt); err != nil {
+		return LoginToken[ID]{}, err
+	}
+	lt.Token = token
+	return lt, nil
+}
+
+// LoginURLFunc returns the login url for a token, e.g. the login domain of the tenant the token was issued for.
+type LoginURLFunc[ID comparable] func(lt LoginToken[ID]) string
+
+// LoginURL returns the login url with the tokenstring added as query parameter, keeping existing query parameters.
+// The login url is resolved by the function set with WithLoginURLFunc, falling back to the configured login url.
+func (a *LoginTokenAuth[ID]) LoginURL(lt LoginToken[ID]) string {
+	u, _ := url.Parse(a.loginURL) // validated on construction
+	if a.urlFunc != nil {
+		if v, err := url.Parse(a.urlFunc(lt)); err == nil && v.String() != "" {
+			u = v
+		}
+	}
+	q := u.Query()
+	q.Set(a.loginTokenParam, lt.Token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// RevokeToken removes the token by tokenstring regardless of its expiry, returning error if token not found.
+func (a *LoginTokenAuth[ID]) RevokeToken(token string) error {
+	if a.closed.Load() {
+		return ErrClosed
+	}
+	if err := a.checkPrefix(token); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	key := a.hashToken(token)
+	_, exists, err := a.store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrTokenNotFound
+	}
+	return a.store.Delete(ctx, key)
+}
+
+// RevokeAllForAccount removes all login tokens referencing account ID and returns the number removed.
+func (a *LoginTokenAuth[ID]) RevokeAllForAccount(id ID) (int, error) {
+	if a.closed.Load() {
+		return 0, ErrClosed
+	}
+	return a.store.DeleteByAccount(context.Background(), id)
+}
+
+// Count returns the number of unexpired login tokens.
+func (a *LoginTokenAuth[ID]) Count() (int, error) {
+	if a.closed.Load() {
+		return 0, ErrClosed
+	}
+	return a.store.Count(context.Background(), a.clock())
+}
+
+// CountForAccount returns the number of unexpired login tokens referencing account ID.
+func (a *LoginTokenAuth[ID]) CountForAccount(id ID) (int, error) {
+	if a.closed.Load() {
+		return 0, ErrClosed
+	}
+	return a.store.CountForAccount(context.Background(), id, a.clock())
+}
+
+// HasPendingToken reports whether account ID has an unexpired login token and when the most recent one was created,
+// e.g. to tell users a login link was already sent. Tokens are neither consumed nor returned.
+func (a *LoginTokenAuth[ID]) HasPendingToken(id ID) (bool, time.Time, error) {
+	if a.closed.Load() {
+		return false, time.Time{}, ErrClosed
+	}
+	tokens, err := a.store.List(context.Background(), id, a.clock())
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	tokens = withoutRecoveryCodes(tokens)
+	var latest time.Time
+	for _, lt := range tokens {
+		if lt.Created.After(latest) {
+			latest = lt.Created
+		}
+	}
+	return len(tokens) > 0, latest, nil
+}
+
+// ListOptions controls the tokens returned by ListForAccount.
+type ListOptions struct {
+	// IncludeFull returns the full hashed tokenstrings instead of redacting them to their last 4 characters.
+	IncludeFull bool
+}
+
+// ListForAccount returns all unexpired login tokens referencing account ID ordered by creation, e.g. for support inspection.
+// As only hashed tokenstrings are stored, the returned Token is the redacted hash unless opts.IncludeFull is set.
+func (a *LoginTokenAuth[ID]) ListForAccount(id ID, opts ListOptions) ([]LoginToken[ID], error) {
+	tokens, err := a.list(id)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.IncludeFull {
+		redactTokens(tokens)
+	}
+	return tokens, nil
+}
+
+// ListForAccountPaged is like ListForAccount, returning the page of at most limit tokens starting at offset
+// with redacted tokenstrings and the total number of tokens of the account, e.g. for admin interfaces.
+// Tokens created at the same time are ordered by hashed tokenstring, so pages are stable across calls.
+// An offset beyond the last token returns an empty page.
+func (a *LoginTokenAuth[ID]) ListForAccountPaged(id ID, offset, limit int) ([]LoginToken[ID], int, error) {
+	if offset < 0 || limit <= 0 {
+		return nil, 0, fmt.Errorf("login token page offset %d must not be negative and limit %d must be positive", offset, limit)
+	}
+	tokens, err := a.list(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	total := len(tokens)
+	page := tokens[min(offset, total):min(offset+limit, total)]
+	redactTokens(page)
+	return page, total, nil
+}
+
+// list returns all unexpired tokens of account ID ordered by creation and hashed tokenstring.
+func (a *LoginTokenAuth[ID]) list(id ID) ([]LoginToken[ID], error) {
+	if a.closed.Load() {
+		return nil, ErrClosed
+	}
+	tokens, err := a.store.List(context.Background(), id, a.clock())
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].Created.Equal(tokens[j].Created) {
+			return tokens[i].Created.Before(tokens[j].Created)
+		}
+		return tokens[i].Token < tokens[j].Token
+	})
+	for i := range tokens {
+		if tokens[i], err = a.openData(tokens[i]); err != nil {
+			return nil, err
+		}
+	}
+	return tokens, nil
+}
+
+// redactTokens redacts the hashed tokenstrings of tokens to their last 4 characters.
+func redactTokens[ID comparable](tokens []LoginToken[ID]) {
+	for i := range tokens {
+		tokens[i].Token = redactToken(tokens[i].Token)
+	}
+}
+
+// redactToken returns token with all but its last 4 characters replaced by "...".
+func redactToken(token string) string {
+	if len(token) <= 4 {
+		return token
+	}
+	return "..." + token[len(token)-4:]
+}
+
+// storedToken is the encoding of a login token by stores and DumpState, keeping the tokenstring unredacted.
+type storedToken[ID comparable] LoginToken[ID]
+
+// MarshalJSON encodes lt with its tokenstring redacted to the last 4 characters, so tokens logged or serialized
+// in responses don't leak the tokenstring. Stores persist tokens by their unredacted encoding.
+func (lt LoginToken[ID]) MarshalJSON() ([]byte, error) {
+	st := storedToken[ID](lt)
+	st.Token = redactToken(lt.Token)
+	return json.Marshal(st)
+}
+
+// Clear removes all login tokens from the store and resets the metrics, e.g. between test cases.
+func (a *LoginTokenAuth[ID]) Clear() error {
+	if a.closed.Load() {
+		return ErrClosed
+	}
+	if err := a.store.Clear(context.Background()); err != nil {
+		return err
+	}
+	a.metrics.reset()
+	a.stats.active.Store(0)
+	return nil
+}
+
+// tableCreator is implemented by stores able to create their table, like SQLStore.
+type tableCreator interface {
+	CreateTable(ctx context.Context) error
+}
+
+// Start prepares the LoginTokenAuth for serving traffic and should be called before, so a misconfigured store
+// fails on startup instead of on the first login. It checks the store is reachable like Ping, creates the table
+// of the store if enabled by WithCreateTable, and starts purging expired tokens like StartGC at the interval
+// set by WithGCInterval.
+func (a *LoginTokenAuth[ID]) Start(ctx context.Context) error {
+	if err := a.Ping(ctx); err != nil {
+		return fmt.Errorf("login token store unreachable: %w", err)
+	}
+	if a.createTable {
+		tc, ok := a.store.(tableCreator)
+		if !ok {
+			return fmt.Errorf("token store %T does not support creating its table", a.store)
+		}
+		if err := tc.CreateTable(ctx); err != nil {
+			return fmt.Errorf("creating login token table: %w", err)
+		}
+	}
+	a.StartGC(a.gcInterval)
+	return nil
+}
+
+// StartGC starts a goroutine purging expired tokens from the store every interval until Close is called.
+// The number of tokens purged each cycle is passed to the callback set by WithPurgeCallback.
+// Calling StartGC while already running or with GC disabled by WithGC has no effect.
+func (a *LoginTokenAuth[ID]) StartGC(interval time.Duration) {
+	a.gcMux.Lock()
+	defer a.gcMux.Unlock()
+	if a.gcStop != nil || a.closed.Load() || !a.gc {
+		return
+	}
+	stop := make(chan struct{})
+	a.gcStop = stop
+
+	a.gcWG.Add(1)
+	go func() {
+		defer a.gcWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				n, err := a.purgeExpired(context.Background())
+				if err != nil {
+					logging.Logger.WithField("chore", "purgeExpiredLoginToken").Error(err)
+				}
+				if a.onPurge != nil {
+					a.onPurge(n)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Ping checks that the token store is reachable, e.g. for a readiness probe.
+// Stores not implementing Pinger, like MemoryStore, are always considered healthy.
+func (a *LoginTokenAuth[ID]) Ping(ctx context.Context) error {
+	if a.closed.Load() {
+		return ErrClosed
+	}
+	if p, ok := a.store.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// Close stops the goroutine started by StartGC and waits for it to return, sends queued webhook events, then flushes
+// and closes the store if it implements Flush(ctx) or io.Closer. Waiting aborts when ctx is done.
+// Operations after Close return ErrClosed. It is safe to call Close multiple times.
+func (a *LoginTokenAuth[ID]) Close(ctx context.Context) error {
+	a.gcMux.Lock()
+	if a.closed.Load() {
+		a.gcMux.Unlock()
+		return nil
+	}
+	a.closed.Store(true)
+	if a.gcStop != nil {
+		close(a.gcStop)
+		a.gcStop = nil
+	}
+	a.gcMux.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		a.gcWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if a.webhook != nil {
+		if err := a.webhook.close(ctx); err != nil {
+			return err
+		}
+	}
+
+	if f, ok := a.store.(flusher); ok {
+		if err := f.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	if c, ok := a.store.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// PurgeNow removes expired tokens from the store like a purge run by StartGC and returns the number of tokens removed,
+// e.g. for a scheduled job purging a store shared by multiple instances having GC disabled by WithGC.
+// Stores purge with a single bulk delete where supported, like SQLStore.
+func (a *LoginTokenAuth[ID]) PurgeNow(ctx context.Context) (int, error) {
+	if a.closed.Load() {
+		return 0, ErrClosed
+	}
+	return a.purgeExpired(ctx)
+}
+
+// purgeExpired removes expired tokens from the store, updates the active tokens metric
+// and returns the number of tokens removed.
+func (a *LoginTokenAuth[ID]) purgeExpired(ctx context.Context) (n int, err error) {
+	ctx, span := a.startSpan(ctx, "pwdless.PurgeExpired")
+	defer func() {
+		span.SetAttributes(attribute.Int("pwdless.purged", n))
+		endSpan(span, err)
+		a.logPurged(ctx, n, err)
+	}()
+
+	now := a.clock()
+	a.idempotent.mux.Lock()
+	a.idempotent.purge(now)
+	a.idempotent.mux.Unlock()
+	a.resent.mux.Lock()
+	a.resent.purge(now)
+	a.resent.mux.Unlock()
+	a.nonces.purge(now)
+	if n, err = a.purgeStore(ctx, now); err != nil {
+		return n, err
+	}
+	active, err := a.store.Count(ctx, now)
+	if err != nil {
+		return n, err
+	}
+	a.metrics.setActive(active)
+	a.stats.active.Store(int64(active))
+	return n, nil
+}
+
+// purgeStore removes tokens expired at now from the store, counting and reporting them, and returns the number removed.
+func (a *LoginTokenAuth[ID]) purgeStore(ctx context.Context, now time.Time) (int, error) {
+	// keep tokens still accepted within the clock skew
+	var purged []LoginToken[ID]
+	var err error
+	if p, ok := a.store.(chunkPurger[ID]); ok && a.purgeBatchSize > 0 {
+		purged, err = p.PurgeExpiredChunked(ctx, now.Add(-a.clockSkew), a.purgeBatchSize)
+	} else {
+		purged, err = a.store.PurgeExpired(ctx, now.Add(-a.clockSkew))
+	}
+	a.expired(purged)
+	return len(purged), err
+}
+
+// expired counts and reports the expired tokens removed from the store.
+func (a *LoginTokenAuth[ID]) expired(removed []LoginToken[ID]) {
+	a.metrics.addPurged(len(removed))
+	a.stats.purged.Add(uint64(len(removed)))
+	for _, lt := range removed {
+		a.hooks.onExpire(lt)
+	}
+}
+
+func copyData(data map[string]string) map[string]string {
+	if data == nil {
+		return nil
+	}
+	c := make(map[string]string, len(data))
+	for k, v := range data {
+		c[k] = v
+	}
+	return c
+}
+
+// hashToken returns the hex encoded HMAC-SHA256 of token keyed by the configured secret,
+// or its plain SHA-256 hash if no secret is set.
+func (a *LoginTokenAuth[ID]) hashToken(token string) string {
+	if len(a.hashSecret) == 0 {
+		sum := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(sum[:])
+	}
+	return macToken(a.hashSecret, token)
+}
+
+// macToken returns the hex encoded HMAC-SHA256 of token keyed by secret.
+func macToken(secret []byte, token string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// secureEqual reports whether a and b are equal in constant time.
+// Any comparison of token secrets must use it, as a plain string comparison returns on the first mismatching byte
+// and lets an attacker guess a token byte by byte from response timings.
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// defaultAlphabet holds the base64url characters, which are safe to use in urls unescaped.
+const defaultAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// randStringBytes returns a random string of length n drawn from alphabet using random bytes read from r.
+// Random bytes not fitting into a multiple of len(alphabet) are rejected to avoid modulo bias.
+// It fails if r returns fewer bytes than requested.
+func randStringBytes(r io.Reader, n int, alphabet string) (string, error) {
+	max := 256 - 256%len(alphabet)
+	res := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(res) < n {
+		if read, err := io.ReadFull(r, buf); err != nil {
+			return "", fmt.Errorf("random source returned %d of %d bytes: %w", read, n, err)
+		}
+		for _, v := range buf {
+			if int(v) >= max {
+				continue
+			}
+			res = append(res, alphabet[int(v)%len(alphabet)])
+			if len(res) == n {
+				break
+			}
+		}
 	}
-	return string(buf)
+	return string(res), nil
 }
@@ -0,0 +1,2404 @@
+package pwdless
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var errStore = errors.New("store unavailable")
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	mux sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mux.Lock()
+	c.now = c.now.Add(d)
+	c.mux.Unlock()
+}
+
+// newTestAuth returns a LoginTokenAuthInt using a MemoryStore and tokens expiring after expiry.
+func newTestAuth(expiry time.Duration, opts ...Option) (*LoginTokenAuthInt, *MemoryStore[int]) {
+	store := NewMemoryStore[int]()
+	opts = append([]Option{
+		WithLoginURL("http://localhost/login"),
+		WithExpiry(expiry),
+		WithStore(store),
+	}, opts...)
+	a, err := NewLoginTokenAuthWithOptions[int](opts...)
+	if err != nil {
+		panic(err)
+	}
+	return a, store
+}
+
+// failingStore is a TokenStore returning errStore on every operation.
+type failingStore struct{}
+
+func (failingStore) Save(ctx context.Context, lt LoginToken[int]) error { return errStore }
+func (failingStore) Get(ctx context.Context, token string) (LoginToken[int], bool, error) {
+	return LoginToken[int]{}, false, errStore
+}
+func (failingStore) Delete(ctx context.Context, token string) error           { return errStore }
+func (failingStore) DeleteByAccount(ctx context.Context, id int) (int, error) { return 0, errStore }
+func (failingStore) PurgeExpired(ctx context.Context, now time.Time) ([]LoginToken[int], error) {
+	return nil, errStore
+}
+func (failingStore) Count(ctx context.Context, now time.Time) (int, error) { return 0, errStore }
+func (failingStore) Clear(ctx context.Context) error                       { return errStore }
+func (failingStore) List(ctx context.Context, id int, now time.Time) ([]LoginToken[int], error) {
+	return nil, errStore
+}
+func (failingStore) Extend(ctx context.Context, token string, now, expiry time.Time) (LoginToken[int], bool, error) {
+	return LoginToken[int]{}, false, errStore
+}
+func (failingStore) CountForAccount(ctx context.Context, id int, now time.Time) (int, error) {
+	return 0, errStore
+}
+
+func TestLoginTokenAuth_storeErrors(t *testing.T) {
+	a, err := NewLoginTokenAuth(WithStore[int](failingStore{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.CreateToken(1); err != errStore {
+		t.Errorf("CreateToken got error %v, want: %v", err, errStore)
+	}
+	if _, err := a.GetAccountID(strings.Repeat("a", defaultLoginTokenLength)); !errors.Is(err, errStore) {
+		t.Errorf("GetAccountID got error %v, want: %v", err, errStore)
+	}
+}
+
+func TestLoginTokenAuth_WellFormed(t *testing.T) {
+	a, _ := newTestAuth(time.Minute, WithPrefix("lt_"), WithStore[int](failingStore{}))
+	valid := "lt_" + strings.Repeat("aZ0-_", 6) + "ab"
+	if !a.WellFormed(valid) {
+		t.Errorf("got %q not well formed", valid)
+	}
+	for _, token := range []string{
+		"",
+		"lt_",
+		valid[3:],
+		"xx_" + valid[3:],
+		valid[:len(valid)-1],
+		valid + "a",
+		valid[:len(valid)-1] + "!",
+		valid[:len(valid)-2] + "ä",
+	} {
+		if a.WellFormed(token) {
+			t.Errorf("got %q well formed", token)
+		}
+		// rejected without accessing the failing store
+		if _, err := a.GetAccountID(token); !errors.Is(err, ErrTokenNotFound) && !errors.Is(err, ErrTokenPrefix) {
+			t.Errorf("got error %v for %q, want: %v or %v", err, token, ErrTokenNotFound, ErrTokenPrefix)
+		}
+	}
+	if _, err := a.GetAccountID(valid); !errors.Is(err, errStore) {
+		t.Errorf("got error %v for well formed token, want: %v", err, errStore)
+	}
+
+	g, _ := newTestAuth(time.Minute, WithTokenGenerator(func() string { return "generated" }))
+	if !g.WellFormed("any token") {
+		t.Error("got token not well formed with token generator")
+	}
+	off, _ := newTestAuth(time.Minute, WithStore[int](failingStore{}), WithWellFormedCheck(false))
+	if _, err := off.GetAccountID("token"); !errors.Is(err, errStore) {
+		t.Errorf("got error %v with check disabled, want: %v", err, errStore)
+	}
+}
+
+func TestLoginTokenAuth_wrappedErrors(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountID(lt.Token); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = a.GetAccountID(lt.Token)
+	if !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("got %v, want error wrapping %v", err, ErrTokenNotFound)
+	}
+	key := a.hashToken(lt.Token)
+	if want := "consume failed for token ..." + key[len(key)-4:] + ": " + ErrTokenNotFound.Error(); err.Error() != want {
+		t.Errorf("got error %q, want: %q", err, want)
+	}
+	if strings.Contains(err.Error(), lt.Token) || strings.Contains(err.Error(), key) {
+		t.Errorf("got error %q containing the token", err)
+	}
+}
+
+func TestLoginTokenAuth_memoryStore(t *testing.T) {
+	store := NewMemoryStore[int]()
+	a, err := NewLoginTokenAuth(WithStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.Get(context.Background(), a.hashToken(lt.Token)); !ok {
+		t.Fatal("token not saved to injected store")
+	}
+
+	id, err := a.GetAccountID(lt.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Errorf("got account id %d, want: %d", id, 1)
+	}
+	if _, ok, _ := store.Get(context.Background(), a.hashToken(lt.Token)); ok {
+		t.Error("token not deleted from store after consume")
+	}
+}
+
+func TestLoginTokenAuth_expiry(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Second, WithClock(clock.Now))
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := clock.Now().Add(time.Second); !lt.Expiry.Equal(want) {
+		t.Fatalf("got expiry %v, want: %v", lt.Expiry, want)
+	}
+	if _, err := a.Peek(lt.Token); err != nil {
+		t.Fatalf("got error %v for valid token", err)
+	}
+
+	clock.Add(time.Second + time.Nanosecond)
+	if _, err := a.GetAccountID(lt.Token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got error %v for expired token, want: %v", err, ErrTokenExpired)
+	}
+}
+
+func TestLoginTokenAuth_WithClockSkew(t *testing.T) {
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Minute, WithClock(clock.Now), WithClockSkew(5*time.Second))
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	late, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(time.Minute + 3*time.Second)
+	if n, err := a.purgeExpired(context.Background()); err != nil || n != 0 {
+		t.Errorf("got %d, %v tokens purged within skew, want: %d", n, err, 0)
+	}
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v for token expiring within skew, want: 1, <nil>", id, err)
+	}
+
+	clock.Add(3 * time.Second)
+	if _, err := a.GetAccountID(late.Token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got error %v for token expired beyond skew, want: %v", err, ErrTokenExpired)
+	}
+	if n := len(store.token); n != 0 {
+		t.Errorf("got %d tokens in store, want: %d", n, 0)
+	}
+}
+
+func TestLoginTokenAuth_WithFutureTolerance(t *testing.T) {
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Hour, WithClock(clock.Now), WithFutureTolerance(time.Minute))
+
+	within, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	beyond, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for token, d := range map[string]time.Duration{within.Token: time.Minute, beyond.Token: time.Minute + time.Second} {
+		lt := store.token[a.hashToken(token)]
+		lt.Created = clock.Now().Add(d)
+		store.token[lt.Token] = lt
+	}
+
+	if id, err := a.GetAccountID(within.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v for token created within tolerance, want: 1, <nil>", id, err)
+	}
+	if _, err := a.GetAccountID(beyond.Token); !errors.Is(err, errTokenFromFuture) {
+		t.Errorf("got error %v for token created beyond tolerance, want: %v", err, errTokenFromFuture)
+	}
+}
+
+func TestLoginTokenAuth_WithDeleteExpiredOnAccess(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		clock := newFakeClock()
+		var opts []Option
+		if !enabled {
+			opts = append(opts, WithDeleteExpiredOnAccess(false))
+		}
+		a, store := newTestAuth(time.Second, append(opts, WithClock(clock.Now))...)
+
+		lt, err := a.CreateToken(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clock.Add(2 * time.Second)
+		if _, err := a.GetAccountID(lt.Token); !errors.Is(err, ErrTokenExpired) {
+			t.Errorf("got error %v for expired token, want: %v", err, ErrTokenExpired)
+		}
+		if n := len(store.token); n == 0 != enabled {
+			t.Errorf("got %d tokens in store after failed lookup with delete %v", n, enabled)
+		}
+	}
+}
+
+func TestRandStringBytes(t *testing.T) {
+	const n, samples = 32, 10000
+	seen := make(map[string]bool, samples)
+	for i := 0; i < samples; i++ {
+		s, err := randStringBytes(rand.Reader, n, defaultAlphabet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s) != n {
+			t.Fatalf("got length %d, want: %d", len(s), n)
+		}
+		if i := strings.IndexFunc(s, func(r rune) bool { return !strings.ContainsRune(defaultAlphabet, r) }); i >= 0 {
+			t.Fatalf("got character %q not in alphabet", s[i])
+		}
+		if seen[s] {
+			t.Fatalf("got duplicate token %s", s)
+		}
+		seen[s] = true
+	}
+}
+
+func TestLoginTokenAuth_randSource(t *testing.T) {
+	// bytes 0 to 63 pick the alphabet in order
+	src := make([]byte, 64)
+	for i := range src {
+		src[i] = byte(i)
+	}
+	a, _ := newTestAuth(time.Minute, WithRandSource(bytes.NewReader(src)))
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := defaultAlphabet[:32]; lt.Token != want {
+		t.Errorf("got token %s, want: %s", lt.Token, want)
+	}
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v, want: %d", id, err, 1)
+	}
+
+	// the remaining bytes pick the second half
+	if lt, err := a.CreateToken(2); err != nil || lt.Token != defaultAlphabet[32:] {
+		t.Errorf("got token %s, %v, want: %s", lt.Token, err, defaultAlphabet[32:])
+	}
+	if _, err := a.CreateToken(3); err == nil {
+		t.Error("got no error for exhausted random source")
+	}
+
+	a, _ = newTestAuth(time.Minute, WithRandSource(bytes.NewReader(src[:10])))
+	if _, err := a.CreateToken(1); err == nil || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got error %v for short random source, want: %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestLoginTokenAuth_hashedAtRest(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{"sha256", ""},
+		{"hmac", "secret"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a, store := newTestAuth(time.Minute)
+			a.hashSecret = []byte(tc.secret)
+
+			lt, err := a.CreateToken(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok, _ := store.Get(context.Background(), lt.Token); ok {
+				t.Error("plaintext token saved to store")
+			}
+			if _, ok, _ := store.Get(context.Background(), a.hashToken(lt.Token)); !ok {
+				t.Error("hashed token not saved to store")
+			}
+			if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+				t.Errorf("got %d, %v, want: 1, <nil>", id, err)
+			}
+		})
+	}
+}
+
+func TestLoginTokenAuth_RevokeToken(t *testing.T) {
+	a, err := NewLoginTokenAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.RevokeToken(lt.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountID(lt.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got error %v for revoked token, want: %v", err, ErrTokenNotFound)
+	}
+	if err := a.RevokeToken(lt.Token); err != ErrTokenNotFound {
+		t.Errorf("got error %v revoking twice, want: %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestLoginTokenAuth_RevokeAllForAccount(t *testing.T) {
+	a, err := NewLoginTokenAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := a.CreateToken(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := a.RevokeAllForAccount(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d tokens revoked, want: %d", n, 1)
+	}
+	if _, err := a.GetAccountID(lt.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got error %v for revoked token, want: %v", err, ErrTokenNotFound)
+	}
+	if _, err := a.GetAccountID(other.Token); err != nil {
+		t.Errorf("got error %v for token of other account", err)
+	}
+}
+
+func TestLoginTokenAuth_StartGC(t *testing.T) {
+	a, store := newTestAuth(time.Millisecond)
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.Get(context.Background(), a.hashToken(lt.Token)); !ok {
+		t.Fatal("token not saved to store")
+	}
+
+	a.StartGC(5 * time.Millisecond)
+	a.StartGC(5 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, _ := store.Get(context.Background(), a.hashToken(lt.Token)); ok {
+		t.Error("expired token not purged by gc")
+	}
+}
+
+func TestLoginTokenAuth_concurrentPurge(t *testing.T) {
+	a, _ := newTestAuth(time.Millisecond)
+	a.StartGC(time.Millisecond)
+	defer a.Close(context.Background())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				lt, err := a.CreateToken(id)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				a.GetAccountID(lt.Token)
+				a.RevokeAllForAccount(id)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLoginTokenAuth_canceledContext(t *testing.T) {
+	a, err := NewLoginTokenAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := a.CreateTokenContext(ctx, 1); err != context.Canceled {
+		t.Errorf("CreateTokenContext got error %v, want: %v", err, context.Canceled)
+	}
+	if _, err := a.GetAccountIDContext(ctx, lt.Token); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetAccountIDContext got error %v, want: %v", err, context.Canceled)
+	}
+	if _, err := a.GetAccountID(lt.Token); err != nil {
+		t.Errorf("token consumed by canceled context: %v", err)
+	}
+}
+
+func TestLoginTokenAuth_genericID(t *testing.T) {
+	a, err := NewLoginTokenAuthFor[string]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt, err := a.CreateToken("0b6a1d6e-uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := a.GetAccountID(lt.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "0b6a1d6e-uuid" {
+		t.Errorf("got account id %s, want: %s", id, "0b6a1d6e-uuid")
+	}
+
+	if _, err := NewLoginTokenAuthFor[string](WithStore(NewMemoryStore[int]())); err == nil {
+		t.Error("got no error for store with mismatching account ID type")
+	}
+}
+
+func TestLoginTokenAuth_data(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+	data := map[string]string{"redirect": "/settings"}
+	lt, err := a.CreateTokenWithData(1, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data["redirect"] = "/modified"
+
+	id, got, err := a.GetAccountIDWithData(lt.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || got["redirect"] != "/settings" {
+		t.Errorf("got %d, %v, want: 1, map[redirect:/settings]", id, got)
+	}
+
+	lt, err = a.CreateToken(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, got, err := a.GetAccountIDWithData(lt.Token); err != nil || got != nil {
+		t.Errorf("got %v, %v, want: nil data", got, err)
+	}
+}
+
+func TestLoginTokenAuth_Peek(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if id, err := a.Peek(lt.Token); err != nil || id != 1 {
+			t.Fatalf("got %d, %v, want: 1, <nil>", id, err)
+		}
+	}
+	if _, err := a.GetAccountID(lt.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Peek(lt.Token); err != ErrTokenNotFound {
+		t.Errorf("got error %v for consumed token, want: %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestLoginTokenAuth_CreateTokenWithUses(t *testing.T) {
+	a, store := newTestAuth(time.Minute)
+	lt, err := a.CreateTokenWithUses(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for want := 3; want > 0; want-- {
+		if n, err := a.RemainingUses(lt.Token); err != nil || n != want {
+			t.Errorf("got %d, %v remaining uses, want: %d", n, err, want)
+		}
+		if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+			t.Fatalf("got %d, %v consuming with %d uses left, want: 1, <nil>", id, err, want)
+		}
+	}
+	if _, err := a.GetAccountID(lt.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got error %v after all uses, want: %v", err, ErrTokenNotFound)
+	}
+	if n := len(store.token); n != 0 {
+		t.Errorf("got %d tokens in store after all uses, want: %d", n, 0)
+	}
+
+	single, err := a.CreateTokenWithUses(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := a.RemainingUses(single.Token); err != nil || n != 1 {
+		t.Errorf("got %d, %v remaining uses of single use token, want: %d", n, err, 1)
+	}
+	reusable, err := a.CreateReusableToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := a.RemainingUses(reusable.Token); err != nil || n != -1 {
+		t.Errorf("got %d, %v remaining uses of reusable token, want: %d", n, err, -1)
+	}
+	if _, err := a.CreateTokenWithUses(1, -1); err == nil {
+		t.Error("got no error for negative max uses")
+	}
+}
+
+func TestLoginTokenAuth_PurgeNow(t *testing.T) {
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Minute, WithClock(clock.Now), WithGC(false))
+	for id := 1; id <= 3; id++ {
+		if _, err := a.CreateToken(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.Add(2 * time.Minute)
+	kept, err := a.CreateToken(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.StartGC(time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	if n := len(store.token); n != 4 {
+		t.Fatalf("got %d tokens with GC disabled, want: %d", n, 4)
+	}
+	n, err := a.PurgeNow(context.Background())
+	if err != nil || n != 3 {
+		t.Errorf("got %d, %v purged, want: %d", n, err, 3)
+	}
+	if _, ok := store.token[a.hashToken(kept.Token)]; !ok || len(store.token) != 1 {
+		t.Errorf("got %d tokens after purge, want only the unexpired token kept", len(store.token))
+	}
+
+	a.Close(context.Background())
+	if _, err := a.PurgeNow(context.Background()); err != ErrClosed {
+		t.Errorf("got %v after close, want: %v", err, ErrClosed)
+	}
+}
+
+func TestLoginTokenAuth_Consume(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+	created, err := a.CreateTokenWithData(1, map[string]string{"tenant": "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Add(time.Second)
+	lt, err := a.Consume(created.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lt.Token != created.Token || lt.AccountID != 1 || lt.Data["tenant"] != "acme" ||
+		!lt.Created.Equal(created.Created) || !lt.Expiry.Equal(created.Expiry) {
+		t.Errorf("got %+v, want: %+v", lt, created)
+	}
+	if _, err := a.Consume(created.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got %v consuming twice, want: %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestLoginTokenAuth_CreateReusableTokenWithIdle(t *testing.T) {
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Minute, WithClock(clock.Now))
+	lt, err := a.CreateReusableTokenWithIdle(1, time.Hour, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every use resets the idle timeout until the absolute expiry
+	for i := 0; i < 6; i++ {
+		clock.Add(9 * time.Minute)
+		if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+			t.Fatalf("got %d, %v on use %d within idle timeout, want: %d, <nil>", id, err, i, 1)
+		}
+	}
+	if got := store.token[a.hashToken(lt.Token)].LastUsed; !got.Equal(clock.Now()) {
+		t.Errorf("got last used %v, want: %v", got, clock.Now())
+	}
+	clock.Add(7 * time.Minute)
+	if _, err := a.GetAccountID(lt.Token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got %v past absolute expiry, want: %v", err, ErrTokenExpired)
+	}
+
+	idle, err := a.CreateReusableTokenWithIdle(1, 0, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !idle.Expiry.Equal(clock.Now().Add(time.Minute)) {
+		t.Errorf("got expiry %v, want configured expiry", idle.Expiry)
+	}
+	idle, err = a.CreateReusableTokenWithIdle(1, time.Hour, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(5 * time.Minute)
+	if _, err := a.GetAccountID(idle.Token); err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(11 * time.Minute)
+	if _, err := a.GetAccountID(idle.Token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got %v past idle timeout, want: %v", err, ErrTokenExpired)
+	}
+	if _, ok := store.token[a.hashToken(idle.Token)]; ok {
+		t.Error("got idle expired token kept in store")
+	}
+
+	if _, err := a.CreateReusableTokenWithIdle(1, time.Hour, 0); err == nil {
+		t.Error("got no error without idle timeout")
+	}
+}
+
+func TestLoginTokenAuth_consumeDeletes(t *testing.T) {
+	a, store := newTestAuth(time.Minute, WithConsumeDeletes(false), WithMetrics(prometheus.NewRegistry()))
+	m := a.metrics
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+			t.Fatalf("got %d, %v consuming kept token, want: %d", id, err, 1)
+		}
+	}
+	if _, ok := store.token[a.hashToken(lt.Token)]; !ok {
+		t.Error("consumed token removed from store")
+	}
+	if got := m.Snapshot().Consumed; got != 2 {
+		t.Errorf("got %d consumptions, want: %d", got, 2)
+	}
+
+	if err := a.RevokeToken(lt.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountID(lt.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got %v for revoked token, want: %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestLoginTokenAuth_consumeGrace(t *testing.T) {
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Minute, WithClock(clock.Now), WithConsumeGrace(5*time.Second), WithMetrics(prometheus.NewRegistry()))
+	m := a.metrics
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+		t.Fatalf("got %d, %v, want: %d, <nil>", id, err, 1)
+	}
+	stored := store.token[a.hashToken(lt.Token)]
+	if !stored.Consumed.Equal(clock.Now()) {
+		t.Errorf("got consumed %v, want token marked consumed at %v", stored.Consumed, clock.Now())
+	}
+	clock.Add(5 * time.Second)
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v retrying within grace period, want: %d, <nil>", id, err, 1)
+	}
+	if n, err := a.RemainingUses(lt.Token); err != nil || n != 0 {
+		t.Errorf("got %d, %v remaining uses of consumed token, want: %d", n, err, 0)
+	}
+	if n := m.Snapshot().Consumed; n != 1 {
+		t.Errorf("got %d consumed, want retry not counted: %d", n, 1)
+	}
+
+	clock.Add(time.Second)
+	if _, err := a.GetAccountID(lt.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got %v retrying after grace period, want: %v", err, ErrTokenNotFound)
+	}
+	if _, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithConsumeGrace(-time.Second)); err == nil {
+		t.Error("got no error for negative consume grace")
+	}
+}
+
+func TestLoginTokenAuth_VerifyFunc(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verify := a.VerifyFunc()
+	for i := 0; i < 2; i++ {
+		if id, err := verify(lt.Token); err != nil || id != 1 {
+			t.Fatalf("got %d, %v, want: 1, <nil>", id, err)
+		}
+	}
+	if _, err := verify("unknown"); err != ErrTokenNotFound {
+		t.Errorf("got error %v for unknown token, want: %v", err, ErrTokenNotFound)
+	}
+	if _, err := a.GetAccountID(lt.Token); err != nil {
+		t.Errorf("got error %v consuming verified token, want: <nil>", err)
+	}
+}
+
+func TestLoginTokenAuth_WithTokenGenerator(t *testing.T) {
+	var n int32
+	gen := func() string {
+		return fmt.Sprintf("tok%04d", atomic.AddInt32(&n, 1))
+	}
+	a, _ := newTestAuth(time.Minute, WithTokenGenerator(gen), WithPrefix("lt_"))
+
+	for _, want := range []string{"lt_tok0002", "lt_tok0003"} {
+		lt, err := a.CreateToken(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lt.Token != want {
+			t.Errorf("got token %s, want: %s", lt.Token, want)
+		}
+		if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+			t.Errorf("got %d, %v consuming generated token", id, err)
+		}
+	}
+
+	if _, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithTokenGenerator(func() string { return "" })); err == nil {
+		t.Error("got no error for generator returning empty tokenstrings")
+	}
+}
+
+func TestLoginTokenAuth_tokenCollision(t *testing.T) {
+	var n int32
+	tokens := []string{"probe", "same", "same", "other"}
+	gen := func() string {
+		return tokens[atomic.AddInt32(&n, 1)-1]
+	}
+	a, store := newTestAuth(time.Minute, WithTokenGenerator(gen))
+
+	first, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := a.CreateToken(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Token != "same" || second.Token != "other" {
+		t.Errorf("got tokens %s, %s, want: same, other", first.Token, second.Token)
+	}
+	if n := len(store.token); n != 2 {
+		t.Errorf("got %d tokens in store, want: %d", n, 2)
+	}
+	for _, lt := range []LoginToken[int]{first, second} {
+		if id, err := a.GetAccountID(lt.Token); err != nil || id != lt.AccountID {
+			t.Errorf("got %d, %v consuming token of account %d", id, err, lt.AccountID)
+		}
+	}
+
+	a, _ = newTestAuth(time.Minute, WithTokenGenerator(func() string { return "same" }))
+	if _, err := a.CreateToken(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateToken(2); err != errTokenCollision {
+		t.Errorf("got error %v for persistent collision, want: %v", err, errTokenCollision)
+	}
+}
+
+// testStoreCollision tests that s refuses to overwrite a token of another account and CreateToken retries.
+func testStoreCollision(t *testing.T, s TokenStore[int]) {
+	ctx := context.Background()
+	expiry := time.Now().Add(time.Minute)
+	if err := s.Save(ctx, LoginToken[int]{Token: "collide", AccountID: 1, Expiry: expiry}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(ctx, LoginToken[int]{Token: "collide", AccountID: 1, Expiry: expiry, Uses: 1}); err != nil {
+		t.Errorf("got %v replacing token of same account, want: nil", err)
+	}
+	if err := s.Save(ctx, LoginToken[int]{Token: "collide", AccountID: 2, Expiry: expiry}); err != errTokenCollision {
+		t.Errorf("got %v saving token of another account, want: %v", err, errTokenCollision)
+	}
+	if lt, _, err := s.Get(ctx, "collide"); err != nil || lt.AccountID != 1 || lt.Uses != 1 {
+		t.Errorf("got %+v, %v, want replaced token of account 1", lt, err)
+	}
+
+	var n int32
+	tokens := []string{"probe", "same", "same", "other"}
+	a, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithStore(s),
+		WithTokenGenerator(func() string { return tokens[atomic.AddInt32(&n, 1)-1] }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := a.CreateToken(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Token != "same" || second.Token != "other" {
+		t.Errorf("got tokens %s, %s, want: same, other", first.Token, second.Token)
+	}
+	if id, err := a.GetAccountID(first.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v consuming token of account 1", id, err)
+	}
+}
+
+func TestLoginTokenAuth_HasPendingToken(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+
+	if ok, _, err := a.HasPendingToken(1); ok || err != nil {
+		t.Errorf("got %v, %v without tokens, want: false", ok, err)
+	}
+	if _, err := a.CreateToken(1); err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(30 * time.Second)
+	if _, err := a.CreateToken(1); err != nil {
+		t.Fatal(err)
+	}
+	if ok, created, err := a.HasPendingToken(1); !ok || err != nil || !created.Equal(clock.Now()) {
+		t.Errorf("got %v, %s, %v, want: true, %s", ok, created, err, clock.Now())
+	}
+	if n, _ := a.CountForAccount(1); n != 2 {
+		t.Errorf("got %d tokens, want tokens not consumed", n)
+	}
+
+	clock.Add(2 * time.Minute)
+	if ok, _, err := a.HasPendingToken(1); ok || err != nil {
+		t.Errorf("got %v, %v with expired tokens, want: false", ok, err)
+	}
+}
+
+func TestLoginTokenAuth_WithConstantTimeLookup(t *testing.T) {
+	const minDuration = 20 * time.Millisecond
+	a, _ := newTestAuth(time.Minute, WithConstantTimeLookup(minDuration))
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"hit", lt.Token, nil},
+		{"miss", "unknown", ErrTokenNotFound},
+	} {
+		start := time.Now()
+		if _, err := a.GetAccountID(tc.token); !errors.Is(err, tc.err) {
+			t.Fatalf("got %v for %s, want: %v", err, tc.name, tc.err)
+		}
+		if d := time.Since(start); d < minDuration {
+			t.Errorf("got %s for %s, want at least %s", d, tc.name, minDuration)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	a.GetAccountIDContext(ctx, "unknown")
+	if d := time.Since(start); d >= minDuration {
+		t.Errorf("got %s with done context, want padding to end early", d)
+	}
+}
+
+func TestLoginTokenAuth_Created(t *testing.T) {
+	clock := newFakeClock()
+	var hooked LoginToken[int]
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithHooks(Hooks[int]{
+		OnCreate: func(lt LoginToken[int]) { hooked = lt },
+	}))
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lt.Created.Equal(clock.Now()) || !lt.Created.Before(lt.Expiry) {
+		t.Errorf("got created %s, expiry %s, want created %s preceding expiry", lt.Created, lt.Expiry, clock.Now())
+	}
+	if !hooked.Created.Equal(lt.Created) {
+		t.Errorf("got created %s in hook, want: %s", hooked.Created, lt.Created)
+	}
+	tokens, err := a.ListForAccount(1, ListOptions{})
+	if err != nil || len(tokens) != 1 || !tokens[0].Created.Equal(lt.Created) {
+		t.Errorf("got %+v, %v listing, want created %s", tokens, err, lt.Created)
+	}
+}
+
+func TestLoginTokenAuth_WithAccountSecret(t *testing.T) {
+	var mux sync.Mutex
+	secrets := map[int]string{1: "one", 2: "two"}
+	a, _ := newTestAuth(time.Minute, WithAccountSecret(func(id int) ([]byte, error) {
+		mux.Lock()
+		defer mux.Unlock()
+		s, ok := secrets[id]
+		if !ok {
+			return nil, errStore
+		}
+		return []byte(s), nil
+	}))
+
+	create := func(id int) string {
+		lt, err := a.CreateReusableToken(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lt.Token
+	}
+	one, two := create(1), create(2)
+	code, err := a.CreateCode(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Peek(one); err != nil {
+		t.Fatalf("got %v before rotation, want: nil", err)
+	}
+
+	mux.Lock()
+	secrets[1] = "rotated"
+	mux.Unlock()
+	if _, err := a.GetAccountID(one); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got %v after rotating secret, want: %v", err, ErrTokenNotFound)
+	}
+	if err := a.GetAccountIDByCode(1, code); err != ErrTokenNotFound {
+		t.Errorf("got %v for code after rotating secret, want: %v", err, ErrTokenNotFound)
+	}
+	if id, err := a.GetAccountID(two); err != nil || id != 2 {
+		t.Errorf("got %d, %v for other account, want: %d", id, err, 2)
+	}
+	if id, err := a.GetAccountID(create(1)); err != nil || id != 1 {
+		t.Errorf("got %d, %v for token created after rotation, want: %d", id, err, 1)
+	}
+
+	if _, err := a.CreateToken(3); err != errStore {
+		t.Errorf("got %v for account without secret, want: %v", err, errStore)
+	}
+}
+
+func TestLoginTokenAuth_TTL(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Add(20 * time.Second)
+	if ttl, err := a.TTL(lt.Token); err != nil || ttl != 40*time.Second {
+		t.Errorf("got %s, %v, want: %s", ttl, err, 40*time.Second)
+	}
+	if _, err := a.TTL("unknown"); err != ErrTokenNotFound {
+		t.Errorf("got error %v for unknown token, want: %v", err, ErrTokenNotFound)
+	}
+	if _, err := a.Peek(lt.Token); err != nil {
+		t.Errorf("got error %v, want token not consumed by TTL", err)
+	}
+	clock.Add(time.Minute)
+	if _, err := a.TTL(lt.Token); err != ErrTokenExpired {
+		t.Errorf("got error %v for expired token, want: %v", err, ErrTokenExpired)
+	}
+}
+
+func TestLoginTokenAuth_CreateReusableToken(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+	reusable, err := a.CreateReusableToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	single, err := a.CreateToken(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if id, err := a.GetAccountID(reusable.Token); err != nil || id != 1 {
+			t.Fatalf("consume %d of reusable token got %d, %v, want: 1, <nil>", i+1, id, err)
+		}
+	}
+	if _, err := a.GetAccountID(single.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountID(single.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("second consume of single-use token got error %v, want: %v", err, ErrTokenNotFound)
+	}
+
+	clock.Add(time.Minute + time.Nanosecond)
+	if _, err := a.GetAccountID(reusable.Token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got error %v for expired reusable token, want: %v", err, ErrTokenExpired)
+	}
+}
+
+func TestLoginTokenAuth_rateLimit(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+	a.limiter = newRateLimiter[int](3, time.Minute)
+
+	created, limited := 0, 0
+	for i := 0; i < 10; i++ {
+		_, err := a.CreateToken(1)
+		switch err {
+		case nil:
+			created++
+		case ErrRateLimited:
+			limited++
+		default:
+			t.Fatal(err)
+		}
+	}
+	if created != 3 || limited != 7 {
+		t.Errorf("got %d created and %d rate limited, want: 3 and 7", created, limited)
+	}
+	if _, err := a.CreateToken(2); err != nil {
+		t.Errorf("got error %v for other account", err)
+	}
+}
+
+func TestRateLimiter_window(t *testing.T) {
+	l := newRateLimiter[int](1, time.Minute)
+	now := time.Now()
+	if !l.allow(1, now) {
+		t.Fatal("first event not allowed")
+	}
+	if l.allow(1, now.Add(time.Second)) {
+		t.Error("second event within window allowed")
+	}
+	if !l.allow(1, now.Add(time.Minute)) {
+		t.Error("event after window not allowed")
+	}
+	l.allow(2, now.Add(3*time.Minute))
+	if _, ok := l.events[1]; ok {
+		t.Error("stale key not cleaned up")
+	}
+}
+
+// fakeRateLimitStore is a RateLimitStore shared by instances, expiring counters by clock.
+type fakeRateLimitStore struct {
+	clock  func() time.Time
+	mux    sync.Mutex
+	counts map[string]int
+	expiry map[string]time.Time
+}
+
+func newFakeRateLimitStore(clock func() time.Time) *fakeRateLimitStore {
+	return &fakeRateLimitStore{clock: clock, counts: make(map[string]int), expiry: make(map[string]time.Time)}
+}
+
+func (s *fakeRateLimitStore) Incr(_ context.Context, key string, window time.Duration) (int, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if now := s.clock(); !now.Before(s.expiry[key]) {
+		s.counts[key] = 0
+		s.expiry[key] = now.Add(window)
+	}
+	s.counts[key]++
+	return s.counts[key], nil
+}
+
+func (s *fakeRateLimitStore) Decr(_ context.Context, key string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.counts[key]--
+	return nil
+}
+
+func TestLoginTokenAuth_distributedRateLimit(t *testing.T) {
+	clock := newFakeClock()
+	shared := newFakeRateLimitStore(clock.Now)
+	opts := []Option{WithClock(clock.Now), WithRateLimit(3, time.Minute), WithDistributedRateLimit(shared)}
+	a, _ := newTestAuth(time.Minute, opts...)
+	b, _ := newTestAuth(time.Minute, opts...)
+
+	for i, auth := range []*LoginTokenAuthInt{a, b, a} {
+		if _, err := auth.CreateToken(1); err != nil {
+			t.Fatalf("got %v creating token %d, want: <nil>", err, i+1)
+		}
+	}
+	if _, err := b.CreateToken(1); err != ErrRateLimited {
+		t.Errorf("got %v creating token beyond shared limit, want: %v", err, ErrRateLimited)
+	}
+	if _, err := a.CreateToken(2); err != nil {
+		t.Errorf("got %v for other account, want: <nil>", err)
+	}
+
+	clock.Add(time.Minute)
+	if _, err := b.CreateToken(1); err != nil {
+		t.Errorf("got %v after window expired, want: <nil>", err)
+	}
+
+	failing, _ := newTestAuth(time.Minute, WithRateLimit(3, time.Minute), WithDistributedRateLimit(errRateLimitStore{}))
+	if _, err := failing.CreateToken(1); err != errStore {
+		t.Errorf("got %v with failing rate limit store, want: %v", err, errStore)
+	}
+}
+
+type errRateLimitStore struct{}
+
+func (errRateLimitStore) Incr(context.Context, string, time.Duration) (int, error) {
+	return 0, errStore
+}
+
+func TestConfig_validate(t *testing.T) {
+	valid := config{
+		loginURL:         "http://localhost/login",
+		loginTokenParam:  defaultLoginTokenParam,
+		loginTokenLength: minLoginTokenLength,
+		loginTokenExpiry: time.Minute,
+		emailTemplate:    defaultLoginEmailTemplate,
+		alphabet:         defaultAlphabet,
+		randSource:       rand.Reader,
+		asyncConcurrency: 1,
+		gcInterval:       time.Minute,
+	}
+	if err := valid.validate(); err != nil {
+		t.Fatalf("got error %v for valid config", err)
+	}
+
+	tests := []struct {
+		name string
+		mod  func(c *config)
+	}{
+		{"short_token", func(c *config) { c.loginTokenLength = minLoginTokenLength - 1 }},
+		{"zero_token", func(c *config) { c.loginTokenLength = 0 }},
+		{"zero_expiry", func(c *config) { c.loginTokenExpiry = 0 }},
+		{"negative_expiry", func(c *config) { c.loginTokenExpiry = -time.Minute }},
+		{"missing_url", func(c *config) { c.loginURL = "" }},
+		{"invalid_url", func(c *config) { c.loginURL = "http://[::1" }},
+		{"missing_template", func(c *config) { c.emailTemplate = nil }},
+		{"invalid_prefix", func(c *config) { c.tokenPrefix = "lt/" }},
+		{"negative_jitter", func(c *config) { c.expiryJitter = -time.Second }},
+		{"negative_skew", func(c *config) { c.clockSkew = -time.Second }},
+		{"negative_future_tolerance", func(c *config) { c.futureTolerance = -time.Second }},
+		{"negative_consume_delay", func(c *config) { c.consumeDelay = -time.Second }},
+		{"zero_concurrency", func(c *config) { c.asyncConcurrency = 0 }},
+		{"short_alphabet", func(c *config) { c.alphabet = "abcdef" }},
+		{"duplicate_alphabet", func(c *config) { c.alphabet = "abcdefghijklmnopa" }},
+		{"non_ascii_alphabet", func(c *config) { c.alphabet = "abcdefghijklmnopä" }},
+		{"missing_rand_source", func(c *config) { c.randSource = nil }},
+		{"zero_gc_interval", func(c *config) { c.gcInterval = 0 }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := valid
+			tc.mod(&c)
+			if err := c.validate(); err == nil {
+				t.Error("got no error for invalid config")
+			}
+		})
+	}
+}
+
+func TestNewLoginTokenAuthWithOptions(t *testing.T) {
+	short, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://a/login"), WithTokenLength(20), WithExpiry(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://b/login"), WithTokenLength(40), WithExpiry(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lt, err := short.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lt.Token) != 20 || lt.Expiry.After(time.Now().Add(time.Minute)) {
+		t.Errorf("got token %s expiring %v, want 20 chars expiring within a minute", lt.Token, lt.Expiry)
+	}
+	lt, err = long.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lt.Token) != 40 || lt.Expiry.Before(time.Now().Add(time.Minute)) {
+		t.Errorf("got token %s expiring %v, want 40 chars expiring within an hour", lt.Token, lt.Expiry)
+	}
+
+	if _, err := NewLoginTokenAuthWithOptions[int](); err == nil {
+		t.Error("got no error without login url")
+	}
+}
+
+func TestLoginTokenAuth_LoginURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		param string
+		want  string
+	}{
+		{"plain", "http://localhost/login", "", "http://localhost/login?token=abc"},
+		{"trailing_slash", "http://localhost/login/", "", "http://localhost/login/?token=abc"},
+		{"query", "http://localhost/login?lang=en", "", "http://localhost/login?lang=en&token=abc"},
+		{"param", "http://localhost/login", "t", "http://localhost/login?t=abc"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a, _ := newTestAuth(time.Minute, WithLoginURL(tc.url), WithTokenParam(tc.param))
+			if got := a.LoginURL(LoginToken[int]{Token: "abc"}); got != tc.want {
+				t.Errorf("got %s, want: %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoginTokenAuth_LoginURLFunc(t *testing.T) {
+	a, _ := newTestAuth(time.Minute, WithLoginURLFunc(func(lt LoginToken[int]) string {
+		if lt.Data["tenant"] == "" {
+			return ""
+		}
+		return "https://" + lt.Data["tenant"] + ".example.com/login"
+	}))
+	tests := []struct {
+		name string
+		data map[string]string
+		want string
+	}{
+		{"tenant", map[string]string{"tenant": "acme"}, "https://acme.example.com/login?token=abc"},
+		{"fallback", nil, "http://localhost/login?token=abc"},
+		{"invalid", map[string]string{"tenant": "%"}, "http://localhost/login?token=abc"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := a.LoginURL(LoginToken[int]{Token: "abc", Data: tc.data}); got != tc.want {
+				t.Errorf("got %s, want: %s", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := NewLoginTokenAuthWithOptions[string](WithLoginURL("http://localhost/login"), WithLoginURLFunc(func(LoginToken[int]) string { return "" })); err == nil {
+		t.Error("got no error for login url func of different account ID type")
+	}
+}
+
+func TestLoginTokenAuth_hooks(t *testing.T) {
+	var created, consumed, expired []LoginToken[int]
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithHooks(Hooks[int]{
+		OnCreate:  func(lt LoginToken[int]) { created = append(created, lt) },
+		OnConsume: func(lt LoginToken[int]) { consumed = append(consumed, lt) },
+		OnExpire:  func(lt LoginToken[int]) { expired = append(expired, lt) },
+	}))
+
+	lt1, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateToken(2); err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 2 {
+		t.Fatalf("OnCreate called %d times, want: %d", len(created), 2)
+	}
+	if created[0].Token != a.hashToken(lt1.Token) {
+		t.Error("OnCreate not called with hashed token")
+	}
+
+	if _, err := a.GetAccountID(lt1.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountID(lt1.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got error %v, want: %v", err, ErrTokenNotFound)
+	}
+	if len(consumed) != 1 || consumed[0].AccountID != 1 {
+		t.Errorf("OnConsume called with %v, want once for account %d", consumed, 1)
+	}
+
+	clock.Add(2 * time.Minute)
+	if _, err := a.purgeExpired(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.purgeExpired(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].AccountID != 2 {
+		t.Errorf("OnExpire called with %v, want once for account %d", expired, 2)
+	}
+	if len(created) != 2 || len(consumed) != 1 {
+		t.Error("hooks called for unrelated events")
+	}
+}
+
+func TestLoginTokenAuth_nilHooks(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithHooks(Hooks[int]{}))
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountID(lt.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateToken(1); err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(2 * time.Minute)
+	if _, err := a.purgeExpired(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewLoginTokenAuthWithOptions[string](WithLoginURL("http://localhost/login"), WithHooks(Hooks[int]{})); err == nil {
+		t.Error("expected error for hooks of mismatching account ID type")
+	}
+}
+
+func TestLoginTokenAuth_Count(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+	for _, id := range []int{1, 1, 2} {
+		if _, err := a.CreateToken(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.Add(2 * time.Minute)
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateToken(3); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := a.Count(); err != nil || n != 2 {
+		t.Errorf("got count %d, %v, want: %d", n, err, 2)
+	}
+	if n, err := a.CountForAccount(1); err != nil || n != 1 {
+		t.Errorf("got count %d, %v for account 1, want: %d", n, err, 1)
+	}
+	if n, err := a.CountForAccount(2); err != nil || n != 0 {
+		t.Errorf("got count %d, %v for account 2, want: %d", n, err, 0)
+	}
+
+	if _, err := a.GetAccountID(lt.Token); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := a.CountForAccount(1); err != nil || n != 0 {
+		t.Errorf("got count %d, %v for account 1 after consume, want: %d", n, err, 0)
+	}
+}
+
+func TestLoginTokenAuth_CreateTokenWithExpiry(t *testing.T) {
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Minute, WithClock(clock.Now))
+
+	long, err := a.CreateTokenWithExpiry(1, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := clock.Now().Add(24 * time.Hour); !long.Expiry.Equal(want) {
+		t.Errorf("got expiry %v, want: %v", long.Expiry, want)
+	}
+	def, err := a.CreateTokenWithExpiry(2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := clock.Now().Add(time.Minute); !def.Expiry.Equal(want) {
+		t.Errorf("got expiry %v for zero ttl, want: %v", def.Expiry, want)
+	}
+	if _, err := a.CreateTokenWithExpiry(3, -time.Minute); err == nil {
+		t.Error("got no error for negative ttl")
+	}
+
+	clock.Add(time.Hour)
+	if _, err := a.GetAccountID(def.Token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got error %v for expired default token, want: %v", err, ErrTokenExpired)
+	}
+	if _, err := a.purgeExpired(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.token) != 1 {
+		t.Errorf("got %d tokens after purge, want: %d", len(store.token), 1)
+	}
+	if id, err := a.GetAccountID(long.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v for long lived token, want: %d", id, err, 1)
+	}
+
+	clock.Add(24 * time.Hour)
+	long, _ = a.CreateTokenWithExpiry(1, 24*time.Hour)
+	clock.Add(25 * time.Hour)
+	if _, err := a.GetAccountID(long.Token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got error %v for expired long lived token, want: %v", err, ErrTokenExpired)
+	}
+}
+
+func TestLoginTokenAuth_errors(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.GetAccountID("unknown")
+	if !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got error %v for unknown token, want: %v", err, ErrTokenNotFound)
+	}
+	if wrapped := fmt.Errorf("login: %w", err); !errors.Is(wrapped, ErrTokenNotFound) {
+		t.Errorf("got wrapped error %v not matching %v", wrapped, ErrTokenNotFound)
+	}
+	clock.Add(2 * time.Minute)
+	if _, err := a.Peek(lt.Token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got error %v from Peek for expired token, want: %v", err, ErrTokenExpired)
+	}
+	if _, err := a.GetAccountID(lt.Token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got error %v for expired token, want: %v", err, ErrTokenExpired)
+	}
+}
+
+func TestLoginTokenAuth_Refresh(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiring, err := a.CreateToken(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Add(50 * time.Second)
+	refreshed, err := a.Refresh(lt.Token, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := clock.Now().Add(time.Hour); !refreshed.Expiry.Equal(want) || refreshed.Token != lt.Token {
+		t.Errorf("got refreshed token %+v, want expiry: %v", refreshed, want)
+	}
+	if _, err := a.Refresh(lt.Token, -time.Minute); err == nil {
+		t.Error("got no error for negative ttl")
+	}
+
+	clock.Add(30 * time.Minute)
+	if _, err := a.Refresh(expiring.Token, time.Hour); err != ErrTokenNotFound {
+		t.Errorf("got error %v refreshing expired token, want: %v", err, ErrTokenNotFound)
+	}
+	if _, err := a.Refresh("unknown", time.Hour); err != ErrTokenNotFound {
+		t.Errorf("got error %v refreshing unknown token, want: %v", err, ErrTokenNotFound)
+	}
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v for refreshed token, want: %d", id, err, 1)
+	}
+	if _, err := a.Refresh(lt.Token, time.Hour); err != ErrTokenNotFound {
+		t.Errorf("got error %v refreshing consumed token, want: %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestLoginTokenAuth_maxPerAccount(t *testing.T) {
+	t.Run("evict_oldest", func(t *testing.T) {
+		clock := newFakeClock()
+		a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithMaxPerAccount(2, true))
+		var tokens []LoginToken[int]
+		for i := 0; i < 3; i++ {
+			lt, err := a.CreateToken(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens = append(tokens, lt)
+			clock.Add(time.Second)
+		}
+		if _, err := a.CreateToken(2); err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := a.CountForAccount(1); n != 2 {
+			t.Errorf("got %d tokens for account, want: %d", n, 2)
+		}
+		if _, err := a.Peek(tokens[0].Token); err != ErrTokenNotFound {
+			t.Errorf("got error %v for oldest token, want: %v", err, ErrTokenNotFound)
+		}
+		for _, lt := range tokens[1:] {
+			if _, err := a.Peek(lt.Token); err != nil {
+				t.Errorf("got error %v for newer token", err)
+			}
+		}
+	})
+
+	t.Run("reject_new", func(t *testing.T) {
+		clock := newFakeClock()
+		a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithMaxPerAccount(2, false))
+		for i := 0; i < 2; i++ {
+			if _, err := a.CreateToken(1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := a.CreateToken(1); err != ErrTooManyTokens {
+			t.Errorf("got error %v, want: %v", err, ErrTooManyTokens)
+		}
+		if _, err := a.CreateToken(2); err != nil {
+			t.Errorf("got error %v for other account", err)
+		}
+
+		clock.Add(2 * time.Minute)
+		if _, err := a.CreateToken(1); err != nil {
+			t.Errorf("got error %v after previous tokens expired", err)
+		}
+	})
+}
+
+func TestSecureEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"abc", "ABC", false},
+		{"abc", "abcd", false},
+		{"", "", true},
+	}
+	for _, tc := range tests {
+		if got := secureEqual(tc.a, tc.b); got != tc.want {
+			t.Errorf("secureEqual(%q, %q) = %v, want: %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestLoginTokenAuth_Clear(t *testing.T) {
+	a, _ := newTestAuth(time.Minute, WithMetrics(prometheus.NewRegistry()))
+	m := a.metrics
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			a.CreateToken(id)
+		}(i)
+	}
+	wg.Wait()
+	if n, _ := a.Count(); n != 10 {
+		t.Fatalf("got count %d, want: %d", n, 10)
+	}
+
+	if err := a.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := a.Count(); err != nil || n != 0 {
+		t.Errorf("got count %d, %v after clear, want: %d", n, err, 0)
+	}
+	if got := m.Snapshot(); got != (MetricsSnapshot{}) {
+		t.Errorf("got metrics %+v after clear, want zero values", got)
+	}
+}
+
+func TestLoginTokenAuth_prefix(t *testing.T) {
+	a, _ := newTestAuth(time.Minute, WithPrefix("lt_"))
+	ev, _ := newTestAuth(time.Minute, WithPrefix("ev_"))
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(lt.Token, "lt_") || len(lt.Token) != len("lt_")+defaultLoginTokenLength {
+		t.Errorf("got token %q, want prefix %q", lt.Token, "lt_")
+	}
+	if u := a.LoginURL(lt); !strings.HasSuffix(u, "token="+lt.Token) {
+		t.Errorf("got login url %s, want prefixed token", u)
+	}
+
+	if _, err := ev.GetAccountID(lt.Token); !errors.Is(err, ErrTokenPrefix) {
+		t.Errorf("got error %v for token of other type, want: %v", err, ErrTokenPrefix)
+	}
+	if _, err := a.GetAccountID(strings.TrimPrefix(lt.Token, "lt_")); !errors.Is(err, ErrTokenPrefix) {
+		t.Errorf("got error %v for token without prefix, want: %v", err, ErrTokenPrefix)
+	}
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v, want: %d", id, err, 1)
+	}
+
+	if _, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithPrefix("a b")); err == nil {
+		t.Error("got no error for invalid prefix")
+	}
+}
+
+func TestLoginTokenAuth_ListForAccount(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+	if _, err := a.CreateToken(1); err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(2 * time.Minute)
+	first, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(time.Second)
+	if _, err := a.CreateToken(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateToken(2); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := a.ListForAccount(1, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("got %d tokens, want: %d", len(tokens), 2)
+	}
+	hash := a.hashToken(first.Token)
+	if tokens[0].Token != "..."+hash[len(hash)-4:] {
+		t.Errorf("got redacted token %q, want suffix of %q", tokens[0].Token, hash)
+	}
+
+	full, err := a.ListForAccount(1, ListOptions{IncludeFull: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full[0].Token != hash || !full[0].Created.Before(full[1].Created) {
+		t.Errorf("got tokens %+v, want full hashes ordered by creation", full)
+	}
+}
+
+func TestLoginTokenAuth_ListForAccountPaged(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+	for i := 0; i < 5; i++ {
+		if _, err := a.CreateToken(1); err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 1 {
+			clock.Add(time.Second)
+		}
+	}
+	if _, err := a.CreateToken(2); err != nil {
+		t.Fatal(err)
+	}
+	all, err := a.ListForAccount(1, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		offset, limit int
+		want          []LoginToken[int]
+	}{
+		{"first", 0, 2, all[:2]},
+		{"middle", 2, 2, all[2:4]},
+		{"last partial", 4, 2, all[4:]},
+		{"all", 0, 10, all},
+		{"at end", 5, 2, nil},
+		{"out of range", 10, 2, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				page, total, err := a.ListForAccountPaged(1, tc.offset, tc.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if total != 5 || len(page) != len(tc.want) {
+					t.Fatalf("got %d of %d tokens, want: %d of %d", len(page), total, len(tc.want), 5)
+				}
+				for j := range page {
+					if page[j].Token != tc.want[j].Token {
+						t.Errorf("got token %q at %d, want: %q", page[j].Token, j, tc.want[j].Token)
+					}
+				}
+			}
+		})
+	}
+
+	for _, p := range [][2]int{{-1, 2}, {0, 0}, {0, -1}} {
+		if _, _, err := a.ListForAccountPaged(1, p[0], p[1]); err == nil {
+			t.Errorf("got no error for offset %d and limit %d", p[0], p[1])
+		}
+	}
+}
+
+// closingStore is a MemoryStore recording calls to Flush and Close.
+type closingStore struct {
+	*MemoryStore[int]
+	flushed, closed int
+}
+
+func (s *closingStore) Flush(ctx context.Context) error {
+	s.flushed++
+	return nil
+}
+
+func (s *closingStore) Close() error {
+	s.closed++
+	return nil
+}
+
+// pingStore is a MemoryStore failing its health check with err.
+type pingStore struct {
+	*MemoryStore[int]
+	err error
+}
+
+func (s pingStore) Ping(ctx context.Context) error { return s.err }
+
+func TestLoginTokenAuth_Ping(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newTestAuth(time.Minute)
+	if err := a.Ping(ctx); err != nil {
+		t.Errorf("got %v for memory store, want: nil", err)
+	}
+
+	a, _ = newTestAuth(time.Minute, WithStore[int](pingStore{NewMemoryStore[int](), errStore}))
+	if err := a.Ping(ctx); err != errStore {
+		t.Errorf("got %v, want: %v", err, errStore)
+	}
+
+	a, _ = newTestAuth(time.Minute, WithStore[int](NewCachingStore[int](NewMemoryStore[int](), pingStore{NewMemoryStore[int](), errStore})))
+	if err := a.Ping(ctx); err != errStore {
+		t.Errorf("got %v through caching store, want: %v", err, errStore)
+	}
+
+	if err := a.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Ping(ctx); err != ErrClosed {
+		t.Errorf("got %v after close, want: %v", err, ErrClosed)
+	}
+}
+
+func TestLoginTokenAuth_Start(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newTestAuth(time.Minute, WithStore[int](pingStore{NewMemoryStore[int](), errStore}))
+	if err := a.Start(ctx); !errors.Is(err, errStore) {
+		t.Errorf("got %v for unreachable store, want error wrapping %v", err, errStore)
+	}
+	if a.gcStop != nil {
+		t.Error("gc started for unreachable store")
+	}
+
+	a, _ = newTestAuth(time.Minute, WithCreateTable(true))
+	if err := a.Start(ctx); err == nil {
+		t.Error("got no error creating table of memory store")
+	}
+
+	a, store := newTestAuth(time.Millisecond, WithGCInterval(time.Millisecond))
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := a.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.Get(ctx, a.hashToken(lt.Token)); ok {
+		t.Error("expired token not purged by gc")
+	}
+}
+
+func TestLoginTokenAuth_Close(t *testing.T) {
+	store := &closingStore{MemoryStore: NewMemoryStore[int]()}
+	a, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithStore[int](store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.StartGC(time.Millisecond)
+
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if store.flushed != 1 || store.closed != 1 {
+		t.Errorf("got store flushed %d and closed %d times, want once", store.flushed, store.closed)
+	}
+
+	if _, err := a.CreateToken(1); err != ErrClosed {
+		t.Errorf("got error %v creating token after close, want: %v", err, ErrClosed)
+	}
+	if _, err := a.GetAccountID(lt.Token); err != ErrClosed {
+		t.Errorf("got error %v consuming token after close, want: %v", err, ErrClosed)
+	}
+	if _, err := a.Count(); err != ErrClosed {
+		t.Errorf("got error %v counting tokens after close, want: %v", err, ErrClosed)
+	}
+	a.StartGC(time.Millisecond)
+	if a.gcStop != nil {
+		t.Error("gc started after close")
+	}
+}
+
+func TestLoginTokenAuth_ConsumeAndRotate(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+	old, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, lt, err := a.ConsumeAndRotate(old.Token, 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || lt.AccountID != 1 || lt.Token == old.Token {
+		t.Errorf("got %d, %+v, want new token for account %d", id, lt, 1)
+	}
+	if want := clock.Now().Add(30 * time.Second); !lt.Expiry.Equal(want) {
+		t.Errorf("got expiry %v, want: %v", lt.Expiry, want)
+	}
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v for new token, want: %d", id, err, 1)
+	}
+	if _, _, err := a.ConsumeAndRotate(old.Token, 0); err != ErrTokenReuseDetected {
+		t.Errorf("got error %v rotating superseded token, want: %v", err, ErrTokenReuseDetected)
+	}
+}
+
+func TestLoginTokenAuth_ConsumeAndRotate_reuse(t *testing.T) {
+	a, store := newTestAuth(time.Minute)
+	first, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := a.ConsumeAndRotate(first.Token, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, third, err := a.ConsumeAndRotate(second.Token, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	family := store.token[a.hashToken(first.Token)].FamilyID
+	if family == "" || store.token[a.hashToken(third.Token)].FamilyID != family {
+		t.Fatalf("got family %q of rotated token, want family shared with the first token", store.token[a.hashToken(third.Token)].FamilyID)
+	}
+
+	if _, err := a.GetAccountID(second.Token); !errors.Is(err, ErrTokenReuseDetected) {
+		t.Errorf("got error %v replaying superseded token, want: %v", err, ErrTokenReuseDetected)
+	}
+	for _, lt := range []LoginToken[int]{first, second, third} {
+		if _, err := a.Peek(lt.Token); err != ErrTokenNotFound {
+			t.Errorf("got error %v for token of revoked family, want: %v", err, ErrTokenNotFound)
+		}
+	}
+	if id, err := a.GetAccountID(other.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v for token outside the family, want: %d", id, err, 1)
+	}
+}
+
+func TestLoginTokenAuth_ConsumeAndRotate_createFails(t *testing.T) {
+	a, _ := newTestAuth(time.Minute, WithMaxPerAccount(1, false))
+	old, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := a.ConsumeAndRotate(old.Token, 0); err != ErrTooManyTokens {
+		t.Errorf("got error %v, want: %v", err, ErrTooManyTokens)
+	}
+	if _, err := a.Peek(old.Token); err != nil {
+		t.Errorf("got error %v, want old token kept valid", err)
+	}
+}
+
+func TestLoginTokenAuth_expiryJitter(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithExpiryJitter(time.Minute))
+	min := clock.Now().Add(time.Minute)
+	max := min.Add(time.Minute)
+
+	first, last := max, min
+	for i := 0; i < 100; i++ {
+		lt, err := a.CreateToken(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lt.Expiry.Before(min) || lt.Expiry.After(max) {
+			t.Fatalf("got expiry %v outside of jitter window [%v, %v]", lt.Expiry, min, max)
+		}
+		if lt.Expiry.Before(first) {
+			first = lt.Expiry
+		}
+		if lt.Expiry.After(last) {
+			last = lt.Expiry
+		}
+	}
+	if spread := last.Sub(first); spread < 30*time.Second {
+		t.Errorf("got expiries spread over %s, want most of the jitter window", spread)
+	}
+}
+
+func TestLoginTokenAuth_alphabet(t *testing.T) {
+	const alphabet = "23456789abcdefghijkmnpqrstuvwxyz"
+	a, _ := newTestAuth(time.Minute, WithAlphabet(alphabet))
+	for i := 0; i < 100; i++ {
+		lt, err := a.CreateToken(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i := strings.IndexFunc(lt.Token, func(r rune) bool { return !strings.ContainsRune(alphabet, r) }); i >= 0 {
+			t.Fatalf("got character %q not in alphabet", lt.Token[i])
+		}
+	}
+}
+
+func TestLoginTokenAuth_bound(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+	fp := Fingerprint("127.0.0.1", "test-agent")
+	if fp == Fingerprint("127.0.0.2", "test-agent") {
+		t.Fatal("got equal fingerprints for different clients")
+	}
+
+	lt, err := a.CreateTokenBound(1, fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountIDBound(lt.Token, Fingerprint("10.0.0.1", "test-agent")); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Errorf("got error %v for other fingerprint, want: %v", err, ErrFingerprintMismatch)
+	}
+	if _, err := a.GetAccountID(lt.Token); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Errorf("got error %v consuming bound token without fingerprint, want: %v", err, ErrFingerprintMismatch)
+	}
+	if _, err := a.Peek(lt.Token); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Errorf("got error %v peeking bound token without fingerprint, want: %v", err, ErrFingerprintMismatch)
+	}
+	if id, err := a.PeekBound(lt.Token, fp); err != nil || id != 1 {
+		t.Errorf("got %d, %v peeking with matching fingerprint, want: %d", id, err, 1)
+	}
+	if id, err := a.GetAccountIDBound(lt.Token, fp); err != nil || id != 1 {
+		t.Errorf("got %d, %v for matching fingerprint, want: %d", id, err, 1)
+	}
+
+	unbound, err := a.CreateTokenBound(2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := a.GetAccountIDBound(unbound.Token, fp); err != nil || id != 2 {
+		t.Errorf("got %d, %v for unbound token, want: %d", id, err, 2)
+	}
+}
+
+func TestLoginTokenAuth_scoped(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+
+	lt, err := a.CreateScopedToken(1, "delete-account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountIDForScope(lt.Token, "change-email"); !errors.Is(err, ErrScopeMismatch) {
+		t.Errorf("got error %v for other scope, want: %v", err, ErrScopeMismatch)
+	}
+	if _, err := a.GetAccountID(lt.Token); !errors.Is(err, ErrScopeMismatch) {
+		t.Errorf("got error %v consuming scoped token as login token, want: %v", err, ErrScopeMismatch)
+	}
+	if _, _, err := a.ConsumeAndRotate(lt.Token, 0); err != ErrScopeMismatch {
+		t.Errorf("got error %v rotating scoped token, want: %v", err, ErrScopeMismatch)
+	}
+	if id, err := a.GetAccountIDForScope(lt.Token, "delete-account"); err != nil || id != 1 {
+		t.Errorf("got %d, %v for matching scope, want: %d, <nil>", id, err, 1)
+	}
+	if _, err := a.GetAccountIDForScope(lt.Token, "delete-account"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got error %v for consumed scoped token, want: %v", err, ErrTokenNotFound)
+	}
+
+	login, err := a.CreateToken(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountIDForScope(login.Token, "delete-account"); !errors.Is(err, ErrScopeMismatch) {
+		t.Errorf("got error %v consuming login token for scope, want: %v", err, ErrScopeMismatch)
+	}
+	if id, err := a.GetAccountID(login.Token); err != nil || id != 2 {
+		t.Errorf("got %d, %v for login token, want: %d, <nil>", id, err, 2)
+	}
+}
+
+func TestLoginTokenAuth_purgeCount(t *testing.T) {
+	clock := newFakeClock()
+	purged := make(chan int, 10)
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithPurgeCallback(func(n int) { purged <- n }))
+	for i := 0; i < 3; i++ {
+		if _, err := a.CreateToken(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := a.CreateTokenWithExpiry(4, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(2 * time.Minute)
+
+	n, err := a.purgeExpired(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("got %d tokens purged, want: %d", n, 3)
+	}
+
+	if _, err := a.CreateToken(5); err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(2 * time.Minute)
+	a.StartGC(time.Millisecond)
+	defer a.Close(context.Background())
+	select {
+	case n := <-purged:
+		if n != 1 {
+			t.Errorf("got purge callback with %d, want: %d", n, 1)
+		}
+	case <-time.After(time.Second):
+		t.Error("purge callback not called")
+	}
+}
+
+func TestMemoryStore_maxSize(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	evicted := 0
+	s := NewBoundedMemoryStore[int](2)
+	s.onEvict = func() { evicted++ }
+
+	save := func(token string, created time.Time, ttl time.Duration) {
+		if err := s.Save(ctx, LoginToken[int]{Token: token, Created: created, Expiry: created.Add(ttl)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("a", now, time.Minute)
+	save("b", now.Add(time.Second), time.Minute)
+	save("c", now.Add(2*time.Second), time.Minute)
+	if _, ok, _ := s.Get(ctx, "a"); ok || len(s.token) != 2 {
+		t.Errorf("least recently created token not evicted, got %d tokens", len(s.token))
+	}
+	if evicted != 1 {
+		t.Errorf("got %d forced evictions, want: %d", evicted, 1)
+	}
+
+	// b expired at the time d is created and is evicted without counting as forced eviction
+	save("d", now.Add(2*time.Minute), time.Minute)
+	if _, ok, _ := s.Get(ctx, "b"); ok {
+		t.Error("expired token not evicted")
+	}
+	if evicted != 1 {
+		t.Errorf("got %d forced evictions, want: %d", evicted, 1)
+	}
+
+	if err := s.Delete(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	save("e", now.Add(2*time.Minute), time.Minute)
+	if len(s.token) != 2 || s.order.Len() != 2 || evicted != 1 {
+		t.Errorf("got %d tokens, %d ordered, %d evictions after delete", len(s.token), s.order.Len(), evicted)
+	}
+}
+
+func TestMemoryStore_maxSizeExpiredFirst(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	evicted := 0
+	s := NewBoundedMemoryStore[int](2)
+	s.onEvict = func() { evicted++ }
+
+	// b is created after a but already expired, it is evicted instead of the live a
+	for _, lt := range []LoginToken[int]{
+		{Token: "a", Created: now, Expiry: now.Add(time.Hour)},
+		{Token: "b", Created: now.Add(time.Second), Expiry: now},
+		{Token: "c", Created: now.Add(2 * time.Second), Expiry: now.Add(time.Hour)},
+	} {
+		if err := s.Save(ctx, lt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok, _ := s.Get(ctx, "b"); ok {
+		t.Error("expired token kept while evicting")
+	}
+	if _, ok, _ := s.Get(ctx, "a"); !ok {
+		t.Error("live token evicted while an expired token was stored")
+	}
+	if evicted != 0 {
+		t.Errorf("got %d forced evictions, want: %d", evicted, 0)
+	}
+	if errs := s.Verify(ctx); len(errs) > 0 {
+		t.Errorf("got invariant violations %v", errs)
+	}
+}
+
+// hookedContext calls hook whenever Err is checked, e.g. between chunks of a purge.
+type hookedContext struct {
+	context.Context
+	hook func()
+}
+
+func (c hookedContext) Err() error {
+	c.hook()
+	return c.Context.Err()
+}
+
+func TestMemoryStore_PurgeExpiredChunkedDeleteResume(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := NewMemoryStore[int]()
+	for i := 0; i < 9; i++ {
+		ttl := time.Minute
+		if i >= 6 {
+			ttl = -time.Minute
+		}
+		if err := s.Save(ctx, LoginToken[int]{Token: strconv.Itoa(i), AccountID: i, Created: now, Expiry: now.Add(ttl)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// delete tokens between chunks as consumed concurrently, starting with the one the second chunk resumes at
+	checks := 0
+	hooked := hookedContext{ctx, func() {
+		if checks++; checks >= 2 && checks <= 5 {
+			s.Delete(ctx, strconv.Itoa(checks))
+		}
+	}}
+	purged, err := s.PurgeExpiredChunked(hooked, now, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 3 || checks != 4 {
+		t.Errorf("got %d purged in %d chunks, want: 3 in 4", len(purged), checks)
+	}
+}
+
+func TestMemoryStore_PurgeExpiredChunked(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := NewMemoryStore[int]()
+	for i := 0; i < 10; i++ {
+		ttl := time.Minute
+		if i%3 == 0 {
+			ttl = -time.Minute
+		}
+		if err := s.Save(ctx, LoginToken[int]{Token: strconv.Itoa(i), AccountID: i, Created: now, Expiry: now.Add(ttl)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purged, err := s.PurgeExpiredChunked(ctx, now, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 4 || s.Len() != 6 || s.order.Len() != 6 {
+		t.Errorf("got %d purged and %d tokens left, want: %d and %d", len(purged), s.Len(), 4, 6)
+	}
+	for _, lt := range purged {
+		if lt.AccountID%3 != 0 {
+			t.Errorf("unexpired token %s purged", lt.Token)
+		}
+	}
+
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Minute, WithClock(clock.Now), WithPurgeBatchSize(2))
+	for i := 0; i < 5; i++ {
+		if _, err := a.CreateToken(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.Add(2 * time.Minute)
+	if n, err := a.PurgeNow(ctx); err != nil || n != 5 || len(store.token) != 0 {
+		t.Errorf("got %d purged with %d left, err %v, want: %d purged", n, len(store.token), err, 5)
+	}
+
+	if _, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithPurgeBatchSize(-1)); err == nil {
+		t.Error("negative purge batch size accepted")
+	}
+}
+
+// BenchmarkMemoryStore_purge reports the longest stall of a concurrent Get while purging
+// a store of 100000 tokens, half of them expired, in a single pass and in chunks.
+func BenchmarkMemoryStore_purge(b *testing.B) {
+	for _, size := range []int{0, 100} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			ctx := context.Background()
+			now := time.Now()
+			s := NewMemoryStore[int]()
+			var stall time.Duration
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				for j := 0; j < 100000; j++ {
+					lt := LoginToken[int]{Token: strconv.Itoa(j), AccountID: j, Created: now, Expiry: now.Add(time.Minute)}
+					if j%2 == 0 {
+						lt.Expiry = now.Add(-time.Minute)
+					}
+					s.Save(ctx, lt)
+				}
+				done := make(chan struct{})
+				stalled := make(chan time.Duration)
+				go func() {
+					var longest time.Duration
+					for {
+						select {
+						case <-done:
+							stalled <- longest
+							return
+						default:
+						}
+						start := time.Now()
+						s.Get(ctx, "1")
+						longest = max(longest, time.Since(start))
+					}
+				}()
+				b.StartTimer()
+
+				if _, err := s.PurgeExpiredChunked(ctx, now, size); err != nil {
+					b.Fatal(err)
+				}
+				close(done)
+				stall = max(stall, <-stalled)
+			}
+			b.ReportMetric(float64(stall.Microseconds()), "max-stall-µs")
+		})
+	}
+}
+
+func TestLoginTokenAuth_maxStoreSize(t *testing.T) {
+	a, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithMaxStoreSize(3), WithMetrics(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := a.metrics
+	for i := 0; i < 5; i++ {
+		if _, err := a.CreateToken(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, _ := a.Count(); n != 3 {
+		t.Errorf("got %d tokens, want: %d", n, 3)
+	}
+	if got := m.Snapshot().Evicted; got != 2 {
+		t.Errorf("got %d evicted, want: %d", got, 2)
+	}
+
+	if _, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithMaxStoreSize(3), WithStore(NewMemoryStore[int]())); err == nil {
+		t.Error("got no error combining max store size with custom store")
+	}
+}
+
+func TestLoginToken_MarshalJSON(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := json.Marshal(lt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(v), lt.Token) {
+		t.Errorf("got %s, want tokenstring %q redacted", v, lt.Token)
+	}
+	var got LoginToken[int]
+	if err := json.Unmarshal(v, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Token != redactToken(lt.Token) || got.AccountID != 1 || !got.Expiry.Equal(lt.Expiry) || !got.Created.Equal(lt.Created) {
+		t.Errorf("got %+v, want %+v with redacted tokenstring", got, lt)
+	}
+
+	if v, err = json.Marshal([]LoginToken[int]{lt}); err != nil || strings.Contains(string(v), lt.Token) {
+		t.Errorf("got %s, %v for slice of tokens, want tokenstring redacted", v, err)
+	}
+}
+
+func TestLoginToken_Valid(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		lt   LoginToken[int]
+		at   time.Time
+		want bool
+	}{
+		{"before expiry", LoginToken[int]{Expiry: now}, now.Add(-time.Nanosecond), true},
+		{"at expiry", LoginToken[int]{Expiry: now}, now, true},
+		{"after expiry", LoginToken[int]{Expiry: now}, now.Add(time.Nanosecond), false},
+		{"at idle timeout", LoginToken[int]{Created: now, Expiry: now.Add(time.Hour), IdleTimeout: time.Minute}, now.Add(time.Minute), true},
+		{"after idle timeout", LoginToken[int]{Created: now, Expiry: now.Add(time.Hour), IdleTimeout: time.Minute}, now.Add(time.Minute + time.Nanosecond), false},
+		{"used within idle timeout", LoginToken[int]{Created: now, LastUsed: now.Add(time.Minute), Expiry: now.Add(time.Hour), IdleTimeout: time.Minute}, now.Add(2 * time.Minute), true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.lt.Valid(tc.at); got != tc.want {
+				t.Errorf("got %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoginTokenAuth_validAtExpiry(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Add(lt.Expiry.Sub(clock.Now()))
+	if ttl, err := a.TTL(lt.Token); err != nil || ttl != 0 {
+		t.Errorf("got %s, %v at expiry, want: 0, <nil>", ttl, err)
+	}
+	if n, err := a.PurgeNow(context.Background()); err != nil || n != 0 {
+		t.Errorf("got %d, %v purged at expiry, want: 0, <nil>", n, err)
+	}
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v at expiry, want: %d, <nil>", id, err, 1)
+	}
+}
+
+func TestLoginToken_String(t *testing.T) {
+	lt := LoginToken[int]{Token: "secrettokenstring", AccountID: 1, Expiry: time.Now()}
+	if s := lt.String(); strings.Contains(s, lt.Token) || !strings.Contains(s, "...ring") {
+		t.Errorf("got %q, want tokenstring redacted", s)
+	}
+	if s := fmt.Sprint(lt); strings.Contains(s, lt.Token) {
+		t.Errorf("got %q formatting token, want tokenstring redacted", s)
+	}
+}
@@ -0,0 +1,259 @@
+package pwdless
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// consumeAgeBuckets are the upper bounds of the token age histogram, spanning quick clicks to links opened a day later.
+var consumeAgeBuckets = []time.Duration{
+	10 * time.Second, 30 * time.Second, time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute,
+	15 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour, 24 * time.Hour,
+}
+
+var (
+	createdDesc         = prometheus.NewDesc("logintoken_created_total", "Number of login tokens created.", nil, nil)
+	consumedDesc        = prometheus.NewDesc("logintoken_consumed_total", "Number of login tokens successfully consumed.", nil, nil)
+	consumeFailuresDesc = prometheus.NewDesc("logintoken_consume_failures_total", "Number of failed login token consumptions by reason.", []string{"reason"}, nil)
+	purgedDesc          = prometheus.NewDesc("logintoken_purged_total", "Number of expired login tokens removed from the store.", nil, nil)
+	evictedDesc         = prometheus.NewDesc("logintoken_evicted_total", "Number of unexpired login tokens evicted to stay within the store size limit.", nil, nil)
+	pressureDesc        = prometheus.NewDesc("logintoken_memory_pressure_total", "Number of token creations finding the store at its high-water mark.", nil, nil)
+	limitedDesc         = prometheus.NewDesc("logintoken_create_limited_total", "Number of token creations rejected by the rate limit or the limit of tokens per account.", nil, nil)
+	webhookDroppedDesc  = prometheus.NewDesc("logintoken_webhook_dropped_total", "Number of webhook events dropped as the queue was full.", nil, nil)
+	degradedDesc        = prometheus.NewDesc("logintoken_store_degraded_total", "Number of times the token store degraded to memory as the primary store failed.", nil, nil)
+	activeDesc          = prometheus.NewDesc("logintoken_active", "Number of unexpired login tokens as of the last purge.", nil, nil)
+	consumeAgeDesc      = prometheus.NewDesc("logintoken_consume_age_seconds", "Age of login tokens at successful consumption by token scope.", []string{"scope"}, nil)
+)
+
+// Metrics counts login token operations and is safe for concurrent use.
+// It implements prometheus.Collector, see WithMetrics.
+type Metrics struct {
+	created         atomic.Int64
+	consumed        atomic.Int64
+	consumeNotFound atomic.Int64
+	consumeExpired  atomic.Int64
+	purged          atomic.Int64
+	evicted         atomic.Int64
+	pressure        atomic.Int64
+	limited         atomic.Int64
+	webhookDropped  atomic.Int64
+	degraded        atomic.Int64
+	active          atomic.Int64
+
+	agesMux sync.Mutex
+	ages    map[string]*AgeHistogram // by token scope
+}
+
+// AgeHistogram counts the age of tokens at consumption in buckets, see Metrics.ConsumeAges.
+type AgeHistogram struct {
+	// Bounds are the upper bounds of the buckets.
+	Bounds []time.Duration
+	// Counts are the cumulative number of observations per bucket, not greater than its bound.
+	Counts []int64
+	Sum    time.Duration
+	Count  int64
+}
+
+// observe counts the age d.
+func (h *AgeHistogram) observe(d time.Duration) {
+	for i, b := range h.Bounds {
+		if d <= b {
+			h.Counts[i]++
+		}
+	}
+	h.Sum += d
+	h.Count++
+}
+
+// NewMetrics returns a Metrics with all values set to zero.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// MetricsSnapshot holds the values of Metrics at a point in time.
+type MetricsSnapshot struct {
+	Created         int64
+	Consumed        int64
+	ConsumeNotFound int64
+	ConsumeExpired  int64
+	Purged          int64
+	Evicted         int64
+	Pressure        int64
+	Limited         int64
+	WebhookDropped  int64
+	Degraded        int64
+	Active          int64
+}
+
+// Snapshot returns the current values.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	return MetricsSnapshot{
+		Created:         m.created.Load(),
+		Consumed:        m.consumed.Load(),
+		ConsumeNotFound: m.consumeNotFound.Load(),
+		ConsumeExpired:  m.consumeExpired.Load(),
+		Purged:          m.purged.Load(),
+		Evicted:         m.evicted.Load(),
+		Pressure:        m.pressure.Load(),
+		Limited:         m.limited.Load(),
+		WebhookDropped:  m.webhookDropped.Load(),
+		Degraded:        m.degraded.Load(),
+		Active:          m.active.Load(),
+	}
+}
+
+// ConsumeAges returns the histograms of the age of tokens at successful consumption by token scope,
+// the empty scope holding login tokens. Tokens without creation time are not counted.
+func (m *Metrics) ConsumeAges() map[string]AgeHistogram {
+	m.agesMux.Lock()
+	defer m.agesMux.Unlock()
+	ages := make(map[string]AgeHistogram, len(m.ages))
+	for scope, h := range m.ages {
+		c := *h
+		c.Counts = append([]int64(nil), h.Counts...)
+		ages[scope] = c
+	}
+	return ages
+}
+
+// Describe sends the descriptors of all metrics to ch, implementing prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		createdDesc, consumedDesc, consumeFailuresDesc, purgedDesc, evictedDesc, pressureDesc,
+		limitedDesc, webhookDroppedDesc, degradedDesc, activeDesc, consumeAgeDesc,
+	} {
+		ch <- d
+	}
+}
+
+// Collect sends the current values to ch, implementing prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	s := m.Snapshot()
+	counter := func(d *prometheus.Desc, v int64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, float64(v), labels...)
+	}
+	counter(createdDesc, s.Created)
+	counter(consumedDesc, s.Consumed)
+	counter(consumeFailuresDesc, s.ConsumeNotFound, "not_found")
+	counter(consumeFailuresDesc, s.ConsumeExpired, "expired")
+	counter(purgedDesc, s.Purged)
+	counter(evictedDesc, s.Evicted)
+	counter(pressureDesc, s.Pressure)
+	counter(limitedDesc, s.Limited)
+	counter(webhookDroppedDesc, s.WebhookDropped)
+	counter(degradedDesc, s.Degraded)
+	ch <- prometheus.MustNewConstMetric(activeDesc, prometheus.GaugeValue, float64(s.Active))
+	for scope, h := range m.ConsumeAges() {
+		buckets := make(map[float64]uint64, len(h.Bounds))
+		for i, b := range h.Bounds {
+			buckets[b.Seconds()] = uint64(h.Counts[i])
+		}
+		ch <- prometheus.MustNewConstHistogram(consumeAgeDesc, uint64(h.Count), h.Sum.Seconds(), buckets, scope)
+	}
+}
+
+// The following methods are no-ops on a nil Metrics.
+
+func (m *Metrics) reset() {
+	if m != nil {
+		m.created.Store(0)
+		m.consumed.Store(0)
+		m.consumeNotFound.Store(0)
+		m.consumeExpired.Store(0)
+		m.purged.Store(0)
+		m.evicted.Store(0)
+		m.pressure.Store(0)
+		m.limited.Store(0)
+		m.webhookDropped.Store(0)
+		m.degraded.Store(0)
+		m.active.Store(0)
+		m.agesMux.Lock()
+		m.ages = nil
+		m.agesMux.Unlock()
+	}
+}
+
+func (m *Metrics) incCreated() {
+	if m != nil {
+		m.created.Add(1)
+	}
+}
+
+func (m *Metrics) incConsumed() {
+	if m != nil {
+		m.consumed.Add(1)
+	}
+}
+
+func (m *Metrics) incConsumeNotFound() {
+	if m != nil {
+		m.consumeNotFound.Add(1)
+	}
+}
+
+func (m *Metrics) incConsumeExpired() {
+	if m != nil {
+		m.consumeExpired.Add(1)
+	}
+}
+
+func (m *Metrics) observeConsumeAge(scope string, age time.Duration) {
+	if m != nil {
+		m.agesMux.Lock()
+		defer m.agesMux.Unlock()
+		h, ok := m.ages[scope]
+		if !ok {
+			if m.ages == nil {
+				m.ages = make(map[string]*AgeHistogram)
+			}
+			h = &AgeHistogram{Bounds: consumeAgeBuckets, Counts: make([]int64, len(consumeAgeBuckets))}
+			m.ages[scope] = h
+		}
+		h.observe(age)
+	}
+}
+
+func (m *Metrics) addPurged(n int) {
+	if m != nil {
+		m.purged.Add(int64(n))
+	}
+}
+
+func (m *Metrics) incEvicted() {
+	if m != nil {
+		m.evicted.Add(1)
+	}
+}
+
+func (m *Metrics) incPressure() {
+	if m != nil {
+		m.pressure.Add(1)
+	}
+}
+
+func (m *Metrics) incLimited() {
+	if m != nil {
+		m.limited.Add(1)
+	}
+}
+
+func (m *Metrics) setActive(n int) {
+	if m != nil {
+		m.active.Store(int64(n))
+	}
+}
+
+func (m *Metrics) incWebhookDropped() {
+	if m != nil {
+		m.webhookDropped.Add(1)
+	}
+}
+
+func (m *Metrics) incDegraded() {
+	if m != nil {
+		m.degraded.Add(1)
+	}
+}
@@ -0,0 +1,186 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gathered returns the metric named name with a label for each pair of labels gathered from reg, or nil if not found.
+func gathered(t *testing.T, reg *prometheus.Registry, name string, labels ...string) *dto.Metric {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range f.GetMetric() {
+			for i := 0; i < len(labels); i += 2 {
+				found := false
+				for _, l := range m.GetLabel() {
+					found = found || l.GetName() == labels[i] && l.GetValue() == labels[i+1]
+				}
+				if !found {
+					continue metrics
+				}
+			}
+			return m
+		}
+	}
+	return nil
+}
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithMetrics(reg))
+	m := a.metrics
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiring, err := a.CreateToken(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateToken(3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountID(lt.Token); err != nil {
+		t.Fatal(err)
+	}
+	a.GetAccountID(lt.Token)
+	if _, err := a.purgeExpired(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Snapshot().Active; got != 2 {
+		t.Errorf("got %d active tokens, want: %d", got, 2)
+	}
+
+	clock.Add(2 * time.Minute)
+	a.GetAccountID(expiring.Token)
+	if _, err := a.purgeExpired(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := MetricsSnapshot{
+		Created:         3,
+		Consumed:        1,
+		ConsumeNotFound: 1,
+		ConsumeExpired:  1,
+		Purged:          2,
+		Active:          0,
+	}
+	if got := m.Snapshot(); got != want {
+		t.Errorf("got metrics %+v, want: %+v", got, want)
+	}
+
+	if got := gathered(t, reg, "logintoken_created_total").GetCounter().GetValue(); got != 3 {
+		t.Errorf("got %g created gathered, want: %d", got, 3)
+	}
+	if got := gathered(t, reg, "logintoken_consume_failures_total", "reason", "expired").GetCounter().GetValue(); got != 1 {
+		t.Errorf("got %g expired failures gathered, want: %d", got, 1)
+	}
+	if active := gathered(t, reg, "logintoken_active"); active.GetGauge() == nil {
+		t.Errorf("got %v active gathered, want gauge", active)
+	}
+	if _, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithMetrics(reg)); err == nil {
+		t.Error("got nil error registering metrics twice")
+	}
+}
+
+func TestMetrics_expiredCountedOnce(t *testing.T) {
+	for _, count := range []bool{true, false} {
+		clock := newFakeClock()
+		expired := 0
+		a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithMetrics(prometheus.NewRegistry()), WithCountAccessExpiry(count),
+			WithHooks(Hooks[int]{OnExpire: func(LoginToken[int]) { expired++ }}))
+		m := a.metrics
+
+		accessed, err := a.CreateToken(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.CreateToken(2); err != nil {
+			t.Fatal(err)
+		}
+		clock.Add(2 * time.Minute)
+		if _, err := a.GetAccountID(accessed.Token); !errors.Is(err, ErrTokenExpired) {
+			t.Fatalf("got error %v, want: %v", err, ErrTokenExpired)
+		}
+		if _, err := a.purgeExpired(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		want := 1
+		if count {
+			want = 2
+		}
+		if got := m.Snapshot().Purged; got != int64(want) || expired != want {
+			t.Errorf("counting access expiry %t: got %d purged and %d expire hook calls, want: %d", count, got, expired, want)
+		}
+	}
+}
+
+func TestMetrics_consumeAge(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Hour, WithClock(clock.Now), WithMetrics(reg))
+	m := a.metrics
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scoped, err := a.CreateScopedToken(1, "delete-account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(4 * time.Minute)
+	if _, err := a.GetAccountID(lt.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountIDForScope(scoped.Token, "delete-account"); err != nil {
+		t.Fatal(err)
+	}
+
+	ages := m.ConsumeAges()
+	for _, scope := range []string{"", "delete-account"} {
+		h := ages[scope]
+		if h.Count != 1 || h.Sum != 4*time.Minute {
+			t.Fatalf("got %d observations summing to %s for scope %q, want: 1 of %s", h.Count, h.Sum, scope, 4*time.Minute)
+		}
+		for i, b := range h.Bounds {
+			want := int64(0)
+			if b >= 5*time.Minute {
+				want = 1
+			}
+			if h.Counts[i] != want {
+				t.Errorf("got %d observations in bucket %s for scope %q, want: %d", h.Counts[i], b, scope, want)
+			}
+		}
+	}
+
+	for _, b := range gathered(t, reg, "logintoken_consume_age_seconds", "scope", "").GetHistogram().GetBucket() {
+		want := uint64(0)
+		if b.GetUpperBound() >= 300 {
+			want = 1
+		}
+		if b.GetCumulativeCount() != want {
+			t.Errorf("got %d gathered in bucket %g, want: %d", b.GetCumulativeCount(), b.GetUpperBound(), want)
+		}
+	}
+	h := gathered(t, reg, "logintoken_consume_age_seconds", "scope", "delete-account").GetHistogram()
+	if h.GetSampleSum() != 240 || h.GetSampleCount() != 1 {
+		t.Errorf("got %d gathered summing to %g for scope %q, want: 1 of 240", h.GetSampleCount(), h.GetSampleSum(), "delete-account")
+	}
+}
@@ -0,0 +1,150 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// MigratingStore implements TokenStore moving from a secondary store to a primary store without dropping tokens,
+// e.g. from a MemoryStore to a RedisStore. Writes go to the primary store only, reads check the primary store
+// and fall back to the secondary store, deletes apply to both. Once all tokens of the secondary store expired
+// the MigratingStore can be replaced by the primary store.
+type MigratingStore[ID comparable] struct {
+	primary   TokenStore[ID]
+	secondary TokenStore[ID]
+}
+
+// NewMigratingStore returns a MigratingStore writing to primary and additionally reading from secondary.
+func NewMigratingStore[ID comparable](primary, secondary TokenStore[ID]) *MigratingStore[ID] {
+	return &MigratingStore[ID]{
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+// Save stores the login token in the primary store.
+func (s *MigratingStore[ID]) Save(ctx context.Context, lt LoginToken[ID]) error {
+	return s.primary.Save(ctx, lt)
+}
+
+// Get returns the login token for tokenstring from the primary or the secondary store and whether it exists.
+func (s *MigratingStore[ID]) Get(ctx context.Context, token string) (LoginToken[ID], bool, error) {
+	lt, ok, err := s.primary.Get(ctx, token)
+	if err != nil || ok {
+		return lt, ok, err
+	}
+	return s.secondary.Get(ctx, token)
+}
+
+// Delete removes the login token for tokenstring from both stores.
+func (s *MigratingStore[ID]) Delete(ctx context.Context, token string) error {
+	return errors.Join(s.primary.Delete(ctx, token), s.secondary.Delete(ctx, token))
+}
+
+// DeleteByAccount removes all login tokens referencing account ID from both stores and returns the number removed.
+func (s *MigratingStore[ID]) DeleteByAccount(ctx context.Context, id ID) (int, error) {
+	n, err := s.primary.DeleteByAccount(ctx, id)
+	m, err2 := s.secondary.DeleteByAccount(ctx, id)
+	return n + m, errors.Join(err, err2)
+}
+
+// PurgeExpired removes all login tokens expired at now from both stores and returns the removed tokens.
+func (s *MigratingStore[ID]) PurgeExpired(ctx context.Context, now time.Time) ([]LoginToken[ID], error) {
+	purged, err := s.primary.PurgeExpired(ctx, now)
+	old, err2 := s.secondary.PurgeExpired(ctx, now)
+	return append(purged, old...), errors.Join(err, err2)
+}
+
+// Count returns the number of login tokens not expired at now in both stores.
+func (s *MigratingStore[ID]) Count(ctx context.Context, now time.Time) (int, error) {
+	n, err := s.primary.Count(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	m, err := s.secondary.Count(ctx, now)
+	return n + m, err
+}
+
+// CountForAccount returns the number of login tokens referencing account ID not expired at now in both stores.
+func (s *MigratingStore[ID]) CountForAccount(ctx context.Context, id ID, now time.Time) (int, error) {
+	n, err := s.primary.CountForAccount(ctx, id, now)
+	if err != nil {
+		return 0, err
+	}
+	m, err := s.secondary.CountForAccount(ctx, id, now)
+	return n + m, err
+}
+
+// Clear removes all login tokens from both stores.
+func (s *MigratingStore[ID]) Clear(ctx context.Context) error {
+	return errors.Join(s.primary.Clear(ctx), s.secondary.Clear(ctx))
+}
+
+// List returns all login tokens referencing account ID not expired at now from both stores.
+func (s *MigratingStore[ID]) List(ctx context.Context, id ID, now time.Time) ([]LoginToken[ID], error) {
+	tokens, err := s.primary.List(ctx, id, now)
+	if err != nil {
+		return nil, err
+	}
+	old, err := s.secondary.List(ctx, id, now)
+	if err != nil {
+		return nil, err
+	}
+	return append(tokens, old...), nil
+}
+
+// Extend sets the expiry of the login token for tokenstring if it exists and is not expired at now.
+// Tokens of the secondary store are moved to the primary store with the new expiry.
+func (s *MigratingStore[ID]) Extend(ctx context.Context, token string, now, expiry time.Time) (LoginToken[ID], bool, error) {
+	lt, ok, err := s.primary.Extend(ctx, token, now, expiry)
+	if err != nil || ok {
+		return lt, ok, err
+	}
+	lt, ok, err = s.secondary.Get(ctx, token)
+	if err != nil || !ok || !lt.Valid(now) {
+		return LoginToken[ID]{}, false, err
+	}
+	lt.Expiry = expiry
+	if err := s.primary.Save(ctx, lt); err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	if err := s.secondary.Delete(ctx, token); err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	return lt, true, nil
+}
+
+// Flush flushes both stores if they buffer writes.
+func (s *MigratingStore[ID]) Flush(ctx context.Context) error {
+	var errs []error
+	for _, store := range []TokenStore[ID]{s.primary, s.secondary} {
+		if f, ok := store.(flusher); ok {
+			errs = append(errs, f.Flush(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes both stores if they implement io.Closer.
+func (s *MigratingStore[ID]) Close() error {
+	var errs []error
+	for _, store := range []TokenStore[ID]{s.primary, s.secondary} {
+		if c, ok := store.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ping checks both stores if they implement Pinger.
+func (s *MigratingStore[ID]) Ping(ctx context.Context) error {
+	var errs []error
+	for _, store := range []TokenStore[ID]{s.primary, s.secondary} {
+		if p, ok := store.(Pinger); ok {
+			errs = append(errs, p.Ping(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,69 @@
+package pwdless
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMigratingStore(t *testing.T) {
+	ctx := context.Background()
+	primary := NewMemoryStore[int]()
+	secondary := NewMemoryStore[int]()
+	s := NewMigratingStore[int](primary, secondary)
+
+	exp := time.Now().Add(time.Minute)
+	if err := secondary.Save(ctx, LoginToken[int]{Token: "old", AccountID: 1, Expiry: exp}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(ctx, LoginToken[int]{Token: "new", AccountID: 1, Expiry: exp}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := secondary.Get(ctx, "new"); ok {
+		t.Error("token written to secondary store")
+	}
+
+	for _, token := range []string{"old", "new"} {
+		if lt, ok, err := s.Get(ctx, token); err != nil || !ok || lt.AccountID != 1 {
+			t.Errorf("got %+v, %v, %v for %s, want found", lt, ok, err, token)
+		}
+	}
+	if n, err := s.CountForAccount(ctx, 1, time.Now()); err != nil || n != 2 {
+		t.Errorf("got %d, %v, want: %d", n, err, 2)
+	}
+
+	if err := primary.Save(ctx, LoginToken[int]{Token: "old", AccountID: 1, Expiry: exp}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "old"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := primary.Get(ctx, "old"); ok {
+		t.Error("token not deleted from primary store")
+	}
+	if _, ok, _ := secondary.Get(ctx, "old"); ok {
+		t.Error("token not deleted from secondary store")
+	}
+}
+
+func TestMigratingStore_Extend(t *testing.T) {
+	ctx := context.Background()
+	primary := NewMemoryStore[int]()
+	secondary := NewMemoryStore[int]()
+	s := NewMigratingStore[int](primary, secondary)
+
+	now := time.Now()
+	if err := secondary.Save(ctx, LoginToken[int]{Token: "old", AccountID: 1, Expiry: now.Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	lt, ok, err := s.Extend(ctx, "old", now, now.Add(time.Hour))
+	if err != nil || !ok || !lt.Expiry.Equal(now.Add(time.Hour)) {
+		t.Fatalf("got %+v, %v, %v, want extended", lt, ok, err)
+	}
+	if _, ok, _ := primary.Get(ctx, "old"); !ok {
+		t.Error("extended token not moved to primary store")
+	}
+	if _, ok, _ := secondary.Get(ctx, "old"); ok {
+		t.Error("extended token not removed from secondary store")
+	}
+}
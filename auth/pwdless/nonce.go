@@ -0,0 +1,87 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var errNonceMissing = errors.New("login token nonce missing")
+
+// nonceSet holds the nonces seen for a token until its expiry.
+type nonceSet struct {
+	expiry time.Time
+	seen   map[string]struct{}
+}
+
+// nonceTracker records the nonces seen per stored token key.
+type nonceTracker struct {
+	mux    sync.Mutex
+	tokens map[string]*nonceSet
+}
+
+// record adds nonce to the set of key expiring at expiry and reports whether it was not seen before.
+func (t *nonceTracker) record(key, nonce string, expiry time.Time) bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if t.tokens == nil {
+		t.tokens = make(map[string]*nonceSet)
+	}
+	set, ok := t.tokens[key]
+	if !ok {
+		set = &nonceSet{seen: make(map[string]struct{})}
+		t.tokens[key] = set
+	}
+	set.expiry = expiry
+	if _, ok := set.seen[nonce]; ok {
+		return false
+	}
+	set.seen[nonce] = struct{}{}
+	return true
+}
+
+// forget removes nonce from the set of key, so it can be used again.
+func (t *nonceTracker) forget(key, nonce string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if set, ok := t.tokens[key]; ok {
+		delete(set.seen, nonce)
+	}
+}
+
+// purge removes the nonce sets of tokens expired at now.
+func (t *nonceTracker) purge(now time.Time) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	for k, set := range t.tokens {
+		if now.After(set.expiry) {
+			delete(t.tokens, k)
+		}
+	}
+}
+
+// GetAccountIDWithNonce is like GetAccountID, additionally rejecting a nonce already used with the token with ErrReplay,
+// e.g. to keep a captured request with a reusable token from being replayed. Nonces are recorded in memory
+// until the token expires and purged with expired tokens, an empty nonce is rejected. A nonce is only used up
+// by a successful consumption, so a request failed e.g. by a validator or the store can be retried with it.
+func (a *LoginTokenAuth[ID]) GetAccountIDWithNonce(token, nonce string) (ID, error) {
+	var id ID
+	if nonce == "" {
+		return id, errNonceMissing
+	}
+	ctx := context.Background()
+	lt, err := a.lookup(ctx, token)
+	if err != nil {
+		return id, err
+	}
+	if !a.nonces.record(lt.Token, nonce, lt.Expiry) {
+		return id, ErrReplay
+	}
+	key := lt.Token
+	lt, err = a.consume(ctx, token, "", "", "")
+	if err != nil {
+		a.nonces.forget(key, nonce)
+	}
+	return lt.AccountID, err
+}
@@ -0,0 +1,69 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_GetAccountIDWithNonce(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+	lt, err := a.CreateReusableToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := a.GetAccountIDWithNonce(lt.Token, "n1"); err != nil || id != 1 {
+		t.Fatalf("got %d, %v, want: %d", id, err, 1)
+	}
+	if _, err := a.GetAccountIDWithNonce(lt.Token, "n1"); err != ErrReplay {
+		t.Errorf("got %v for repeated nonce, want: %v", err, ErrReplay)
+	}
+	if id, err := a.GetAccountIDWithNonce(lt.Token, "n2"); err != nil || id != 1 {
+		t.Errorf("got %d, %v for new nonce, want: %d", id, err, 1)
+	}
+	if _, err := a.GetAccountIDWithNonce(lt.Token, ""); err == nil {
+		t.Error("got no error for empty nonce")
+	}
+	if _, err := a.GetAccountIDWithNonce("unknown", "n3"); err != ErrTokenNotFound {
+		t.Errorf("got %v for unknown token, want: %v", err, ErrTokenNotFound)
+	}
+
+	other, err := a.CreateReusableToken(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountIDWithNonce(other.Token, "n1"); err != nil {
+		t.Errorf("got %v for nonce used with other token, want: nil", err)
+	}
+
+	clock.Add(2 * time.Minute)
+	if _, err := a.purgeExpired(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(a.nonces.tokens); n != 0 {
+		t.Errorf("got %d nonce sets after purge, want: %d", n, 0)
+	}
+}
+
+func TestLoginTokenAuth_GetAccountIDWithNonceRetry(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithConsumeDelay(time.Second))
+	lt, err := a.CreateReusableToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.GetAccountIDWithNonce(lt.Token, "n1"); !errors.Is(err, errTooEarly) {
+		t.Fatalf("got %v consuming within delay, want error wrapping %v", err, errTooEarly)
+	}
+	clock.Add(2 * time.Second)
+	if id, err := a.GetAccountIDWithNonce(lt.Token, "n1"); err != nil || id != 1 {
+		t.Errorf("got %d, %v retrying nonce of failed consume, want: %d, <nil>", id, err, 1)
+	}
+	if _, err := a.GetAccountIDWithNonce(lt.Token, "n1"); err != ErrReplay {
+		t.Errorf("got %v for nonce of successful consume, want: %v", err, ErrReplay)
+	}
+}
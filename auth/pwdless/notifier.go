@@ -0,0 +1,53 @@
+package pwdless
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Channel names a delivery channel of login links, e.g. "email", "sms" or "push".
+type Channel string
+
+// LoginMessage is the login link delivered to an account by a Notifier.
+type LoginMessage struct {
+	// To is the address passed to SendLoginLink, notifiers may look up their own address by account instead.
+	To     string
+	Token  string
+	URL    string
+	Expiry time.Time
+	// Locale is the locale of the account resolved by WithLocalizedLoginEmail, empty without.
+	Locale string
+}
+
+// Notifier delivers login links to accounts, used by SendLoginLink instead of the EmailSender if set with WithNotifier.
+type Notifier[ID comparable] interface {
+	Notify(ctx context.Context, id ID, msg LoginMessage) error
+}
+
+// NopNotifier is a Notifier discarding all messages, useful for tests.
+type NopNotifier[ID comparable] struct{}
+
+// Notify does nothing and returns nil.
+func (NopNotifier[ID]) Notify(ctx context.Context, id ID, msg LoginMessage) error {
+	return nil
+}
+
+// ChannelNotifier is a Notifier routing messages to the notifier registered for the channel selected per account,
+// e.g. by the delivery preference of the account.
+type ChannelNotifier[ID comparable] struct {
+	// Select returns the channel to notify account id by.
+	Select    func(id ID) Channel
+	Notifiers map[Channel]Notifier[ID]
+}
+
+// Notify delivers msg by the notifier of the channel selected for account id.
+// It fails if no notifier is registered for the channel.
+func (n ChannelNotifier[ID]) Notify(ctx context.Context, id ID, msg LoginMessage) error {
+	ch := n.Select(id)
+	c, ok := n.Notifiers[ch]
+	if !ok {
+		return fmt.Errorf("no notifier for channel %q", ch)
+	}
+	return c.Notify(ctx, id, msg)
+}
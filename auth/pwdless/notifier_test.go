@@ -0,0 +1,69 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// recordingNotifier is a Notifier recording the messages per account and returning err.
+type recordingNotifier struct {
+	msgs map[int]LoginMessage
+	err  error
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, id int, msg LoginMessage) error {
+	if n.msgs == nil {
+		n.msgs = make(map[int]LoginMessage)
+	}
+	n.msgs[id] = msg
+	return n.err
+}
+
+func TestLoginTokenAuth_SendLoginLink_notifier(t *testing.T) {
+	email, sms := &recordingNotifier{}, &recordingNotifier{}
+	n := ChannelNotifier[int]{
+		Select: func(id int) Channel {
+			if id%2 == 0 {
+				return "sms"
+			}
+			return "email"
+		},
+		Notifiers: map[Channel]Notifier[int]{"email": email, "sms": sms},
+	}
+	a, store := newTestAuth(time.Minute, WithNotifier[int](n))
+
+	if err := a.SendLoginLink(1, "test@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SendLoginLink(2, "+15550100"); err != nil {
+		t.Fatal(err)
+	}
+	if len(email.msgs) != 1 || len(sms.msgs) != 1 {
+		t.Fatalf("got %d email and %d sms messages, want one each", len(email.msgs), len(sms.msgs))
+	}
+	msg, ok := sms.msgs[2]
+	if !ok || msg.To != "+15550100" || msg.URL != "http://localhost/login?token="+msg.Token {
+		t.Fatalf("got sms message %+v, want login link of account 2", msg)
+	}
+	if id, err := a.GetAccountID(email.msgs[1].Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v for notified token, want: %d", id, err, 1)
+	}
+
+	sms.err = errors.New("sms gateway unavailable")
+	if err := a.SendLoginLink(4, "+15550100"); err != sms.err {
+		t.Errorf("got error %v, want: %v", err, sms.err)
+	}
+	delete(n.Notifiers, "sms")
+	if err := a.SendLoginLink(6, "+15550100"); err == nil {
+		t.Error("got no error for channel without notifier")
+	}
+	if len(store.token) != 1 {
+		t.Errorf("got %d tokens saved, want: %d left after failed deliveries", len(store.token), 1)
+	}
+
+	if _, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithNotifier[string](NopNotifier[string]{})); err == nil {
+		t.Error("notifier of other account ID type accepted")
+	}
+}
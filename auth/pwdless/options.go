@@ -0,0 +1,869 @@
+package pwdless
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dhax/go-base/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// minLoginTokenLength is the minimum accepted length of generated tokenstrings.
+	minLoginTokenLength = 20
+	// minAlphabetLength is the minimum number of distinct characters tokenstrings are drawn from.
+	minAlphabetLength = 16
+
+	defaultLoginTokenLength = 32
+	defaultLoginTokenExpiry = 11 * time.Minute
+	defaultLoginTokenParam  = "token"
+	defaultFutureTolerance  = time.Minute
+	defaultGCInterval       = time.Minute
+)
+
+// config holds the LoginTokenAuth settings independent of the account ID type.
+type config struct {
+	loginURL         string
+	loginTokenParam  string
+	loginTokenLength int
+	tokenPrefix      string
+	alphabet         string
+	tokenGenerator   func() string
+	randSource       io.Reader
+	loginTokenExpiry time.Duration
+	expiryJitter     time.Duration
+	clockSkew        time.Duration
+	futureTolerance  time.Duration
+	consumeDelay     time.Duration
+	wellFormedCheck  bool
+	minLookup        time.Duration
+	deleteExpired    bool
+	consumeDeletes   bool
+	countAccessExp   bool
+	gc               bool
+	purgeBatchSize   int
+	gcInterval       time.Duration
+	createTable      bool
+	consumeGrace     time.Duration
+	hashSecret       []byte
+	dataKey          string
+	signingSecret    []byte
+	statelessFormat  StatelessFormat
+	rateLimit        int
+	rateWindow       time.Duration
+	rateLimitStore   RateLimitStore
+	attemptLimit     int
+	attemptBackoff   time.Duration
+	maxPerAccount    int
+	maxStoreSize     int
+	fallback         bool
+	pressureMax      int
+	pressurePolicy   PressurePolicy
+	// evictionPolicy is an EvictionPolicy[ID] matching the ID of the configured LoginTokenAuth.
+	evictionPolicy   interface{}
+	asyncConcurrency int
+	evictOldest      bool
+	clock            func() time.Time
+	onPurge          func(purged int)
+	registry         *prometheus.Registry
+	tracerProvider   trace.TracerProvider
+	logger           *slog.Logger
+	emailSender      EmailSender
+	relayOnly        bool
+	emailTemplate    *template.Template
+	emailSubject     string
+	localeEmails     map[string]LoginEmail
+	defaultLocale    string
+	webhookURL       string
+	webhookClient    *http.Client
+	webhookOnCreate  bool
+	redirectAllow    []string
+	errorRenderer    ErrorRenderer
+
+	// store is a TokenStore[ID] matching the ID of the configured LoginTokenAuth.
+	store interface{}
+	// hooks is a Hooks[ID] matching the ID of the configured LoginTokenAuth.
+	hooks interface{}
+	// auditor is an Auditor[ID] matching the ID of the configured LoginTokenAuth.
+	auditor interface{}
+	// issuer is a JWTIssuer[ID] matching the ID of the configured LoginTokenAuth.
+	issuer interface{}
+	// loginURLFunc is a LoginURLFunc[ID] matching the ID of the configured LoginTokenAuth.
+	loginURLFunc interface{}
+	// accountSecret is an AccountSecretFunc[ID] matching the ID of the configured LoginTokenAuth.
+	accountSecret interface{}
+	// accountUpdater is an AccountUpdater[ID] matching the ID of the configured LoginTokenAuth.
+	accountUpdater interface{}
+	// sessionStore is a SessionStore[ID] matching the ID of the configured LoginTokenAuth.
+	sessionStore interface{}
+	// localeFunc is a LocaleFunc[ID] matching the ID of the configured LoginTokenAuth.
+	localeFunc interface{}
+	// notifier is a Notifier[ID] matching the ID of the configured LoginTokenAuth.
+	notifier interface{}
+	// activity is an *AccountActivity[ID] matching the ID of the configured LoginTokenAuth.
+	activity interface{}
+	// validators is a []Validator[ID] matching the ID of the configured LoginTokenAuth.
+	validators interface{}
+
+	// err is an error reading a setting, returned by validate.
+	err error
+}
+
+// defaultConfig returns the settings used unless overridden by options.
+func defaultConfig() config {
+	return config{
+		loginTokenLength: defaultLoginTokenLength,
+		loginTokenExpiry: defaultLoginTokenExpiry,
+		loginTokenParam:  defaultLoginTokenParam,
+		alphabet:         defaultAlphabet,
+		randSource:       rand.Reader,
+		clock:            time.Now,
+		futureTolerance:  defaultFutureTolerance,
+		emailTemplate:    defaultLoginEmailTemplate,
+		emailSubject:     defaultLoginEmailSubject,
+		deleteExpired:    true,
+		consumeDeletes:   true,
+		wellFormedCheck:  true,
+		countAccessExp:   true,
+		gc:               true,
+		gcInterval:       defaultGCInterval,
+		asyncConcurrency: defaultAsyncConcurrency,
+	}
+}
+
+// validate returns an error describing the first invalid setting.
+func (c *config) validate() error {
+	if c.err != nil {
+		return c.err
+	}
+	if c.loginTokenLength < minLoginTokenLength {
+		return fmt.Errorf("login token length %d is below minimum of %d", c.loginTokenLength, minLoginTokenLength)
+	}
+	if err := validateAlphabet(c.alphabet); err != nil {
+		return err
+	}
+	if !validTokenPrefix(c.tokenPrefix) {
+		return fmt.Errorf("login token prefix %q must only contain letters, digits, '_' or '-'", c.tokenPrefix)
+	}
+	if c.loginTokenExpiry <= 0 {
+		return fmt.Errorf("login token expiry %s must be a positive duration like \"15m\" or \"24h\"", c.loginTokenExpiry)
+	}
+	if c.minLookup < 0 {
+		return fmt.Errorf("login token minimum lookup duration %s must not be negative", c.minLookup)
+	}
+	if c.consumeGrace < 0 {
+		return fmt.Errorf("login token consume grace %s must not be negative", c.consumeGrace)
+	}
+	if c.clockSkew < 0 {
+		return fmt.Errorf("login token clock skew %s must not be negative", c.clockSkew)
+	}
+	if c.consumeDelay < 0 {
+		return fmt.Errorf("login token consume delay %s must not be negative", c.consumeDelay)
+	}
+	if c.futureTolerance < 0 {
+		return fmt.Errorf("login token future tolerance %s must not be negative", c.futureTolerance)
+	}
+	if c.expiryJitter < 0 {
+		return fmt.Errorf("login token expiry jitter %s must not be negative", c.expiryJitter)
+	}
+	if c.loginURL == "" {
+		return errors.New("login url required")
+	}
+	if _, err := url.Parse(c.loginURL); err != nil {
+		return fmt.Errorf("invalid login url: %v", err)
+	}
+	if c.webhookURL != "" {
+		if _, err := url.Parse(c.webhookURL); err != nil {
+			return fmt.Errorf("invalid webhook url: %v", err)
+		}
+	}
+	if c.loginTokenParam == "" {
+		return errors.New("login token param required")
+	}
+	if c.rateLimit > 0 && c.rateWindow <= 0 {
+		return fmt.Errorf("login token rate window %s must be positive", c.rateWindow)
+	}
+	if c.attemptLimit < 0 {
+		return fmt.Errorf("login token attempt threshold %d must not be negative", c.attemptLimit)
+	}
+	if c.attemptLimit > 0 && c.attemptBackoff <= 0 {
+		return fmt.Errorf("login token attempt backoff %s must be positive", c.attemptBackoff)
+	}
+	if c.randSource == nil {
+		return errors.New("login token random source required")
+	}
+	if c.tokenGenerator != nil && c.tokenGenerator() == "" {
+		return errors.New("login token generator returned empty tokenstring")
+	}
+	if c.asyncConcurrency <= 0 {
+		return fmt.Errorf("login token async concurrency %d must be positive", c.asyncConcurrency)
+	}
+	if c.maxStoreSize < 0 {
+		return fmt.Errorf("login token max store size %d must not be negative", c.maxStoreSize)
+	}
+	if c.gcInterval <= 0 {
+		return fmt.Errorf("login token gc interval %s must be positive", c.gcInterval)
+	}
+	if c.purgeBatchSize < 0 {
+		return fmt.Errorf("login token purge batch size %d must not be negative", c.purgeBatchSize)
+	}
+	if c.pressureMax < 0 {
+		return fmt.Errorf("login token memory pressure maximum %d must not be negative", c.pressureMax)
+	}
+	if c.pressurePolicy != RejectNew && c.pressurePolicy != AggressivePurge {
+		return fmt.Errorf("unknown memory pressure policy %d", c.pressurePolicy)
+	}
+	if c.maxPerAccount < 0 {
+		return fmt.Errorf("login token max per account %d must not be negative", c.maxPerAccount)
+	}
+	if c.relayOnly && c.emailSender == nil && c.notifier == nil {
+		return errors.New("login token server relay only mode requires an email sender or notifier")
+	}
+	if c.emailTemplate == nil {
+		return errors.New("login email template required")
+	}
+	if c.localeFunc != nil {
+		if _, ok := c.localeEmails[c.defaultLocale]; !ok {
+			return fmt.Errorf("login email for default locale %q required", c.defaultLocale)
+		}
+		for locale, e := range c.localeEmails {
+			if e.Text == nil {
+				return fmt.Errorf("login email template for locale %q required", locale)
+			}
+		}
+	}
+	return nil
+}
+
+// validateAlphabet returns an error if alphabet contains non ASCII or duplicate characters
+// or less than minAlphabetLength characters.
+func validateAlphabet(alphabet string) error {
+	seen := make(map[byte]bool, len(alphabet))
+	for i := 0; i < len(alphabet); i++ {
+		b := alphabet[i]
+		if b >= 0x80 {
+			return fmt.Errorf("login token alphabet must only contain ASCII characters")
+		}
+		if seen[b] {
+			return fmt.Errorf("login token alphabet contains duplicate character %q", b)
+		}
+		seen[b] = true
+	}
+	if len(alphabet) < minAlphabetLength {
+		return fmt.Errorf("login token alphabet of %d characters is below minimum of %d", len(alphabet), minAlphabetLength)
+	}
+	return nil
+}
+
+// validTokenPrefix reports whether prefix is safe to use in urls unescaped.
+func validTokenPrefix(prefix string) bool {
+	for _, r := range prefix {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// Option configures a LoginTokenAuth instance.
+type Option func(*config)
+
+// requiredViperKeys are the viper keys LoginTokenAuth needs to be configured by.
+var requiredViperKeys = []string{"auth_login_url", "auth_login_token_length", "auth_login_token_expiry"}
+
+// viperConfigError returns err describing the required keys if v has no auth_* key set at all,
+// as a missing configuration fails with less obvious errors about invalid settings otherwise.
+func viperConfigError(v *viper.Viper, err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, key := range v.AllKeys() {
+		if strings.HasPrefix(key, "auth_") {
+			return err
+		}
+	}
+	return fmt.Errorf("login token auth not configured, no auth_* keys set in viper, required are %s: %w", strings.Join(requiredViperKeys, ", "), err)
+}
+
+// viperOptions returns the options configured by v.
+func viperOptions(v *viper.Viper) []Option {
+	return []Option{
+		WithLoginURL(v.GetString("auth_login_url")),
+		WithTokenParam(v.GetString("auth_login_token_param")),
+		WithTokenLength(v.GetInt("auth_login_token_length")),
+		viperExpiry(v, "auth_login_token_expiry"),
+		viperGC(v, "auth_login_token_gc"),
+		WithHashSecret(v.GetString("auth_token_hash_secret")),
+		WithDataKey(v.GetString("auth_token_data_key")),
+		WithRateLimit(v.GetInt("auth_login_token_rate_limit"), v.GetDuration("auth_login_token_rate_window")),
+		WithMaxPerAccount(v.GetInt("auth_login_token_max_per_account"), v.GetBool("auth_login_token_evict_oldest")),
+		WithBruteForceProtection(v.GetInt("auth_login_token_attempt_threshold"), v.GetDuration("auth_login_token_attempt_backoff")),
+	}
+}
+
+// WithLoginURL sets the client login url the token is sent with.
+func WithLoginURL(url string) Option {
+	return func(c *config) {
+		c.loginURL = url
+	}
+}
+
+// WithTokenParam sets the query parameter name the token is added to the login url with, defaults to "token".
+// An empty name keeps the current setting.
+func WithTokenParam(name string) Option {
+	return func(c *config) {
+		if name != "" {
+			c.loginTokenParam = name
+		}
+	}
+}
+
+// WithTokenLength sets the length of generated tokenstrings, defaults to 32.
+func WithTokenLength(n int) Option {
+	return func(c *config) {
+		c.loginTokenLength = n
+	}
+}
+
+// WithTokenGenerator sets gen to generate tokenstrings instead of the default crypto random generator,
+// e.g. for tokens sortable by creation time like ULIDs. Generated tokenstrings have to be unguessable,
+// token length and alphabet settings do not apply. gen is called once on construction to verify it does
+// not return empty tokenstrings and must be safe for concurrent use.
+func WithTokenGenerator(gen func() string) Option {
+	return func(c *config) {
+		c.tokenGenerator = gen
+	}
+}
+
+// WithPrefix sets a prefix like "lt_" prepended to generated tokenstrings to tell token types apart.
+// Tokenstrings not carrying the prefix are rejected with ErrTokenPrefix without a store lookup.
+func WithPrefix(prefix string) Option {
+	return func(c *config) {
+		c.tokenPrefix = prefix
+	}
+}
+
+// WithRandSource sets the source of random bytes tokenstrings, one-time codes and pairing codes are generated from,
+// defaults to crypto/rand.Reader. Only tests should set it, e.g. to a deterministic reader for reproducible tokens.
+// Generating a token fails if r returns fewer bytes than needed.
+func WithRandSource(r io.Reader) Option {
+	return func(c *config) {
+		c.randSource = r
+	}
+}
+
+// WithAlphabet sets the characters tokenstrings are drawn from, defaults to the base64url characters.
+// The alphabet must consist of at least 16 distinct ASCII characters.
+func WithAlphabet(alphabet string) Option {
+	return func(c *config) {
+		c.alphabet = alphabet
+	}
+}
+
+// viperExpiry sets the expiry from key of v, see parseExpiry.
+func viperExpiry(v *viper.Viper, key string) Option {
+	return func(c *config) {
+		d, legacy, err := parseExpiry(v.Get(key))
+		if err != nil {
+			c.err = fmt.Errorf("%s: %v", key, err)
+			return
+		}
+		if legacy && logging.Logger != nil {
+			logging.Logger.WithField("key", key).Warnf("login token expiry without unit is deprecated and read as minutes, use a duration like \"%dm\"", int(d.Minutes()))
+		}
+		c.loginTokenExpiry = d
+	}
+}
+
+// parseExpiry reads v as a duration string like "15m" or "24h". For compatibility bare numbers are read as minutes,
+// reported by legacy. An unset value returns 0.
+func parseExpiry(v interface{}) (d time.Duration, legacy bool, err error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, false, nil
+	case time.Duration:
+		return v, false, nil
+	case int:
+		return time.Duration(v) * time.Minute, true, nil
+	case int64:
+		return time.Duration(v) * time.Minute, true, nil
+	case float64:
+		return time.Duration(v * float64(time.Minute)), true, nil
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return 0, false, nil
+		}
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return time.Duration(n * float64(time.Minute)), true, nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid login token expiry %q, use a duration like \"15m\" or \"24h\"", s)
+		}
+		return d, false, nil
+	default:
+		return 0, false, fmt.Errorf("invalid login token expiry %v of type %T, use a duration like \"15m\" or \"24h\"", v, v)
+	}
+}
+
+// WithExpiry sets the duration tokens are valid for, defaults to 11 minutes.
+func WithExpiry(d time.Duration) Option {
+	return func(c *config) {
+		c.loginTokenExpiry = d
+	}
+}
+
+// WithExpiryJitter adds a random duration of up to d to the expiry of each created token,
+// spreading the expiry of tokens created in a burst. Jitter never shortens the expiry.
+func WithExpiryJitter(d time.Duration) Option {
+	return func(c *config) {
+		c.expiryJitter = d
+	}
+}
+
+// WithClockSkew tolerates clock differences between hosts creating and verifying tokens, e.g. with StatelessTokenAuth
+// or a shared store, by accepting tokens until d past their expiry. Defaults to 0. A larger skew extends the window
+// in which a leaked token can be used, so it should be kept to the expected clock drift, usually a few seconds.
+func WithClockSkew(d time.Duration) Option {
+	return func(c *config) {
+		c.clockSkew = d
+	}
+}
+
+// WithWellFormedCheck sets whether tokens not WellFormed are rejected with ErrTokenNotFound before looking them up
+// in the store, defaults to true. Disable it to keep tokens valid after changing the token length or alphabet,
+// or to import tokens of another format with ImportToken.
+func WithWellFormedCheck(enabled bool) Option {
+	return func(c *config) {
+		c.wellFormedCheck = enabled
+	}
+}
+
+// WithConsumeDelay rejects consuming tokens, like GetAccountID, within d of their creation with errTooEarly,
+// while Peek and Middleware accept them immediately. This defeats email scanners prefetching login links
+// instantly, which would consume single use tokens before the user clicks them. Defaults to 0, disabled.
+// Rejected attempts neither consume the token nor count as invalid attempts.
+func WithConsumeDelay(d time.Duration) Option {
+	return func(c *config) {
+		c.consumeDelay = d
+	}
+}
+
+// WithFutureTolerance rejects tokens created more than d after the current time with errTokenFromFuture,
+// as trusting them would extend their validity by the clock difference, defaults to a minute. Such tokens are
+// created by a host with a clock ahead or tampered with. For StatelessTokenAuth the creation time is derived
+// from the expiry carried by the token, so lowering the configured expiry rejects tokens created before by the prior one.
+func WithFutureTolerance(d time.Duration) Option {
+	return func(c *config) {
+		c.futureTolerance = d
+	}
+}
+
+// WithConstantTimeLookup pads every consumption of a token, like GetAccountID, to take at least minDuration,
+// whether the token is found or not. This trades some latency for reducing the timing side channel revealing
+// whether a token exists. Padding uses the real time regardless of WithClock and ends early when the context is done.
+func WithConstantTimeLookup(minDuration time.Duration) Option {
+	return func(c *config) {
+		c.minLookup = minDuration
+	}
+}
+
+// WithDeleteExpiredOnAccess sets whether consuming an expired token, like GetAccountID, removes it from the store
+// instead of leaving it for the next purge, defaults to true.
+func WithDeleteExpiredOnAccess(enabled bool) Option {
+	return func(c *config) {
+		c.deleteExpired = enabled
+	}
+}
+
+// WithConsumeDeletes sets whether consuming a token, like GetAccountID, removes it from the store, defaults to true.
+// Disabled, tokens can be consumed repeatedly until they expire or are revoked, for flows invalidating tokens
+// externally, e.g. reconciled with the audit trail. Use limits and consume grace do not apply then.
+func WithConsumeDeletes(enabled bool) Option {
+	return func(c *config) {
+		c.consumeDeletes = enabled
+	}
+}
+
+// WithCountAccessExpiry sets whether an expired token removed on access, see WithDeleteExpiredOnAccess, is counted
+// as purged by the metrics and stats and reported to the OnExpire hook like tokens removed by the purge, defaults to true.
+// Either way every expired token is counted at most once, by the path removing it. Disable it together with
+// deleting on access to count expirations by the purge only.
+func WithCountAccessExpiry(enabled bool) Option {
+	return func(c *config) {
+		c.countAccessExp = enabled
+	}
+}
+
+// WithConsumeGrace keeps single use tokens for d after being consumed, so consuming them again within d returns the
+// same account instead of ErrTokenNotFound, e.g. for clients retrying a request whose response got lost.
+// Defaults to 0, deleting tokens on consumption. The token can be used by anyone holding it during the grace period,
+// so d should be kept short, like a few seconds.
+func WithConsumeGrace(d time.Duration) Option {
+	return func(c *config) {
+		c.consumeGrace = d
+	}
+}
+
+// WithGC sets whether StartGC purges expired tokens, defaults to true. Disable it on all instances sharing a store
+// purged by a scheduled job calling PurgeNow instead.
+func WithGC(enabled bool) Option {
+	return func(c *config) {
+		c.gc = enabled
+	}
+}
+
+// WithGCInterval sets the interval Start starts purging expired tokens at, defaults to a minute.
+func WithGCInterval(d time.Duration) Option {
+	return func(c *config) {
+		c.gcInterval = d
+	}
+}
+
+// WithCreateTable sets whether Start creates the table of the token store if it does not exist,
+// like SQLStore.CreateTable, defaults to false. Start fails for stores not supporting it.
+func WithCreateTable(enabled bool) Option {
+	return func(c *config) {
+		c.createTable = enabled
+	}
+}
+
+// WithPurgeBatchSize sets purges of a MemoryStore or ShardedMemoryStore to visit at most n tokens per lock
+// acquisition instead of holding the lock for a whole scan, trading a longer purge for shorter stalls of
+// concurrent token operations. A size of 0, the default, purges in a single pass. Other stores ignore it.
+func WithPurgeBatchSize(n int) Option {
+	return func(c *config) {
+		c.purgeBatchSize = n
+	}
+}
+
+// viperGC sets whether StartGC purges expired tokens from key of v if set.
+func viperGC(v *viper.Viper, key string) Option {
+	return func(c *config) {
+		if v.IsSet(key) {
+			c.gc = v.GetBool(key)
+		}
+	}
+}
+
+// WithHashSecret sets the HMAC key for hashing stored tokens, plain SHA-256 is used if empty.
+func WithHashSecret(secret string) Option {
+	return func(c *config) {
+		c.hashSecret = []byte(secret)
+	}
+}
+
+// WithDataKey sets the key the data attached to tokens is encrypted by with AES-256-GCM before being saved to the store,
+// data is stored in plaintext if empty. Tokens saved under another key fail with ErrDataDecryption on lookup.
+func WithDataKey(key string) Option {
+	return func(c *config) {
+		c.dataKey = key
+	}
+}
+
+// WithSigningSecret sets the HMAC key signing tokens of a StatelessTokenAuth, which must be at least 32 bytes.
+func WithSigningSecret(secret string) Option {
+	return func(c *config) {
+		c.signingSecret = []byte(secret)
+	}
+}
+
+// WithStatelessFormat sets the serialization of StatelessTokenAuth tokens, defaults to FormatCompact.
+// Only tokens in the configured format are accepted.
+func WithStatelessFormat(f StatelessFormat) Option {
+	return func(c *config) {
+		c.statelessFormat = f
+	}
+}
+
+// WithRateLimit limits the number of tokens created per account within window, a limit of 0 disables rate limiting.
+func WithRateLimit(limit int, window time.Duration) Option {
+	return func(c *config) {
+		c.rateLimit = limit
+		c.rateWindow = window
+	}
+}
+
+// WithDistributedRateLimit counts the tokens created per account for the rate limit set by WithRateLimit in store
+// instead of in memory, so the limit is shared by all instances using store and survives restarts.
+// Counts are kept for fixed windows starting with the first token created in a window.
+func WithDistributedRateLimit(store RateLimitStore) Option {
+	return func(c *config) {
+		c.rateLimitStore = store
+	}
+}
+
+// WithBruteForceProtection locks out a source after threshold consecutive invalid tokens for baseBackoff,
+// doubling the lockout with every further invalid token. Locked out sources get ErrTooManyAttempts.
+// Sources are identified by the source passed to GetAccountIDFrom or the fingerprint passed to GetAccountIDBound,
+// their failures are forgotten on a successful consume or after staying quiet for the current backoff window.
+// A threshold of 0 disables the protection.
+func WithBruteForceProtection(threshold int, baseBackoff time.Duration) Option {
+	return func(c *config) {
+		c.attemptLimit = threshold
+		c.attemptBackoff = baseBackoff
+	}
+}
+
+// WithMaxPerAccount limits the number of active tokens per account to n, a limit of 0 disables it.
+// When the limit is reached the oldest tokens are removed if evictOldest is set, otherwise creation fails with ErrTooManyTokens.
+func WithMaxPerAccount(n int, evictOldest bool) Option {
+	return func(c *config) {
+		c.maxPerAccount = n
+		c.evictOldest = evictOldest
+	}
+}
+
+// WithTracerProvider sets the TracerProvider creating spans around token creation, consumption and purging
+// as children of any span in the context passed. Failed operations record their error and set the span status
+// to error. Without a TracerProvider no spans are created.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithLogger sets the logger token creation, consumption, rejection and purging is logged to.
+// Tokenstrings are logged redacted to the last 4 characters of their hash. Without a logger nothing is logged.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = l
+	}
+}
+
+// WithPurgeCallback sets fn to be called with the number of tokens removed on every purge run by StartGC,
+// e.g. to alert on unusually large purges indicating clock skew.
+func WithPurgeCallback(fn func(purged int)) Option {
+	return func(c *config) {
+		c.onPurge = fn
+	}
+}
+
+// WithClock sets the function returning the current time used for expiry, defaults to time.Now.
+func WithClock(clock func() time.Time) Option {
+	return func(c *config) {
+		c.clock = clock
+	}
+}
+
+// WithAsyncConcurrency sets the number of tokens CreateTokensAsync creates concurrently, defaults to 8.
+func WithAsyncConcurrency(n int) Option {
+	return func(c *config) {
+		c.asyncConcurrency = n
+	}
+}
+
+// WithMaxStoreSize limits the default MemoryStore to n tokens, a limit of 0 disables it.
+// When exceeded the least recently created tokens are evicted, preferring already expired ones.
+// It cannot be combined with WithStore, use NewBoundedMemoryStore instead.
+func WithMaxStoreSize(n int) Option {
+	return func(c *config) {
+		c.maxStoreSize = n
+	}
+}
+
+// WithMemoryPressure sets a high-water mark of maxTokens held by a MemoryStore or ShardedMemoryStore, including expired
+// tokens not purged yet, for when token creation outpaces the GC. Reaching it is counted by the metrics and logged,
+// and token creation applies policy. A maxTokens of 0 disables it. Concurrent creation may exceed the mark slightly.
+func WithMemoryPressure(maxTokens int, policy PressurePolicy) Option {
+	return func(c *config) {
+		c.pressureMax = maxTokens
+		c.pressurePolicy = policy
+	}
+}
+
+// WithEvictionPolicy sets the order tokens are evicted in by WithMemoryPressure with policy AggressivePurge,
+// e.g. to protect tokens created within the last seconds as they are likely about to be used. Defaults to
+// evicting the tokens expiring soonest, then the oldest. Expired tokens are always purged before any eviction.
+func WithEvictionPolicy[ID comparable](evictBefore EvictionPolicy[ID]) Option {
+	return func(c *config) {
+		c.evictionPolicy = evictBefore
+	}
+}
+
+// WithLoginURLFunc sets f to resolve the login url per token, e.g. from a tenant stored in the token data.
+// The static login url is used when f is unset or returns an empty or invalid url.
+func WithLoginURLFunc[ID comparable](f LoginURLFunc[ID]) Option {
+	return func(c *config) {
+		c.loginURLFunc = f
+	}
+}
+
+// WithAccountSecret sets f to look up per account secrets additionally hashing each token, so rotating the secret
+// of an account invalidates all its tokens without deleting them. Tokens created without account secret are rejected.
+func WithAccountSecret[ID comparable](f AccountSecretFunc[ID]) Option {
+	return func(c *config) {
+		c.accountSecret = f
+	}
+}
+
+// WithStore sets the TokenStore used to persist login tokens, defaults to a MemoryStore.
+func WithStore[ID comparable](s TokenStore[ID]) Option {
+	return func(c *config) {
+		c.store = s
+	}
+}
+
+// WithFallback sets whether the store set by WithStore is wrapped in a FallbackStore, serving logins from memory
+// while it fails, defaults to false. Tokens created during an outage only validate on the creating instance until
+// the store recovers, so enable it only if availability matters more than consistency across instances.
+func WithFallback(enabled bool) Option {
+	return func(c *config) {
+		c.fallback = enabled
+	}
+}
+
+// WithHooks sets callbacks invoked on token lifecycle events.
+func WithHooks[ID comparable](h Hooks[ID]) Option {
+	return func(c *config) {
+		c.hooks = h
+	}
+}
+
+// WithAuditor sets the Auditor every consume attempt is recorded by.
+func WithAuditor[ID comparable](au Auditor[ID]) Option {
+	return func(c *config) {
+		c.auditor = au
+	}
+}
+
+// WithAccountUpdater sets the AccountUpdater logins consumed by ConsumeAndRecord are recorded by.
+func WithAccountUpdater[ID comparable](u AccountUpdater[ID]) Option {
+	return func(c *config) {
+		c.accountUpdater = u
+	}
+}
+
+// WithMetrics counts token operations in Metrics registered in reg, creating the LoginTokenAuth fails if
+// registering does, e.g. as another LoginTokenAuth registered its metrics in reg already.
+// The active tokens gauge is updated on every purge run by StartGC.
+func WithMetrics(reg *prometheus.Registry) Option {
+	return func(c *config) {
+		c.registry = reg
+	}
+}
+
+// WithEmailSender sets the EmailSender used by SendLoginLink.
+func WithEmailSender(s EmailSender) Option {
+	return func(c *config) {
+		c.emailSender = s
+	}
+}
+
+// WithSessionStore sets the SessionStore sessions are created by with ConsumeForSession.
+func WithSessionStore[ID comparable](s SessionStore[ID]) Option {
+	return func(c *config) {
+		c.sessionStore = s
+	}
+}
+
+// WithAccountActivity sets the AccountActivity updated whenever a token is issued or consumed successfully.
+func WithAccountActivity[ID comparable](t *AccountActivity[ID]) Option {
+	return func(c *config) {
+		c.activity = t
+	}
+}
+
+// WithValidators adds validators checking tokens on consumption, after the built-in expiry, fingerprint, scope and delay
+// checks and before the token is deleted. Validators run in order and the first error rejects the token, which is returned
+// wrapped like the built-in errors.
+// Validators added by repeated options run in the order of the options.
+func WithValidators[ID comparable](v ...Validator[ID]) Option {
+	return func(c *config) {
+		vs, _ := c.validators.([]Validator[ID])
+		c.validators = append(vs, v...)
+	}
+}
+
+// WithNotifier sets the Notifier SendLoginLink delivers login links by instead of the EmailSender,
+// e.g. a ChannelNotifier routing to email, SMS or push notifiers.
+func WithNotifier[ID comparable](n Notifier[ID]) Option {
+	return func(c *config) {
+		c.notifier = n
+	}
+}
+
+// WithServerRelayOnly sets whether tokenstrings never leave the service except in emails sent by SendLoginLink,
+// for integrations relaying login requests through another service. CreateToken and its variants then return
+// the hash the token is stored by as one-way reference in place of the tokenstring, which cannot be consumed.
+// It requires an EmailSender set by WithEmailSender or a Notifier set by WithNotifier.
+func WithServerRelayOnly(enabled bool) Option {
+	return func(c *config) {
+		c.relayOnly = enabled
+	}
+}
+
+// WithLoginEmail sets the subject and body template of emails sent by SendLoginLink.
+// The template is executed with LoginLinkContent, providing .URL and .Expiry.
+func WithLoginEmail(subject string, tmpl *template.Template) Option {
+	return func(c *config) {
+		c.emailSubject = subject
+		c.emailTemplate = tmpl
+	}
+}
+
+// WithLocalizedLoginEmail sets the login emails sent by SendLoginLink per locale, selecting the email by the locale
+// of the account returned by f and falling back to defaultLocale for locales without email. Templates are executed
+// with LoginLinkContent providing .URL, .Expiry and .Locale. HTML templates are sent along the text if the EmailSender
+// implements HTMLSender. Notifiers receive the resolved locale in LoginMessage. It overrides WithLoginEmail.
+func WithLocalizedLoginEmail[ID comparable](f LocaleFunc[ID], emails map[string]LoginEmail, defaultLocale string) Option {
+	return func(c *config) {
+		c.localeFunc = f
+		c.localeEmails = emails
+		c.defaultLocale = defaultLocale
+	}
+}
+
+// WithWebhook posts a JSON event like {"event":"consume","account_id":123,"at":"..."} to url whenever a token is consumed,
+// using client or http.DefaultClient if nil. Events are queued and sent asynchronously, retrying failures with backoff,
+// so a slow endpoint never blocks token operations. Events are dropped if the queue is full, counted by Metrics.
+func WithWebhook(url string, client *http.Client) Option {
+	return func(c *config) {
+		c.webhookURL = url
+		c.webhookClient = client
+	}
+}
+
+// WithWebhookOnCreate additionally posts "create" events to the webhook configured by WithWebhook when tokens are created.
+func WithWebhookOnCreate() Option {
+	return func(c *config) {
+		c.webhookOnCreate = true
+	}
+}
+
+// WithRedirectAllowlist sets the patterns redirects of CreateTokenWithRedirect have to match, rejecting all if empty.
+// Patterns starting with "/" match relative paths by prefix, patterns like "https://example.com/app" match absolute urls
+// with the same scheme and host by path prefix and other patterns match absolute http(s) urls by host,
+// with "*.example.com" matching all subdomains.
+func WithRedirectAllowlist(patterns []string) Option {
+	return func(c *config) {
+		c.redirectAllow = append([]string(nil), patterns...)
+	}
+}
+
+// WithErrorRenderer sets render to respond to failed requests of ConsumeHandler, Middleware and ConsumingMiddleware,
+// e.g. redirecting to a page to request a new login link. Defaults to JSONErrorRenderer.
+func WithErrorRenderer(render ErrorRenderer) Option {
+	return func(c *config) {
+		c.errorRenderer = render
+	}
+}
+
+// WithJWTIssuer sets the JWTIssuer used by ConsumeForJWT.
+func WithJWTIssuer[ID comparable](i JWTIssuer[ID]) Option {
+	return func(c *config) {
+		c.issuer = i
+	}
+}
@@ -0,0 +1,120 @@
+package pwdless
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		want   time.Duration
+		legacy bool
+		err    bool
+	}{
+		{"minutes", "15m", 15 * time.Minute, false, false},
+		{"hours", "1h", time.Hour, false, false},
+		{"duration", 24 * time.Hour, 24 * time.Hour, false, false},
+		{"legacy_string", "15", 15 * time.Minute, true, false},
+		{"legacy_int", 15, 15 * time.Minute, true, false},
+		{"legacy_float", 1.5, 90 * time.Second, true, false},
+		{"unset", nil, 0, false, false},
+		{"invalid", "15 minutes", 0, false, true},
+		{"invalid_type", true, 0, false, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d, legacy, err := parseExpiry(tc.value)
+			if (err != nil) != tc.err {
+				t.Fatalf("got error %v, want error: %v", err, tc.err)
+			}
+			if d != tc.want || legacy != tc.legacy {
+				t.Errorf("got %s, legacy %v, want: %s, legacy %v", d, legacy, tc.want, tc.legacy)
+			}
+		})
+	}
+}
+
+func TestViperExpiry(t *testing.T) {
+	const key = "test_login_token_expiry"
+	defer viper.Set(key, nil)
+
+	for value, want := range map[string]time.Duration{"15m": 15 * time.Minute, "1h": time.Hour, "15": 15 * time.Minute} {
+		viper.Set(key, value)
+		c := config{}
+		viperExpiry(viper.GetViper(), key)(&c)
+		if c.err != nil || c.loginTokenExpiry != want {
+			t.Errorf("got %s, %v for %q, want: %s", c.loginTokenExpiry, c.err, value, want)
+		}
+	}
+
+	viper.Set(key, "soon")
+	if _, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), viperExpiry(viper.GetViper(), key)); err == nil {
+		t.Error("got no error for invalid expiry")
+	}
+}
+
+func TestViperConfigError(t *testing.T) {
+	_, err := NewLoginTokenAuthWithOptions[int]()
+	if err == nil {
+		t.Fatal("got no error for missing settings")
+	}
+
+	got := viperConfigError(viper.New(), err)
+	if !errors.Is(got, err) {
+		t.Errorf("got error %v, want it to wrap: %v", got, err)
+	}
+	for _, key := range requiredViperKeys {
+		if !strings.Contains(got.Error(), key) {
+			t.Errorf("got error %q, want it to list key %s", got, key)
+		}
+	}
+
+	v := viper.New()
+	v.SetDefault("auth_login_url", "")
+	if got := viperConfigError(v, err); got != err {
+		t.Errorf("got error %v with auth keys set, want: %v", got, err)
+	}
+	if got := viperConfigError(viper.New(), nil); got != nil {
+		t.Errorf("got error %v for valid settings, want: <nil>", got)
+	}
+}
+
+func TestNewLoginTokenAuthFromViper(t *testing.T) {
+	newViper := func(prefix string) *viper.Viper {
+		v := viper.New()
+		v.SetEnvPrefix(prefix)
+		v.AutomaticEnv()
+		return v
+	}
+	t.Setenv("USERS_AUTH_LOGIN_URL", "https://users.example.com/login")
+	t.Setenv("USERS_AUTH_LOGIN_TOKEN_LENGTH", "32")
+	t.Setenv("USERS_AUTH_LOGIN_TOKEN_EXPIRY", "15m")
+	t.Setenv("ADMINS_AUTH_LOGIN_URL", "https://admins.example.com/login")
+	t.Setenv("ADMINS_AUTH_LOGIN_TOKEN_LENGTH", "48")
+	t.Setenv("ADMINS_AUTH_LOGIN_TOKEN_EXPIRY", "5m")
+
+	users, err := NewLoginTokenAuthFromViper[int](newViper("users"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	admins, err := NewLoginTokenAuthFromViper[int](newViper("admins"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users.loginURL != "https://users.example.com/login" || users.loginTokenLength != 32 || users.loginTokenExpiry != 15*time.Minute {
+		t.Errorf("got %s, %d, %s for users, want settings of users prefix", users.loginURL, users.loginTokenLength, users.loginTokenExpiry)
+	}
+	if admins.loginURL != "https://admins.example.com/login" || admins.loginTokenLength != 48 || admins.loginTokenExpiry != 5*time.Minute {
+		t.Errorf("got %s, %d, %s for admins, want settings of admins prefix", admins.loginURL, admins.loginTokenLength, admins.loginTokenExpiry)
+	}
+
+	if _, err := NewLoginTokenAuthFromViper[int](viper.New()); err == nil || !strings.Contains(err.Error(), "not configured") {
+		t.Errorf("got %v for empty viper, want error listing required keys", err)
+	}
+}
@@ -0,0 +1,130 @@
+package pwdless
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// pairingCodeLength is the number of characters of pairing codes.
+	pairingCodeLength = 8
+	// pairingAlphabet holds upper case letters and digits without the easily confused 0, 1, I and O,
+	// which keeps pairing codes compact in alphanumeric QR codes and readable when typed in.
+	pairingAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+	// pairingExpiry is the maximum expiry of pairing codes, shorter configured login token expiries apply.
+	pairingExpiry = 2 * time.Minute
+	// pairingKeyPrefix and pollKeyPrefix separate pairing store keys from hashed tokenstrings,
+	// so neither pairing codes nor poll tokens can be consumed as tokens.
+	pairingKeyPrefix = "pair:"
+	pollKeyPrefix    = "poll:"
+	// pairingPollKey is the data key of a pairing code referencing the store key of its poll token.
+	pairingPollKey = "poll"
+)
+
+// Pairing is a short lived single use pairing code for signing in a second device, e.g. by scanning a QR code.
+type Pairing struct {
+	// Code is claimed by the second device with ClaimPairing.
+	Code string
+	// PollToken is kept by the originating device to poll for the claim with PairingStatus.
+	PollToken string
+	Expiry    time.Time
+}
+
+// CreatePairing creates a pairing code for account ID expiring after 2 minutes, or the configured expiry if shorter.
+// The code is claimed once by the second device with ClaimPairing, while the originating device polls
+// for the claim with PairingStatus. Pairing codes share rate limiting and per account limits with tokens.
+func (a *LoginTokenAuth[ID]) CreatePairing(id ID) (Pairing, error) {
+	ctx := context.Background()
+	poll, pollKey, err := a.newToken(id)
+	if err != nil {
+		return Pairing{}, err
+	}
+	pollKey = pollKeyPrefix + pollKey
+	ttl := min(a.loginTokenExpiry, pairingExpiry)
+	lt, err := a.issue(ctx, LoginToken[ID]{AccountID: id, Data: map[string]string{pairingPollKey: pollKey}}, ttl, a.newPairingCode)
+	if err != nil {
+		return Pairing{}, err
+	}
+	if err := a.store.Save(ctx, LoginToken[ID]{Token: pollKey, AccountID: id, Created: lt.Created, Expiry: lt.Expiry}); err != nil {
+		return Pairing{}, err
+	}
+	return Pairing{Code: lt.Token, PollToken: poll, Expiry: lt.Expiry}, nil
+}
+
+// newPairingCode returns a random pairing code and the key it is stored by.
+func (a *LoginTokenAuth[ID]) newPairingCode(ID) (string, string, error) {
+	code, err := randStringBytes(a.randSource, pairingCodeLength, pairingAlphabet)
+	if err != nil {
+		return "", "", err
+	}
+	return code, pairingKeyPrefix + a.hashToken(code), nil
+}
+
+// ClaimPairing consumes the pairing code created by CreatePairing and returns its account ID,
+// returning ErrTokenNotFound if it does not exist or was claimed already and ErrTokenExpired if it is past its expiry.
+// The claim is reported to the originating device by PairingStatus until the pairing expiry passed again.
+func (a *LoginTokenAuth[ID]) ClaimPairing(code string) (id ID, err error) {
+	if a.closed.Load() {
+		return id, ErrClosed
+	}
+	defer a.pad(context.Background(), time.Now())
+	ctx, span := a.startSpan(context.Background(), "pwdless.ClaimPairing")
+	key := pairingKeyPrefix + a.hashToken(code)
+	defer func() {
+		span.SetAttributes(attribute.Bool("pwdless.hit", err == nil))
+		endSpan(span, err)
+		if err != nil {
+			a.stats.failed.Add(1)
+			a.logFailure(ctx, key, err)
+		}
+		a.audit(key, id, "", err)
+	}()
+
+	lt, err := a.get(ctx, key)
+	if err == nil {
+		err = a.verifyAccount(lt, code)
+	}
+	switch err {
+	case nil:
+	case ErrTokenNotFound:
+		a.metrics.incConsumeNotFound()
+		return id, err
+	case ErrTokenExpired:
+		a.metrics.incConsumeExpired()
+		return id, err
+	default:
+		return id, err
+	}
+	if lt, err = a.redeem(ctx, lt); err != nil {
+		return id, err
+	}
+	now := a.clock()
+	poll := LoginToken[ID]{Token: lt.Data[pairingPollKey], AccountID: lt.AccountID, Created: lt.Created, Expiry: now.Add(min(a.loginTokenExpiry, pairingExpiry)), Consumed: now}
+	if err := a.store.Save(ctx, poll); err != nil {
+		return id, err
+	}
+	return lt.AccountID, nil
+}
+
+// PairingStatus reports whether the pairing code of pollToken returned by CreatePairing was claimed
+// and the account ID it was claimed for. A successful poll removes the poll token, so the claim is reported once.
+// It returns ErrTokenNotFound if the poll token does not exist and ErrTokenExpired if the pairing expired unclaimed.
+func (a *LoginTokenAuth[ID]) PairingStatus(pollToken string) (claimed bool, id ID, err error) {
+	if a.closed.Load() {
+		return false, id, ErrClosed
+	}
+	ctx := context.Background()
+	lt, err := a.get(ctx, pollKeyPrefix+a.hashToken(pollToken))
+	if err != nil {
+		return false, id, err
+	}
+	if lt.Consumed.IsZero() {
+		return false, id, nil
+	}
+	if err := a.store.Delete(ctx, lt.Token); err != nil {
+		return false, id, err
+	}
+	return true, lt.AccountID, nil
+}
@@ -0,0 +1,63 @@
+package pwdless
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_Pairing(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Hour, WithClock(clock.Now))
+
+	p, err := a.CreatePairing(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Code) != pairingCodeLength || strings.Trim(p.Code, pairingAlphabet) != "" {
+		t.Errorf("got code %q, want %d characters of %q", p.Code, pairingCodeLength, pairingAlphabet)
+	}
+	if want := clock.Now().Add(pairingExpiry); p.Expiry.After(want) {
+		t.Errorf("got expiry %s, want at most %s", p.Expiry, want)
+	}
+	if claimed, _, err := a.PairingStatus(p.PollToken); claimed || err != nil {
+		t.Errorf("got %v, %v polling before claim, want: false, <nil>", claimed, err)
+	}
+	if _, err := a.GetAccountID(p.PollToken); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got %v consuming poll token as token, want: %v", err, ErrTokenNotFound)
+	}
+	if _, err := a.GetAccountID(p.Code); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got %v consuming pairing code as token, want: %v", err, ErrTokenNotFound)
+	}
+
+	if id, err := a.ClaimPairing(p.Code); err != nil || id != 1 {
+		t.Fatalf("got %d, %v claiming pairing, want: %d, <nil>", id, err, 1)
+	}
+	if _, err := a.ClaimPairing(p.Code); err != ErrTokenNotFound {
+		t.Errorf("got %v claiming pairing again, want: %v", err, ErrTokenNotFound)
+	}
+	if claimed, id, err := a.PairingStatus(p.PollToken); !claimed || id != 1 || err != nil {
+		t.Errorf("got %v, %d, %v polling after claim, want: true, %d, <nil>", claimed, id, err, 1)
+	}
+	if _, _, err := a.PairingStatus(p.PollToken); err != ErrTokenNotFound {
+		t.Errorf("got %v polling again after reported claim, want: %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestLoginTokenAuth_PairingExpired(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Hour, WithClock(clock.Now))
+
+	p, err := a.CreatePairing(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(pairingExpiry + time.Second)
+	if _, err := a.ClaimPairing(p.Code); err != ErrTokenExpired {
+		t.Errorf("got %v claiming expired pairing, want: %v", err, ErrTokenExpired)
+	}
+	if _, _, err := a.PairingStatus(p.PollToken); err != ErrTokenExpired {
+		t.Errorf("got %v polling expired pairing, want: %v", err, ErrTokenExpired)
+	}
+}
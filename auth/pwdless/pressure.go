@@ -0,0 +1,93 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrStoreFull is returned by token creation if the store holds the maximum number of tokens set by WithMemoryPressure
+// with policy RejectNew.
+var ErrStoreFull = errors.New("login token store full")
+
+// PressurePolicy is the behavior of WithMemoryPressure once the store holds the maximum number of tokens.
+type PressurePolicy int
+
+const (
+	// RejectNew fails token creation with ErrStoreFull until tokens are consumed or purged.
+	RejectNew PressurePolicy = iota
+	// AggressivePurge purges expired tokens immediately and, if still full, evicts tokens by the EvictionPolicy,
+	// the tokens expiring soonest by default.
+	AggressivePurge
+)
+
+// String returns the policy name as used in logs.
+func (p PressurePolicy) String() string {
+	switch p {
+	case RejectNew:
+		return "reject_new"
+	case AggressivePurge:
+		return "aggressive_purge"
+	}
+	return fmt.Sprintf("PressurePolicy(%d)", int(p))
+}
+
+// EvictionPolicy reports whether token a is evicted before token b when the store is full, see WithEvictionPolicy.
+type EvictionPolicy[ID comparable] func(a, b LoginToken[ID]) bool
+
+// evictSoonestExpiring is the default EvictionPolicy, evicting the tokens expiring soonest, then the oldest.
+func evictSoonestExpiring[ID comparable](a, b LoginToken[ID]) bool {
+	if !a.Expiry.Equal(b.Expiry) {
+		return a.Expiry.Before(b.Expiry)
+	}
+	return a.Created.Before(b.Created)
+}
+
+// sizer is implemented by stores able to report the number of tokens held, like MemoryStore.
+type sizer interface {
+	Len() int
+}
+
+// relievePressure makes room for a token created at now if the store reached the maximum set by WithMemoryPressure,
+// returning ErrStoreFull with policy RejectNew.
+func (a *LoginTokenAuth[ID]) relievePressure(ctx context.Context, now time.Time, u *batchUndo[ID]) error {
+	s, ok := a.store.(sizer)
+	if a.pressureMax <= 0 || !ok {
+		return nil
+	}
+	n := s.Len()
+	if n < a.pressureMax {
+		return nil
+	}
+	a.metrics.incPressure()
+	a.logMemoryPressure(ctx, n, a.pressurePolicy)
+	if a.pressurePolicy == RejectNew {
+		return ErrStoreFull
+	}
+	if _, err := a.purgeStore(ctx, now); err != nil {
+		return err
+	}
+	if n = s.Len(); n < a.pressureMax {
+		return nil
+	}
+	l, ok := a.store.(lister[ID])
+	if !ok {
+		return ErrStoreFull
+	}
+	tokens, err := l.All(ctx, now)
+	if err != nil {
+		return err
+	}
+	sort.Slice(tokens, func(i, j int) bool { return a.evictBefore(tokens[i], tokens[j]) })
+	for _, lt := range tokens[:min(n-a.pressureMax+1, len(tokens))] {
+		if err := a.store.Delete(ctx, lt.Token); err != nil {
+			return err
+		}
+		a.metrics.incEvicted()
+		a.stats.active.Add(-1)
+		u.evict(lt)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package pwdless
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLoginTokenAuth_memoryPressureRejectNew(t *testing.T) {
+	a, store := newTestAuth(time.Minute, WithMemoryPressure(3, RejectNew), WithMetrics(prometheus.NewRegistry()))
+	m := a.metrics
+
+	for i := 0; i < 3; i++ {
+		if _, err := a.CreateToken(i); err != nil {
+			t.Fatalf("got %v creating token %d below the mark, want: <nil>", err, i+1)
+		}
+	}
+	if _, err := a.CreateToken(4); err != ErrStoreFull {
+		t.Errorf("got %v at the mark, want: %v", err, ErrStoreFull)
+	}
+	if n := store.Len(); n != 3 {
+		t.Errorf("got %d tokens in store, want: %d", n, 3)
+	}
+	if got := m.Snapshot().Pressure; got != 1 {
+		t.Errorf("got %d pressure events, want: %d", got, 1)
+	}
+}
+
+func TestLoginTokenAuth_memoryPressureAggressivePurge(t *testing.T) {
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Minute, WithClock(clock.Now), WithMemoryPressure(3, AggressivePurge), WithMetrics(prometheus.NewRegistry()))
+	m := a.metrics
+
+	expired, err := a.CreateTokenWithExpiry(1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	soonest, err := a.CreateTokenWithExpiry(2, 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := a.CreateToken(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(2 * time.Second)
+
+	// the expired token is purged out of cycle
+	if _, err := a.CreateToken(4); err != nil {
+		t.Fatalf("got %v at the mark with expired token, want: <nil>", err)
+	}
+	if _, ok := store.token[a.hashToken(expired.Token)]; ok {
+		t.Error("expired token not purged at the mark")
+	}
+	if got := m.Snapshot(); got.Purged != 1 || got.Evicted != 0 {
+		t.Errorf("got %d purged and %d evicted, want: 1 and 0", got.Purged, got.Evicted)
+	}
+
+	// without expired tokens the one expiring soonest is evicted
+	if _, err := a.CreateToken(5); err != nil {
+		t.Fatalf("got %v at the mark without expired tokens, want: <nil>", err)
+	}
+	if _, ok := store.token[a.hashToken(soonest.Token)]; ok {
+		t.Error("token expiring soonest not evicted")
+	}
+	if _, ok := store.token[a.hashToken(latest.Token)]; !ok {
+		t.Error("token expiring later evicted")
+	}
+	if n := store.Len(); n != 3 {
+		t.Errorf("got %d tokens in store, want: %d", n, 3)
+	}
+	if got := m.Snapshot(); got.Evicted != 1 || got.Pressure != 2 {
+		t.Errorf("got %d evicted and %d pressure events, want: 1 and 2", got.Evicted, got.Pressure)
+	}
+}
+
+func TestLoginTokenAuth_memoryPressureStore(t *testing.T) {
+	_, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithExpiry(time.Minute),
+		WithStore[int](NewRetryingStore[int](NewMemoryStore[int](), 1, 0, nil)), WithMemoryPressure(3, RejectNew))
+	if err == nil {
+		t.Error("got no error for memory pressure with store not reporting its size")
+	}
+}
+
+func TestLoginTokenAuth_evictionPolicy(t *testing.T) {
+	clock := newFakeClock()
+	protectRecent := func(a, b LoginToken[int]) bool {
+		recent := clock.Now().Add(-5 * time.Second)
+		if ar, br := a.Created.After(recent), b.Created.After(recent); ar != br {
+			return br
+		}
+		return a.Expiry.Before(b.Expiry)
+	}
+	a, store := newTestAuth(time.Hour, WithClock(clock.Now), WithMemoryPressure(3, AggressivePurge),
+		WithEvictionPolicy[int](protectRecent))
+
+	old, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(10 * time.Second)
+	recent, err := a.CreateTokenWithExpiry(2, 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateTokenWithExpiry(3, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.CreateToken(4); err != nil {
+		t.Fatalf("got %v at the mark, want: <nil>", err)
+	}
+	if _, ok := store.token[a.hashToken(old.Token)]; ok {
+		t.Error("old token not evicted")
+	}
+	if _, ok := store.token[a.hashToken(recent.Token)]; !ok {
+		t.Error("recent token expiring soonest evicted")
+	}
+}
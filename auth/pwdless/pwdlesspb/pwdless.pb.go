@@ -0,0 +1,395 @@
+// Package pwdless.v1 exposes login token operations of a pwdless.LoginTokenAuth
+// to services not written in Go sharing its token store.
+//
+// Errors are returned as gRPC status codes:
+//   NOT_FOUND           token not found, expired or created in the future
+//   INVALID_ARGUMENT    token prefix, scope or fingerprint mismatch, malformed account ID
+//   PERMISSION_DENIED   token reuse detected
+//   FAILED_PRECONDITION token consumed before the delay set by WithConsumeDelay
+//   RESOURCE_EXHAUSTED  rate limit, token limit or attempt limit exceeded
+//   UNAVAILABLE         LoginTokenAuth closed
+//   INTERNAL            all other errors
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: pwdlesspb/pwdless.proto
+
+package pwdlesspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CreateTokenRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// account_id is the JSON encoded account ID, e.g. "42" for int IDs.
+	AccountId     string `protobuf:"bytes,1,opt,name=account_id,json=accountId,proto3" json:"account_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateTokenRequest) Reset() {
+	*x = CreateTokenRequest{}
+	mi := &file_pwdlesspb_pwdless_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateTokenRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateTokenRequest) ProtoMessage() {}
+
+func (x *CreateTokenRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pwdlesspb_pwdless_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateTokenRequest.ProtoReflect.Descriptor instead.
+func (*CreateTokenRequest) Descriptor() ([]byte, []int) {
+	return file_pwdlesspb_pwdless_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CreateTokenRequest) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+type CreateTokenResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Token string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	// expiry is the expiry of the token as unix timestamp in seconds.
+	Expiry        int64 `protobuf:"varint,2,opt,name=expiry,proto3" json:"expiry,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateTokenResponse) Reset() {
+	*x = CreateTokenResponse{}
+	mi := &file_pwdlesspb_pwdless_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateTokenResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateTokenResponse) ProtoMessage() {}
+
+func (x *CreateTokenResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pwdlesspb_pwdless_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateTokenResponse.ProtoReflect.Descriptor instead.
+func (*CreateTokenResponse) Descriptor() ([]byte, []int) {
+	return file_pwdlesspb_pwdless_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CreateTokenResponse) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *CreateTokenResponse) GetExpiry() int64 {
+	if x != nil {
+		return x.Expiry
+	}
+	return 0
+}
+
+type ConsumeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Token string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	// source identifies the client presenting the token, e.g. its IP, counted against attempt limits.
+	Source        string `protobuf:"bytes,2,opt,name=source,proto3" json:"source,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConsumeRequest) Reset() {
+	*x = ConsumeRequest{}
+	mi := &file_pwdlesspb_pwdless_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConsumeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConsumeRequest) ProtoMessage() {}
+
+func (x *ConsumeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pwdlesspb_pwdless_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConsumeRequest.ProtoReflect.Descriptor instead.
+func (*ConsumeRequest) Descriptor() ([]byte, []int) {
+	return file_pwdlesspb_pwdless_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ConsumeRequest) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *ConsumeRequest) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+type ConsumeResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// account_id is the JSON encoded account ID.
+	AccountId     string `protobuf:"bytes,1,opt,name=account_id,json=accountId,proto3" json:"account_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConsumeResponse) Reset() {
+	*x = ConsumeResponse{}
+	mi := &file_pwdlesspb_pwdless_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConsumeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConsumeResponse) ProtoMessage() {}
+
+func (x *ConsumeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pwdlesspb_pwdless_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConsumeResponse.ProtoReflect.Descriptor instead.
+func (*ConsumeResponse) Descriptor() ([]byte, []int) {
+	return file_pwdlesspb_pwdless_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ConsumeResponse) GetAccountId() string {
+	if x != nil {
+		return x.AccountId
+	}
+	return ""
+}
+
+type RevokeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RevokeRequest) Reset() {
+	*x = RevokeRequest{}
+	mi := &file_pwdlesspb_pwdless_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RevokeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RevokeRequest) ProtoMessage() {}
+
+func (x *RevokeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pwdlesspb_pwdless_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RevokeRequest.ProtoReflect.Descriptor instead.
+func (*RevokeRequest) Descriptor() ([]byte, []int) {
+	return file_pwdlesspb_pwdless_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *RevokeRequest) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+type RevokeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RevokeResponse) Reset() {
+	*x = RevokeResponse{}
+	mi := &file_pwdlesspb_pwdless_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RevokeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RevokeResponse) ProtoMessage() {}
+
+func (x *RevokeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pwdlesspb_pwdless_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RevokeResponse.ProtoReflect.Descriptor instead.
+func (*RevokeResponse) Descriptor() ([]byte, []int) {
+	return file_pwdlesspb_pwdless_proto_rawDescGZIP(), []int{5}
+}
+
+var File_pwdlesspb_pwdless_proto protoreflect.FileDescriptor
+
+const file_pwdlesspb_pwdless_proto_rawDesc = "" +
+	"\n" +
+	"\x17pwdlesspb/pwdless.proto\x12\n" +
+	"pwdless.v1\"3\n" +
+	"\x12CreateTokenRequest\x12\x1d\n" +
+	"\n" +
+	"account_id\x18\x01 \x01(\tR\taccountId\"C\n" +
+	"\x13CreateTokenResponse\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x12\x16\n" +
+	"\x06expiry\x18\x02 \x01(\x03R\x06expiry\">\n" +
+	"\x0eConsumeRequest\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x12\x16\n" +
+	"\x06source\x18\x02 \x01(\tR\x06source\"0\n" +
+	"\x0fConsumeResponse\x12\x1d\n" +
+	"\n" +
+	"account_id\x18\x01 \x01(\tR\taccountId\"%\n" +
+	"\rRevokeRequest\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\"\x10\n" +
+	"\x0eRevokeResponse2\xe8\x01\n" +
+	"\x11LoginTokenService\x12N\n" +
+	"\vCreateToken\x12\x1e.pwdless.v1.CreateTokenRequest\x1a\x1f.pwdless.v1.CreateTokenResponse\x12B\n" +
+	"\aConsume\x12\x1a.pwdless.v1.ConsumeRequest\x1a\x1b.pwdless.v1.ConsumeResponse\x12?\n" +
+	"\x06Revoke\x12\x19.pwdless.v1.RevokeRequest\x1a\x1a.pwdless.v1.RevokeResponseB0Z.github.com/dhax/go-base/auth/pwdless/pwdlesspbb\x06proto3"
+
+var (
+	file_pwdlesspb_pwdless_proto_rawDescOnce sync.Once
+	file_pwdlesspb_pwdless_proto_rawDescData []byte
+)
+
+func file_pwdlesspb_pwdless_proto_rawDescGZIP() []byte {
+	file_pwdlesspb_pwdless_proto_rawDescOnce.Do(func() {
+		file_pwdlesspb_pwdless_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pwdlesspb_pwdless_proto_rawDesc), len(file_pwdlesspb_pwdless_proto_rawDesc)))
+	})
+	return file_pwdlesspb_pwdless_proto_rawDescData
+}
+
+var file_pwdlesspb_pwdless_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_pwdlesspb_pwdless_proto_goTypes = []any{
+	(*CreateTokenRequest)(nil),  // 0: pwdless.v1.CreateTokenRequest
+	(*CreateTokenResponse)(nil), // 1: pwdless.v1.CreateTokenResponse
+	(*ConsumeRequest)(nil),      // 2: pwdless.v1.ConsumeRequest
+	(*ConsumeResponse)(nil),     // 3: pwdless.v1.ConsumeResponse
+	(*RevokeRequest)(nil),       // 4: pwdless.v1.RevokeRequest
+	(*RevokeResponse)(nil),      // 5: pwdless.v1.RevokeResponse
+}
+var file_pwdlesspb_pwdless_proto_depIdxs = []int32{
+	0, // 0: pwdless.v1.LoginTokenService.CreateToken:input_type -> pwdless.v1.CreateTokenRequest
+	2, // 1: pwdless.v1.LoginTokenService.Consume:input_type -> pwdless.v1.ConsumeRequest
+	4, // 2: pwdless.v1.LoginTokenService.Revoke:input_type -> pwdless.v1.RevokeRequest
+	1, // 3: pwdless.v1.LoginTokenService.CreateToken:output_type -> pwdless.v1.CreateTokenResponse
+	3, // 4: pwdless.v1.LoginTokenService.Consume:output_type -> pwdless.v1.ConsumeResponse
+	5, // 5: pwdless.v1.LoginTokenService.Revoke:output_type -> pwdless.v1.RevokeResponse
+	3, // [3:6] is the sub-list for method output_type
+	0, // [0:3] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_pwdlesspb_pwdless_proto_init() }
+func file_pwdlesspb_pwdless_proto_init() {
+	if File_pwdlesspb_pwdless_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pwdlesspb_pwdless_proto_rawDesc), len(file_pwdlesspb_pwdless_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pwdlesspb_pwdless_proto_goTypes,
+		DependencyIndexes: file_pwdlesspb_pwdless_proto_depIdxs,
+		MessageInfos:      file_pwdlesspb_pwdless_proto_msgTypes,
+	}.Build()
+	File_pwdlesspb_pwdless_proto = out.File
+	file_pwdlesspb_pwdless_proto_goTypes = nil
+	file_pwdlesspb_pwdless_proto_depIdxs = nil
+}
@@ -0,0 +1,219 @@
+// Package pwdless.v1 exposes login token operations of a pwdless.LoginTokenAuth
+// to services not written in Go sharing its token store.
+//
+// Errors are returned as gRPC status codes:
+//   NOT_FOUND           token not found, expired or created in the future
+//   INVALID_ARGUMENT    token prefix, scope or fingerprint mismatch, malformed account ID
+//   PERMISSION_DENIED   token reuse detected
+//   FAILED_PRECONDITION token consumed before the delay set by WithConsumeDelay
+//   RESOURCE_EXHAUSTED  rate limit, token limit or attempt limit exceeded
+//   UNAVAILABLE         LoginTokenAuth closed
+//   INTERNAL            all other errors
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: pwdlesspb/pwdless.proto
+
+package pwdlesspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	LoginTokenService_CreateToken_FullMethodName = "/pwdless.v1.LoginTokenService/CreateToken"
+	LoginTokenService_Consume_FullMethodName     = "/pwdless.v1.LoginTokenService/Consume"
+	LoginTokenService_Revoke_FullMethodName      = "/pwdless.v1.LoginTokenService/Revoke"
+)
+
+// LoginTokenServiceClient is the client API for LoginTokenService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// LoginTokenService creates, consumes and revokes login tokens.
+type LoginTokenServiceClient interface {
+	// CreateToken creates a login token for an account.
+	CreateToken(ctx context.Context, in *CreateTokenRequest, opts ...grpc.CallOption) (*CreateTokenResponse, error)
+	// Consume consumes a login token and returns its account, like GetAccountID.
+	Consume(ctx context.Context, in *ConsumeRequest, opts ...grpc.CallOption) (*ConsumeResponse, error)
+	// Revoke deletes a login token without consuming it.
+	Revoke(ctx context.Context, in *RevokeRequest, opts ...grpc.CallOption) (*RevokeResponse, error)
+}
+
+type loginTokenServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLoginTokenServiceClient(cc grpc.ClientConnInterface) LoginTokenServiceClient {
+	return &loginTokenServiceClient{cc}
+}
+
+func (c *loginTokenServiceClient) CreateToken(ctx context.Context, in *CreateTokenRequest, opts ...grpc.CallOption) (*CreateTokenResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateTokenResponse)
+	err := c.cc.Invoke(ctx, LoginTokenService_CreateToken_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loginTokenServiceClient) Consume(ctx context.Context, in *ConsumeRequest, opts ...grpc.CallOption) (*ConsumeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConsumeResponse)
+	err := c.cc.Invoke(ctx, LoginTokenService_Consume_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loginTokenServiceClient) Revoke(ctx context.Context, in *RevokeRequest, opts ...grpc.CallOption) (*RevokeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RevokeResponse)
+	err := c.cc.Invoke(ctx, LoginTokenService_Revoke_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LoginTokenServiceServer is the server API for LoginTokenService service.
+// All implementations must embed UnimplementedLoginTokenServiceServer
+// for forward compatibility.
+//
+// LoginTokenService creates, consumes and revokes login tokens.
+type LoginTokenServiceServer interface {
+	// CreateToken creates a login token for an account.
+	CreateToken(context.Context, *CreateTokenRequest) (*CreateTokenResponse, error)
+	// Consume consumes a login token and returns its account, like GetAccountID.
+	Consume(context.Context, *ConsumeRequest) (*ConsumeResponse, error)
+	// Revoke deletes a login token without consuming it.
+	Revoke(context.Context, *RevokeRequest) (*RevokeResponse, error)
+	mustEmbedUnimplementedLoginTokenServiceServer()
+}
+
+// UnimplementedLoginTokenServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedLoginTokenServiceServer struct{}
+
+func (UnimplementedLoginTokenServiceServer) CreateToken(context.Context, *CreateTokenRequest) (*CreateTokenResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method CreateToken not implemented")
+}
+func (UnimplementedLoginTokenServiceServer) Consume(context.Context, *ConsumeRequest) (*ConsumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Consume not implemented")
+}
+func (UnimplementedLoginTokenServiceServer) Revoke(context.Context, *RevokeRequest) (*RevokeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Revoke not implemented")
+}
+func (UnimplementedLoginTokenServiceServer) mustEmbedUnimplementedLoginTokenServiceServer() {}
+func (UnimplementedLoginTokenServiceServer) testEmbeddedByValue()                           {}
+
+// UnsafeLoginTokenServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LoginTokenServiceServer will
+// result in compilation errors.
+type UnsafeLoginTokenServiceServer interface {
+	mustEmbedUnimplementedLoginTokenServiceServer()
+}
+
+func RegisterLoginTokenServiceServer(s grpc.ServiceRegistrar, srv LoginTokenServiceServer) {
+	// If the following call panics, it indicates UnimplementedLoginTokenServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&LoginTokenService_ServiceDesc, srv)
+}
+
+func _LoginTokenService_CreateToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoginTokenServiceServer).CreateToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LoginTokenService_CreateToken_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoginTokenServiceServer).CreateToken(ctx, req.(*CreateTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoginTokenService_Consume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConsumeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoginTokenServiceServer).Consume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LoginTokenService_Consume_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoginTokenServiceServer).Consume(ctx, req.(*ConsumeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoginTokenService_Revoke_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoginTokenServiceServer).Revoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LoginTokenService_Revoke_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoginTokenServiceServer).Revoke(ctx, req.(*RevokeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// LoginTokenService_ServiceDesc is the grpc.ServiceDesc for LoginTokenService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LoginTokenService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pwdless.v1.LoginTokenService",
+	HandlerType: (*LoginTokenServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateToken",
+			Handler:    _LoginTokenService_CreateToken_Handler,
+		},
+		{
+			MethodName: "Consume",
+			Handler:    _LoginTokenService_Consume_Handler,
+		},
+		{
+			MethodName: "Revoke",
+			Handler:    _LoginTokenService_Revoke_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pwdlesspb/pwdless.proto",
+}
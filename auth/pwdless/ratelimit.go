@@ -0,0 +1,116 @@
+package pwdless
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateLimitKeyPrefix is prepended to account IDs to build RateLimitStore keys.
+const rateLimitKeyPrefix = "ratelimit:"
+
+// RateLimitStore counts events per key shared by all instances using it, e.g. backed by redis INCR and PEXPIRE,
+// so account rate limits are enforced across instances and restarts. Stores also implementing
+// Decr(ctx, key) error, e.g. by redis DECR, have the events of batches failed in CreateTokens refunded.
+type RateLimitStore interface {
+	// Incr increments the counter of key and returns its new value. A new counter must be set to expire
+	// after window, so counts reset automatically.
+	Incr(ctx context.Context, key string, window time.Duration) (int, error)
+}
+
+// rateLimitRefunder is implemented by RateLimitStores able to take back an event counted by Incr.
+type rateLimitRefunder interface {
+	Decr(ctx context.Context, key string) error
+}
+
+// sharedRateLimiter allows up to limit events per account within a fixed window starting with the first event,
+// counted by a RateLimitStore.
+type sharedRateLimiter[ID comparable] struct {
+	store  RateLimitStore
+	limit  int
+	window time.Duration
+}
+
+// allow records an event for account id and reports whether it is within the limit.
+func (l *sharedRateLimiter[ID]) allow(ctx context.Context, id ID) (bool, error) {
+	n, err := l.store.Incr(ctx, fmt.Sprint(rateLimitKeyPrefix, id), l.window)
+	if err != nil {
+		return false, err
+	}
+	return n <= l.limit, nil
+}
+
+// refund takes back an event recorded for account id if the store supports it.
+func (l *sharedRateLimiter[ID]) refund(ctx context.Context, id ID) error {
+	if r, ok := l.store.(rateLimitRefunder); ok {
+		return r.Decr(ctx, fmt.Sprint(rateLimitKeyPrefix, id))
+	}
+	return nil
+}
+
+// rateLimiter allows up to limit events per key within a sliding window.
+type rateLimiter[K comparable] struct {
+	limit  int
+	window time.Duration
+
+	mux         sync.Mutex
+	events      map[K][]time.Time
+	lastCleanup time.Time
+}
+
+func newRateLimiter[K comparable](limit int, window time.Duration) *rateLimiter[K] {
+	return &rateLimiter[K]{
+		limit:  limit,
+		window: window,
+		events: make(map[K][]time.Time),
+	}
+}
+
+// allow records an event for key at now and reports whether it is within the limit.
+// Keys without events in the current window are removed once per window.
+func (l *rateLimiter[K]) allow(key K, now time.Time) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if now.Sub(l.lastCleanup) > l.window {
+		for k, ev := range l.events {
+			if ev = l.prune(ev, now); len(ev) == 0 {
+				delete(l.events, k)
+			} else {
+				l.events[k] = ev
+			}
+		}
+		l.lastCleanup = now
+	}
+
+	ev := l.prune(l.events[key], now)
+	if len(ev) >= l.limit {
+		l.events[key] = ev
+		return false
+	}
+	l.events[key] = append(ev, now)
+	return true
+}
+
+// refund removes an event recorded for key at t.
+func (l *rateLimiter[K]) refund(key K, t time.Time) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	ev := l.events[key]
+	for i := len(ev) - 1; i >= 0; i-- {
+		if ev[i].Equal(t) {
+			l.events[key] = append(ev[:i], ev[i+1:]...)
+			return
+		}
+	}
+}
+
+// prune drops events older than the window.
+func (l *rateLimiter[K]) prune(ev []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(ev) && now.Sub(ev[i]) >= l.window {
+		i++
+	}
+	return ev[i:]
+}
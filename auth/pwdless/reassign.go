@@ -0,0 +1,42 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errReassignUnsupported = errors.New("token store does not support reassigning tokens")
+
+// reassigner is implemented by stores able to change the account of a token atomically.
+type reassigner[ID comparable] interface {
+	Reassign(ctx context.Context, token string, now time.Time, id ID, accountHash string) (bool, error)
+}
+
+// Reassign changes the account of the unexpired token by tokenstring to newID, e.g. when merging accounts,
+// returning ErrTokenNotFound and ErrTokenExpired like GetAccountID. The store updates the token atomically,
+// so concurrent consumption returns either the old or the new account ID. Only stores implementing
+// Reassign(ctx, token, now, id, accountHash), like MemoryStore, ShardedMemoryStore, SQLStore and BoltStore, are supported.
+func (a *LoginTokenAuth[ID]) Reassign(token string, newID ID) error {
+	r, ok := a.store.(reassigner[ID])
+	if !ok {
+		return errReassignUnsupported
+	}
+	ctx := context.Background()
+	lt, err := a.lookup(ctx, token)
+	if err != nil {
+		return err
+	}
+	hash, err := a.accountHash(newID, token)
+	if err != nil {
+		return err
+	}
+	ok, err = r.Reassign(ctx, lt.Token, a.clock(), newID, hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrTokenNotFound
+	}
+	return nil
+}
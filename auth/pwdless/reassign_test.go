@@ -0,0 +1,49 @@
+package pwdless
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_Reassign(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithAccountSecret(func(id int) ([]byte, error) {
+		return []byte(fmt.Sprintf("secret-%d", id)), nil
+	}))
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Reassign(lt.Token, 2); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 2 {
+		t.Errorf("got %d, %v after reassign, want: 2, <nil>", id, err)
+	}
+	if err := a.Reassign(lt.Token, 3); err != ErrTokenNotFound {
+		t.Errorf("got error %v reassigning consumed token, want: %v", err, ErrTokenNotFound)
+	}
+
+	expired, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(2 * time.Minute)
+	if err := a.Reassign(expired.Token, 2); err != ErrTokenExpired {
+		t.Errorf("got error %v reassigning expired token, want: %v", err, ErrTokenExpired)
+	}
+
+	unsupported, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithStore[int](struct{ TokenStore[int] }{NewMemoryStore[int]()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := unsupported.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unsupported.Reassign(other.Token, 2); err != errReassignUnsupported {
+		t.Errorf("got error %v for store without Reassign, want: %v", err, errReassignUnsupported)
+	}
+}
@@ -0,0 +1,67 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errNoAccountUpdater = errors.New("no account updater configured")
+
+// AccountUpdater records successful logins on accounts, e.g. setting a last login timestamp.
+type AccountUpdater[ID comparable] interface {
+	// RecordLogin records the login of account id at.
+	RecordLogin(ctx context.Context, id ID, at time.Time) error
+}
+
+// ConsumeAndRecord is like GetAccountIDContext, additionally recording the login by the AccountUpdater set with
+// WithAccountUpdater. If recording fails the token is restored as it was before consumption, so the login can be
+// retried, though hooks, metrics and webhooks already reported the consumption. The returned error wraps both errors
+// if restoring fails too.
+func (a *LoginTokenAuth[ID]) ConsumeAndRecord(ctx context.Context, token string) (ID, error) {
+	var id ID
+	if a.updater == nil {
+		return id, errNoAccountUpdater
+	}
+	lt, err := a.consumeOrRestore(ctx, token, func(lt LoginToken[ID]) error {
+		if err := a.updater.RecordLogin(ctx, lt.AccountID, a.clock()); err != nil {
+			return fmt.Errorf("recording login: %w", err)
+		}
+		return nil
+	})
+	return lt.AccountID, err
+}
+
+// consumeOrRestore consumes the token like GetAccountIDContext and calls f with the consumed token,
+// restoring the token as it was before consumption if f fails.
+func (a *LoginTokenAuth[ID]) consumeOrRestore(ctx context.Context, token string, f func(LoginToken[ID]) error) (LoginToken[ID], error) {
+	// keep the token as stored to restore it, consumption reports lookup failures
+	orig, lookupErr := a.lookup(ctx, token)
+	if errors.Is(lookupErr, ErrTokenReuseDetected) {
+		return LoginToken[ID]{}, lookupErr
+	}
+	lt, err := a.consume(ctx, token, "", "", "")
+	if err != nil {
+		return LoginToken[ID]{}, err
+	}
+	if err := f(lt); err != nil {
+		if lookupErr != nil {
+			return LoginToken[ID]{}, err
+		}
+		if rerr := a.restore(ctx, orig); rerr != nil {
+			return LoginToken[ID]{}, errors.Join(err, fmt.Errorf("restoring login token: %w", rerr))
+		}
+		return LoginToken[ID]{}, err
+	}
+	return lt, nil
+}
+
+// restore saves the stored token lt as looked up before consumption.
+func (a *LoginTokenAuth[ID]) restore(ctx context.Context, lt LoginToken[ID]) error {
+	sealed, err := a.sealData(lt)
+	if err != nil {
+		return err
+	}
+	return a.store.Save(ctx, sealed)
+}
@@ -0,0 +1,57 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// accountUpdater records logins by account, failing with err if set.
+type accountUpdater struct {
+	err    error
+	logins map[int]time.Time
+}
+
+func (u *accountUpdater) RecordLogin(_ context.Context, id int, at time.Time) error {
+	if u.err != nil {
+		return u.err
+	}
+	u.logins[id] = at
+	return nil
+}
+
+func TestLoginTokenAuth_ConsumeAndRecord(t *testing.T) {
+	clock := newFakeClock()
+	u := &accountUpdater{logins: make(map[int]time.Time)}
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithAccountUpdater[int](u))
+	ctx := context.Background()
+
+	lt, err := a.CreateTokenWithData(1, map[string]string{"k": "v"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.err = errStore
+	if _, err := a.ConsumeAndRecord(ctx, lt.Token); !errors.Is(err, errStore) {
+		t.Errorf("got %v with failing updater, want: %v", err, errStore)
+	}
+	if _, ok := u.logins[1]; ok {
+		t.Error("got login recorded by failing updater")
+	}
+
+	u.err = nil
+	if id, err := a.ConsumeAndRecord(ctx, lt.Token); err != nil || id != 1 {
+		t.Fatalf("got %d, %v retrying after failed update, want: %d, <nil>", id, err, 1)
+	}
+	if at, ok := u.logins[1]; !ok || !at.Equal(clock.Now()) {
+		t.Errorf("got login at %s, %v, want recorded at %s", at, ok, clock.Now())
+	}
+	if _, err := a.ConsumeAndRecord(ctx, lt.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got %v for consumed token, want: %v", err, ErrTokenNotFound)
+	}
+
+	plain, _ := newTestAuth(time.Minute)
+	if _, err := plain.ConsumeAndRecord(ctx, lt.Token); err != errNoAccountUpdater {
+		t.Errorf("got %v without updater, want: %v", err, errNoAccountUpdater)
+	}
+}
@@ -0,0 +1,170 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// recoveryCodeLength is the number of characters of recovery codes, drawn from codeAlphabet.
+	recoveryCodeLength = 10
+	// recoveryCodeExpiry is the expiry of recovery codes, which are meant to be printed and kept.
+	recoveryCodeExpiry = 365 * 24 * time.Hour
+	// maxRecoveryCodes is the maximum number of recovery codes created at once.
+	maxRecoveryCodes = 20
+	// recoveryKeyPrefix separates recovery code store keys from hashed tokenstrings and codes.
+	recoveryKeyPrefix = "recovery:"
+)
+
+// ErrRecoveryCodesExhausted is returned by GetAccountIDByRecoveryCode if the account has no unused recovery codes left.
+var ErrRecoveryCodesExhausted = errors.New("no recovery codes left, please create new ones")
+
+// CreateRecoveryCodes creates count single use recovery codes for account ID expiring after a year, to be printed
+// and used with GetAccountIDByRecoveryCode when the login link can't be received. The codes are returned once,
+// only their hashes are stored. Creating codes again replaces all codes created before for the account.
+// Recovery codes neither count against per account limits nor are reported by HasPendingToken.
+func (a *LoginTokenAuth[ID]) CreateRecoveryCodes(id ID, count int) (_ []string, err error) {
+	if a.closed.Load() {
+		return nil, ErrClosed
+	}
+	if count <= 0 || count > maxRecoveryCodes {
+		return nil, fmt.Errorf("recovery code count %d must be between 1 and %d", count, maxRecoveryCodes)
+	}
+	ctx, span := a.startSpan(context.Background(), "pwdless.CreateRecoveryCodes")
+	defer func() { endSpan(span, err) }()
+
+	now := a.clock()
+	old, err := a.recoveryCodes(ctx, id, now)
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]string, count)
+	stored := make([]LoginToken[ID], count)
+	for i := range stored {
+		var lt LoginToken[ID]
+		lt, stored[i], err = a.rekey(LoginToken[ID]{AccountID: id, Created: now, Expiry: now.Add(recoveryCodeExpiry)}, a.newRecoveryCode)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = lt.Token
+	}
+	if err := a.saveBatch(ctx, stored); err != nil {
+		return nil, err
+	}
+	for _, lt := range old {
+		if err := a.store.Delete(ctx, lt.Token); err != nil {
+			return nil, err
+		}
+		a.stats.active.Add(-1)
+	}
+	for _, lt := range stored {
+		a.created(ctx, lt)
+	}
+	return codes, nil
+}
+
+// newRecoveryCode returns a random recovery code and the key it is stored by for account ID.
+func (a *LoginTokenAuth[ID]) newRecoveryCode(id ID) (string, string, error) {
+	code, err := randStringBytes(a.randSource, recoveryCodeLength, codeAlphabet)
+	if err != nil {
+		return "", "", err
+	}
+	return code, a.recoveryKey(id, code), nil
+}
+
+func (a *LoginTokenAuth[ID]) recoveryKey(id ID, code string) string {
+	return recoveryKeyPrefix + a.hashToken(fmt.Sprintf("%v\x00%s", id, code))
+}
+
+// isRecoveryCode reports whether the stored token lt is a recovery code.
+func isRecoveryCode[ID comparable](lt LoginToken[ID]) bool {
+	return strings.HasPrefix(lt.Token, recoveryKeyPrefix)
+}
+
+// withoutRecoveryCodes returns tokens without recovery codes, reusing tokens.
+func withoutRecoveryCodes[ID comparable](tokens []LoginToken[ID]) []LoginToken[ID] {
+	n := 0
+	for _, lt := range tokens {
+		if !isRecoveryCode(lt) {
+			tokens[n] = lt
+			n++
+		}
+	}
+	return tokens[:n]
+}
+
+// recoveryCodes returns the unused recovery codes of account id stored at now.
+func (a *LoginTokenAuth[ID]) recoveryCodes(ctx context.Context, id ID, now time.Time) ([]LoginToken[ID], error) {
+	tokens, err := a.store.List(ctx, id, now)
+	if err != nil {
+		return nil, err
+	}
+	var codes []LoginToken[ID]
+	for _, lt := range tokens {
+		if isRecoveryCode(lt) {
+			codes = append(codes, lt)
+		}
+	}
+	return codes, nil
+}
+
+// GetAccountIDByRecoveryCode consumes a recovery code created by CreateRecoveryCodes for account ID, accepting it
+// like GetAccountIDByCode in any case and with spaces or dashes added. It returns ErrTokenNotFound for wrong or used
+// codes and ErrRecoveryCodesExhausted if the account has no unused codes left. After 5 invalid codes validation for
+// the account is locked with ErrTooManyAttempts for the login token expiry, doubling with every further invalid code.
+// Codes are removed once used regardless of WithConsumeDeletes and WithConsumeGrace.
+func (a *LoginTokenAuth[ID]) GetAccountIDByRecoveryCode(id ID, code string) (err error) {
+	if a.closed.Load() {
+		return ErrClosed
+	}
+	code = normalizeCode(code)
+	defer a.pad(context.Background(), time.Now())
+	ctx, span := a.startSpan(context.Background(), "pwdless.GetAccountIDByRecoveryCode")
+	key := a.recoveryKey(id, code)
+	defer func() {
+		span.SetAttributes(attribute.Bool("pwdless.hit", err == nil))
+		endSpan(span, err)
+		if err != nil {
+			a.stats.failed.Add(1)
+			a.logFailure(ctx, key, err, slog.Any("account_id", id))
+		}
+		a.audit(key, id, "", err)
+	}()
+
+	source := recoveryKeyPrefix + fmt.Sprint(id)
+	if !a.codes.allow(source, a.clock()) {
+		return ErrTooManyAttempts
+	}
+	lt, err := a.get(ctx, key)
+	if err == nil {
+		err = a.verifyAccount(lt, code)
+	}
+	switch err {
+	case nil:
+	case ErrTokenNotFound, ErrTokenExpired:
+		if err == ErrTokenExpired {
+			a.metrics.incConsumeExpired()
+		} else {
+			a.metrics.incConsumeNotFound()
+		}
+		a.codes.fail(source, a.clock())
+		left, lerr := a.recoveryCodes(ctx, id, a.clock())
+		if lerr != nil {
+			return lerr
+		}
+		if len(left) == 0 {
+			return ErrRecoveryCodesExhausted
+		}
+		return ErrTokenNotFound
+	default:
+		return err
+	}
+	a.codes.reset(source)
+	return a.burn(ctx, lt)
+}
@@ -0,0 +1,111 @@
+package pwdless
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_RecoveryCodes(t *testing.T) {
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Minute, WithClock(clock.Now), WithMaxPerAccount(1, true))
+
+	codes, err := a.CreateRecoveryCodes(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 3 {
+		t.Fatalf("got %d codes, want: %d", len(codes), 3)
+	}
+	for _, code := range codes {
+		if len(code) != recoveryCodeLength || strings.Trim(code, codeAlphabet) != "" {
+			t.Errorf("got code %q, want %d characters of %q", code, recoveryCodeLength, codeAlphabet)
+		}
+	}
+	for key := range store.token {
+		for _, code := range codes {
+			if strings.Contains(key, code) {
+				t.Errorf("got code %q stored in plaintext", code)
+			}
+		}
+	}
+	// recovery codes don't count against the per account limit nor as pending tokens
+	if pending, _, err := a.HasPendingToken(1); err != nil || pending {
+		t.Errorf("got %v, %v pending with recovery codes only, want: false, <nil>", pending, err)
+	}
+	if _, err := a.CreateToken(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateToken(1); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(store.token); n != 4 {
+		t.Errorf("got %d tokens in store, want: %d", n, 4)
+	}
+
+	clock.Add(30 * 24 * time.Hour)
+	if err := a.GetAccountIDByRecoveryCode(2, codes[0]); err != ErrRecoveryCodesExhausted {
+		t.Errorf("got %v for code of other account, want: %v", err, ErrRecoveryCodesExhausted)
+	}
+	if err := a.GetAccountIDByRecoveryCode(1, strings.ToLower(codes[0][:5]+"-"+codes[0][5:])); err != nil {
+		t.Fatalf("got %v consuming code, want: <nil>", err)
+	}
+	if err := a.GetAccountIDByRecoveryCode(1, codes[0]); err != ErrTokenNotFound {
+		t.Errorf("got %v consuming used code, want: %v", err, ErrTokenNotFound)
+	}
+	for _, code := range codes[1:] {
+		if err := a.GetAccountIDByRecoveryCode(1, code); err != nil {
+			t.Fatalf("got %v consuming code, want: <nil>", err)
+		}
+	}
+	if err := a.GetAccountIDByRecoveryCode(1, codes[0]); err != ErrRecoveryCodesExhausted {
+		t.Errorf("got %v after all codes used, want: %v", err, ErrRecoveryCodesExhausted)
+	}
+}
+
+func TestLoginTokenAuth_RecoveryCodesSingleUse(t *testing.T) {
+	a, _ := newTestAuth(time.Minute, WithConsumeDeletes(false), WithConsumeGrace(time.Minute))
+	codes, err := a.CreateRecoveryCodes(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.GetAccountIDByRecoveryCode(1, codes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.GetAccountIDByRecoveryCode(1, codes[0]); err != ErrTokenNotFound {
+		t.Errorf("got %v for used code, want: %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestLoginTokenAuth_RecoveryCodesRegenerate(t *testing.T) {
+	a, store := newTestAuth(time.Minute)
+
+	old, err := a.CreateRecoveryCodes(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := a.CreateRecoveryCodes(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(store.token); n != 2 {
+		t.Errorf("got %d tokens in store, want: %d", n, 2)
+	}
+	for _, code := range old {
+		if err := a.GetAccountIDByRecoveryCode(1, code); err != ErrTokenNotFound {
+			t.Errorf("got %v consuming replaced code, want: %v", err, ErrTokenNotFound)
+		}
+	}
+	if err := a.GetAccountIDByRecoveryCode(1, codes[1]); err != nil {
+		t.Errorf("got %v consuming new code, want: <nil>", err)
+	}
+	if got := a.Stats().Active; got != 1 {
+		t.Errorf("got %d active tokens, want: %d", got, 1)
+	}
+
+	for _, count := range []int{0, maxRecoveryCodes + 1} {
+		if _, err := a.CreateRecoveryCodes(1, count); err == nil {
+			t.Errorf("got no error creating %d codes", count)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// redirectDataKey is the data key the redirect of CreateTokenWithRedirect is attached to the token with.
+const redirectDataKey = "redirect"
+
+var errDisallowedRedirect = errors.New("redirect not allowed")
+
+// CreateTokenWithRedirect is like CreateToken, attaching the redirect next to be returned by GetAccountIDWithRedirect,
+// e.g. the page to continue on after login. It returns errDisallowedRedirect if next does not match the allowlist
+// set by WithRedirectAllowlist. An empty next attaches no redirect.
+func (a *LoginTokenAuth[ID]) CreateTokenWithRedirect(id ID, next string) (LoginToken[ID], error) {
+	var data map[string]string
+	if next != "" {
+		if !a.allowRedirect(next) {
+			return LoginToken[ID]{}, errDisallowedRedirect
+		}
+		data = map[string]string{redirectDataKey: next}
+	}
+	return a.relayed(a.createToken(context.Background(), LoginToken[ID]{AccountID: id, Data: data}, a.loginTokenExpiry))
+}
+
+// GetAccountIDWithRedirect is like GetAccountID, additionally returning the redirect attached by CreateTokenWithRedirect.
+// The redirect is checked against the allowlist again and empty if the token has none or it is no longer allowed.
+func (a *LoginTokenAuth[ID]) GetAccountIDWithRedirect(token string) (ID, string, error) {
+	lt, err := a.consume(context.Background(), token, "", "", "")
+	if err != nil {
+		return lt.AccountID, "", err
+	}
+	next := lt.Data[redirectDataKey]
+	if next != "" && !a.allowRedirect(next) {
+		next = ""
+	}
+	return lt.AccountID, next, nil
+}
+
+// allowRedirect reports whether next is a relative path or http(s) url matching a pattern of the redirect allowlist.
+func (a *LoginTokenAuth[ID]) allowRedirect(next string) bool {
+	// Browsers treat backslashes like slashes, so "/\evil.com" would leave the site.
+	if strings.ContainsAny(next, "\\\x00\t\r\n") {
+		return false
+	}
+	u, err := url.Parse(next)
+	if err != nil || u.User != nil || u.Opaque != "" {
+		return false
+	}
+	relative := u.Scheme == "" && u.Host == ""
+	if relative && (!strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//")) {
+		return false
+	}
+	if !relative && ((u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		return false
+	}
+
+	for _, pattern := range a.redirectAllow {
+		switch {
+		case strings.HasPrefix(pattern, "/"):
+			if relative && matchPathPrefix(pattern, u.Path) {
+				return true
+			}
+		case strings.Contains(pattern, "://"):
+			p, err := url.Parse(pattern)
+			if err == nil && !relative && p.Scheme == u.Scheme && strings.EqualFold(p.Host, u.Host) && matchPathPrefix(p.Path, u.Path) {
+				return true
+			}
+		default:
+			if !relative && matchHost(pattern, u.Hostname()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPathPrefix reports whether the cleaned path p starts with prefix, so "/app/../admin" does not match "/app/".
+func matchPathPrefix(prefix, p string) bool {
+	if p == "" {
+		p = "/"
+	}
+	clean := path.Clean(p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return strings.HasPrefix(clean, prefix)
+}
+
+// matchHost reports whether host equals pattern or, for patterns like "*.example.com", is a subdomain of it.
+func matchHost(pattern, host string) bool {
+	pattern, host = strings.ToLower(pattern), strings.ToLower(host)
+	if domain, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+domain)
+	}
+	return host == pattern
+}
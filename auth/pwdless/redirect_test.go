@@ -0,0 +1,64 @@
+package pwdless
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_CreateTokenWithRedirect(t *testing.T) {
+	a, _ := newTestAuth(time.Minute, WithRedirectAllowlist([]string{"/app/", "*.example.com", "https://partner.org/sso"}))
+
+	tests := []struct {
+		next    string
+		allowed bool
+	}{
+		{"/app/settings?tab=1", true},
+		{"/app/", true},
+		{"/admin", false},
+		{"/app/../admin", false},
+		{"//evil.com/app/", false},
+		{"/\\evil.com", false},
+		{"app/settings", false},
+		{"https://www.example.com/home", true},
+		{"http://shop.EXAMPLE.com", true},
+		{"https://example.com", false},
+		{"https://evilexample.com", false},
+		{"https://www.example.com.evil.com", false},
+		{"https://user@www.example.com", false},
+		{"javascript:alert(1)", false},
+		{"https://partner.org/sso/callback", true},
+		{"http://partner.org/sso/callback", false},
+		{"https://partner.org/other", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.next, func(t *testing.T) {
+			lt, err := a.CreateTokenWithRedirect(1, tc.next)
+			if !tc.allowed {
+				if err != errDisallowedRedirect {
+					t.Errorf("got error %v, want: %v", err, errDisallowedRedirect)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, next, err := a.GetAccountIDWithRedirect(lt.Token)
+			if err != nil || id != 1 || next != tc.next {
+				t.Errorf("got %d, %q, %v, want: 1, %q, <nil>", id, next, err, tc.next)
+			}
+		})
+	}
+
+	lt, err := a.CreateTokenWithRedirect(2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, next, err := a.GetAccountIDWithRedirect(lt.Token); err != nil || id != 2 || next != "" {
+		t.Errorf("got %d, %q, %v without redirect, want: 2, \"\", <nil>", id, next, err)
+	}
+
+	none, _ := newTestAuth(time.Minute)
+	if _, err := none.CreateTokenWithRedirect(1, "/app/"); err != errDisallowedRedirect {
+		t.Errorf("got error %v without allowlist, want: %v", err, errDisallowedRedirect)
+	}
+}
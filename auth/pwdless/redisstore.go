@@ -0,0 +1,267 @@
+package pwdless
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// RedisClient defines the redis commands used by RedisStore.
+// It is satisfied by a thin adapter around any redis client library, which should abort commands when ctx is done.
+type RedisClient interface {
+	// Set stores value under key with ttl set as expiry.
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// SetNX stores value under key with ttl set as expiry if key does not exist and reports whether it was stored.
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	// Get returns the value stored under key and false if key does not exist.
+	Get(ctx context.Context, key string) (string, bool, error)
+	// PTTL returns the remaining time to live of key, negative if key does not exist.
+	PTTL(ctx context.Context, key string) (time.Duration, error)
+	// Expire sets the time to live of key.
+	Expire(ctx context.Context, key string, ttl time.Duration) error
+	// Del removes keys and returns the number of keys removed.
+	Del(ctx context.Context, keys ...string) (int, error)
+	// SAdd adds member to the set stored at key.
+	SAdd(ctx context.Context, key, member string) error
+	// SMembers returns all members of the set stored at key.
+	SMembers(ctx context.Context, key string) ([]string, error)
+	// Exists returns the number of keys existing.
+	Exists(ctx context.Context, keys ...string) (int, error)
+	// ZAdd adds member with score to the sorted set stored at key.
+	ZAdd(ctx context.Context, key string, score float64, member string) error
+	// ZRem removes members from the sorted set stored at key.
+	ZRem(ctx context.Context, key string, members ...string) error
+	// ZRange returns the members of the sorted set stored at key ranked between start and stop, -1 being the last member.
+	ZRange(ctx context.Context, key string, start, stop int) ([]string, error)
+	// ZCount returns the number of members of the sorted set stored at key with a score between min and max.
+	ZCount(ctx context.Context, key string, min, max float64) (int, error)
+	// ZRemRangeByScore removes all members of the sorted set stored at key with a score between min and max.
+	ZRemRangeByScore(ctx context.Context, key string, min, max float64) error
+}
+
+// DefaultRedisKeyPrefix is prepended to tokenstrings to build redis keys.
+const DefaultRedisKeyPrefix = "logintoken:"
+
+// errRedisExpired is returned by RedisStore when saving a token already expired, as redis can't store it.
+var errRedisExpired = errors.New("login token already expired, not saved to redis")
+
+// RedisStore implements TokenStore using redis, allowing multiple api instances to share login tokens.
+// Tokens are saved JSON encoded with their expiry as redis TTL, therefore expired tokens are evicted by redis itself
+// and the manual purge loop is only needed to trim the token index. Each account's tokens are indexed in a set
+// expiring with its latest token, all tokens are indexed in a sorted set scored by expiry for counting.
+// TTLs are computed by the clock set by WithClock if used through WithStore, otherwise by the wall clock.
+type RedisStore[ID comparable] struct {
+	client RedisClient
+	prefix string
+	clock  func() time.Time
+}
+
+// NewRedisStore returns a RedisStore using client. An empty prefix defaults to DefaultRedisKeyPrefix.
+func NewRedisStore[ID comparable](client RedisClient, prefix string) *RedisStore[ID] {
+	if prefix == "" {
+		prefix = DefaultRedisKeyPrefix
+	}
+	return &RedisStore[ID]{
+		client: client,
+		prefix: prefix,
+		clock:  time.Now,
+	}
+}
+
+// Save stores the login token under the token key expiring at the token's expiry.
+// It returns errRedisExpired for tokens already expired and errTokenCollision if the tokenstring is stored
+// for another account. New tokens are stored atomically, replacing a token of the same account is not.
+func (s *RedisStore[ID]) Save(ctx context.Context, lt LoginToken[ID]) error {
+	ttl := lt.Expiry.Sub(s.clock())
+	if ttl <= 0 {
+		return errRedisExpired
+	}
+	v, err := json.Marshal(storedToken[ID](lt))
+	if err != nil {
+		return err
+	}
+	set, err := s.client.SetNX(ctx, s.key(lt.Token), string(v), ttl)
+	if err != nil {
+		return err
+	}
+	if !set {
+		old, ok, err := s.Get(ctx, lt.Token)
+		if err != nil {
+			return err
+		}
+		if ok && old.AccountID != lt.AccountID {
+			return errTokenCollision
+		}
+		if err := s.client.Set(ctx, s.key(lt.Token), string(v), ttl); err != nil {
+			return err
+		}
+	}
+	if err := s.client.ZAdd(ctx, s.indexKey(), expiryScore(lt.Expiry), lt.Token); err != nil {
+		return err
+	}
+	idx := s.accountKey(lt.AccountID)
+	if err := s.client.SAdd(ctx, idx, lt.Token); err != nil {
+		return err
+	}
+	idxTTL, err := s.client.PTTL(ctx, idx)
+	if err != nil {
+		return err
+	}
+	if idxTTL < ttl {
+		return s.client.Expire(ctx, idx, ttl)
+	}
+	return nil
+}
+
+// Get returns the login token for tokenstring, reported as not existing when expired or evicted.
+func (s *RedisStore[ID]) Get(ctx context.Context, token string) (LoginToken[ID], bool, error) {
+	v, ok, err := s.client.Get(ctx, s.key(token))
+	if err != nil || !ok {
+		return LoginToken[ID]{}, false, err
+	}
+	var lt LoginToken[ID]
+	if err := json.Unmarshal([]byte(v), &lt); err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	return lt, true, nil
+}
+
+// Delete removes the login token for tokenstring.
+func (s *RedisStore[ID]) Delete(ctx context.Context, token string) error {
+	if _, err := s.client.Del(ctx, s.key(token)); err != nil {
+		return err
+	}
+	return s.client.ZRem(ctx, s.indexKey(), token)
+}
+
+// DeleteByAccount removes all login tokens referencing account ID and returns the number removed.
+func (s *RedisStore[ID]) DeleteByAccount(ctx context.Context, id ID) (int, error) {
+	idx := s.accountKey(id)
+	tokens, err := s.client.SMembers(ctx, idx)
+	if err != nil || len(tokens) == 0 {
+		return 0, err
+	}
+	keys := make([]string, len(tokens))
+	for i, t := range tokens {
+		keys[i] = s.key(t)
+	}
+	n, err := s.client.Del(ctx, keys...)
+	if err != nil {
+		return n, err
+	}
+	if err := s.client.ZRem(ctx, s.indexKey(), tokens...); err != nil {
+		return n, err
+	}
+	_, err = s.client.Del(ctx, idx)
+	return n, err
+}
+
+// PurgeExpired only trims expired tokens from the token index as redis evicts expired keys by TTL,
+// hence no purged tokens are returned.
+func (s *RedisStore[ID]) PurgeExpired(ctx context.Context, now time.Time) ([]LoginToken[ID], error) {
+	return nil, s.client.ZRemRangeByScore(ctx, s.indexKey(), math.Inf(-1), expiryScore(now))
+}
+
+// Extend sets the expiry of the login token for tokenstring if it exists and is not expired at now.
+// The update is not atomic, a token deleted concurrently may be saved again.
+func (s *RedisStore[ID]) Extend(ctx context.Context, token string, now, expiry time.Time) (LoginToken[ID], bool, error) {
+	lt, ok, err := s.Get(ctx, token)
+	if err != nil || !ok || !lt.Valid(now) {
+		return LoginToken[ID]{}, false, err
+	}
+	lt.Expiry = expiry
+	if err := s.Save(ctx, lt); err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	return lt, true, nil
+}
+
+// Count returns the number of login tokens not expired at now using the token index.
+func (s *RedisStore[ID]) Count(ctx context.Context, now time.Time) (int, error) {
+	return s.client.ZCount(ctx, s.indexKey(), expiryScore(now), math.Inf(1))
+}
+
+// CountForAccount returns the number of login tokens referencing account ID not yet evicted by redis.
+func (s *RedisStore[ID]) CountForAccount(ctx context.Context, id ID, now time.Time) (int, error) {
+	tokens, err := s.client.SMembers(ctx, s.accountKey(id))
+	if err != nil || len(tokens) == 0 {
+		return 0, err
+	}
+	keys := make([]string, len(tokens))
+	for i, t := range tokens {
+		keys[i] = s.key(t)
+	}
+	return s.client.Exists(ctx, keys...)
+}
+
+// Clear removes all login tokens found in the token index along with their account indexes.
+func (s *RedisStore[ID]) Clear(ctx context.Context) error {
+	tokens, err := s.client.ZRange(ctx, s.indexKey(), 0, -1)
+	if err != nil {
+		return err
+	}
+	keys := []string{s.indexKey()}
+	accounts := make(map[string]bool)
+	for _, t := range tokens {
+		lt, ok, err := s.Get(ctx, t)
+		if err != nil {
+			return err
+		}
+		if ok && !accounts[s.accountKey(lt.AccountID)] {
+			accounts[s.accountKey(lt.AccountID)] = true
+			keys = append(keys, s.accountKey(lt.AccountID))
+		}
+		keys = append(keys, s.key(t))
+	}
+	_, err = s.client.Del(ctx, keys...)
+	return err
+}
+
+// List returns all login tokens referencing account ID not expired at now.
+func (s *RedisStore[ID]) List(ctx context.Context, id ID, now time.Time) ([]LoginToken[ID], error) {
+	members, err := s.client.SMembers(ctx, s.accountKey(id))
+	if err != nil {
+		return nil, err
+	}
+	var tokens []LoginToken[ID]
+	for _, t := range members {
+		lt, ok, err := s.Get(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		if ok && lt.Valid(now) {
+			tokens = append(tokens, lt)
+		}
+	}
+	return tokens, nil
+}
+
+// Ping checks redis is reachable, using the client's Ping if it implements Pinger
+// and a round trip checking the token index exists otherwise.
+func (s *RedisStore[ID]) Ping(ctx context.Context) error {
+	if p, ok := s.client.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	_, err := s.client.Exists(ctx, s.indexKey())
+	return err
+}
+
+func (s *RedisStore[ID]) key(token string) string {
+	return s.prefix + token
+}
+
+func (s *RedisStore[ID]) accountKey(id ID) string {
+	return s.prefix + "account:" + fmt.Sprint(id)
+}
+
+func (s *RedisStore[ID]) indexKey() string {
+	return s.prefix + "index"
+}
+
+// expiryScore returns t as sorted set score in unix milliseconds.
+func expiryScore(t time.Time) float64 {
+	return float64(t.UnixNano() / int64(time.Millisecond))
+}
@@ -0,0 +1,414 @@
+package pwdless
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis implements RedisClient in memory honoring key expiry.
+type fakeRedis struct {
+	mux    sync.Mutex
+	values map[string]string
+	sets   map[string]map[string]bool
+	zsets  map[string]map[string]float64
+	expiry map[string]time.Time
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		values: make(map[string]string),
+		sets:   make(map[string]map[string]bool),
+		zsets:  make(map[string]map[string]float64),
+		expiry: make(map[string]time.Time),
+	}
+}
+
+func (c *fakeRedis) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.values[key] = value
+	c.expiry[key] = time.Now().Add(ttl)
+	return nil
+}
+
+func (c *fakeRedis) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.alive(key) {
+		return false, nil
+	}
+	c.values[key] = value
+	c.expiry[key] = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (c *fakeRedis) Get(ctx context.Context, key string) (string, bool, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !c.alive(key) {
+		return "", false, nil
+	}
+	v, ok := c.values[key]
+	return v, ok, nil
+}
+
+func (c *fakeRedis) PTTL(ctx context.Context, key string) (time.Duration, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !c.alive(key) {
+		return -2, nil
+	}
+	exp, ok := c.expiry[key]
+	if !ok {
+		return -1, nil
+	}
+	return time.Until(exp), nil
+}
+
+func (c *fakeRedis) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.alive(key) {
+		c.expiry[key] = time.Now().Add(ttl)
+	}
+	return nil
+}
+
+func (c *fakeRedis) Del(ctx context.Context, keys ...string) (int, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	n := 0
+	for _, key := range keys {
+		if c.alive(key) {
+			n++
+		}
+		c.remove(key)
+	}
+	return n, nil
+}
+
+func (c *fakeRedis) SAdd(ctx context.Context, key, member string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !c.alive(key) {
+		c.sets[key] = make(map[string]bool)
+	}
+	c.sets[key][member] = true
+	return nil
+}
+
+func (c *fakeRedis) SMembers(ctx context.Context, key string) ([]string, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !c.alive(key) {
+		return nil, nil
+	}
+	var members []string
+	for m := range c.sets[key] {
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+func (c *fakeRedis) Exists(ctx context.Context, keys ...string) (int, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	n := 0
+	for _, key := range keys {
+		if c.alive(key) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (c *fakeRedis) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !c.alive(key) {
+		c.zsets[key] = make(map[string]float64)
+	}
+	c.zsets[key][member] = score
+	return nil
+}
+
+func (c *fakeRedis) ZRem(ctx context.Context, key string, members ...string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for _, m := range members {
+		delete(c.zsets[key], m)
+	}
+	return nil
+}
+
+func (c *fakeRedis) ZRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	var members []string
+	for m := range c.zsets[key] {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool { return c.zsets[key][members[i]] < c.zsets[key][members[j]] })
+	if stop < 0 {
+		stop += len(members)
+	}
+	if start >= len(members) || start > stop {
+		return nil, nil
+	}
+	return members[start : stop+1], nil
+}
+
+func (c *fakeRedis) ZCount(ctx context.Context, key string, min, max float64) (int, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	n := 0
+	for _, score := range c.zsets[key] {
+		if score >= min && score <= max {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (c *fakeRedis) ZRemRangeByScore(ctx context.Context, key string, min, max float64) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for m, score := range c.zsets[key] {
+		if score >= min && score <= max {
+			delete(c.zsets[key], m)
+		}
+	}
+	return nil
+}
+
+func (c *fakeRedis) alive(key string) bool {
+	_, isValue := c.values[key]
+	_, isSet := c.sets[key]
+	_, isZSet := c.zsets[key]
+	if exp, ok := c.expiry[key]; ok && time.Now().After(exp) {
+		c.remove(key)
+		return false
+	}
+	return isValue || isSet || isZSet
+}
+
+func (c *fakeRedis) remove(key string) {
+	delete(c.values, key)
+	delete(c.sets, key)
+	delete(c.zsets, key)
+	delete(c.expiry, key)
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeRedis()
+	s := NewRedisStore[int](client, "")
+	if err := s.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	lt := LoginToken[int]{Token: "abc", AccountID: 42, Expiry: time.Now().Add(time.Minute)}
+	if err := s.Save(ctx, lt); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.values[DefaultRedisKeyPrefix+"abc"]; !ok {
+		t.Errorf("token not saved under key %s", DefaultRedisKeyPrefix+"abc")
+	}
+
+	got, ok, err := s.Get(ctx, "abc")
+	if err != nil || !ok {
+		t.Fatalf("got %v, %v, want saved token", ok, err)
+	}
+	if got.AccountID != 42 {
+		t.Errorf("got account id %d, want: %d", got.AccountID, 42)
+	}
+	if got.Expiry.Before(time.Now()) {
+		t.Errorf("got expiry %v in the past", got.Expiry)
+	}
+
+	if err := s.Delete(ctx, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.Get(ctx, "abc"); ok {
+		t.Error("token found after delete")
+	}
+
+	expiring := LoginToken[int]{Token: "exp", AccountID: 1, Expiry: time.Now().Add(10 * time.Millisecond)}
+	if err := s.Save(ctx, expiring); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := s.Get(ctx, "exp"); ok {
+		t.Error("token found after redis ttl expired")
+	}
+}
+
+func TestRedisStore_clock(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	s := NewRedisStore[int](newFakeRedis(), "")
+	a, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithStore[int](s), WithClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v for token expiring by configured clock, want: 1, nil", id, err)
+	}
+	expired := LoginToken[int]{Token: "exp", AccountID: 1, Expiry: clock.Now().Add(-time.Second)}
+	if err := s.Save(ctx, expired); err != errRedisExpired {
+		t.Errorf("got %v saving expired token, want: %v", err, errRedisExpired)
+	}
+}
+
+func TestRedisStore_DeleteByAccount(t *testing.T) {
+	ctx := context.Background()
+	s := NewRedisStore[int](newFakeRedis(), "")
+	exp := time.Now().Add(time.Minute)
+	for _, lt := range []LoginToken[int]{
+		{Token: "a", AccountID: 1, Expiry: exp},
+		{Token: "b", AccountID: 1, Expiry: exp},
+		{Token: "c", AccountID: 2, Expiry: exp},
+	} {
+		if err := s.Save(ctx, lt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := s.DeleteByAccount(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d tokens removed, want: %d", n, 2)
+	}
+	if _, ok, _ := s.Get(ctx, "a"); ok {
+		t.Error("token of account 1 found after delete")
+	}
+	if _, ok, _ := s.Get(ctx, "c"); !ok {
+		t.Error("token of account 2 removed")
+	}
+}
+
+func TestRedisStore_data(t *testing.T) {
+	ctx := context.Background()
+	s := NewRedisStore[int](newFakeRedis(), "")
+	lt := LoginToken[int]{Token: "abc", AccountID: 1, Expiry: time.Now().Add(time.Minute), Data: map[string]string{"k": "v"}}
+	if err := s.Save(ctx, lt); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := s.Get(ctx, "abc")
+	if err != nil || !ok {
+		t.Fatalf("got %v, %v, want saved token", ok, err)
+	}
+	if got.Data["k"] != "v" || !got.Expiry.Equal(lt.Expiry) {
+		t.Errorf("got %+v, want: %+v", got, lt)
+	}
+}
+
+func TestRedisStore_Count(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeRedis()
+	s := NewRedisStore[int](client, "")
+	now := time.Now()
+	for _, lt := range []LoginToken[int]{
+		{Token: "a", AccountID: 1, Expiry: now.Add(time.Minute)},
+		{Token: "b", AccountID: 1, Expiry: now.Add(time.Minute)},
+		{Token: "c", AccountID: 2, Expiry: now.Add(time.Minute)},
+		{Token: "d", AccountID: 2, Expiry: now.Add(10 * time.Millisecond)},
+	} {
+		if err := s.Save(ctx, lt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Delete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if n, err := s.Count(ctx, time.Now()); err != nil || n != 2 {
+		t.Errorf("got count %d, %v, want: %d", n, err, 2)
+	}
+	if n, err := s.CountForAccount(ctx, 2, time.Now()); err != nil || n != 1 {
+		t.Errorf("got count %d, %v for account 2, want: %d", n, err, 1)
+	}
+	if tokens, err := s.List(ctx, 2, time.Now()); err != nil || len(tokens) != 1 || tokens[0].Token != "c" {
+		t.Errorf("got tokens %+v, %v for account 2, want token c", tokens, err)
+	}
+
+	if _, err := s.PurgeExpired(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(client.zsets[DefaultRedisKeyPrefix+"index"]); n != 2 {
+		t.Errorf("got %d tokens indexed after purge, want: %d", n, 2)
+	}
+}
+
+func TestRedisStore_Extend(t *testing.T) {
+	ctx := context.Background()
+	s := NewRedisStore[int](newFakeRedis(), "")
+	now := time.Now()
+	if err := s.Save(ctx, LoginToken[int]{Token: "a", AccountID: 1, Expiry: now.Add(10 * time.Millisecond)}); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := s.Extend(ctx, "a", now, now.Add(time.Minute))
+	if !ok || err != nil || !got.Expiry.Equal(now.Add(time.Minute)) {
+		t.Fatalf("got %+v, %v, %v extending token", got, ok, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := s.Get(ctx, "a"); !ok {
+		t.Error("extended token evicted before new expiry")
+	}
+	if _, ok, err := s.Extend(ctx, "x", now, now.Add(time.Minute)); ok || err != nil {
+		t.Errorf("got %v, %v extending unknown token, want not extended", ok, err)
+	}
+}
+
+func TestRedisStore_Clear(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeRedis()
+	s := NewRedisStore[int](client, "")
+	exp := time.Now().Add(time.Minute)
+	for _, lt := range []LoginToken[int]{
+		{Token: "a", AccountID: 1, Expiry: exp},
+		{Token: "b", AccountID: 2, Expiry: exp},
+	} {
+		if err := s.Save(ctx, lt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(client.values) + len(client.sets) + len(client.zsets); n != 0 {
+		t.Errorf("got %d keys after clear, want none", n)
+	}
+}
+
+func TestRedisStore_legacyCreated(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeRedis()
+	s := NewRedisStore[int](client, "")
+	expiry := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+	legacy := fmt.Sprintf(`{"Token":"abc","AccountID":1,"Expiry":%q}`, expiry.Format(time.RFC3339))
+	if err := client.Set(ctx, s.key("abc"), legacy, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	lt, ok, err := s.Get(ctx, "abc")
+	if err != nil || !ok || !lt.Created.IsZero() || !lt.Expiry.Equal(expiry) {
+		t.Errorf("got %+v, %v, %v for token persisted without created, want zero created", lt, ok, err)
+	}
+}
+
+func TestRedisStore_collision(t *testing.T) {
+	testStoreCollision(t, NewRedisStore[int](newFakeRedis(), ""))
+}
@@ -0,0 +1,94 @@
+package pwdless
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// refLength is the number of characters of references, drawn from pairingAlphabet to be typed in easily.
+	refLength = 8
+	// refKeyPrefix separates reference store keys from hashed tokenstrings, so references can't be consumed as tokens.
+	refKeyPrefix = "ref:"
+	// refSecretKey is the data key of a reference holding its hashed secret.
+	refSecretKey = "secret"
+)
+
+// RefToken is a short reference to a login token validated together with a long random secret.
+type RefToken struct {
+	// Ref is short enough to be shown on screen and typed in, but not sufficient to consume the token.
+	Ref string
+	// Secret is the long part of the token, e.g. embedded only in the login link sent by email.
+	Secret string
+	Expiry time.Time
+}
+
+// CreateRefToken creates a reference token for account ID, consumed by presenting both its reference
+// and secret to GetAccountIDByRef. References share expiry, rate limiting and per account limits with tokens.
+func (a *LoginTokenAuth[ID]) CreateRefToken(id ID) (RefToken, error) {
+	secret, err := randStringBytes(a.randSource, a.loginTokenLength, a.alphabet)
+	if err != nil {
+		return RefToken{}, err
+	}
+	lt, err := a.issue(context.Background(), LoginToken[ID]{AccountID: id, Data: map[string]string{refSecretKey: a.hashToken(secret)}},
+		a.loginTokenExpiry, a.newRef)
+	if err != nil {
+		return RefToken{}, err
+	}
+	return RefToken{Ref: lt.Token, Secret: secret, Expiry: lt.Expiry}, nil
+}
+
+// newRef returns a random reference and the key it is stored by.
+func (a *LoginTokenAuth[ID]) newRef(ID) (string, string, error) {
+	ref, err := randStringBytes(a.randSource, refLength, pairingAlphabet)
+	if err != nil {
+		return "", "", err
+	}
+	return ref, refKeyPrefix + a.hashToken(ref), nil
+}
+
+// GetAccountIDByRef consumes the reference token created by CreateRefToken and returns its account ID,
+// returning ErrTokenNotFound if the reference does not exist or the secret does not match
+// and ErrTokenExpired if it is past its expiry. Tokens presented with a wrong secret are not consumed.
+func (a *LoginTokenAuth[ID]) GetAccountIDByRef(ref, secret string) (id ID, err error) {
+	if a.closed.Load() {
+		return id, ErrClosed
+	}
+	defer a.pad(context.Background(), time.Now())
+	ctx, span := a.startSpan(context.Background(), "pwdless.GetAccountIDByRef")
+	key := refKeyPrefix + a.hashToken(ref)
+	defer func() {
+		span.SetAttributes(attribute.Bool("pwdless.hit", err == nil))
+		endSpan(span, err)
+		if err != nil {
+			a.stats.failed.Add(1)
+			a.logFailure(ctx, key, err)
+		}
+		a.audit(key, id, "", err)
+	}()
+
+	lt, err := a.get(ctx, key)
+	if err == nil && !secureEqual(lt.Data[refSecretKey], a.hashToken(secret)) {
+		err = ErrTokenNotFound
+	}
+	if err == nil {
+		err = a.verifyAccount(lt, ref)
+	}
+	switch err {
+	case nil:
+	case ErrTokenNotFound:
+		a.metrics.incConsumeNotFound()
+		return id, err
+	case ErrTokenExpired:
+		a.metrics.incConsumeExpired()
+		return id, err
+	default:
+		return id, err
+	}
+	if lt, err = a.redeem(ctx, lt); err != nil {
+		return id, err
+	}
+	return lt.AccountID, nil
+}
@@ -0,0 +1,59 @@
+package pwdless
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_RefToken(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Hour, WithClock(clock.Now))
+
+	rt, err := a.CreateRefToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.Ref) != refLength || strings.Trim(rt.Ref, pairingAlphabet) != "" {
+		t.Errorf("got ref %q, want %d characters of %q", rt.Ref, refLength, pairingAlphabet)
+	}
+	if len(rt.Secret) != defaultLoginTokenLength {
+		t.Errorf("got secret of %d characters, want: %d", len(rt.Secret), defaultLoginTokenLength)
+	}
+	if want := clock.Now().Add(time.Hour); !rt.Expiry.Equal(want) {
+		t.Errorf("got expiry %s, want: %s", rt.Expiry, want)
+	}
+	for _, token := range []string{rt.Ref, rt.Secret} {
+		if _, err := a.GetAccountID(token); !errors.Is(err, ErrTokenNotFound) {
+			t.Errorf("got %v consuming %q as token, want: %v", err, token, ErrTokenNotFound)
+		}
+	}
+
+	if _, err := a.GetAccountIDByRef(rt.Ref, rt.Secret[1:]+"x"); err != ErrTokenNotFound {
+		t.Errorf("got %v for wrong secret, want: %v", err, ErrTokenNotFound)
+	}
+	if _, err := a.GetAccountIDByRef(rt.Ref, ""); err != ErrTokenNotFound {
+		t.Errorf("got %v for empty secret, want: %v", err, ErrTokenNotFound)
+	}
+	if id, err := a.GetAccountIDByRef(rt.Ref, rt.Secret); err != nil || id != 1 {
+		t.Fatalf("got %d, %v after wrong secret, want: %d, <nil>", id, err, 1)
+	}
+	if _, err := a.GetAccountIDByRef(rt.Ref, rt.Secret); err != ErrTokenNotFound {
+		t.Errorf("got %v consuming ref again, want: %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestLoginTokenAuth_RefTokenExpired(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Hour, WithClock(clock.Now))
+
+	rt, err := a.CreateRefToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(time.Hour + time.Second)
+	if _, err := a.GetAccountIDByRef(rt.Ref, rt.Secret); err != ErrTokenExpired {
+		t.Errorf("got %v consuming expired ref, want: %v", err, ErrTokenExpired)
+	}
+}
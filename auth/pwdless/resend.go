@@ -0,0 +1,48 @@
+package pwdless
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Resend returns a login token for account ID and whether it was newly created. If the token last returned by
+// Resend for the account was created less than minInterval ago and is neither expired nor consumed, it is returned
+// again instead of creating a new one, e.g. to send a single link when users request it twice in a row.
+// Like CreateTokenIdempotent, the recent tokenstring is kept in memory and not shared between instances.
+func (a *LoginTokenAuth[ID]) Resend(id ID, minInterval time.Duration) (LoginToken[ID], bool, error) {
+	if a.closed.Load() {
+		return LoginToken[ID]{}, false, ErrClosed
+	}
+	ctx := context.Background()
+	key := fmt.Sprint(id)
+
+	m := &a.resent
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	now := a.clock()
+	m.purge(now)
+	if lt, ok := m.tokens[key]; ok && now.Sub(lt.Created) < minInterval {
+		_, err := a.lookupIssued(ctx, lt.Token)
+		if err == nil {
+			lt.Data = copyData(lt.Data)
+			lt, _ = a.relayed(lt, nil)
+			return lt, false, nil
+		}
+		if err != ErrTokenNotFound && err != ErrTokenExpired {
+			return LoginToken[ID]{}, false, err
+		}
+	}
+	delete(m.tokens, key)
+
+	lt, err := a.createToken(ctx, LoginToken[ID]{AccountID: id}, a.loginTokenExpiry)
+	if err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	if m.tokens == nil {
+		m.tokens = make(map[string]LoginToken[ID])
+	}
+	m.tokens[key] = lt
+	lt, _ = a.relayed(lt, nil)
+	return lt, true, nil
+}
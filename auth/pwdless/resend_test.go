@@ -0,0 +1,50 @@
+package pwdless
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_Resend(t *testing.T) {
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Hour, WithClock(clock.Now))
+
+	lt, created, err := a.Resend(1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Error("got existing token for first resend, want created")
+	}
+
+	clock.Add(30 * time.Second)
+	again, created, err := a.Resend(1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || again.Token != lt.Token {
+		t.Errorf("got token %s, created %v within interval, want same token %s", again.Token, created, lt.Token)
+	}
+	if other, created, _ := a.Resend(2, time.Minute); !created || other.Token == lt.Token {
+		t.Error("got same token for different account")
+	}
+
+	clock.Add(time.Minute)
+	later, created, err := a.Resend(1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || later.Token == lt.Token {
+		t.Errorf("got token %s, created %v after interval, want new token", later.Token, created)
+	}
+	if n := len(store.token); n != 3 {
+		t.Errorf("got %d tokens in store, want: %d", n, 3)
+	}
+
+	if _, err := a.GetAccountID(later.Token); err != nil {
+		t.Fatal(err)
+	}
+	if consumed, created, _ := a.Resend(1, time.Minute); !created || consumed.Token == later.Token {
+		t.Error("got consumed token again, want new token")
+	}
+}
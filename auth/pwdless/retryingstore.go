@@ -0,0 +1,167 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// RetryingStore implements TokenStore retrying failed operations of a wrapped store, e.g. one backed by
+// a network service returning transient errors. Operations are attempted up to the configured number of times,
+// waiting with exponential backoff in between. Retries stop once ctx is done or its deadline would pass
+// during the next wait, returning the last error. Flush, Ping and Close are passed through without retries.
+type RetryingStore[ID comparable] struct {
+	store       TokenStore[ID]
+	attempts    int
+	backoff     time.Duration
+	isRetryable func(error) bool
+}
+
+// NewRetryingStore returns a RetryingStore attempting operations of store up to attempts times, waiting backoff
+// before the second attempt and doubling it for every further attempt. Only errors isRetryable reports true for
+// are retried, a nil isRetryable retries all errors. Context errors and tokenstring collisions are never retried.
+func NewRetryingStore[ID comparable](store TokenStore[ID], attempts int, backoff time.Duration, isRetryable func(error) bool) *RetryingStore[ID] {
+	if isRetryable == nil {
+		isRetryable = func(error) bool { return true }
+	}
+	return &RetryingStore[ID]{
+		store:       store,
+		attempts:    max(attempts, 1),
+		backoff:     backoff,
+		isRetryable: isRetryable,
+	}
+}
+
+// retryable reports whether the failed operation may be retried.
+func (s *RetryingStore[ID]) retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errTokenCollision) {
+		return false
+	}
+	return s.isRetryable(err)
+}
+
+// do calls op until it succeeds, fails with an error not to be retried or all attempts are taken.
+func (s *RetryingStore[ID]) do(ctx context.Context, op func() error) error {
+	wait := s.backoff
+	for i := 1; ; i++ {
+		err := op()
+		if err == nil || i == s.attempts || !s.retryable(err) {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+		wait *= 2
+	}
+}
+
+// Save adds or replaces a login token in the wrapped store.
+func (s *RetryingStore[ID]) Save(ctx context.Context, lt LoginToken[ID]) error {
+	return s.do(ctx, func() error { return s.store.Save(ctx, lt) })
+}
+
+// Get returns the login token for tokenstring from the wrapped store and whether it exists.
+// Tokens not existing are not retried.
+func (s *RetryingStore[ID]) Get(ctx context.Context, token string) (lt LoginToken[ID], ok bool, err error) {
+	err = s.do(ctx, func() error {
+		lt, ok, err = s.store.Get(ctx, token)
+		return err
+	})
+	return lt, ok, err
+}
+
+// Delete removes the login token for tokenstring from the wrapped store.
+func (s *RetryingStore[ID]) Delete(ctx context.Context, token string) error {
+	return s.do(ctx, func() error { return s.store.Delete(ctx, token) })
+}
+
+// DeleteByAccount removes all login tokens referencing account ID from the wrapped store and returns the number removed.
+func (s *RetryingStore[ID]) DeleteByAccount(ctx context.Context, id ID) (n int, err error) {
+	err = s.do(ctx, func() error {
+		n, err = s.store.DeleteByAccount(ctx, id)
+		return err
+	})
+	return n, err
+}
+
+// PurgeExpired removes all login tokens expired at now from the wrapped store and returns the removed tokens.
+func (s *RetryingStore[ID]) PurgeExpired(ctx context.Context, now time.Time) (purged []LoginToken[ID], err error) {
+	err = s.do(ctx, func() error {
+		purged, err = s.store.PurgeExpired(ctx, now)
+		return err
+	})
+	return purged, err
+}
+
+// Count returns the number of login tokens not expired at now in the wrapped store.
+func (s *RetryingStore[ID]) Count(ctx context.Context, now time.Time) (n int, err error) {
+	err = s.do(ctx, func() error {
+		n, err = s.store.Count(ctx, now)
+		return err
+	})
+	return n, err
+}
+
+// CountForAccount returns the number of login tokens referencing account ID not expired at now in the wrapped store.
+func (s *RetryingStore[ID]) CountForAccount(ctx context.Context, id ID, now time.Time) (n int, err error) {
+	err = s.do(ctx, func() error {
+		n, err = s.store.CountForAccount(ctx, id, now)
+		return err
+	})
+	return n, err
+}
+
+// Clear removes all login tokens from the wrapped store.
+func (s *RetryingStore[ID]) Clear(ctx context.Context) error {
+	return s.do(ctx, func() error { return s.store.Clear(ctx) })
+}
+
+// List returns all login tokens referencing account ID not expired at now from the wrapped store.
+func (s *RetryingStore[ID]) List(ctx context.Context, id ID, now time.Time) (tokens []LoginToken[ID], err error) {
+	err = s.do(ctx, func() error {
+		tokens, err = s.store.List(ctx, id, now)
+		return err
+	})
+	return tokens, err
+}
+
+// Extend sets the expiry of the login token for tokenstring in the wrapped store if it exists and is not expired at now.
+func (s *RetryingStore[ID]) Extend(ctx context.Context, token string, now, expiry time.Time) (lt LoginToken[ID], ok bool, err error) {
+	err = s.do(ctx, func() error {
+		lt, ok, err = s.store.Extend(ctx, token, now, expiry)
+		return err
+	})
+	return lt, ok, err
+}
+
+// Flush flushes the wrapped store if it buffers writes.
+func (s *RetryingStore[ID]) Flush(ctx context.Context) error {
+	if f, ok := s.store.(flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+// Ping checks the wrapped store if it implements Pinger.
+func (s *RetryingStore[ID]) Ping(ctx context.Context) error {
+	if p, ok := s.store.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// Close closes the wrapped store if it implements io.Closer.
+func (s *RetryingStore[ID]) Close() error {
+	if c, ok := s.store.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
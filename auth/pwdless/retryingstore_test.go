@@ -0,0 +1,102 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTransient = errors.New("transient store error")
+
+// transientStore is a MemoryStore failing every operation with err until it failed fails times.
+type transientStore struct {
+	*MemoryStore[int]
+	err          error
+	fails, calls int
+}
+
+func (s *transientStore) fail() error {
+	if s.calls++; s.calls <= s.fails {
+		return s.err
+	}
+	s.calls = 0
+	return nil
+}
+
+func (s *transientStore) Save(ctx context.Context, lt LoginToken[int]) error {
+	if err := s.fail(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Save(ctx, lt)
+}
+
+func (s *transientStore) Get(ctx context.Context, token string) (LoginToken[int], bool, error) {
+	if err := s.fail(); err != nil {
+		return LoginToken[int]{}, false, err
+	}
+	return s.MemoryStore.Get(ctx, token)
+}
+
+func (s *transientStore) Delete(ctx context.Context, token string) error {
+	if err := s.fail(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Delete(ctx, token)
+}
+
+func TestRetryingStore(t *testing.T) {
+	flaky := &transientStore{MemoryStore: NewMemoryStore[int](), err: errTransient, fails: 2}
+	a, _ := newTestAuth(time.Minute, WithStore[int](NewRetryingStore[int](flaky, 3, time.Millisecond, nil)))
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatalf("got %v creating token on third attempt, want: <nil>", err)
+	}
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v consuming token on third attempt, want: %d, <nil>", id, err, 1)
+	}
+	if _, err := a.GetAccountID(lt.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got %v for consumed token, want: %v", err, ErrTokenNotFound)
+	}
+
+	s := NewRetryingStore[int](flaky, 2, time.Millisecond, nil)
+	ctx := context.Background()
+	if err := s.Save(ctx, LoginToken[int]{Token: "a", AccountID: 1, Expiry: time.Now().Add(time.Minute)}); err != errTransient {
+		t.Errorf("got %v after all attempts failed, want: %v", err, errTransient)
+	}
+}
+
+func TestRetryingStore_noRetry(t *testing.T) {
+	ctx := context.Background()
+	errPermanent := errors.New("permanent store error")
+	flaky := &transientStore{MemoryStore: NewMemoryStore[int](), err: errPermanent, fails: 1}
+	s := NewRetryingStore[int](flaky, 3, time.Millisecond, func(err error) bool { return err == errTransient })
+	if _, _, err := s.Get(ctx, "a"); err != errPermanent || flaky.calls != 1 {
+		t.Errorf("got %v after %d calls, want permanent error not retried", err, flaky.calls)
+	}
+
+	flaky = &transientStore{MemoryStore: NewMemoryStore[int](), err: errTransient, fails: 3}
+	s = NewRetryingStore[int](flaky, 3, time.Hour, nil)
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, _, err := s.Get(ctx, "a"); err != errTransient || flaky.calls != 1 {
+		t.Errorf("got %v after %d calls, want no retry past deadline", err, flaky.calls)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("got retry waiting %s, want return before backoff", d)
+	}
+
+	mem := NewMemoryStore[int]()
+	s = NewRetryingStore[int](mem, 3, time.Hour, nil)
+	if err := s.Save(ctx, LoginToken[int]{Token: "a", AccountID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(ctx, LoginToken[int]{Token: "a", AccountID: 2}); err != errTokenCollision {
+		t.Errorf("got %v, want collision not retried: %v", err, errTokenCollision)
+	}
+	if _, ok, err := s.Get(ctx, "x"); ok || err != nil {
+		t.Errorf("got %v, %v for unknown token, want not found without retry", ok, err)
+	}
+}
@@ -0,0 +1,116 @@
+package pwdless
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	htmltemplate "html/template"
+	"text/template"
+	"time"
+)
+
+const defaultLoginEmailSubject = "Login Token"
+
+var defaultLoginEmailTemplate = template.Must(template.New("loginLink").Parse(
+	"Please use the link below to log in, it is valid until {{.Expiry.Format \"2006-01-02 15:04 MST\"}}.\n\n{{.URL}}\n"))
+
+var errNoEmailSender = errors.New("no email sender or notifier configured")
+
+// EmailSender defines sending plain text emails.
+type EmailSender interface {
+	Send(to, subject, body string) error
+}
+
+// HTMLSender is implemented by EmailSenders able to send emails with an HTML alternative to the plain text body,
+// used by SendLoginLink for localized login emails having an HTML template.
+type HTMLSender interface {
+	SendHTML(to, subject, text, html string) error
+}
+
+// NopSender is an EmailSender discarding all emails, useful for tests.
+type NopSender struct{}
+
+// Send does nothing and returns nil.
+func (NopSender) Send(to, subject, body string) error {
+	return nil
+}
+
+// LoginLinkContent defines content for the login link email template.
+type LoginLinkContent struct {
+	URL    string
+	Expiry time.Time
+	// Locale is the locale of the account the email is rendered for, empty without WithLocalizedLoginEmail.
+	Locale string
+}
+
+// LoginEmail is the subject and templates of a login email in one locale, see WithLocalizedLoginEmail.
+// Both templates are executed with LoginLinkContent, HTML is optional.
+type LoginEmail struct {
+	Subject string
+	Text    *template.Template
+	HTML    *htmltemplate.Template
+}
+
+// LocaleFunc returns the locale of account id, e.g. "de" for a German speaking user.
+type LocaleFunc[ID comparable] func(id ID) string
+
+// locale returns the locale of account id and its login email, falling back to the default locale
+// if none is configured for it.
+func (a *LoginTokenAuth[ID]) locale(id ID) (string, LoginEmail) {
+	if a.localeFunc == nil {
+		return "", LoginEmail{Subject: a.emailSubject, Text: a.emailTemplate}
+	}
+	locale := a.localeFunc(id)
+	e, ok := a.localeEmails[locale]
+	if !ok {
+		locale = a.defaultLocale
+		e = a.localeEmails[locale]
+	}
+	return locale, e
+}
+
+// SendLoginLink creates a login token referencing account ID and sends its login url to the email address to
+// using the configured EmailSender and template, localized by WithLocalizedLoginEmail, or delivers it
+// by the Notifier set with WithNotifier with to as address. The token is removed again if sending fails.
+func (a *LoginTokenAuth[ID]) SendLoginLink(id ID, to string) error {
+	if a.emailSender == nil && a.notifier == nil {
+		return errNoEmailSender
+	}
+	ctx := context.Background()
+	lt, err := a.createToken(ctx, LoginToken[ID]{AccountID: id}, a.loginTokenExpiry)
+	if err != nil {
+		return err
+	}
+
+	locale, email := a.locale(id)
+	if a.notifier != nil {
+		err = a.notifier.Notify(ctx, id, LoginMessage{To: to, Token: lt.Token, URL: a.LoginURL(lt), Expiry: lt.Expiry, Locale: locale})
+	} else {
+		err = a.sendEmail(to, email, LoginLinkContent{URL: a.LoginURL(lt), Expiry: lt.Expiry, Locale: locale})
+	}
+	if err != nil {
+		if rerr := a.store.Delete(ctx, a.hashToken(lt.Token)); rerr != nil {
+			return rerr
+		}
+		return err
+	}
+	return nil
+}
+
+// sendEmail renders email with content and sends it to, including the HTML body if the email has an HTML template
+// and the EmailSender implements HTMLSender.
+func (a *LoginTokenAuth[ID]) sendEmail(to string, email LoginEmail, content LoginLinkContent) error {
+	var text bytes.Buffer
+	if err := email.Text.Execute(&text, content); err != nil {
+		return err
+	}
+	hs, ok := a.emailSender.(HTMLSender)
+	if email.HTML == nil || !ok {
+		return a.emailSender.Send(to, email.Subject, text.String())
+	}
+	var html bytes.Buffer
+	if err := email.HTML.Execute(&html, content); err != nil {
+		return err
+	}
+	return hs.SendHTML(to, email.Subject, text.String(), html.String())
+}
@@ -0,0 +1,209 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	htmltemplate "html/template"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+// recordingSender is an EmailSender recording the last email and returning err.
+type recordingSender struct {
+	to, subject, body string
+	err               error
+}
+
+func (s *recordingSender) Send(to, subject, body string) error {
+	s.to, s.subject, s.body = to, subject, body
+	return s.err
+}
+
+// htmlSender is a recordingSender also recording the HTML body of the last email.
+type htmlSender struct {
+	recordingSender
+	html string
+}
+
+func (s *htmlSender) SendHTML(to, subject, text, html string) error {
+	s.html = html
+	return s.Send(to, subject, text)
+}
+
+func TestLoginTokenAuth_SendLoginLink(t *testing.T) {
+	sender := &recordingSender{}
+	tmpl := template.Must(template.New("test").Parse("{{.URL}} {{.Expiry.Unix}}"))
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Minute, WithClock(clock.Now), WithEmailSender(sender), WithLoginEmail("Sign in", tmpl))
+
+	if err := a.SendLoginLink(1, "test@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if sender.to != "test@example.com" || sender.subject != "Sign in" {
+		t.Errorf("got email to %q with subject %q", sender.to, sender.subject)
+	}
+	parts := strings.Fields(sender.body)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "http://localhost/login?token=") {
+		t.Fatalf("got body %q, want login url and expiry", sender.body)
+	}
+	if want := strconv.FormatInt(clock.Now().Add(time.Minute).Unix(), 10); parts[1] != want {
+		t.Errorf("got expiry %s, want: %s", parts[1], want)
+	}
+	token := strings.TrimPrefix(parts[0], "http://localhost/login?token=")
+	if id, err := a.GetAccountID(token); err != nil || id != 1 {
+		t.Errorf("got %d, %v for sent token, want: %d", id, err, 1)
+	}
+
+	sender.err = errors.New("smtp unavailable")
+	if err := a.SendLoginLink(2, "test@example.com"); err != sender.err {
+		t.Errorf("got error %v, want: %v", err, sender.err)
+	}
+	if len(store.token) != 0 {
+		t.Errorf("got %d tokens saved after failed send, want none", len(store.token))
+	}
+}
+
+func TestLoginTokenAuth_SendLoginLink_noSender(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+	if err := a.SendLoginLink(1, "test@example.com"); err != errNoEmailSender {
+		t.Errorf("got error %v, want: %v", err, errNoEmailSender)
+	}
+
+	a, _ = newTestAuth(time.Minute, WithEmailSender(NopSender{}))
+	if err := a.SendLoginLink(1, "test@example.com"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoginTokenAuth_serverRelayOnly(t *testing.T) {
+	sender := &recordingSender{}
+	tmpl := template.Must(template.New("test").Parse("{{.URL}}"))
+	a, store := newTestAuth(time.Minute, WithServerRelayOnly(true), WithEmailSender(sender), WithLoginEmail("Sign in", tmpl))
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.token[lt.Token]; !ok {
+		t.Errorf("got token %q, want: reference it is stored by", lt.Token)
+	}
+	if _, err := a.GetAccountID(lt.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got error %v consuming reference, want: %v", err, ErrTokenNotFound)
+	}
+
+	if err := a.SendLoginLink(2, "test@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := strings.TrimPrefix(sender.body, "http://localhost/login?token=")
+	if _, ok := store.token[token]; ok || token == sender.body {
+		t.Fatalf("got body %q, want login url with tokenstring", sender.body)
+	}
+	if id, err := a.GetAccountID(token); err != nil || id != 2 {
+		t.Errorf("got %d, %v for sent token, want: %d", id, err, 2)
+	}
+
+	if _, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithServerRelayOnly(true)); err == nil {
+		t.Error("server relay only without email sender accepted")
+	}
+}
+
+func TestLoginTokenAuth_SendLoginLink_localized(t *testing.T) {
+	sender := &htmlSender{}
+	emails := map[string]LoginEmail{
+		"en": {
+			Subject: "Sign in",
+			Text:    template.Must(template.New("en").Parse("{{.Locale}}: sign in at {{.URL}}")),
+		},
+		"de": {
+			Subject: "Anmelden",
+			Text:    template.Must(template.New("de").Parse("{{.Locale}}: anmelden unter {{.URL}}")),
+			HTML:    htmltemplate.Must(htmltemplate.New("de").Parse(`<a href="{{.URL}}">Anmelden</a> {{.Locale}}`)),
+		},
+	}
+	locales := map[int]string{1: "en", 2: "de", 3: "fr"}
+	a, _ := newTestAuth(time.Minute, WithEmailSender(sender),
+		WithLocalizedLoginEmail[int](func(id int) string { return locales[id] }, emails, "en"))
+
+	tests := []struct {
+		id      int
+		subject string
+		body    string
+		html    string
+	}{
+		{1, "Sign in", "en: sign in at http://localhost/login?token=", ""},
+		{2, "Anmelden", "de: anmelden unter http://localhost/login?token=", `<a href="http://localhost/login?token=`},
+		// fallback to the default locale
+		{3, "Sign in", "en: sign in at http://localhost/login?token=", ""},
+	}
+	for _, tc := range tests {
+		sender.html = ""
+		if err := a.SendLoginLink(tc.id, "test@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		htmlOK := strings.HasPrefix(sender.html, tc.html) && (tc.html != "" || sender.html == "")
+		if sender.subject != tc.subject || !strings.HasPrefix(sender.body, tc.body) || !htmlOK {
+			t.Errorf("account %d: got email %q, %q, html %q, want: %q, %q, html %q", tc.id, sender.subject, sender.body, sender.html, tc.subject, tc.body, tc.html)
+		}
+	}
+
+	if _, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"),
+		WithLocalizedLoginEmail[int](func(int) string { return "" }, emails, "fr")); err == nil {
+		t.Error("got no error without email for default locale")
+	}
+}
+
+func TestLoginTokenAuth_serverRelayOnlyVariants(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		create func(a *LoginTokenAuthInt) ([]LoginToken[int], error)
+	}{
+		{"idempotent", func(a *LoginTokenAuthInt) ([]LoginToken[int], error) {
+			lt, err := a.CreateTokenIdempotent(1, "key")
+			if err != nil {
+				return nil, err
+			}
+			again, err := a.CreateTokenIdempotent(1, "key")
+			return []LoginToken[int]{lt, again}, err
+		}},
+		{"resend", func(a *LoginTokenAuthInt) ([]LoginToken[int], error) {
+			lt, _, err := a.Resend(1, time.Minute)
+			if err != nil {
+				return nil, err
+			}
+			again, _, err := a.Resend(1, time.Minute)
+			return []LoginToken[int]{lt, again}, err
+		}},
+		{"redirect", func(a *LoginTokenAuthInt) ([]LoginToken[int], error) {
+			lt, err := a.CreateTokenWithRedirect(1, "/app")
+			return []LoginToken[int]{lt}, err
+		}},
+		{"batch", func(a *LoginTokenAuthInt) ([]LoginToken[int], error) {
+			return a.CreateTokens([]int{1, 2})
+		}},
+		{"rotate", func(a *LoginTokenAuthInt) ([]LoginToken[int], error) {
+			old, err := a.createToken(context.Background(), LoginToken[int]{AccountID: 1}, time.Minute)
+			if err != nil {
+				return nil, err
+			}
+			_, lt, err := a.ConsumeAndRotate(old.Token, 0)
+			return []LoginToken[int]{lt}, err
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, store := newTestAuth(time.Minute, WithServerRelayOnly(true), WithEmailSender(NopSender{}),
+				WithRedirectAllowlist([]string{"/app"}))
+			tokens, err := tc.create(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, lt := range tokens {
+				if _, ok := store.token[lt.Token]; !ok {
+					t.Errorf("got token %q, want: reference it is stored by", lt.Token)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errNoSessionStore = errors.New("no session store configured")
+
+// SessionStore creates durable sessions for accounts logged in by a login token, see ConsumeForSession.
+type SessionStore[ID comparable] interface {
+	// Create creates a session for account id expiring after ttl and returns its ID.
+	Create(ctx context.Context, id ID, ttl time.Duration) (string, error)
+}
+
+// ConsumeForSession consumes the token like GetAccountID and creates a session for its account expiring after
+// sessionTTL by the SessionStore set with WithSessionStore, returning the session ID and account ID.
+// If creating the session fails the token is restored as it was before consumption like ConsumeAndRecord.
+func (a *LoginTokenAuth[ID]) ConsumeForSession(token string, sessionTTL time.Duration) (sessionID string, id ID, err error) {
+	if a.sessions == nil {
+		return "", id, errNoSessionStore
+	}
+	if sessionTTL <= 0 {
+		return "", id, fmt.Errorf("session ttl %s must be positive", sessionTTL)
+	}
+	ctx := context.Background()
+	lt, err := a.consumeOrRestore(ctx, token, func(lt LoginToken[ID]) error {
+		var err error
+		if sessionID, err = a.sessions.Create(ctx, lt.AccountID, sessionTTL); err != nil {
+			return fmt.Errorf("creating session: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", id, err
+	}
+	return sessionID, lt.AccountID, nil
+}
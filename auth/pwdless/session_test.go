@@ -0,0 +1,63 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// sessionStore creates sessions by account, failing with err if set.
+type sessionStore struct {
+	err      error
+	sessions map[string]int
+	ttl      time.Duration
+}
+
+func (s *sessionStore) Create(_ context.Context, id int, ttl time.Duration) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	sid := "s" + strconv.Itoa(len(s.sessions))
+	s.sessions[sid] = id
+	s.ttl = ttl
+	return sid, nil
+}
+
+func TestLoginTokenAuth_ConsumeForSession(t *testing.T) {
+	s := &sessionStore{sessions: make(map[string]int)}
+	a, _ := newTestAuth(time.Minute, WithSessionStore[int](s))
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.err = errStore
+	if _, _, err := a.ConsumeForSession(lt.Token, time.Hour); !errors.Is(err, errStore) {
+		t.Errorf("got %v with failing session store, want: %v", err, errStore)
+	}
+	if _, err := a.Peek(lt.Token); err != nil {
+		t.Errorf("got %v, want token restored after failed session creation", err)
+	}
+
+	s.err = nil
+	sid, id, err := a.ConsumeForSession(lt.Token, time.Hour)
+	if err != nil || id != 1 || s.sessions[sid] != 1 || s.ttl != time.Hour {
+		t.Fatalf("got session %q for account %d, %v with ttl %s, want session of account %d with ttl %s", sid, id, err, s.ttl, 1, time.Hour)
+	}
+	if _, _, err := a.ConsumeForSession(lt.Token, time.Hour); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("got %v for consumed token, want: %v", err, ErrTokenNotFound)
+	}
+	if len(s.sessions) != 1 {
+		t.Errorf("got %d sessions, want: %d", len(s.sessions), 1)
+	}
+
+	if _, _, err := a.ConsumeForSession(lt.Token, 0); err == nil {
+		t.Error("got no error for zero session ttl")
+	}
+	plain, _ := newTestAuth(time.Minute)
+	if _, _, err := plain.ConsumeForSession(lt.Token, time.Hour); err != errNoSessionStore {
+		t.Errorf("got %v without session store, want: %v", err, errNoSessionStore)
+	}
+}
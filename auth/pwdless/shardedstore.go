@@ -0,0 +1,153 @@
+package pwdless
+
+import (
+	"context"
+	"hash/maphash"
+	"sort"
+	"time"
+)
+
+// defaultShardCount is the number of shards of a ShardedMemoryStore if none is given.
+const defaultShardCount = 32
+
+// ShardedMemoryStore implements TokenStore by partitioning login tokens by tokenstring across MemoryStores
+// each guarded by its own lock, reducing lock contention under highly concurrent creation and consumption.
+// Operations on all tokens of an account, purging and counting visit every shard.
+type ShardedMemoryStore[ID comparable] struct {
+	shards []*MemoryStore[ID]
+	seed   maphash.Seed
+}
+
+// NewShardedMemoryStore returns an empty in-memory token store with n shards, defaulting to 32 if n is not positive.
+func NewShardedMemoryStore[ID comparable](n int) *ShardedMemoryStore[ID] {
+	if n <= 0 {
+		n = defaultShardCount
+	}
+	s := &ShardedMemoryStore[ID]{
+		shards: make([]*MemoryStore[ID], n),
+		seed:   maphash.MakeSeed(),
+	}
+	for i := range s.shards {
+		s.shards[i] = NewMemoryStore[ID]()
+	}
+	return s
+}
+
+// shard returns the shard holding tokenstring.
+func (s *ShardedMemoryStore[ID]) shard(token string) *MemoryStore[ID] {
+	return s.shards[maphash.String(s.seed, token)%uint64(len(s.shards))]
+}
+
+// Save adds or replaces a login token. It fails if the tokenstring is already stored for another account.
+func (s *ShardedMemoryStore[ID]) Save(ctx context.Context, lt LoginToken[ID]) error {
+	return s.shard(lt.Token).Save(ctx, lt)
+}
+
+// Get returns the login token for tokenstring and whether it exists.
+func (s *ShardedMemoryStore[ID]) Get(ctx context.Context, token string) (LoginToken[ID], bool, error) {
+	return s.shard(token).Get(ctx, token)
+}
+
+// Delete removes the login token for tokenstring.
+func (s *ShardedMemoryStore[ID]) Delete(ctx context.Context, token string) error {
+	return s.shard(token).Delete(ctx, token)
+}
+
+// Extend sets the expiry of the login token for tokenstring if it exists and is not expired at now.
+func (s *ShardedMemoryStore[ID]) Extend(ctx context.Context, token string, now, expiry time.Time) (LoginToken[ID], bool, error) {
+	return s.shard(token).Extend(ctx, token, now, expiry)
+}
+
+// Reassign sets the account of the login token for tokenstring to id with accountHash if it exists and is not
+// expired at now, and reports whether it was updated.
+func (s *ShardedMemoryStore[ID]) Reassign(ctx context.Context, token string, now time.Time, id ID, accountHash string) (bool, error) {
+	return s.shard(token).Reassign(ctx, token, now, id, accountHash)
+}
+
+// DeleteByAccount removes all login tokens referencing account ID and returns the number removed.
+func (s *ShardedMemoryStore[ID]) DeleteByAccount(ctx context.Context, id ID) (int, error) {
+	return s.sum(func(m *MemoryStore[ID]) (int, error) { return m.DeleteByAccount(ctx, id) })
+}
+
+// ExtendForAccount adds by to the expiry of all login tokens referencing account ID not expired at now
+// and returns the number extended.
+func (s *ShardedMemoryStore[ID]) ExtendForAccount(ctx context.Context, id ID, now time.Time, by time.Duration) (int, error) {
+	return s.sum(func(m *MemoryStore[ID]) (int, error) { return m.ExtendForAccount(ctx, id, now, by) })
+}
+
+// Count returns the number of login tokens not expired at now.
+func (s *ShardedMemoryStore[ID]) Count(ctx context.Context, now time.Time) (int, error) {
+	return s.sum(func(m *MemoryStore[ID]) (int, error) { return m.Count(ctx, now) })
+}
+
+// CountForAccount returns the number of login tokens referencing account ID not expired at now.
+func (s *ShardedMemoryStore[ID]) CountForAccount(ctx context.Context, id ID, now time.Time) (int, error) {
+	return s.sum(func(m *MemoryStore[ID]) (int, error) { return m.CountForAccount(ctx, id, now) })
+}
+
+// Len returns the number of stored login tokens, including expired tokens not purged yet.
+func (s *ShardedMemoryStore[ID]) Len() int {
+	n := 0
+	for _, m := range s.shards {
+		n += m.Len()
+	}
+	return n
+}
+
+// Clear removes all login tokens.
+func (s *ShardedMemoryStore[ID]) Clear(ctx context.Context) error {
+	for _, m := range s.shards {
+		if err := m.Clear(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeExpired removes all login tokens expired at now and returns the removed tokens.
+func (s *ShardedMemoryStore[ID]) PurgeExpired(ctx context.Context, now time.Time) ([]LoginToken[ID], error) {
+	return s.collect(func(m *MemoryStore[ID]) ([]LoginToken[ID], error) { return m.PurgeExpired(ctx, now) })
+}
+
+// PurgeExpiredChunked is like PurgeExpired, but visits at most size tokens of a shard per lock acquisition.
+func (s *ShardedMemoryStore[ID]) PurgeExpiredChunked(ctx context.Context, now time.Time, size int) ([]LoginToken[ID], error) {
+	return s.collect(func(m *MemoryStore[ID]) ([]LoginToken[ID], error) { return m.PurgeExpiredChunked(ctx, now, size) })
+}
+
+// List returns all login tokens referencing account ID not expired at now.
+func (s *ShardedMemoryStore[ID]) List(ctx context.Context, id ID, now time.Time) ([]LoginToken[ID], error) {
+	return s.collect(func(m *MemoryStore[ID]) ([]LoginToken[ID], error) { return m.List(ctx, id, now) })
+}
+
+// All returns all login tokens not expired at now in order of creation.
+func (s *ShardedMemoryStore[ID]) All(ctx context.Context, now time.Time) ([]LoginToken[ID], error) {
+	tokens, err := s.collect(func(m *MemoryStore[ID]) ([]LoginToken[ID], error) { return m.All(ctx, now) })
+	sort.SliceStable(tokens, func(i, j int) bool { return tokens[i].Created.Before(tokens[j].Created) })
+	return tokens, err
+}
+
+// sum returns the sum of f applied to all shards, stopping at the first error.
+func (s *ShardedMemoryStore[ID]) sum(f func(*MemoryStore[ID]) (int, error)) (int, error) {
+	total := 0
+	for _, m := range s.shards {
+		n, err := f(m)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// collect returns the tokens returned by f for all shards, stopping at the first error.
+func (s *ShardedMemoryStore[ID]) collect(f func(*MemoryStore[ID]) ([]LoginToken[ID], error)) ([]LoginToken[ID], error) {
+	var tokens []LoginToken[ID]
+	for _, m := range s.shards {
+		t, err := f(m)
+		tokens = append(tokens, t...)
+		if err != nil {
+			return tokens, err
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,121 @@
+package pwdless
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShardedMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewShardedMemoryStore[int](4)
+	if n := len(s.shards); n != 4 {
+		t.Fatalf("got %d shards, want: %d", n, 4)
+	}
+	if n := len(NewShardedMemoryStore[int](0).shards); n != defaultShardCount {
+		t.Errorf("got %d shards by default, want: %d", n, defaultShardCount)
+	}
+
+	now := time.Now()
+	for i := 0; i < 40; i++ {
+		lt := LoginToken[int]{Token: fmt.Sprintf("t%02d", i), AccountID: i % 2, Created: now.Add(time.Duration(i)), Expiry: now.Add(time.Minute)}
+		if i < 10 {
+			lt.Expiry = now.Add(-time.Minute)
+		}
+		if err := s.Save(ctx, lt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	used := 0
+	for _, m := range s.shards {
+		if len(m.token) > 0 {
+			used++
+		}
+	}
+	if used < 2 {
+		t.Errorf("got tokens in %d shards, want them spread", used)
+	}
+
+	if lt, ok, err := s.Get(ctx, "t20"); err != nil || !ok || lt.AccountID != 0 {
+		t.Errorf("got %+v, %v, %v, want token of account 0", lt, ok, err)
+	}
+	if n, _ := s.Count(ctx, now); n != 30 {
+		t.Errorf("got count %d, want: %d", n, 30)
+	}
+	if tokens, _ := s.List(ctx, 1, now); len(tokens) != 15 {
+		t.Errorf("got %d tokens for account 1, want: %d", len(tokens), 15)
+	}
+	all, _ := s.All(ctx, now)
+	for i, lt := range all {
+		if want := fmt.Sprintf("t%02d", i+10); lt.Token != want {
+			t.Fatalf("got token %s at %d, want: %s in creation order", lt.Token, i, want)
+		}
+	}
+	if purged, _ := s.PurgeExpired(ctx, now); len(purged) != 10 {
+		t.Errorf("got %d purged tokens, want: %d", len(purged), 10)
+	}
+	if n, _ := s.ExtendForAccount(ctx, 0, now, time.Hour); n != 15 {
+		t.Errorf("got %d extended tokens, want: %d", n, 15)
+	}
+	if n, _ := s.DeleteByAccount(ctx, 1); n != 15 {
+		t.Errorf("got %d deleted tokens, want: %d", n, 15)
+	}
+	if err := s.Delete(ctx, "t20"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.CountForAccount(ctx, 0, now.Add(time.Hour)); n != 14 {
+		t.Errorf("got count %d for account 0, want: %d", n, 14)
+	}
+	if err := s.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.Count(ctx, now); n != 0 {
+		t.Errorf("got count %d after clear, want: %d", n, 0)
+	}
+}
+
+func TestShardedMemoryStore_auth(t *testing.T) {
+	a, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithStore[int](NewShardedMemoryStore[int](8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.DumpState(); err != nil {
+		t.Errorf("got error %v dumping state", err)
+	}
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v, want: 1, <nil>", id, err)
+	}
+}
+
+func benchmarkStore(b *testing.B, store TokenStore[int]) {
+	a, err := NewLoginTokenAuthWithOptions[int](WithLoginURL("http://localhost/login"), WithStore(store))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var n atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			lt, err := a.CreateToken(int(n.Add(1)))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := a.GetAccountID(lt.Token); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkMemoryStore(b *testing.B) {
+	benchmarkStore(b, NewMemoryStore[int]())
+}
+
+func BenchmarkShardedMemoryStore(b *testing.B) {
+	benchmarkStore(b, NewShardedMemoryStore[int](0))
+}
@@ -0,0 +1,106 @@
+package pwdless
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// The query parameters of signed URLs.
+const (
+	signedURLAccount   = "account"
+	signedURLExpiry    = "exp"
+	signedURLSignature = "sig"
+)
+
+// SignedURL returns the configured login url with the account ID, the expiry after ttl as unix timestamp and
+// their HMAC-SHA256 signature added as "account", "exp" and "sig" query parameters, verified by VerifySignedURL
+// without any store, e.g. for preview links cached by a CDN. A ttl of 0 uses the configured expiry, longer ttls
+// are rejected. With WithAccountSecret the signature includes the secret of the account, so rotating it revokes
+// all signed URLs of the account.
+func (a *StatelessTokenAuth[ID]) SignedURL(id ID, ttl time.Duration) (string, error) {
+	if a.loginURL == "" {
+		return "", errors.New("login url required for signed urls")
+	}
+	if ttl == 0 {
+		ttl = a.expiry
+	}
+	if ttl < 0 || ttl > a.expiry {
+		return "", fmt.Errorf("signed url ttl %s must be positive and at most the expiry %s", ttl, a.expiry)
+	}
+	account, err := jwtSubject(id)
+	if err != nil {
+		return "", err
+	}
+	exp := strconv.FormatInt(a.clock().Add(ttl).Unix(), 10)
+	sig, err := a.signURL(id, account, exp)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(a.loginURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set(signedURLAccount, account)
+	q.Set(signedURLExpiry, exp)
+	q.Set(signedURLSignature, sig)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// VerifySignedURL verifies the signature and expiry of a url returned by SignedURL and returns its account ID,
+// or ErrTokenNotFound if the url is malformed or its signature invalid, e.g. for a tampered account or expiry,
+// and ErrTokenExpired if it is past its expiry widened by the configured clock skew. Other query parameters
+// and the url path are not covered by the signature.
+func (a *StatelessTokenAuth[ID]) VerifySignedURL(rawurl string) (ID, error) {
+	var id ID
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return id, ErrTokenNotFound
+	}
+	q := u.Query()
+	account, exp, sig := q.Get(signedURLAccount), q.Get(signedURLExpiry), q.Get(signedURLSignature)
+	expiry, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return id, ErrTokenNotFound
+	}
+	if id, err = parseJWTSubject[ID](account); err != nil {
+		return id, ErrTokenNotFound
+	}
+	want, err := a.signURL(id, account, exp)
+	if err != nil {
+		return id, err
+	}
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return id, ErrTokenNotFound
+	}
+	now := a.clock()
+	e := time.Unix(expiry, 0)
+	if e.Add(-a.expiry).After(now.Add(a.future)) {
+		return id, errTokenFromFuture
+	}
+	if now.After(e.Add(a.skew)) {
+		return id, ErrTokenExpired
+	}
+	return id, nil
+}
+
+// signURL returns the encoded signature of account and exp, keyed by the secret of account id if configured.
+func (a *StatelessTokenAuth[ID]) signURL(id ID, account, exp string) (string, error) {
+	sig := a.sign(signedURLAccount + "=" + account + "&" + signedURLExpiry + "=" + exp)
+	if a.secretFn != nil {
+		secret, err := a.secretFn(id)
+		if err != nil {
+			return "", err
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(sig)
+		sig = mac.Sum(nil)
+	}
+	return statelessEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,95 @@
+package pwdless
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestStatelessTokenAuth_SignedURL(t *testing.T) {
+	clock := newFakeClock()
+	secrets := map[int][]byte{42: []byte("account secret")}
+	a, err := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret), WithExpiry(time.Hour),
+		WithLoginURL("https://example.com/preview?ref=mail"), WithClock(clock.Now),
+		WithAccountSecret(func(id int) ([]byte, error) { return secrets[id], nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := a.SignedURL(42, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("ref") != "mail" || q.Get("account") != "42" || q.Get("sig") == "" {
+		t.Errorf("got url %s, want login url with account and signature", raw)
+	}
+	if id, err := a.VerifySignedURL(raw); err != nil || id != 42 {
+		t.Errorf("got %d, %v verifying url, want: %d, <nil>", id, err, 42)
+	}
+
+	tampered := func(key, value string) string {
+		q := u.Query()
+		q.Set(key, value)
+		v := *u
+		v.RawQuery = q.Encode()
+		return v.String()
+	}
+	for _, rawurl := range []string{
+		tampered("account", "43"),
+		tampered("exp", q.Get("exp")+"0"),
+		tampered("sig", q.Get("sig")[1:]),
+		tampered("account", "invalid"),
+		"https://example.com/preview",
+		"%",
+	} {
+		if _, err := a.VerifySignedURL(rawurl); err != ErrTokenNotFound {
+			t.Errorf("got %v verifying %s, want: %v", err, rawurl, ErrTokenNotFound)
+		}
+	}
+
+	clock.Add(time.Minute + time.Second)
+	if _, err := a.VerifySignedURL(raw); err != ErrTokenExpired {
+		t.Errorf("got %v verifying expired url, want: %v", err, ErrTokenExpired)
+	}
+
+	// rotating the account secret revokes the signed urls of the account
+	raw, err = a.SignedURL(42, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets[42] = []byte("rotated")
+	if _, err := a.VerifySignedURL(raw); err != ErrTokenNotFound {
+		t.Errorf("got %v verifying url after rotating account secret, want: %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestStatelessTokenAuth_SignedURLOptions(t *testing.T) {
+	a, err := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret), WithExpiry(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.SignedURL(1, time.Minute); err == nil {
+		t.Error("got no error without login url")
+	}
+	a, err = NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret), WithExpiry(time.Hour),
+		WithLoginURL("https://example.com/preview"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ttl := range []time.Duration{-time.Second, time.Hour + time.Second} {
+		if _, err := a.SignedURL(1, ttl); err == nil {
+			t.Errorf("got no error for ttl %s", ttl)
+		}
+	}
+	if _, err := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret),
+		WithAccountSecret(func(id string) ([]byte, error) { return nil, nil })); err == nil {
+		t.Error("got no error for account secret func of other ID type")
+	}
+	if _, err := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret), WithLoginURL("http://[::1")); err == nil {
+		t.Error("got no error for invalid login url")
+	}
+}
@@ -0,0 +1,280 @@
+package pwdless
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// SQLStoreSchema is the schema of the table used by SQLStore.
+// It is written for PostgreSQL, the account_id column type has to match the account ID type of the store.
+// The idle_timeout column holds nanoseconds.
+const SQLStoreSchema = `
+CREATE TABLE IF NOT EXISTS login_tokens (
+token text PRIMARY KEY,
+account_id bigint NOT NULL,
+created timestamp with time zone NOT NULL DEFAULT current_timestamp,
+expiry timestamp with time zone NOT NULL,
+data text,
+reusable boolean NOT NULL DEFAULT FALSE,
+max_uses integer NOT NULL DEFAULT 0,
+uses integer NOT NULL DEFAULT 0,
+consumed timestamp with time zone,
+idle_timeout bigint NOT NULL DEFAULT 0,
+last_used timestamp with time zone,
+scope text NOT NULL DEFAULT '',
+family_id text NOT NULL DEFAULT '',
+rotated timestamp with time zone,
+fingerprint text NOT NULL DEFAULT '',
+account_hash text NOT NULL DEFAULT ''
+)`
+
+const (
+	sqlSaveToken = `INSERT INTO login_tokens (token, account_id, created, expiry, data, reusable, max_uses, uses, consumed, idle_timeout, last_used, scope, family_id, rotated, fingerprint, account_hash) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+ON CONFLICT (token) DO UPDATE SET created = $3, expiry = $4, data = $5, reusable = $6, max_uses = $7, uses = $8, consumed = $9, idle_timeout = $10, last_used = $11, scope = $12, family_id = $13, rotated = $14, fingerprint = $15, account_hash = $16
+WHERE login_tokens.account_id = $2`
+	sqlGetToken        = `SELECT token, account_id, created, expiry, data, reusable, max_uses, uses, consumed, idle_timeout, last_used, scope, family_id, rotated, fingerprint, account_hash FROM login_tokens WHERE token = $1`
+	sqlDeleteToken     = `DELETE FROM login_tokens WHERE token = $1`
+	sqlClear           = `DELETE FROM login_tokens`
+	sqlDeleteByAccount = `DELETE FROM login_tokens WHERE account_id = $1`
+	sqlPurgeExpired    = `DELETE FROM login_tokens WHERE expiry < $1 RETURNING token, account_id, created, expiry, data, reusable, max_uses, uses, consumed, idle_timeout, last_used, scope, family_id, rotated, fingerprint, account_hash`
+	sqlExtendToken     = `UPDATE login_tokens SET expiry = $2 WHERE token = $1 AND expiry >= $3 RETURNING token, account_id, created, expiry, data, reusable, max_uses, uses, consumed, idle_timeout, last_used, scope, family_id, rotated, fingerprint, account_hash`
+	sqlReassignToken   = `UPDATE login_tokens SET account_id = $2, account_hash = $3 WHERE token = $1 AND expiry >= $4`
+	sqlExtendAccount   = `UPDATE login_tokens SET expiry = expiry + $2 * interval '1 microsecond' WHERE account_id = $1 AND expiry >= $3`
+	sqlListForAccount  = `SELECT token, account_id, created, expiry, data, reusable, max_uses, uses, consumed, idle_timeout, last_used, scope, family_id, rotated, fingerprint, account_hash FROM login_tokens WHERE account_id = $1 AND expiry >= $2`
+	sqlCount           = `SELECT count(*) FROM login_tokens WHERE expiry >= $1`
+	sqlCountForAccount = `SELECT count(*) FROM login_tokens WHERE account_id = $1 AND expiry >= $2`
+)
+
+// SQLStore implements TokenStore using a database/sql database, allowing multiple api instances to share login tokens.
+// Queries use PostgreSQL syntax and work with any PostgreSQL driver like lib/pq or pgx registered by the caller.
+type SQLStore[ID comparable] struct {
+	db *sql.DB
+}
+
+// NewSQLStore returns a SQLStore using db. The table has to exist, see CreateTable.
+func NewSQLStore[ID comparable](db *sql.DB) *SQLStore[ID] {
+	return &SQLStore[ID]{
+		db: db,
+	}
+}
+
+// CreateTable creates the login_tokens table described by SQLStoreSchema if it does not exist.
+func (s *SQLStore[ID]) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, SQLStoreSchema)
+	return err
+}
+
+// Save adds or replaces a login token. It returns errTokenCollision if the tokenstring is stored for another account.
+func (s *SQLStore[ID]) Save(ctx context.Context, lt LoginToken[ID]) error {
+	args, err := saveArgs(lt)
+	if err != nil {
+		return err
+	}
+	return saved(s.db.ExecContext(ctx, sqlSaveToken, args...))
+}
+
+// SaveBatch adds or replaces all tokens in a single transaction.
+// It saves none if a tokenstring is stored for another account, returning errTokenCollision.
+func (s *SQLStore[ID]) SaveBatch(ctx context.Context, tokens []LoginToken[ID]) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, sqlSaveToken)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, lt := range tokens {
+		args, err := saveArgs(lt)
+		if err != nil {
+			return err
+		}
+		if err := saved(stmt.ExecContext(ctx, args...)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// saved returns errTokenCollision if sqlSaveToken did not save the token, as it is stored for another account.
+func saved(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errTokenCollision
+	}
+	return nil
+}
+
+// saveArgs returns the arguments of sqlSaveToken for lt.
+func saveArgs[ID comparable](lt LoginToken[ID]) ([]interface{}, error) {
+	var data sql.NullString
+	if lt.Data != nil {
+		v, err := json.Marshal(lt.Data)
+		if err != nil {
+			return nil, err
+		}
+		data = sql.NullString{String: string(v), Valid: true}
+	}
+	consumed := sql.NullTime{Time: lt.Consumed.UTC(), Valid: !lt.Consumed.IsZero()}
+	lastUsed := sql.NullTime{Time: lt.LastUsed.UTC(), Valid: !lt.LastUsed.IsZero()}
+	rotated := sql.NullTime{Time: lt.Rotated.UTC(), Valid: !lt.Rotated.IsZero()}
+	return []interface{}{lt.Token, lt.AccountID, lt.Created.UTC(), lt.Expiry.UTC(), data, lt.Reusable, lt.MaxUses, lt.Uses,
+		consumed, int64(lt.IdleTimeout), lastUsed, lt.Scope, lt.FamilyID, rotated, lt.Fingerprint, lt.AccountHash}, nil
+}
+
+// Get returns the login token for tokenstring and whether it exists.
+func (s *SQLStore[ID]) Get(ctx context.Context, token string) (LoginToken[ID], bool, error) {
+	lt, err := scanLoginToken[ID](s.db.QueryRowContext(ctx, sqlGetToken, token))
+	if err == sql.ErrNoRows {
+		return LoginToken[ID]{}, false, nil
+	}
+	if err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	return lt, true, nil
+}
+
+// Delete removes the login token for tokenstring.
+func (s *SQLStore[ID]) Delete(ctx context.Context, token string) error {
+	_, err := s.db.ExecContext(ctx, sqlDeleteToken, token)
+	return err
+}
+
+// DeleteByAccount removes all login tokens referencing account ID and returns the number removed.
+func (s *SQLStore[ID]) DeleteByAccount(ctx context.Context, id ID) (int, error) {
+	res, err := s.db.ExecContext(ctx, sqlDeleteByAccount, id)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// PurgeExpired removes all login tokens expired at now and returns the removed tokens.
+func (s *SQLStore[ID]) PurgeExpired(ctx context.Context, now time.Time) ([]LoginToken[ID], error) {
+	rows, err := s.db.QueryContext(ctx, sqlPurgeExpired, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanLoginTokens[ID](rows)
+}
+
+// Clear removes all login tokens.
+func (s *SQLStore[ID]) Clear(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, sqlClear)
+	return err
+}
+
+// List returns all login tokens referencing account ID not expired at now.
+func (s *SQLStore[ID]) List(ctx context.Context, id ID, now time.Time) ([]LoginToken[ID], error) {
+	rows, err := s.db.QueryContext(ctx, sqlListForAccount, id, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanLoginTokens[ID](rows)
+}
+
+// Extend sets the expiry of the login token for tokenstring if it exists and is not expired at now.
+func (s *SQLStore[ID]) Extend(ctx context.Context, token string, now, expiry time.Time) (LoginToken[ID], bool, error) {
+	lt, err := scanLoginToken[ID](s.db.QueryRowContext(ctx, sqlExtendToken, token, expiry.UTC(), now.UTC()))
+	if err == sql.ErrNoRows {
+		return LoginToken[ID]{}, false, nil
+	}
+	if err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	return lt, true, nil
+}
+
+// Reassign sets the account of the login token for tokenstring to id with accountHash if it exists and is not
+// expired at now, and reports whether it was updated.
+func (s *SQLStore[ID]) Reassign(ctx context.Context, token string, now time.Time, id ID, accountHash string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, sqlReassignToken, token, id, accountHash, now.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ExtendForAccount adds by to the expiry of all login tokens referencing account ID not expired at now
+// and returns the number extended.
+func (s *SQLStore[ID]) ExtendForAccount(ctx context.Context, id ID, now time.Time, by time.Duration) (int, error) {
+	res, err := s.db.ExecContext(ctx, sqlExtendAccount, id, by.Microseconds(), now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Count returns the number of login tokens not expired at now.
+func (s *SQLStore[ID]) Count(ctx context.Context, now time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, sqlCount, now.UTC()).Scan(&n)
+	return n, err
+}
+
+// CountForAccount returns the number of login tokens referencing account ID not expired at now.
+func (s *SQLStore[ID]) CountForAccount(ctx context.Context, id ID, now time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, sqlCountForAccount, id, now.UTC()).Scan(&n)
+	return n, err
+}
+
+// Ping verifies the database connection is alive.
+func (s *SQLStore[ID]) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanLoginTokens[ID comparable](rows *sql.Rows) ([]LoginToken[ID], error) {
+	var tokens []LoginToken[ID]
+	for rows.Next() {
+		lt, err := scanLoginToken[ID](rows)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, lt)
+	}
+	return tokens, rows.Err()
+}
+
+func scanLoginToken[ID comparable](row scanner) (LoginToken[ID], error) {
+	var lt LoginToken[ID]
+	var data sql.NullString
+	var consumed, lastUsed, rotated sql.NullTime
+	var idle int64
+	if err := row.Scan(&lt.Token, &lt.AccountID, &lt.Created, &lt.Expiry, &data, &lt.Reusable, &lt.MaxUses, &lt.Uses,
+		&consumed, &idle, &lastUsed, &lt.Scope, &lt.FamilyID, &rotated, &lt.Fingerprint, &lt.AccountHash); err != nil {
+		return LoginToken[ID]{}, err
+	}
+	lt.Consumed = consumed.Time
+	lt.IdleTimeout = time.Duration(idle)
+	lt.LastUsed = lastUsed.Time
+	lt.Rotated = rotated.Time
+	if data.Valid {
+		if err := json.Unmarshal([]byte(data.String), &lt.Data); err != nil {
+			return LoginToken[ID]{}, err
+		}
+	}
+	return lt, nil
+}
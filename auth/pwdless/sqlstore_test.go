@@ -0,0 +1,305 @@
+package pwdless
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSQLDriver implements database/sql/driver answering the queries of SQLStore from an in-memory table.
+type fakeSQLDriver struct {
+	mux  sync.Mutex
+	rows map[string][]driver.Value
+}
+
+func (d *fakeSQLDriver) Open(name string) (driver.Conn, error) { return fakeSQLConn{d}, nil }
+
+type fakeSQLConn struct{ d *fakeSQLDriver }
+
+func (c fakeSQLConn) Prepare(query string) (driver.Stmt, error) { return fakeSQLStmt{c.d, query}, nil }
+func (c fakeSQLConn) Close() error                              { return nil }
+func (c fakeSQLConn) Begin() (driver.Tx, error)                 { return c.d.begin(), nil }
+
+// begin starts a transaction by snapshotting the table, restored on rollback.
+func (d *fakeSQLDriver) begin() driver.Tx {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	snapshot := make(map[string][]driver.Value, len(d.rows))
+	for k, v := range d.rows {
+		snapshot[k] = v
+	}
+	return fakeSQLTx{d, snapshot}
+}
+
+type fakeSQLTx struct {
+	d        *fakeSQLDriver
+	snapshot map[string][]driver.Value
+}
+
+func (tx fakeSQLTx) Commit() error { return nil }
+
+func (tx fakeSQLTx) Rollback() error {
+	tx.d.mux.Lock()
+	tx.d.rows = tx.snapshot
+	tx.d.mux.Unlock()
+	return nil
+}
+
+type fakeSQLStmt struct {
+	d     *fakeSQLDriver
+	query string
+}
+
+func (s fakeSQLStmt) Close() error  { return nil }
+func (s fakeSQLStmt) NumInput() int { return -1 }
+
+func (s fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	rows, err := s.Query(args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(rows.(*fakeSQLRows).rows)), nil
+}
+
+func (s fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.d
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	res := &fakeSQLRows{}
+	switch s.query {
+	case SQLStoreSchema:
+	case sqlSaveToken:
+		if r, ok := d.rows[args[0].(string)]; !ok || r[1] == args[1] {
+			d.rows[args[0].(string)] = args
+			res.rows = append(res.rows, args)
+		}
+	case sqlGetToken:
+		if r, ok := d.rows[args[0].(string)]; ok {
+			res.rows = append(res.rows, r)
+		}
+	case sqlDeleteToken:
+		if r, ok := d.rows[args[0].(string)]; ok {
+			res.rows = append(res.rows, r)
+			delete(d.rows, args[0].(string))
+		}
+	case sqlClear:
+		for t, r := range d.rows {
+			res.rows = append(res.rows, r)
+			delete(d.rows, t)
+		}
+	case sqlDeleteByAccount:
+		for t, r := range d.rows {
+			if r[1] == args[0] {
+				res.rows = append(res.rows, r)
+				delete(d.rows, t)
+			}
+		}
+	case sqlPurgeExpired:
+		for t, r := range d.rows {
+			if r[3].(time.Time).Before(args[0].(time.Time)) {
+				res.rows = append(res.rows, r)
+				delete(d.rows, t)
+			}
+		}
+	case sqlExtendToken:
+		if r, ok := d.rows[args[0].(string)]; ok && !r[3].(time.Time).Before(args[2].(time.Time)) {
+			r[3] = args[1]
+			res.rows = append(res.rows, r)
+		}
+	case sqlReassignToken:
+		if r, ok := d.rows[args[0].(string)]; ok && !r[3].(time.Time).Before(args[3].(time.Time)) {
+			r[1] = args[1]
+			r[len(r)-1] = args[2]
+			res.rows = append(res.rows, r)
+		}
+	case sqlExtendAccount:
+		for _, r := range d.rows {
+			if r[1] == args[0] && !r[3].(time.Time).Before(args[2].(time.Time)) {
+				r[3] = r[3].(time.Time).Add(time.Duration(args[1].(int64)) * time.Microsecond)
+				res.rows = append(res.rows, r)
+			}
+		}
+	case sqlListForAccount:
+		for _, r := range d.rows {
+			if r[1] == args[0] && !r[3].(time.Time).Before(args[1].(time.Time)) {
+				res.rows = append(res.rows, r)
+			}
+		}
+	case sqlCount, sqlCountForAccount:
+		n := int64(0)
+		for _, r := range d.rows {
+			if !r[3].(time.Time).Before(args[len(args)-1].(time.Time)) && (len(args) == 1 || r[1] == args[0]) {
+				n++
+			}
+		}
+		res.rows = [][]driver.Value{{n}}
+	default:
+		panic("unexpected query: " + s.query)
+	}
+	return res, nil
+}
+
+type fakeSQLRows struct {
+	rows [][]driver.Value
+	i    int
+}
+
+func (r *fakeSQLRows) Columns() []string {
+	if len(r.rows) > 0 && len(r.rows[0]) == 1 {
+		return []string{"count"}
+	}
+	return []string{"token", "account_id", "created", "expiry", "data", "reusable", "max_uses", "uses", "consumed", "idle_timeout", "last_used", "scope", "family_id", "rotated", "fingerprint", "account_hash"}
+}
+
+func (r *fakeSQLRows) Close() error { return nil }
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.i])
+	r.i++
+	return nil
+}
+
+var fakeSQL = &fakeSQLDriver{rows: make(map[string][]driver.Value)}
+
+func init() {
+	sql.Register("pwdless_fake", fakeSQL)
+}
+
+func TestSQLStore(t *testing.T) {
+	db, err := sql.Open("pwdless_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	s := NewSQLStore[int](db)
+	if err := s.CreateTable(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	for _, lt := range []LoginToken[int]{
+		{Token: "a", AccountID: 1, Expiry: now.Add(time.Minute), Data: map[string]string{"k": "v"}},
+		{Token: "b", AccountID: 1, Expiry: now.Add(time.Minute), Reusable: true, MaxUses: 3, Uses: 1, Consumed: now, IdleTimeout: time.Hour, LastUsed: now, Scope: "delete", FamilyID: "f", Rotated: now},
+		{Token: "c", AccountID: 2, Expiry: now.Add(-time.Minute)},
+	} {
+		if err := s.Save(ctx, lt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, ok, err := s.Get(ctx, "a")
+	if err != nil || !ok {
+		t.Fatalf("got %v, %v, want saved token", ok, err)
+	}
+	if got.AccountID != 1 || got.Data["k"] != "v" || !got.Expiry.Equal(now.Add(time.Minute)) || !got.Consumed.IsZero() {
+		t.Errorf("got %+v", got)
+	}
+	if got, _, _ := s.Get(ctx, "b"); !got.Reusable || got.Data != nil || got.MaxUses != 3 || got.Uses != 1 || !got.Consumed.Equal(now) ||
+		got.IdleTimeout != time.Hour || !got.LastUsed.Equal(now) || got.Scope != "delete" ||
+		got.FamilyID != "f" || !got.Rotated.Equal(now) {
+		t.Errorf("got %+v, want reusable consumed token with uses and without data", got)
+	}
+	if _, ok, err := s.Get(ctx, "x"); ok || err != nil {
+		t.Errorf("got %v, %v for unknown token, want not found", ok, err)
+	}
+
+	if n, err := s.Count(ctx, now); err != nil || n != 2 {
+		t.Errorf("got count %d, %v, want: %d", n, err, 2)
+	}
+	if n, err := s.CountForAccount(ctx, 2, now); err != nil || n != 0 {
+		t.Errorf("got count %d, %v for account 2, want: %d", n, err, 0)
+	}
+	if tokens, err := s.List(ctx, 1, now); err != nil || len(tokens) != 2 {
+		t.Errorf("got %d tokens, %v for account 1, want: %d", len(tokens), err, 2)
+	}
+
+	if _, ok, err := s.Extend(ctx, "c", now, now.Add(time.Hour)); ok || err != nil {
+		t.Errorf("got %v, %v extending expired token, want not extended", ok, err)
+	}
+	if got, ok, err := s.Extend(ctx, "b", now, now.Add(time.Hour)); !ok || err != nil || !got.Expiry.Equal(now.Add(time.Hour)) {
+		t.Errorf("got %+v, %v, %v extending token", got, ok, err)
+	}
+
+	if n, err := s.ExtendForAccount(ctx, 1, now, time.Minute); err != nil || n != 2 {
+		t.Errorf("got %d, %v tokens extended for account 1, want: %d", n, err, 2)
+	}
+	if got, _, _ := s.Get(ctx, "a"); !got.Expiry.Equal(now.Add(2 * time.Minute)) {
+		t.Errorf("got expiry %v after extending account, want: %v", got.Expiry, now.Add(2*time.Minute))
+	}
+
+	if ok, err := s.Reassign(ctx, "c", now, 3, ""); ok || err != nil {
+		t.Errorf("got %v, %v reassigning expired token, want not reassigned", ok, err)
+	}
+	if ok, err := s.Reassign(ctx, "a", now, 3, "hash"); !ok || err != nil {
+		t.Errorf("got %v, %v reassigning token", ok, err)
+	}
+	if got, _, _ := s.Get(ctx, "a"); got.AccountID != 3 || got.AccountHash != "hash" {
+		t.Errorf("got %+v after reassign, want account 3", got)
+	}
+	if ok, err := s.Reassign(ctx, "a", now, 1, ""); !ok || err != nil {
+		t.Errorf("got %v, %v reassigning token back", ok, err)
+	}
+
+	purged, err := s.PurgeExpired(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 1 || purged[0].Token != "c" {
+		t.Errorf("got purged %+v, want token c", purged)
+	}
+
+	if err := s.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.Get(ctx, "a"); ok {
+		t.Error("token found after delete")
+	}
+	if n, err := s.DeleteByAccount(ctx, 1); err != nil || n != 1 {
+		t.Errorf("got %d, %v tokens removed, want: %d", n, err, 1)
+	}
+
+	if err := s.Save(ctx, LoginToken[int]{Token: "d", AccountID: 3, Expiry: now.Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Count(ctx, now); err != nil || n != 0 {
+		t.Errorf("got count %d, %v after clear, want: %d", n, err, 0)
+	}
+
+	batch := []LoginToken[int]{
+		{Token: "e", AccountID: 4, Expiry: now.Add(time.Minute)},
+		{Token: "f", AccountID: 5, Expiry: now.Add(time.Minute), Data: map[string]string{"k": "v"}},
+	}
+	if err := s.SaveBatch(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Count(ctx, now); err != nil || n != 2 {
+		t.Errorf("got count %d, %v after batch, want: %d", n, err, 2)
+	}
+	if err := s.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLStore_collision(t *testing.T) {
+	db, err := sql.Open("pwdless_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	testStoreCollision(t, NewSQLStore[int](db))
+}
@@ -0,0 +1,115 @@
+package pwdless
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// stateVersion is the version of the serialized form written by DumpState.
+const stateVersion = 1
+
+// lister is implemented by stores able to return all their tokens, like MemoryStore.
+type lister[ID comparable] interface {
+	All(ctx context.Context, now time.Time) ([]LoginToken[ID], error)
+}
+
+// state is the serialized form of the token store.
+type state[ID comparable] struct {
+	Version int               `json:"version"`
+	Tokens  []storedToken[ID] `json:"tokens"`
+}
+
+// DumpState serializes all unexpired login tokens as JSON, e.g. before a graceful shutdown
+// to restore them with LoadState on startup of the new instance.
+// Tokens are dumped as stored with hashed tokenstrings, no secrets are included. As a consequence
+// the restoring instance has to be configured with the same hash secret for the tokens to validate.
+// It fails if the store does not support listing all tokens, which only MemoryStore and ShardedMemoryStore do.
+func (a *LoginTokenAuth[ID]) DumpState() ([]byte, error) {
+	if a.closed.Load() {
+		return nil, ErrClosed
+	}
+	l, ok := a.store.(lister[ID])
+	if !ok {
+		return nil, fmt.Errorf("token store %T does not support dumping state", a.store)
+	}
+	tokens, err := l.All(context.Background(), a.clock())
+	if err != nil {
+		return nil, err
+	}
+	s := state[ID]{Version: stateVersion, Tokens: make([]storedToken[ID], len(tokens))}
+	for i, lt := range tokens {
+		s.Tokens[i] = storedToken[ID](lt)
+	}
+	return json.Marshal(s)
+}
+
+// LoadState restores login tokens serialized by DumpState into the store, skipping already expired tokens.
+// Existing tokens are kept, tokens with the same tokenstring are replaced.
+func (a *LoginTokenAuth[ID]) LoadState(data []byte) error {
+	if a.closed.Load() {
+		return ErrClosed
+	}
+	var s state[ID]
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s.Version != stateVersion {
+		return fmt.Errorf("unsupported login token state version %d", s.Version)
+	}
+	now := a.clock()
+	for _, st := range s.Tokens {
+		lt := LoginToken[ID](st)
+		if lt.Token == "" {
+			return errors.New("login token state contains token without tokenstring")
+		}
+		if !lt.Valid(now) {
+			continue
+		}
+		if err := a.store.Save(context.Background(), lt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportTo copies all unexpired login tokens into dst, e.g. to back them up to a durable store before maintenance,
+// and returns the number of tokens copied. Tokens are copied as stored with hashed tokenstrings, so restoring them
+// with ImportFrom requires the same hash secret like LoadState. It fails if the store does not support listing
+// all tokens, which only MemoryStore and ShardedMemoryStore do.
+func (a *LoginTokenAuth[ID]) ExportTo(ctx context.Context, dst TokenStore[ID]) (int, error) {
+	if a.closed.Load() {
+		return 0, ErrClosed
+	}
+	return copyTokens(ctx, a.store, dst, a.clock())
+}
+
+// ImportFrom copies all unexpired login tokens of src exported by ExportTo into the store and returns the number
+// of tokens copied. Existing tokens are kept, tokens with the same tokenstring are replaced. It fails if src
+// does not support listing all tokens.
+func (a *LoginTokenAuth[ID]) ImportFrom(ctx context.Context, src TokenStore[ID]) (int, error) {
+	if a.closed.Load() {
+		return 0, ErrClosed
+	}
+	return copyTokens(ctx, src, a.store, a.clock())
+}
+
+// copyTokens saves all tokens of src unexpired at now to dst, returning the number of tokens saved.
+func copyTokens[ID comparable](ctx context.Context, src, dst TokenStore[ID], now time.Time) (int, error) {
+	l, ok := src.(lister[ID])
+	if !ok {
+		return 0, fmt.Errorf("token store %T does not support listing all tokens", src)
+	}
+	tokens, err := l.All(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	for i, lt := range tokens {
+		if err := dst.Save(ctx, lt); err != nil {
+			return i, err
+		}
+	}
+	return len(tokens), nil
+}
@@ -0,0 +1,128 @@
+package pwdless
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_DumpState(t *testing.T) {
+	clock := newFakeClock()
+	secret := WithHashSecret("0123456789abcdef0123456789abcdef")
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), secret)
+
+	short, err := a.CreateTokenWithExpiry(1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt, err := a.CreateTokenWithData(2, map[string]string{"tenant": "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Refresh(lt.Token, time.Minute+123*time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := a.DumpState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("0123456789abcdef")) || bytes.Contains(data, []byte(lt.Token)) {
+		t.Error("state contains secret or plaintext token")
+	}
+
+	clock.Add(2 * time.Second)
+	b, store := newTestAuth(time.Minute, WithClock(clock.Now), secret)
+	if err := b.LoadState(data); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(store.token); n != 1 {
+		t.Errorf("got %d tokens loaded, want: %d", n, 1)
+	}
+	if _, err := b.Peek(short.Token); err != ErrTokenNotFound {
+		t.Errorf("got %v for expired token, want: %v", err, ErrTokenNotFound)
+	}
+	want := clock.Now().Add(-2*time.Second + time.Minute + 123*time.Nanosecond)
+	if got, ok, _ := store.Get(context.Background(), b.hashToken(lt.Token)); !ok || !got.Expiry.Equal(want) {
+		t.Errorf("got %+v, want expiry restored precisely", got)
+	}
+	id, data2, err := b.GetAccountIDWithData(lt.Token)
+	if err != nil || id != 2 || data2["tenant"] != "acme" {
+		t.Errorf("got %d, %v, %v consuming restored token", id, data2, err)
+	}
+
+	if err := b.LoadState([]byte(`{"version":2}`)); err == nil {
+		t.Error("got no error loading unsupported version")
+	}
+}
+
+func TestLoginTokenAuth_DumpStateUnsupported(t *testing.T) {
+	a, _ := newTestAuth(time.Minute, WithStore(failingStore{}))
+	if _, err := a.DumpState(); err == nil {
+		t.Error("got no error dumping state of store not listing all tokens")
+	}
+}
+
+func TestLoginTokenAuth_ExportTo(t *testing.T) {
+	db, err := sql.Open("pwdless_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	dst := NewSQLStore[int](db)
+	if err := dst.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Clear(ctx)
+
+	secret := WithHashSecret("0123456789abcdef0123456789abcdef")
+	a, src := newTestAuth(time.Minute, secret)
+	lt, err := a.CreateTokenWithData(1, map[string]string{"tenant": "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateToken(2); err != nil {
+		t.Fatal(err)
+	}
+	expired, err := a.CreateToken(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := src.token[a.hashToken(expired.Token)]
+	e.Expiry = time.Now().Add(-time.Second)
+	src.token[e.Token] = e
+
+	if n, err := a.ExportTo(ctx, dst); err != nil || n != 2 {
+		t.Fatalf("got %d, %v exported, want: %d, <nil>", n, err, 2)
+	}
+	want := src.token[a.hashToken(lt.Token)]
+	got, ok, err := dst.Get(ctx, want.Token)
+	if err != nil || !ok {
+		t.Fatalf("got %v, %v getting exported token, want: true, <nil>", ok, err)
+	}
+	if got.AccountID != want.AccountID || !got.Expiry.Equal(want.Expiry) || got.Data["tenant"] != "acme" {
+		t.Errorf("got exported token %+v, want: %+v", got, want)
+	}
+	if _, ok, _ := dst.Get(ctx, e.Token); ok {
+		t.Error("expired token exported")
+	}
+
+	b, _ := newTestAuth(time.Minute, secret, WithStore[int](dst))
+	if id, err := b.GetAccountID(lt.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v consuming exported token, want: 1, <nil>", id, err)
+	}
+
+	c, restored := newTestAuth(time.Minute, secret)
+	if n, err := c.ImportFrom(ctx, src); err != nil || n != 2 {
+		t.Fatalf("got %d, %v imported, want: %d, <nil>", n, err, 2)
+	}
+	if n := len(restored.token); n != 2 {
+		t.Errorf("got %d tokens in store, want: %d", n, 2)
+	}
+	if _, err := c.ImportFrom(ctx, dst); err == nil {
+		t.Error("got no error importing from store not supporting listing")
+	}
+}
@@ -0,0 +1,286 @@
+package pwdless
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// minSigningSecretLength is the minimum accepted length of the secret signing stateless tokens.
+const minSigningSecretLength = 32
+
+// StatelessTokenAuth implements login tokens carrying account ID and expiry signed by HMAC-SHA256 inside the tokenstring,
+// so nothing is stored server side. Stateless tokens can neither be revoked nor consumed and stay valid until expiry.
+type StatelessTokenAuth[ID comparable] struct {
+	secret []byte
+	expiry time.Duration
+	format StatelessFormat
+	skew   time.Duration
+	future time.Duration
+	clock  func() time.Time
+
+	loginURL string
+	secretFn AccountSecretFunc[ID]
+}
+
+// StatelessFormat is the serialization of stateless tokens.
+type StatelessFormat int
+
+const (
+	// FormatCompact serializes the payload and signature as two base64url segments, the default.
+	FormatCompact StatelessFormat = iota
+	// FormatJWT serializes tokens as HS256 signed JWT with the account ID as "sub" and expiry as "exp" claim,
+	// so the claims can be read by common JWT libraries.
+	FormatJWT
+)
+
+// statelessEncoding encodes token segments. Decoding is strict, rejecting non-zero padding bits,
+// so every token has a single valid encoding and can't be altered into a different but valid tokenstring.
+var statelessEncoding = base64.RawURLEncoding.Strict()
+
+// statelessPayload is the signed content of a stateless token.
+type statelessPayload[ID comparable] struct {
+	AccountID ID    `json:"a"`
+	Expiry    int64 `json:"e"`
+}
+
+// NewStatelessTokenAuth configures and returns a StatelessTokenAuth instance for accounts identified by ID.
+// Expiry and signing secret are read from viper and may be overridden by opts.
+func NewStatelessTokenAuth[ID comparable](opts ...Option) (*StatelessTokenAuth[ID], error) {
+	return NewStatelessTokenAuthWithOptions[ID](append([]Option{
+		viperExpiry(viper.GetViper(), "auth_login_token_expiry"),
+		WithSigningSecret(viper.GetString("auth_login_token_secret")),
+		WithLoginURL(viper.GetString("auth_login_url")),
+	}, opts...)...)
+}
+
+// NewStatelessTokenAuthWithOptions configures and returns a StatelessTokenAuth instance for accounts identified by ID
+// using only the provided options. Only WithExpiry, WithSigningSecret, WithStatelessFormat, WithClockSkew, WithFutureTolerance,
+// WithClock, and for signed URLs WithLoginURL and WithAccountSecret apply.
+func NewStatelessTokenAuthWithOptions[ID comparable](opts ...Option) (*StatelessTokenAuth[ID], error) {
+	c := config{
+		loginTokenExpiry: defaultLoginTokenExpiry,
+		futureTolerance:  defaultFutureTolerance,
+		clock:            time.Now,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	if len(c.signingSecret) < minSigningSecretLength {
+		return nil, fmt.Errorf("login token signing secret must be at least %d bytes", minSigningSecretLength)
+	}
+	if c.loginTokenExpiry <= 0 {
+		return nil, fmt.Errorf("login token expiry %s must be a positive duration like \"15m\" or \"24h\"", c.loginTokenExpiry)
+	}
+	if c.clockSkew < 0 {
+		return nil, fmt.Errorf("login token clock skew %s must not be negative", c.clockSkew)
+	}
+	if c.futureTolerance < 0 {
+		return nil, fmt.Errorf("login token future tolerance %s must not be negative", c.futureTolerance)
+	}
+	if c.loginURL != "" {
+		if _, err := url.Parse(c.loginURL); err != nil {
+			return nil, fmt.Errorf("invalid login url: %v", err)
+		}
+	}
+	var secretFn AccountSecretFunc[ID]
+	if c.accountSecret != nil {
+		f, ok := c.accountSecret.(AccountSecretFunc[ID])
+		if !ok {
+			var id ID
+			return nil, fmt.Errorf("account secret func %T does not support account ID type %T", c.accountSecret, id)
+		}
+		secretFn = f
+	}
+	if c.statelessFormat != FormatCompact && c.statelessFormat != FormatJWT {
+		return nil, fmt.Errorf("unknown stateless token format %d", c.statelessFormat)
+	}
+	return &StatelessTokenAuth[ID]{
+		secret: c.signingSecret,
+		expiry: c.loginTokenExpiry,
+		format: c.statelessFormat,
+		skew:   c.clockSkew,
+		future: c.futureTolerance,
+		clock:  c.clock,
+
+		loginURL: c.loginURL,
+		secretFn: secretFn,
+	}, nil
+}
+
+// CreateToken returns a signed token referencing account ID expiring after the configured expiry.
+func (a *StatelessTokenAuth[ID]) CreateToken(id ID) (LoginToken[ID], error) {
+	now := a.clock()
+	expiry := now.Add(a.expiry).Truncate(time.Second)
+	var token string
+	var err error
+	if a.format == FormatJWT {
+		token, err = a.encodeJWT(id, expiry)
+	} else {
+		token, err = a.encodeCompact(id, expiry)
+	}
+	if err != nil {
+		return LoginToken[ID]{}, err
+	}
+	return LoginToken[ID]{
+		Token:     token,
+		AccountID: id,
+		Created:   now,
+		Expiry:    expiry,
+	}, nil
+}
+
+// GetAccountID verifies the token signature and expiry and returns the account ID,
+// or ErrTokenNotFound if the token is malformed, not in the configured format or its signature invalid
+// and ErrTokenExpired if it is past its expiry widened by the configured clock skew.
+// Tokens expiring later than a token created now plus the configured future tolerance are rejected
+// with errTokenFromFuture, as they were created in the future by their expiry.
+func (a *StatelessTokenAuth[ID]) GetAccountID(token string) (ID, error) {
+	var id ID
+	var expiry int64
+	var err error
+	if a.format == FormatJWT {
+		id, expiry, err = a.decodeJWT(token)
+	} else {
+		id, expiry, err = a.decodeCompact(token)
+	}
+	if err != nil {
+		return id, err
+	}
+	now := a.clock()
+	exp := time.Unix(expiry, 0)
+	if exp.Add(-a.expiry).After(now.Add(a.future)) {
+		return id, errTokenFromFuture
+	}
+	if now.After(exp.Add(a.skew)) {
+		return id, ErrTokenExpired
+	}
+	return id, nil
+}
+
+func (a *StatelessTokenAuth[ID]) encodeCompact(id ID, expiry time.Time) (string, error) {
+	payload, err := json.Marshal(statelessPayload[ID]{AccountID: id, Expiry: expiry.Unix()})
+	if err != nil {
+		return "", err
+	}
+	p := statelessEncoding.EncodeToString(payload)
+	return p + "." + statelessEncoding.EncodeToString(a.sign(p)), nil
+}
+
+func (a *StatelessTokenAuth[ID]) decodeCompact(token string) (ID, int64, error) {
+	var id ID
+	p, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return id, 0, ErrTokenNotFound
+	}
+	if !a.verify(p, sig) {
+		return id, 0, ErrTokenNotFound
+	}
+	raw, err := statelessEncoding.DecodeString(p)
+	if err != nil {
+		return id, 0, ErrTokenNotFound
+	}
+	var payload statelessPayload[ID]
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return id, 0, ErrTokenNotFound
+	}
+	return payload.AccountID, payload.Expiry, nil
+}
+
+// jwtHeader is the encoded header of FormatJWT tokens, the only header accepted.
+var jwtHeader = statelessEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// jwtClaims are the claims of FormatJWT tokens.
+type jwtClaims struct {
+	Subject string `json:"sub"`
+	Expiry  int64  `json:"exp"`
+}
+
+func (a *StatelessTokenAuth[ID]) encodeJWT(id ID, expiry time.Time) (string, error) {
+	sub, err := jwtSubject(id)
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(jwtClaims{Subject: sub, Expiry: expiry.Unix()})
+	if err != nil {
+		return "", err
+	}
+	p := jwtHeader + "." + statelessEncoding.EncodeToString(claims)
+	return p + "." + statelessEncoding.EncodeToString(a.sign(p)), nil
+}
+
+func (a *StatelessTokenAuth[ID]) decodeJWT(token string) (ID, int64, error) {
+	var id ID
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return id, 0, ErrTokenNotFound
+	}
+	p, sig := token[:i], token[i+1:]
+	header, c, ok := strings.Cut(p, ".")
+	// Accepting only the fixed header rules out algorithm confusion like "alg":"none".
+	if !ok || header != jwtHeader || !a.verify(p, sig) {
+		return id, 0, ErrTokenNotFound
+	}
+	raw, err := statelessEncoding.DecodeString(c)
+	if err != nil {
+		return id, 0, ErrTokenNotFound
+	}
+	var claims jwtClaims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return id, 0, ErrTokenNotFound
+	}
+	if id, err = parseJWTSubject[ID](claims.Subject); err != nil {
+		return id, 0, ErrTokenNotFound
+	}
+	return id, claims.Expiry, nil
+}
+
+// jwtSubject returns account ID as "sub" claim, which has to be a string: string IDs are used as is,
+// other IDs by their JSON encoding, e.g. "123" for int IDs.
+func jwtSubject[ID comparable](id ID) (string, error) {
+	raw, err := json.Marshal(id)
+	if err != nil {
+		return "", err
+	}
+	var sub string
+	if json.Unmarshal(raw, &sub) == nil {
+		return sub, nil
+	}
+	return string(raw), nil
+}
+
+// parseJWTSubject returns the account ID encoded by jwtSubject.
+func parseJWTSubject[ID comparable](sub string) (ID, error) {
+	var id ID
+	if err := json.Unmarshal([]byte(sub), &id); err == nil {
+		return id, nil
+	}
+	quoted, err := json.Marshal(sub)
+	if err != nil {
+		return id, err
+	}
+	err = json.Unmarshal(quoted, &id)
+	return id, err
+}
+
+// verify reports whether sig is the encoded signature of payload.
+func (a *StatelessTokenAuth[ID]) verify(payload, sig string) bool {
+	s, err := statelessEncoding.DecodeString(sig)
+	return err == nil && hmac.Equal(s, a.sign(payload))
+}
+
+func (a *StatelessTokenAuth[ID]) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,241 @@
+package pwdless
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	testSigningSecret = "0123456789abcdef0123456789abcdef"
+	base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+)
+
+func TestStatelessTokenAuth(t *testing.T) {
+	clock := newFakeClock()
+	a, err := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret), WithExpiry(time.Minute), WithClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt, err := a.CreateToken(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := clock.Now().Add(time.Minute); !lt.Expiry.Equal(want) {
+		t.Errorf("got expiry %v, want: %v", lt.Expiry, want)
+	}
+
+	for i := 0; i < 2; i++ {
+		if id, err := a.GetAccountID(lt.Token); err != nil || id != 42 {
+			t.Errorf("got %d, %v, want: %d", id, err, 42)
+		}
+	}
+
+	other, _ := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(strings.ToUpper(testSigningSecret)), WithClock(clock.Now))
+	p, sig, _ := strings.Cut(lt.Token, ".")
+	forged, _ := other.CreateToken(1)
+	fp, _, _ := strings.Cut(forged.Token, ".")
+	for _, token := range []string{"", "invalid", p, p + ".", fp + "." + sig, lt.Token + "x"} {
+		if _, err := a.GetAccountID(token); err != ErrTokenNotFound {
+			t.Errorf("got error %v for token %q, want: %v", err, token, ErrTokenNotFound)
+		}
+	}
+	if _, err := other.GetAccountID(lt.Token); err != ErrTokenNotFound {
+		t.Errorf("got error %v for token signed by other secret, want: %v", err, ErrTokenNotFound)
+	}
+
+	skewed, err := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret), WithClockSkew(5*time.Second), WithClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(time.Minute + time.Second)
+	if _, err := a.GetAccountID(lt.Token); err != ErrTokenExpired {
+		t.Errorf("got error %v for expired token, want: %v", err, ErrTokenExpired)
+	}
+	if id, err := skewed.GetAccountID(lt.Token); err != nil || id != 42 {
+		t.Errorf("got %d, %v for token expiring within skew, want: %d", id, err, 42)
+	}
+	clock.Add(5 * time.Second)
+	if _, err := skewed.GetAccountID(lt.Token); err != ErrTokenExpired {
+		t.Errorf("got error %v for token expired beyond skew, want: %v", err, ErrTokenExpired)
+	}
+}
+
+func TestStatelessTokenAuth_futureTolerance(t *testing.T) {
+	clock := newFakeClock()
+	a, err := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret), WithExpiry(time.Minute),
+		WithFutureTolerance(5*time.Second), WithClock(clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ahead := newFakeClock()
+	ahead.Add(5 * time.Second)
+	within, _ := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret), WithExpiry(time.Minute), WithClock(ahead.Now))
+	lt, err := within.CreateToken(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 42 {
+		t.Errorf("got %d, %v for token created within tolerance, want: %d", id, err, 42)
+	}
+
+	ahead.Add(time.Second)
+	if lt, err = within.CreateToken(42); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountID(lt.Token); err != errTokenFromFuture {
+		t.Errorf("got error %v for token created beyond tolerance, want: %v", err, errTokenFromFuture)
+	}
+
+	// tokens with an expiry signed further in the future are created in the future as well
+	long, _ := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret), WithExpiry(time.Hour), WithClock(clock.Now))
+	if lt, err = long.CreateToken(42); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountID(lt.Token); err != errTokenFromFuture {
+		t.Errorf("got error %v for token expiring beyond expiry, want: %v", err, errTokenFromFuture)
+	}
+	if _, err := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret), WithFutureTolerance(-time.Second)); err == nil {
+		t.Error("got no error for negative future tolerance")
+	}
+}
+
+func TestNewStatelessTokenAuthWithOptions(t *testing.T) {
+	if _, err := NewStatelessTokenAuthWithOptions[int](WithSigningSecret("short")); err == nil {
+		t.Error("got no error for short signing secret")
+	}
+	if _, err := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret), WithExpiry(0)); err == nil {
+		t.Error("got no error for zero expiry")
+	}
+	a, err := NewStatelessTokenAuthWithOptions[string](WithSigningSecret(testSigningSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt, err := a.CreateToken("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != "user-1" {
+		t.Errorf("got %q, %v, want: %q", id, err, "user-1")
+	}
+}
+
+func TestStatelessTokenAuth_formatJWT(t *testing.T) {
+	clock := newFakeClock()
+	newAuth := func(f StatelessFormat) *StatelessTokenAuth[int] {
+		a, err := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret), WithStatelessFormat(f), WithClock(clock.Now))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	compact, jwt := newAuth(FormatCompact), newAuth(FormatJWT)
+
+	lt, err := jwt.CreateToken(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments := strings.Split(lt.Token, ".")
+	if len(segments) != 3 {
+		t.Fatalf("got %d segments in %q, want: %d", len(segments), lt.Token, 3)
+	}
+	var header map[string]string
+	var claims map[string]interface{}
+	for i, v := range []interface{}{&header, &claims} {
+		raw, err := base64.RawURLEncoding.DecodeString(segments[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(raw, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if header["alg"] != "HS256" || claims["sub"] != "42" || claims["exp"] != float64(lt.Expiry.Unix()) {
+		t.Errorf("got header %v and claims %v, want HS256 with sub 42 and exp", header, claims)
+	}
+	if id, err := jwt.GetAccountID(lt.Token); err != nil || id != 42 {
+		t.Errorf("got %d, %v, want: %d", id, err, 42)
+	}
+	// The fake clock lies in the past, so only the signature is verified.
+	parser := &jwtgo.Parser{SkipClaimsValidation: true}
+	parsed, err := parser.Parse(lt.Token, func(*jwtgo.Token) (interface{}, error) { return []byte(testSigningSecret), nil })
+	if err != nil || !parsed.Valid || parsed.Claims.(jwtgo.MapClaims)["sub"] != "42" {
+		t.Errorf("got %v, %v parsing with jwt library, want valid token", parsed, err)
+	}
+
+	c, err := compact.CreateToken(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := compact.GetAccountID(lt.Token); err != ErrTokenNotFound {
+		t.Errorf("got error %v for jwt with compact format, want: %v", err, ErrTokenNotFound)
+	}
+	if _, err := jwt.GetAccountID(c.Token); err != ErrTokenNotFound {
+		t.Errorf("got error %v for compact token with jwt format, want: %v", err, ErrTokenNotFound)
+	}
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + segments[1] + "."
+	if _, err := jwt.GetAccountID(none); err != ErrTokenNotFound {
+		t.Errorf("got error %v for unsigned jwt, want: %v", err, ErrTokenNotFound)
+	}
+
+	s, err := NewStatelessTokenAuthWithOptions[string](WithSigningSecret(testSigningSecret), WithStatelessFormat(FormatJWT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"user-1", "123"} {
+		lt, err := s.CreateToken(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id, err := s.GetAccountID(lt.Token); err != nil || id != want {
+			t.Errorf("got %q, %v, want: %q", id, err, want)
+		}
+	}
+
+	clock.Add(jwt.expiry + time.Second)
+	if _, err := jwt.GetAccountID(lt.Token); err != ErrTokenExpired {
+		t.Errorf("got error %v for expired jwt, want: %v", err, ErrTokenExpired)
+	}
+	if _, err := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret), WithStatelessFormat(2)); err == nil {
+		t.Error("got no error for unknown format")
+	}
+}
+
+func FuzzParseStatelessToken(f *testing.F) {
+	clock := newFakeClock()
+	a, err := NewStatelessTokenAuthWithOptions[int](WithSigningSecret(testSigningSecret), WithExpiry(time.Minute), WithClock(clock.Now))
+	if err != nil {
+		f.Fatal(err)
+	}
+	lt, err := a.CreateToken(42)
+	if err != nil {
+		f.Fatal(err)
+	}
+	p, sig, _ := strings.Cut(lt.Token, ".")
+	// malleable differs from the token only in the unused bits of the last base64 character of the signature
+	last := strings.IndexByte(base64URLAlphabet, sig[len(sig)-1])
+	malleable := p + "." + sig[:len(sig)-1] + string(base64URLAlphabet[last^1])
+	for _, seed := range []string{lt.Token, "", ".", "..", p, p + ".", "." + sig, lt.Token[:len(lt.Token)-1], lt.Token + "=", p + "." + sig + "." + sig, "e30." + sig, malleable} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, token string) {
+		id, err := a.GetAccountID(token)
+		if err == nil {
+			if token != lt.Token || id != 42 {
+				t.Fatalf("got account id %d for token %q not issued", id, token)
+			}
+			return
+		}
+		if err != ErrTokenNotFound && err != ErrTokenExpired {
+			t.Fatalf("got unexpected error %v for token %q", err, token)
+		}
+		if id != 0 {
+			t.Fatalf("got account id %d with error %v", id, err)
+		}
+	})
+}
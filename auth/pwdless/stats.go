@@ -0,0 +1,73 @@
+package pwdless
+
+import "sync/atomic"
+
+// Stats is a snapshot of token operations since the LoginTokenAuth was created.
+type Stats struct {
+	// Active is the number of unexpired tokens, maintained on creation and consumption
+	// and synchronized with the store on every purge run.
+	Active int
+	// Created is the number of tokens created.
+	Created uint64
+	// Consumed is the number of tokens consumed successfully.
+	Consumed uint64
+	// Failed is the number of failed consumptions, e.g. for unknown or expired tokens.
+	Failed uint64
+	// Purged is the number of expired tokens purged, including those removed on access unless disabled by WithCountAccessExpiry.
+	Purged uint64
+}
+
+// stats counts token operations for Stats, independent of the optional Metrics.
+type stats struct {
+	active   atomic.Int64
+	created  atomic.Uint64
+	consumed atomic.Uint64
+	failed   atomic.Uint64
+	purged   atomic.Uint64
+}
+
+// Stats returns a snapshot of the token operations counted since creation, read without accessing the store.
+func (a *LoginTokenAuth[ID]) Stats() Stats {
+	active := a.stats.active.Load()
+	if active < 0 {
+		active = 0
+	}
+	return Stats{
+		Active:   int(active),
+		Created:  a.stats.created.Load(),
+		Consumed: a.stats.consumed.Load(),
+		Failed:   a.stats.failed.Load(),
+		Purged:   a.stats.purged.Load(),
+	}
+}
+
+// SnapshotAndResetStats returns Stats like Stats and resets the created, consumed, failed and purged counts to zero,
+// e.g. for scrapers expecting counts per scrape. Every count is read and reset by a single atomic swap, so no
+// operation counted concurrently is lost, it is part of either this or the next snapshot. Active is not reset,
+// neither are the Metrics counters.
+func (a *LoginTokenAuth[ID]) SnapshotAndResetStats() Stats {
+	active := a.stats.active.Load()
+	if active < 0 {
+		active = 0
+	}
+	return Stats{
+		Active:   int(active),
+		Created:  a.stats.created.Swap(0),
+		Consumed: a.stats.consumed.Swap(0),
+		Failed:   a.stats.failed.Swap(0),
+		Purged:   a.stats.purged.Swap(0),
+	}
+}
+
+func (s *stats) create() {
+	s.created.Add(1)
+	s.active.Add(1)
+}
+
+// consume counts a consumed token, removed from the store unless reusable.
+func (s *stats) consume(reusable bool) {
+	s.consumed.Add(1)
+	if !reusable {
+		s.active.Add(-1)
+	}
+}
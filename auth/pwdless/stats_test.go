@@ -0,0 +1,101 @@
+package pwdless
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now))
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiring, err := a.CreateToken(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateToken(3); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := a.Stats(), (Stats{Active: 3, Created: 3}); got != want {
+		t.Errorf("got stats %+v after create, want: %+v", got, want)
+	}
+
+	if _, err := a.GetAccountID(lt.Token); err != nil {
+		t.Fatal(err)
+	}
+	a.GetAccountID(lt.Token)
+	if got, want := a.Stats(), (Stats{Active: 2, Created: 3, Consumed: 1, Failed: 1}); got != want {
+		t.Errorf("got stats %+v after consume, want: %+v", got, want)
+	}
+
+	clock.Add(2 * time.Minute)
+	a.GetAccountID(expiring.Token)
+	if _, err := a.purgeExpired(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := a.Stats(), (Stats{Active: 0, Created: 3, Consumed: 1, Failed: 2, Purged: 2}); got != want {
+		t.Errorf("got stats %+v after purge, want: %+v", got, want)
+	}
+}
+
+func TestLoginTokenAuth_SnapshotAndResetStats(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+	const workers, n = 8, 200
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				lt, err := a.CreateToken(1)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := a.GetAccountID(lt.Token); err != nil {
+					t.Error(err)
+					return
+				}
+				a.GetAccountID(lt.Token)
+			}
+		}()
+	}
+	var total Stats
+	snapshots := make(chan struct{})
+	go func() {
+		defer close(snapshots)
+		for {
+			s := a.SnapshotAndResetStats()
+			total.Created += s.Created
+			total.Consumed += s.Consumed
+			total.Failed += s.Failed
+			select {
+			case <-done:
+				return
+			default:
+			}
+		}
+	}()
+	wg.Wait()
+	close(done)
+	<-snapshots
+
+	s := a.SnapshotAndResetStats()
+	total.Created += s.Created
+	total.Consumed += s.Consumed
+	total.Failed += s.Failed
+	if want := (Stats{Created: workers * n, Consumed: workers * n, Failed: workers * n}); total != want {
+		t.Errorf("got total stats %+v across snapshots, want: %+v", total, want)
+	}
+	if got := a.Stats(); got != (Stats{}) {
+		t.Errorf("got stats %+v after reset, want: %+v", got, Stats{})
+	}
+}
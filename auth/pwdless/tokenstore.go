@@ -0,0 +1,411 @@
+package pwdless
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errTokenCollision is returned by stores when saving a tokenstring already stored for another account.
+var errTokenCollision = errors.New("login token already exists for another account")
+
+// TokenStore defines persistence operations on login tokens.
+// Implementations should abort and return ctx.Err() when ctx is done.
+// Stores buffering writes may implement Flush(ctx) and stores holding resources io.Closer,
+// both are called by LoginTokenAuth.Close. Stores with a remote backend should implement Pinger.
+// Stores able to save multiple tokens atomically may implement SaveBatch(ctx, tokens) used by LoginTokenAuth.CreateTokens.
+// Stores able to extend all tokens of an account at once may implement ExtendForAccount(ctx, id, now, by)
+// used by LoginTokenAuth.ExtendAllForAccount.
+type TokenStore[ID comparable] interface {
+	Save(ctx context.Context, lt LoginToken[ID]) error
+	Get(ctx context.Context, token string) (LoginToken[ID], bool, error)
+	Delete(ctx context.Context, token string) error
+	DeleteByAccount(ctx context.Context, id ID) (int, error)
+	PurgeExpired(ctx context.Context, now time.Time) ([]LoginToken[ID], error)
+	Count(ctx context.Context, now time.Time) (int, error)
+	CountForAccount(ctx context.Context, id ID, now time.Time) (int, error)
+	// Clear removes all login tokens.
+	Clear(ctx context.Context) error
+	// List returns all login tokens referencing account ID not expired at now.
+	List(ctx context.Context, id ID, now time.Time) ([]LoginToken[ID], error)
+	// Extend sets the expiry of the login token for tokenstring if it exists and is not expired at now,
+	// returning the updated token and whether it was updated.
+	Extend(ctx context.Context, token string, now, expiry time.Time) (LoginToken[ID], bool, error)
+}
+
+// Pinger is implemented by stores able to check the reachability of their backend, used by LoginTokenAuth.Ping.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// flusher is implemented by stores buffering writes.
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// chunkPurger is implemented by stores able to purge in chunks, like MemoryStore.
+type chunkPurger[ID comparable] interface {
+	PurgeExpiredChunked(ctx context.Context, now time.Time, size int) ([]LoginToken[ID], error)
+}
+
+// MemoryStore implements TokenStore by keeping login tokens in an in-memory map.
+// If a maximum size is set, the least recently created tokens are evicted when exceeding it,
+// preferring already expired tokens.
+type MemoryStore[ID comparable] struct {
+	token   map[string]LoginToken[ID]
+	order   *list.List // tokenstrings in order of creation
+	elems   map[string]*list.Element
+	maxSize int
+	mux     sync.RWMutex
+
+	// onEvict is called for every unexpired token evicted to stay within maxSize.
+	onEvict func()
+}
+
+// NewMemoryStore returns an empty in-memory token store.
+func NewMemoryStore[ID comparable]() *MemoryStore[ID] {
+	return NewBoundedMemoryStore[ID](0)
+}
+
+// NewBoundedMemoryStore returns an empty in-memory token store holding at most maxSize tokens, 0 meaning unbounded.
+func NewBoundedMemoryStore[ID comparable](maxSize int) *MemoryStore[ID] {
+	return &MemoryStore[ID]{
+		token:   make(map[string]LoginToken[ID]),
+		order:   list.New(),
+		elems:   make(map[string]*list.Element),
+		maxSize: maxSize,
+	}
+}
+
+// add saves lt, keeping its position in creation order if already present.
+func (s *MemoryStore[ID]) add(lt LoginToken[ID]) {
+	s.token[lt.Token] = lt
+	if _, ok := s.elems[lt.Token]; !ok {
+		s.elems[lt.Token] = s.order.PushBack(lt.Token)
+	}
+}
+
+// collides reports whether the tokenstring of lt is already saved for another account.
+func (s *MemoryStore[ID]) collides(lt LoginToken[ID]) bool {
+	old, ok := s.token[lt.Token]
+	return ok && old.AccountID != lt.AccountID
+}
+
+// remove deletes the token for tokenstring.
+func (s *MemoryStore[ID]) remove(token string) {
+	delete(s.token, token)
+	if e, ok := s.elems[token]; ok {
+		s.order.Remove(e)
+		delete(s.elems, token)
+	}
+}
+
+// evict removes the least recently created tokens exceeding maxSize. Expired tokens are removed first
+// in creation order, including ones created after live tokens with a shorter expiry, before evicting live tokens.
+func (s *MemoryStore[ID]) evict(now time.Time) {
+	for e := s.order.Front(); e != nil && len(s.token) > s.maxSize; {
+		next := e.Next()
+		if t := e.Value.(string); !s.token[t].Valid(now) {
+			s.remove(t)
+		}
+		e = next
+	}
+	for len(s.token) > s.maxSize {
+		s.remove(s.order.Front().Value.(string))
+		if s.onEvict != nil {
+			s.onEvict()
+		}
+	}
+}
+
+// Save adds or replaces a login token. It fails if the tokenstring is already stored for another account.
+func (s *MemoryStore[ID]) Save(ctx context.Context, lt LoginToken[ID]) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.collides(lt) {
+		return errTokenCollision
+	}
+	s.add(lt)
+	if s.maxSize > 0 && len(s.token) > s.maxSize {
+		now := lt.Created
+		if now.IsZero() {
+			now = time.Now()
+		}
+		s.evict(now)
+	}
+	return nil
+}
+
+// SaveBatch adds or replaces all tokens at once. It saves none if a tokenstring is already stored for another account.
+func (s *MemoryStore[ID]) SaveBatch(ctx context.Context, tokens []LoginToken[ID]) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, lt := range tokens {
+		if s.collides(lt) {
+			return errTokenCollision
+		}
+	}
+	now := time.Now()
+	for _, lt := range tokens {
+		s.add(lt)
+		if !lt.Created.IsZero() {
+			now = lt.Created
+		}
+	}
+	if s.maxSize > 0 && len(s.token) > s.maxSize {
+		s.evict(now)
+	}
+	return nil
+}
+
+// Get returns the login token for tokenstring and whether it exists.
+func (s *MemoryStore[ID]) Get(ctx context.Context, token string) (LoginToken[ID], bool, error) {
+	if err := ctx.Err(); err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	s.mux.RLock()
+	lt, ok := s.token[token]
+	s.mux.RUnlock()
+	return lt, ok, nil
+}
+
+// Delete removes the login token for tokenstring.
+func (s *MemoryStore[ID]) Delete(ctx context.Context, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mux.Lock()
+	s.remove(token)
+	s.mux.Unlock()
+	return nil
+}
+
+// DeleteByAccount removes all login tokens referencing account ID and returns the number removed.
+func (s *MemoryStore[ID]) DeleteByAccount(ctx context.Context, id ID) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	n := 0
+	for t, v := range s.token {
+		if v.AccountID == id {
+			s.remove(t)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// PurgeExpired removes all login tokens expired at now and returns the removed tokens.
+func (s *MemoryStore[ID]) PurgeExpired(ctx context.Context, now time.Time) ([]LoginToken[ID], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var purged []LoginToken[ID]
+	for t, v := range s.token {
+		if !v.Valid(now) {
+			s.remove(t)
+			purged = append(purged, v)
+		}
+	}
+	return purged, nil
+}
+
+// PurgeExpiredChunked is like PurgeExpired, but visits at most size tokens in creation order per lock acquisition,
+// so a purge of a large store does not block other operations for a whole scan.
+// Tokens saved while purging may be left for the next purge. A size not positive purges in a single pass.
+func (s *MemoryStore[ID]) PurgeExpiredChunked(ctx context.Context, now time.Time, size int) ([]LoginToken[ID], error) {
+	if size <= 0 {
+		return s.PurgeExpired(ctx, now)
+	}
+	var purged []LoginToken[ID]
+	var keys []string
+	next := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+		keys, next = s.candidates(keys, next, size)
+		s.mux.Lock()
+		for _, t := range keys {
+			if lt, ok := s.token[t]; ok && !lt.Valid(now) {
+				s.remove(t)
+				purged = append(purged, lt)
+			}
+		}
+		s.mux.Unlock()
+		if next == "" {
+			return purged, nil
+		}
+	}
+}
+
+// candidates returns up to size tokenstrings in creation order starting at next, or at the first token for the
+// first chunk without prev, and the tokenstring following them, empty at the end. If next was removed meanwhile,
+// it resumes after the last tokenstring of the previous chunk prev still stored, ending the scan if none is,
+// so concurrent deletes never restart it.
+func (s *MemoryStore[ID]) candidates(prev []string, next string, size int) ([]string, string) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	e, ok := s.order.Front(), true
+	if len(prev) > 0 {
+		e, ok = s.elems[next]
+		for i := len(prev) - 1; !ok && i >= 0; i-- {
+			if pe, found := s.elems[prev[i]]; found {
+				e, ok = pe.Next(), true
+			}
+		}
+		if !ok {
+			return nil, ""
+		}
+	}
+	keys := make([]string, 0, size)
+	for ; e != nil && len(keys) < size; e = e.Next() {
+		keys = append(keys, e.Value.(string))
+	}
+	if e == nil {
+		return keys, ""
+	}
+	return keys, e.Value.(string)
+}
+
+// Extend sets the expiry of the login token for tokenstring if it exists and is not expired at now.
+func (s *MemoryStore[ID]) Extend(ctx context.Context, token string, now, expiry time.Time) (LoginToken[ID], bool, error) {
+	if err := ctx.Err(); err != nil {
+		return LoginToken[ID]{}, false, err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	lt, ok := s.token[token]
+	if !ok || !lt.Valid(now) {
+		return LoginToken[ID]{}, false, nil
+	}
+	lt.Expiry = expiry
+	s.token[token] = lt
+	return lt, true, nil
+}
+
+// Reassign sets the account of the login token for tokenstring to id with accountHash if it exists and is not
+// expired at now, and reports whether it was updated.
+func (s *MemoryStore[ID]) Reassign(ctx context.Context, token string, now time.Time, id ID, accountHash string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	lt, ok := s.token[token]
+	if !ok || !lt.Valid(now) {
+		return false, nil
+	}
+	lt.AccountID = id
+	lt.AccountHash = accountHash
+	s.token[token] = lt
+	return true, nil
+}
+
+// ExtendForAccount adds by to the expiry of all login tokens referencing account ID not expired at now
+// and returns the number extended.
+func (s *MemoryStore[ID]) ExtendForAccount(ctx context.Context, id ID, now time.Time, by time.Duration) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	n := 0
+	for t, lt := range s.token {
+		if lt.AccountID == id && lt.Valid(now) {
+			lt.Expiry = lt.Expiry.Add(by)
+			s.token[t] = lt
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Count returns the number of login tokens not expired at now.
+func (s *MemoryStore[ID]) Count(ctx context.Context, now time.Time) (int, error) {
+	return s.count(ctx, now, func(LoginToken[ID]) bool { return true })
+}
+
+// CountForAccount returns the number of login tokens referencing account ID not expired at now.
+func (s *MemoryStore[ID]) CountForAccount(ctx context.Context, id ID, now time.Time) (int, error) {
+	return s.count(ctx, now, func(lt LoginToken[ID]) bool { return lt.AccountID == id })
+}
+
+// Len returns the number of stored login tokens, including expired tokens not purged yet.
+func (s *MemoryStore[ID]) Len() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return len(s.token)
+}
+
+// Clear removes all login tokens.
+func (s *MemoryStore[ID]) Clear(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mux.Lock()
+	s.token = make(map[string]LoginToken[ID])
+	s.order.Init()
+	s.elems = make(map[string]*list.Element)
+	s.mux.Unlock()
+	return nil
+}
+
+// List returns all login tokens referencing account ID not expired at now.
+func (s *MemoryStore[ID]) List(ctx context.Context, id ID, now time.Time) ([]LoginToken[ID], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	var tokens []LoginToken[ID]
+	for _, v := range s.token {
+		if v.AccountID == id && v.Valid(now) {
+			tokens = append(tokens, v)
+		}
+	}
+	return tokens, nil
+}
+
+func (s *MemoryStore[ID]) count(ctx context.Context, now time.Time, match func(LoginToken[ID]) bool) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	n := 0
+	for _, v := range s.token {
+		if v.Valid(now) && match(v) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// All returns all login tokens not expired at now in order of creation.
+func (s *MemoryStore[ID]) All(ctx context.Context, now time.Time) ([]LoginToken[ID], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	var tokens []LoginToken[ID]
+	for e := s.order.Front(); e != nil; e = e.Next() {
+		if v := s.token[e.Value.(string)]; v.Valid(now) {
+			tokens = append(tokens, v)
+		}
+	}
+	return tokens, nil
+}
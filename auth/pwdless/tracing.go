@@ -0,0 +1,37 @@
+package pwdless
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the instrumentation scope of the spans created around token operations.
+const tracerName = "github.com/dhax/go-base/auth/pwdless"
+
+// nopSpan is returned if no TracerProvider is configured, shared to not allocate per operation.
+var nopSpan trace.Span = noop.Span{}
+
+// startSpan starts a span named name as child of any span in ctx with the store type set as attribute,
+// or returns a no-op span if no TracerProvider is configured.
+func (a *LoginTokenAuth[ID]) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	if a.tracer == nil {
+		return ctx, nopSpan
+	}
+	ctx, span := a.tracer.Start(ctx, name)
+	span.SetAttributes(attribute.String("pwdless.store", fmt.Sprintf("%T", a.store)))
+	return ctx, span
+}
+
+// endSpan records err and sets the span status to error if err is not nil, and ends span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
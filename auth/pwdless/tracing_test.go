@@ -0,0 +1,128 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingProvider is a TracerProvider returning its recordingTracer.
+type recordingProvider struct {
+	embedded.TracerProvider
+	tracer *recordingTracer
+}
+
+// recordingTracer records all started spans.
+type recordingTracer struct {
+	embedded.Tracer
+	mux   sync.Mutex
+	spans []*recordingSpan
+}
+
+// recordingSpan records attributes, error, status and end of a span, see recordingTracer.
+type recordingSpan struct {
+	trace.Span
+	name   string
+	parent string
+	attrs  map[attribute.Key]attribute.Value
+	err    error
+	status codes.Code
+	ended  bool
+}
+
+func (p recordingProvider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return p.tracer
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	s := newRecordingSpan(name)
+	if p, ok := trace.SpanFromContext(ctx).(*recordingSpan); ok {
+		s.parent = p.name
+	}
+	t.spans = append(t.spans, s)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func newRecordingSpan(name string) *recordingSpan {
+	return &recordingSpan{Span: noop.Span{}, name: name, attrs: make(map[attribute.Key]attribute.Value)}
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+func (s *recordingSpan) RecordError(err error, opts ...trace.EventOption) { s.err = err }
+func (s *recordingSpan) SetStatus(code codes.Code, description string)    { s.status = code }
+func (s *recordingSpan) End(opts ...trace.SpanEndOption)                  { s.ended = true }
+
+func TestLoginTokenAuth_tracing(t *testing.T) {
+	tracer := &recordingTracer{}
+	a, _ := newTestAuth(time.Minute, WithTracerProvider(recordingProvider{tracer: tracer}))
+
+	ctx := trace.ContextWithSpan(context.Background(), newRecordingSpan("request"))
+	lt, err := a.CreateTokenContext(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountIDContext(ctx, lt.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountIDContext(ctx, lt.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("got error %v, want: %v", err, ErrTokenNotFound)
+	}
+	if _, err := a.purgeExpired(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name   string
+		parent string
+		hit    interface{}
+		err    error
+		status codes.Code
+	}{
+		{"pwdless.CreateToken", "request", nil, nil, codes.Unset},
+		{"pwdless.GetAccountID", "request", true, nil, codes.Unset},
+		{"pwdless.GetAccountID", "request", false, ErrTokenNotFound, codes.Error},
+		{"pwdless.PurgeExpired", "", nil, nil, codes.Unset},
+	}
+	if len(tracer.spans) != len(want) {
+		t.Fatalf("got %d spans, want: %d", len(tracer.spans), len(want))
+	}
+	for i, w := range want {
+		s := tracer.spans[i]
+		var hit interface{}
+		if v, ok := s.attrs["pwdless.hit"]; ok {
+			hit = v.AsBool()
+		}
+		if s.name != w.name || s.parent != w.parent || hit != w.hit || s.err != w.err || s.status != w.status || !s.ended {
+			t.Errorf("got span %+v, want: %+v", s, w)
+		}
+		if got := s.attrs["pwdless.store"].AsString(); got != "*pwdless.MemoryStore[int]" {
+			t.Errorf("got store attribute %q", got)
+		}
+	}
+}
+
+func TestLoginTokenAuth_tracingDisabled(t *testing.T) {
+	a, _ := newTestAuth(time.Minute)
+	ctx := context.Background()
+	allocs := testing.AllocsPerRun(100, func() {
+		_, span := a.startSpan(ctx, "pwdless.CreateToken")
+		endSpan(span, nil)
+	})
+	if allocs != 0 {
+		t.Errorf("got %g allocations per span without TracerProvider, want: 0", allocs)
+	}
+}
@@ -0,0 +1,138 @@
+package pwdless
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Severity classifies a ConfigIssue.
+type Severity int
+
+const (
+	// SeverityWarning marks settings that work but are likely unintended or insecure.
+	SeverityWarning Severity = iota
+	// SeverityError marks settings LoginTokenAuth fails to be created with.
+	SeverityError
+)
+
+// String returns "warning" or "error".
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// ConfigIssue describes a problem with the setting of a viper key.
+type ConfigIssue struct {
+	Key      string
+	Severity Severity
+	Message  string
+}
+
+// String returns the issue formatted like "error: auth_login_url: login url required".
+func (i ConfigIssue) String() string {
+	if i.Key == "" {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Key, i.Message)
+}
+
+const (
+	// recommendedLoginTokenLength is the tokenstring length below which ValidateConfig warns.
+	recommendedLoginTokenLength = defaultLoginTokenLength
+	// maxRecommendedExpiry is the expiry above which ValidateConfig warns.
+	maxRecommendedExpiry = 24 * time.Hour
+	// validatePingTimeout bounds the store connectivity check of ValidateConfig.
+	validatePingTimeout = 5 * time.Second
+)
+
+// ValidateConfig checks the settings read from viper, overridden by opts like NewLoginTokenAuth, and returns the
+// issues found without creating an instance, e.g. to verify a config change before rolling it out.
+// Settings not read from viper, like the store set by WithStore, are checked if passed as opts.
+// A store implementing Pinger is pinged to check its connectivity. No issues returns nil.
+func ValidateConfig(opts ...Option) []ConfigIssue {
+	c := defaultConfig()
+	for _, opt := range append(viperOptions(viper.GetViper()), opts...) {
+		opt(&c)
+	}
+
+	var issues []ConfigIssue
+	add := func(key string, s Severity, format string, args ...interface{}) {
+		issues = append(issues, ConfigIssue{Key: key, Severity: s, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch u, err := url.Parse(c.loginURL); {
+	case c.loginURL == "":
+		add("auth_login_url", SeverityError, "login url required")
+	case err != nil:
+		add("auth_login_url", SeverityError, "invalid login url: %v", err)
+	case u.Scheme == "" || u.Host == "":
+		add("auth_login_url", SeverityWarning, "login url %q is not absolute, links in login emails will not work", c.loginURL)
+	case u.Scheme != "https" && u.Hostname() != "localhost":
+		add("auth_login_url", SeverityWarning, "login url %q does not use https, tokens may be intercepted", c.loginURL)
+	}
+
+	switch n := c.loginTokenLength; {
+	case c.tokenGenerator != nil:
+	case n < minLoginTokenLength:
+		add("auth_login_token_length", SeverityError, "login token length %d is below minimum of %d", n, minLoginTokenLength)
+	case n < recommendedLoginTokenLength:
+		add("auth_login_token_length", SeverityWarning, "login token length %d is below recommended %d", n, recommendedLoginTokenLength)
+	}
+
+	const expiryKey = "auth_login_token_expiry"
+	d, legacy, err := parseExpiry(viper.Get(expiryKey))
+	switch {
+	case err != nil:
+		add(expiryKey, SeverityError, "%v", err)
+	case legacy:
+		add(expiryKey, SeverityWarning, "bare number %v without unit is read as minutes, use a duration like \"%dm\"", viper.Get(expiryKey), int(d.Minutes()))
+	}
+	if err == nil {
+		switch e := c.loginTokenExpiry; {
+		case e <= 0:
+			add(expiryKey, SeverityError, "login token expiry %s must be a positive duration like \"15m\" or \"24h\"", e)
+		case e > maxRecommendedExpiry:
+			add(expiryKey, SeverityWarning, "login token expiry %s exceeds %s, leaked tokens stay usable for long", e, maxRecommendedExpiry)
+		}
+	}
+
+	if len(c.hashSecret) == 0 {
+		add("auth_token_hash_secret", SeverityWarning, "no hash secret set, stored tokens are hashed with plain SHA-256")
+	}
+	if c.rateLimit > 0 && c.rateWindow <= 0 {
+		add("auth_login_token_rate_window", SeverityError, "login token rate window %s must be positive", c.rateWindow)
+	}
+	if c.maxPerAccount < 0 {
+		add("auth_login_token_max_per_account", SeverityError, "login token max per account %d must not be negative", c.maxPerAccount)
+	}
+	if c.attemptLimit < 0 {
+		add("auth_login_token_attempt_threshold", SeverityError, "login token attempt threshold %d must not be negative", c.attemptLimit)
+	}
+	if c.attemptLimit > 0 && c.attemptBackoff <= 0 {
+		add("auth_login_token_attempt_backoff", SeverityError, "login token attempt backoff %s must be positive", c.attemptBackoff)
+	}
+
+	// Report settings not covered above, e.g. set by opts, once.
+	hasError := false
+	for _, i := range issues {
+		hasError = hasError || i.Severity == SeverityError
+	}
+	if err := c.validate(); err != nil && !hasError {
+		add("", SeverityError, "%v", err)
+	}
+
+	if p, ok := c.store.(Pinger); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), validatePingTimeout)
+		defer cancel()
+		if err := p.Ping(ctx); err != nil {
+			add("", SeverityError, "token store not reachable: %v", err)
+		}
+	}
+	return issues
+}
@@ -0,0 +1,62 @@
+package pwdless
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestValidateConfig(t *testing.T) {
+	valid := map[string]interface{}{
+		"auth_login_url":          "https://example.com/login",
+		"auth_login_token_length": 32,
+		"auth_login_token_expiry": "15m",
+		"auth_token_hash_secret":  "secret",
+	}
+
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		opts     []Option
+		key      string
+		severity Severity
+	}{
+		{"missing url", map[string]interface{}{"auth_login_url": ""}, nil, "auth_login_url", SeverityError},
+		{"relative url", map[string]interface{}{"auth_login_url": "/login"}, nil, "auth_login_url", SeverityWarning},
+		{"plain http url", map[string]interface{}{"auth_login_url": "http://example.com/login"}, nil, "auth_login_url", SeverityWarning},
+		{"length below minimum", map[string]interface{}{"auth_login_token_length": 16}, nil, "auth_login_token_length", SeverityError},
+		{"length below recommended", map[string]interface{}{"auth_login_token_length": 24}, nil, "auth_login_token_length", SeverityWarning},
+		{"bare number expiry", map[string]interface{}{"auth_login_token_expiry": "15"}, nil, "auth_login_token_expiry", SeverityWarning},
+		{"invalid expiry", map[string]interface{}{"auth_login_token_expiry": "soon"}, nil, "auth_login_token_expiry", SeverityError},
+		{"long expiry", map[string]interface{}{"auth_login_token_expiry": "720h"}, nil, "auth_login_token_expiry", SeverityWarning},
+		{"no hash secret", map[string]interface{}{"auth_token_hash_secret": ""}, nil, "auth_token_hash_secret", SeverityWarning},
+		{"rate limit without window", map[string]interface{}{"auth_login_token_rate_limit": 5}, nil, "auth_login_token_rate_window", SeverityError},
+		{"invalid option", nil, []Option{WithPrefix("lt/")}, "", SeverityError},
+		{"unreachable store", nil, []Option{WithStore[int](pingStore{NewMemoryStore[int](), errStore})}, "", SeverityError},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setViper(t, valid)
+			setViper(t, tc.settings)
+
+			issues := ValidateConfig(tc.opts...)
+			if len(issues) != 1 || issues[0].Key != tc.key || issues[0].Severity != tc.severity || issues[0].Message == "" {
+				t.Errorf("got issues %v, want single %s for key %q", issues, tc.severity, tc.key)
+			}
+		})
+	}
+
+	setViper(t, valid)
+	if issues := ValidateConfig(WithStore[int](pingStore{MemoryStore: NewMemoryStore[int]()})); issues != nil {
+		t.Errorf("got issues %v for valid config, want: none", issues)
+	}
+}
+
+// setViper sets the viper keys to settings, restoring them when the test finishes.
+func setViper(t *testing.T, settings map[string]interface{}) {
+	for key, value := range settings {
+		old := viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, old) })
+	}
+}
@@ -0,0 +1,67 @@
+package pwdless
+
+import "time"
+
+// ConsumeRequest describes the consumption of a token checked by the validators.
+type ConsumeRequest struct {
+	// Fingerprint is the fingerprint the token is consumed with, empty if not bound.
+	Fingerprint string
+	// Scope is the scope the token is consumed for, empty by GetAccountID.
+	Scope string
+	// Source identifies the client consuming the token, e.g. its IP, empty if unknown.
+	Source string
+	// Now is the current time by the configured clock.
+	Now time.Time
+}
+
+// Validator checks a token found by its tokenstring before it is consumed, returning an error to reject it.
+// The token passed is the stored token. Validators set by WithValidators run after the built-in ones checking
+// expiry, fingerprint, scope and the consume delay, so they are passed only tokens accepted by those.
+type Validator[ID comparable] func(lt LoginToken[ID], req ConsumeRequest) error
+
+// validate runs the validators in order, returning the error of the first rejecting the token.
+func (a *LoginTokenAuth[ID]) validate(lt LoginToken[ID], req ConsumeRequest) error {
+	for _, v := range a.validators {
+		if err := v(lt, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateExpiry returns ErrTokenExpired if lt expired at the requested time, allowing for the configured clock skew,
+// or ErrTokenNotFound if it was consumed and its grace period passed.
+func (a *LoginTokenAuth[ID]) validateExpiry(lt LoginToken[ID], req ConsumeRequest) error {
+	if lt.Valid(req.Now.Add(-a.clockSkew)) {
+		return nil
+	}
+	// consumed tokens past their grace period are gone
+	if !lt.Consumed.IsZero() {
+		return ErrTokenNotFound
+	}
+	return ErrTokenExpired
+}
+
+// validateFingerprint returns ErrFingerprintMismatch if lt is bound to a fingerprint other than the requested one.
+func (a *LoginTokenAuth[ID]) validateFingerprint(lt LoginToken[ID], req ConsumeRequest) error {
+	if lt.Fingerprint != "" && !secureEqual(lt.Fingerprint, a.hashToken(req.Fingerprint)) {
+		return ErrFingerprintMismatch
+	}
+	return nil
+}
+
+// validateConsumeDelay returns errTooEarly if lt was created less than the configured consume delay before the request.
+func (a *LoginTokenAuth[ID]) validateConsumeDelay(lt LoginToken[ID], req ConsumeRequest) error {
+	if req.Now.Sub(lt.Created) < a.consumeDelay {
+		return errTooEarly
+	}
+	return nil
+}
+
+// validateScope returns ErrScopeMismatch if lt was created for a scope other than the requested one.
+func validateScope[ID comparable](lt LoginToken[ID], req ConsumeRequest) error {
+	if lt.Scope != req.Scope {
+		return ErrScopeMismatch
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package pwdless
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithValidators(t *testing.T) {
+	clock := newFakeClock()
+	errDenied := errors.New("denied")
+	var calls []string
+	var reqs []ConsumeRequest
+	deny := map[string]bool{}
+	validator := func(name string) Validator[int] {
+		return func(lt LoginToken[int], req ConsumeRequest) error {
+			calls = append(calls, name)
+			reqs = append(reqs, req)
+			if deny[name] {
+				return errDenied
+			}
+			return nil
+		}
+	}
+	a, store := newTestAuth(time.Minute, WithClock(clock.Now), WithValidators(validator("first"), validator("second")))
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deny["first"] = true
+	if _, err := a.GetAccountIDFrom(context.Background(), lt.Token, "10.0.0.1"); !errors.Is(err, errDenied) {
+		t.Errorf("got error %v, want error wrapping %v", err, errDenied)
+	}
+	if len(calls) != 1 || calls[0] != "first" {
+		t.Errorf("got validators %v called, want: [first]", calls)
+	}
+	if want := (ConsumeRequest{Source: "10.0.0.1", Now: clock.Now()}); reqs[0] != want {
+		t.Errorf("got request %+v, want: %+v", reqs[0], want)
+	}
+	if n := len(store.token); n != 1 {
+		t.Errorf("got %d tokens in store after rejection, want: %d", n, 1)
+	}
+
+	calls = nil
+	deny["first"] = false
+	if id, err := a.GetAccountID(lt.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v, want: 1, <nil>", id, err)
+	}
+	if len(calls) != 2 || calls[0] != "first" || calls[1] != "second" {
+		t.Errorf("got validators %v called, want: [first second]", calls)
+	}
+
+	scoped, err := a.CreateScopedToken(1, "reset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls = nil
+	if _, err := a.GetAccountID(scoped.Token); !errors.Is(err, ErrScopeMismatch) {
+		t.Errorf("got error %v, want error wrapping %v", err, ErrScopeMismatch)
+	}
+	if len(calls) != 0 {
+		t.Errorf("got validators %v called after built-in check failed, want none", calls)
+	}
+
+	calls = nil
+	expired, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(2 * time.Minute)
+	if _, err := a.GetAccountID(expired.Token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got error %v, want error wrapping %v", err, ErrTokenExpired)
+	}
+	if len(calls) != 0 {
+		t.Errorf("got validators %v called for expired token, want none", calls)
+	}
+}
+
+func TestLoginTokenAuth_validateExpiry(t *testing.T) {
+	clock := newFakeClock()
+	a, _ := newTestAuth(time.Minute, WithClock(clock.Now), WithClockSkew(10*time.Second))
+	now := clock.Now()
+	tests := []struct {
+		name string
+		lt   LoginToken[int]
+		want error
+	}{
+		{"valid", LoginToken[int]{Expiry: now.Add(time.Second)}, nil},
+		{"within_skew", LoginToken[int]{Expiry: now.Add(-5 * time.Second)}, nil},
+		{"expired", LoginToken[int]{Expiry: now.Add(-time.Minute)}, ErrTokenExpired},
+		{"consumed", LoginToken[int]{Expiry: now.Add(-time.Minute), Consumed: now.Add(-2 * time.Minute)}, ErrTokenNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := a.validateExpiry(tc.lt, ConsumeRequest{Now: now}); err != tc.want {
+				t.Errorf("got %v, want: %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoginTokenAuth_ConsumeAndRotateExpiredSuperseded(t *testing.T) {
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Minute, WithClock(clock.Now))
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(30 * time.Second)
+	_, rotated, err := a.ConsumeAndRotate(lt.Token, 2*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the superseded token is rejected as expired before reuse detection revokes its family
+	clock.Add(time.Minute)
+	if _, _, err := a.ConsumeAndRotate(lt.Token, 0); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("got error %v for expired superseded token, want error wrapping %v", err, ErrTokenExpired)
+	}
+	if _, ok := store.token[a.hashToken(rotated.Token)]; !ok {
+		t.Error("family revoked for expired superseded token")
+	}
+}
+
+func TestLoginTokenAuth_WithConsumeDelay(t *testing.T) {
+	clock := newFakeClock()
+	a, store := newTestAuth(time.Minute, WithClock(clock.Now), WithConsumeDelay(2*time.Second), WithBruteForceProtection(1, time.Minute))
+
+	lt, err := a.CreateToken(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := a.Peek(lt.Token); err != nil || id != 1 {
+		t.Errorf("got %d, %v peeking within delay, want: 1, <nil>", id, err)
+	}
+	clock.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		if _, err := a.GetAccountIDFrom(context.Background(), lt.Token, "10.0.0.1"); !errors.Is(err, errTooEarly) {
+			t.Errorf("got error %v consuming within delay, want error wrapping %v", err, errTooEarly)
+		}
+	}
+	if n := len(store.token); n != 1 {
+		t.Errorf("got %d tokens in store after early consumption, want: %d", n, 1)
+	}
+
+	clock.Add(time.Second)
+	if id, err := a.GetAccountIDFrom(context.Background(), lt.Token, "10.0.0.1"); err != nil || id != 1 {
+		t.Errorf("got %d, %v consuming after delay, want: 1, <nil>", id, err)
+	}
+}
@@ -0,0 +1,82 @@
+package pwdless
+
+import (
+	"context"
+	"fmt"
+)
+
+// verifier is implemented by stores able to check their internal invariants, like MemoryStore.
+type verifier interface {
+	Verify(ctx context.Context) []error
+}
+
+// Verify checks the invariants of the token store and returns all violations found, e.g. for a debug endpoint
+// or periodic assertions in long running processes. It returns a single error if the store does not support
+// verification, which only MemoryStore and ShardedMemoryStore do.
+func (a *LoginTokenAuth[ID]) Verify() []error {
+	if a.closed.Load() {
+		return []error{ErrClosed}
+	}
+	v, ok := a.store.(verifier)
+	if !ok {
+		return []error{fmt.Errorf("token store %T does not support verification", a.store)}
+	}
+	return v.Verify(context.Background())
+}
+
+// Verify checks that every token is stored by its tokenstring with an expiry and referenced once
+// in creation order, and returns all violations found.
+func (s *MemoryStore[ID]) Verify(ctx context.Context) []error {
+	if err := ctx.Err(); err != nil {
+		return []error{err}
+	}
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	var errs []error
+	for key, lt := range s.token {
+		if key != lt.Token {
+			errs = append(errs, fmt.Errorf("login token %s stored by key %s", redactToken(lt.Token), redactToken(key)))
+		}
+		if lt.Expiry.IsZero() {
+			errs = append(errs, fmt.Errorf("login token %s has no expiry", redactToken(key)))
+		}
+		if _, ok := s.elems[key]; !ok {
+			errs = append(errs, fmt.Errorf("login token %s missing in creation order", redactToken(key)))
+		}
+	}
+	seen := make(map[string]bool, s.order.Len())
+	for e := s.order.Front(); e != nil; e = e.Next() {
+		key := e.Value.(string)
+		switch {
+		case seen[key]:
+			errs = append(errs, fmt.Errorf("login token %s duplicated in creation order", redactToken(key)))
+		case s.elems[key] != e:
+			errs = append(errs, fmt.Errorf("login token %s creation order not indexed", redactToken(key)))
+		}
+		if _, ok := s.token[key]; !ok {
+			errs = append(errs, fmt.Errorf("removed login token %s left in creation order", redactToken(key)))
+		}
+		seen[key] = true
+	}
+	if len(s.elems) != s.order.Len() {
+		errs = append(errs, fmt.Errorf("creation order index holds %d tokens, order %d", len(s.elems), s.order.Len()))
+	}
+	return errs
+}
+
+// Verify checks the invariants of all shards and that every token is held by the shard of its tokenstring,
+// and returns all violations found.
+func (s *ShardedMemoryStore[ID]) Verify(ctx context.Context) []error {
+	var errs []error
+	for _, m := range s.shards {
+		errs = append(errs, m.Verify(ctx)...)
+		m.mux.RLock()
+		for key := range m.token {
+			if s.shard(key) != m {
+				errs = append(errs, fmt.Errorf("login token %s held by wrong shard", redactToken(key)))
+			}
+		}
+		m.mux.RUnlock()
+	}
+	return errs
+}
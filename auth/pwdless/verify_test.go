@@ -0,0 +1,69 @@
+package pwdless
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginTokenAuth_Verify(t *testing.T) {
+	a, store := newTestAuth(time.Minute)
+	for i := 0; i < 3; i++ {
+		if _, err := a.CreateToken(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if errs := a.Verify(); errs != nil {
+		t.Fatalf("got violations %v for intact store, want none", errs)
+	}
+
+	var keys []string
+	for key := range store.token {
+		keys = append(keys, key)
+	}
+	moved := store.token[keys[0]]
+	moved.Token = "other"
+	store.token[keys[0]] = moved
+	unexpiring := store.token[keys[1]]
+	unexpiring.Expiry = time.Time{}
+	store.token[keys[1]] = unexpiring
+	delete(store.token, keys[2])
+
+	errs := a.Verify()
+	for _, want := range []string{"stored by key", "has no expiry", "removed login token"} {
+		found := false
+		for _, err := range errs {
+			found = found || strings.Contains(err.Error(), want)
+		}
+		if !found {
+			t.Errorf("got violations %v, missing %q", errs, want)
+		}
+	}
+	if len(errs) != 3 {
+		t.Errorf("got %d violations, want: %d", len(errs), 3)
+	}
+
+	sharded := NewShardedMemoryStore[int](2)
+	a, _ = newTestAuth(time.Minute, WithStore[int](sharded))
+	if _, err := a.CreateToken(1); err != nil {
+		t.Fatal(err)
+	}
+	// move the token to the other shard
+	for i, m := range sharded.shards {
+		if m.Len() == 1 {
+			for key, lt := range m.token {
+				sharded.shards[1-i].add(lt)
+				m.remove(key)
+			}
+			break
+		}
+	}
+	if errs := a.Verify(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "wrong shard") {
+		t.Errorf("got violations %v, want: token in wrong shard", errs)
+	}
+
+	a, _ = newTestAuth(time.Minute, WithStore[int](failingStore{}))
+	if errs := a.Verify(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "does not support") {
+		t.Errorf("got violations %v, want: single unsupported error", errs)
+	}
+}
@@ -0,0 +1,143 @@
+package pwdless
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// webhookQueueSize is the number of events buffered for delivery before further events are dropped.
+	webhookQueueSize = 256
+	// webhookAttempts is the number of times delivering an event is tried.
+	webhookAttempts = 3
+	// webhookBackoff is the delay before retrying a failed delivery, doubled for every further retry.
+	webhookBackoff = 500 * time.Millisecond
+)
+
+// webhookEvent is the JSON body posted to the webhook url.
+type webhookEvent struct {
+	Event     string      `json:"event"`
+	AccountID interface{} `json:"account_id"`
+	At        time.Time   `json:"at"`
+}
+
+// webhook posts token events to an url asynchronously from a bounded queue, so slow endpoints never block token operations.
+type webhook struct {
+	url      string
+	client   *http.Client
+	onCreate bool
+	backoff  time.Duration
+	onDrop   func()
+
+	queue chan webhookEvent
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newWebhook(url string, client *http.Client, onCreate bool, onDrop func()) *webhook {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &webhook{
+		url:      url,
+		client:   client,
+		onCreate: onCreate,
+		backoff:  webhookBackoff,
+		onDrop:   onDrop,
+		queue:    make(chan webhookEvent, webhookQueueSize),
+		stop:     make(chan struct{}),
+	}
+}
+
+// start runs the delivery of queued events until close.
+func (w *webhook) start() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for {
+			select {
+			case ev := <-w.queue:
+				w.deliver(ev)
+			case <-w.stop:
+				w.drain()
+				return
+			}
+		}
+	}()
+}
+
+// drain delivers the events still queued when closing.
+func (w *webhook) drain() {
+	for {
+		select {
+		case ev := <-w.queue:
+			w.deliver(ev)
+		default:
+			return
+		}
+	}
+}
+
+// close stops the delivery after the queued events were sent or ctx is done.
+func (w *webhook) close(ctx context.Context) error {
+	close(w.stop)
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// send queues the event for account ID, dropping it if the queue is full. It is a no-op on a nil webhook.
+func (w *webhook) send(event string, id interface{}, at time.Time) {
+	if w == nil || (event == "create" && !w.onCreate) {
+		return
+	}
+	select {
+	case w.queue <- webhookEvent{Event: event, AccountID: id, At: at}:
+	default:
+		if w.onDrop != nil {
+			w.onDrop()
+		}
+	}
+}
+
+// deliver posts ev, retrying failures with exponential backoff.
+func (w *webhook) deliver(ev webhookEvent) {
+	backoff := w.backoff
+	for i := 1; ; i++ {
+		if w.post(ev) == nil || i == webhookAttempts {
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends ev once, failing for transport errors and non 2xx status codes.
+func (w *webhook) post(ev webhookEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
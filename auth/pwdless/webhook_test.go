@@ -0,0 +1,73 @@
+package pwdless
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	events := make(chan webhookEvent, 10)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first delivery to exercise the retry.
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var ev webhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Error(err)
+		}
+		events <- ev
+	}))
+	defer srv.Close()
+
+	a, _ := newTestAuth(time.Minute, WithWebhook(srv.URL, srv.Client()), WithWebhookOnCreate())
+	a.webhook.backoff = time.Millisecond
+
+	lt, err := a.CreateToken(123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.GetAccountID(lt.Token); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(events)
+
+	var got []string
+	for ev := range events {
+		if ev.AccountID != float64(123) || ev.At.IsZero() {
+			t.Errorf("got event %+v, want account 123 and time", ev)
+		}
+		got = append(got, ev.Event)
+	}
+	if len(got) != 2 || got[0] != "create" || got[1] != "consume" {
+		t.Errorf("got events %v, want: [create consume]", got)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("got %d requests, want: %d", n, 3)
+	}
+}
+
+func TestWebhook_dropsWhenFull(t *testing.T) {
+	m := NewMetrics()
+	w := newWebhook("http://localhost/hook", nil, false, m.incWebhookDropped)
+	for i := 0; i < webhookQueueSize+2; i++ {
+		w.send("consume", i, time.Now())
+	}
+	w.send("create", 0, time.Now())
+	if n := len(w.queue); n != webhookQueueSize {
+		t.Errorf("got %d queued events, want: %d", n, webhookQueueSize)
+	}
+	if got := m.Snapshot().WebhookDropped; got != 2 {
+		t.Errorf("got %d dropped events, want: %d", got, 2)
+	}
+}
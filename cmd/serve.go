@@ -44,7 +44,7 @@ func init() {
 	viper.SetDefault("log_level", "debug")
 
 	viper.SetDefault("auth_login_url", "http://localhost:3000/login")
-	viper.SetDefault("auth_login_token_length", 8)
+	viper.SetDefault("auth_login_token_length", 32)
 	viper.SetDefault("auth_login_token_expiry", "11m")
 	viper.SetDefault("auth_jwt_secret", "random")
 	viper.SetDefault("auth_jwt_expiry", "15m")